@@ -7,19 +7,175 @@ import (
 	"os/user"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 type Config struct {
 	RootDir  string          `json:"rootDir"`
 	Database DatabaseSection `json:"database"`
+
+	// TrashDir is where deleted movies are moved. It should be on the same
+	// volume as RootDir, and defaults to a .trash folder in RootDir.
+	TrashDir string `json:"trashDir"`
+	// TrashRetentionDays is the number of days a movie stays in the trash
+	// before it is deleted permanently at startup. Zero keeps it forever.
+	TrashRetentionDays int `json:"trashRetentionDays"`
+	// ImageCacheSize is the number of megabytes of posters that are kept in
+	// memory. Zero uses the default size.
+	ImageCacheSize int `json:"imageCacheSize"`
+	// ImageDir is the folder where the posters are stored as files, named by
+	// a hash of their content. When it is not set, the posters are stored in
+	// the database.
+	ImageDir string `json:"imageDir"`
+	// BackupDir is the folder where the application makes backups of the
+	// library on a schedule. When it is not set, no backups are made.
+	BackupDir string `json:"backupDir"`
+	// BackupIntervalHours is the number of hours between the scheduled
+	// backups. Zero uses the default interval.
+	BackupIntervalHours int `json:"backupIntervalHours"`
+	// BackupKeep is the number of scheduled backups that are kept, the older
+	// ones are removed. Zero uses the default number.
+	BackupKeep int `json:"backupKeep"`
+}
+
+// defaultTrashDir is the name of the trash folder in RootDir, used when TrashDir is not set.
+const defaultTrashDir = ".trash"
+
+// GetTrashDir returns the configured trash directory, defaulting to a .trash folder in RootDir.
+func (c *Config) GetTrashDir() string {
+	if c.TrashDir == "" {
+		return filepath.Join(c.RootDir, defaultTrashDir)
+	}
+	return c.TrashDir
+}
+
+// defaultImageCacheSize is the size of the in-memory image cache in megabytes, used when ImageCacheSize is not set.
+const defaultImageCacheSize = 256
+
+// GetImageCacheBytes returns the size of the in-memory image cache in bytes.
+func (c *Config) GetImageCacheBytes() int64 {
+	if c.ImageCacheSize <= 0 {
+		return defaultImageCacheSize * 1024 * 1024
+	}
+	return int64(c.ImageCacheSize) * 1024 * 1024
+}
+
+// Default backup settings, used when they are not set.
+const (
+	defaultBackupIntervalHours = 24
+	defaultBackupKeep          = 7
+)
+
+// GetBackupInterval returns the time between the scheduled backups.
+func (c *Config) GetBackupInterval() time.Duration {
+	if c.BackupIntervalHours <= 0 {
+		return defaultBackupIntervalHours * time.Hour
+	}
+	return time.Duration(c.BackupIntervalHours) * time.Hour
+}
+
+// GetBackupKeep returns the number of scheduled backups that are kept.
+func (c *Config) GetBackupKeep() int {
+	if c.BackupKeep <= 0 {
+		return defaultBackupKeep
+	}
+	return c.BackupKeep
 }
 
 type DatabaseSection struct {
+	Driver   string `json:"driver"`
+	Path     string `json:"path"`
 	Server   string `json:"server"`
 	Database string `json:"database"`
 	Port     int    `json:"port"`
 	User     string `json:"user"`
 	Password string `json:"password"`
+
+	// QueryTimeout is the number of seconds a database call may take before
+	// it is cancelled, unless the caller sets its own deadline. Zero uses the
+	// default timeout.
+	QueryTimeout int `json:"queryTimeout"`
+	// ConnectTimeout is the number of seconds to wait for the database server
+	// when connecting. Zero uses the default timeout.
+	ConnectTimeout int `json:"connectTimeout"`
+
+	// MaxOpenConns and MaxIdleConns limit the number of connections in the
+	// connection pool, and ConnMaxLifetime is the number of seconds before a
+	// connection is replaced. Zero uses the defaults.
+	MaxOpenConns    int `json:"maxOpenConns"`
+	MaxIdleConns    int `json:"maxIdleConns"`
+	ConnMaxLifetime int `json:"connMaxLifetime"`
+}
+
+// Default database timeouts in seconds, used when they are not set.
+const (
+	defaultQueryTimeout   = 30
+	defaultConnectTimeout = 5
+)
+
+// GetQueryTimeout returns the default timeout of database calls.
+func (d DatabaseSection) GetQueryTimeout() time.Duration {
+	if d.QueryTimeout <= 0 {
+		return defaultQueryTimeout * time.Second
+	}
+	return time.Duration(d.QueryTimeout) * time.Second
+}
+
+// GetConnectTimeout returns the timeout when connecting to the database server.
+func (d DatabaseSection) GetConnectTimeout() time.Duration {
+	if d.ConnectTimeout <= 0 {
+		return defaultConnectTimeout * time.Second
+	}
+	return time.Duration(d.ConnectTimeout) * time.Second
+}
+
+// Default connection pool settings, used when they are not set. Connections
+// are replaced every five minutes, since the NAS drops them when it sleeps.
+const (
+	defaultMaxOpenConns    = 10
+	defaultMaxIdleConns    = 5
+	defaultConnMaxLifetime = 5 * 60
+)
+
+// GetMaxOpenConns returns the maximum number of open database connections.
+func (d DatabaseSection) GetMaxOpenConns() int {
+	if d.MaxOpenConns <= 0 {
+		return defaultMaxOpenConns
+	}
+	return d.MaxOpenConns
+}
+
+// GetMaxIdleConns returns the maximum number of idle database connections,
+// which is never more than the maximum number of open connections.
+func (d DatabaseSection) GetMaxIdleConns() int {
+	idle := d.MaxIdleConns
+	if idle <= 0 {
+		idle = defaultMaxIdleConns
+	}
+	return min(idle, d.GetMaxOpenConns())
+}
+
+// GetConnMaxLifetime returns how long a database connection is used before it is replaced.
+func (d DatabaseSection) GetConnMaxLifetime() time.Duration {
+	if d.ConnMaxLifetime <= 0 {
+		return defaultConnMaxLifetime * time.Second
+	}
+	return time.Duration(d.ConnMaxLifetime) * time.Second
+}
+
+// Supported database drivers. An empty driver is treated as MySQL,
+// so that existing config files keep working.
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+)
+
+// GetDriver returns the configured database driver, defaulting to MySQL.
+func (d DatabaseSection) GetDriver() string {
+	if d.Driver == "" {
+		return DriverMySQL
+	}
+	return strings.ToLower(d.Driver)
 }
 
 // LoadConfig : Loads the config
@@ -50,6 +206,35 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	// The SQLite database file may be given relative to the home directory
+	if config.Database.Path != "" {
+		config.Database.Path, err = expandPath(config.Database.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.TrashDir != "" {
+		config.TrashDir, err = expandPath(config.TrashDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.ImageDir != "" {
+		config.ImageDir, err = expandPath(config.ImageDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.BackupDir != "" {
+		config.BackupDir, err = expandPath(config.BackupDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return config, nil
 }
 
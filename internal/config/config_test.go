@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -66,3 +67,165 @@ func TestExpandPath(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadConfig_SQLite(t *testing.T) {
+	home, _ := os.UserHomeDir()
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	content := `{"rootDir": "/videos", "database": {"driver": "SQLite", "path": "~/softimdb.db"}}`
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Database.GetDriver() != DriverSQLite {
+		t.Errorf("GetDriver() = %q; expected %q", cfg.Database.GetDriver(), DriverSQLite)
+	}
+	if expected := filepath.Join(home, "softimdb.db"); cfg.Database.Path != expected {
+		t.Errorf("Database.Path = %q; expected %q", cfg.Database.Path, expected)
+	}
+	if (DatabaseSection{}).GetDriver() != DriverMySQL {
+		t.Errorf("expected MySQL to be the default driver")
+	}
+}
+
+func TestConfig_GetTrashDir(t *testing.T) {
+	home, _ := os.UserHomeDir()
+
+	tests := []struct {
+		name     string
+		config   Config
+		expected string
+	}{
+		{"Default", Config{RootDir: "/videos"}, "/videos/.trash"},
+		{"Configured", Config{RootDir: "/videos", TrashDir: "/videos/Trash"}, "/videos/Trash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetTrashDir(); got != tt.expected {
+				t.Errorf("GetTrashDir() = %q; expected %q", got, tt.expected)
+			}
+		})
+	}
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	content := `{"rootDir": "/videos", "trashDir": "~/trash", "trashRetentionDays": 30, "imageDir": "~/posters"}`
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if got := cfg.GetTrashDir(); got != filepath.Join(home, "trash") {
+		t.Errorf("GetTrashDir() = %q; expected ~ to be expanded", got)
+	}
+	if cfg.TrashRetentionDays != 30 {
+		t.Errorf("TrashRetentionDays = %d; expected 30", cfg.TrashRetentionDays)
+	}
+	if cfg.ImageDir != filepath.Join(home, "posters") {
+		t.Errorf("ImageDir = %q; expected ~ to be expanded", cfg.ImageDir)
+	}
+}
+
+func TestConfig_GetImageCacheBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected int64
+	}{
+		{"Default", Config{}, 256 * 1024 * 1024},
+		{"Negative", Config{ImageCacheSize: -1}, 256 * 1024 * 1024},
+		{"Configured", Config{ImageCacheSize: 64}, 64 * 1024 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetImageCacheBytes(); got != tt.expected {
+				t.Errorf("GetImageCacheBytes() = %d; expected %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDatabaseSection_Timeouts(t *testing.T) {
+	tests := []struct {
+		name            string
+		database        DatabaseSection
+		expectedQuery   time.Duration
+		expectedConnect time.Duration
+	}{
+		{"Default", DatabaseSection{}, 30 * time.Second, 5 * time.Second},
+		{"Negative", DatabaseSection{QueryTimeout: -1, ConnectTimeout: -1}, 30 * time.Second, 5 * time.Second},
+		{"Configured", DatabaseSection{QueryTimeout: 120, ConnectTimeout: 2}, 120 * time.Second, 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.database.GetQueryTimeout(); got != tt.expectedQuery {
+				t.Errorf("GetQueryTimeout() = %v; expected %v", got, tt.expectedQuery)
+			}
+			if got := tt.database.GetConnectTimeout(); got != tt.expectedConnect {
+				t.Errorf("GetConnectTimeout() = %v; expected %v", got, tt.expectedConnect)
+			}
+		})
+	}
+}
+
+func TestDatabaseSection_Pool(t *testing.T) {
+	tests := []struct {
+		name             string
+		database         DatabaseSection
+		expectedOpen     int
+		expectedIdle     int
+		expectedLifetime time.Duration
+	}{
+		{"Default", DatabaseSection{}, 10, 5, 5 * time.Minute},
+		{"Configured", DatabaseSection{MaxOpenConns: 20, MaxIdleConns: 8, ConnMaxLifetime: 60}, 20, 8, time.Minute},
+		{"Idle above open", DatabaseSection{MaxOpenConns: 3, MaxIdleConns: 8}, 3, 3, 5 * time.Minute},
+		{"Default idle above open", DatabaseSection{MaxOpenConns: 2}, 2, 2, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.database.GetMaxOpenConns(); got != tt.expectedOpen {
+				t.Errorf("GetMaxOpenConns() = %d; expected %d", got, tt.expectedOpen)
+			}
+			if got := tt.database.GetMaxIdleConns(); got != tt.expectedIdle {
+				t.Errorf("GetMaxIdleConns() = %d; expected %d", got, tt.expectedIdle)
+			}
+			if got := tt.database.GetConnMaxLifetime(); got != tt.expectedLifetime {
+				t.Errorf("GetConnMaxLifetime() = %v; expected %v", got, tt.expectedLifetime)
+			}
+		})
+	}
+}
+
+func TestConfig_Backup(t *testing.T) {
+	tests := []struct {
+		name             string
+		config           Config
+		expectedInterval time.Duration
+		expectedKeep     int
+	}{
+		{"Default", Config{}, 24 * time.Hour, 7},
+		{"Configured", Config{BackupIntervalHours: 6, BackupKeep: 3}, 6 * time.Hour, 3},
+		{"Negative", Config{BackupIntervalHours: -1, BackupKeep: -1}, 24 * time.Hour, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetBackupInterval(); got != tt.expectedInterval {
+				t.Errorf("GetBackupInterval() = %v; expected %v", got, tt.expectedInterval)
+			}
+			if got := tt.config.GetBackupKeep(); got != tt.expectedKeep {
+				t.Errorf("GetBackupKeep() = %d; expected %d", got, tt.expectedKeep)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// The kinds of artwork a movie can have.
+const (
+	ArtworkPoster   = "poster"
+	ArtworkBackdrop = "backdrop"
+	ArtworkDisc     = "disc"
+	ArtworkLogo     = "logo"
+)
+
+// ArtworkKinds is the list of artwork kinds, in the order they are shown.
+var ArtworkKinds = []string{ArtworkPoster, ArtworkBackdrop, ArtworkDisc, ArtworkLogo}
+
+// Artwork is an image of a movie, like a poster or a backdrop. A movie can
+// have several images of each kind, where one of them is the primary one.
+// The image of the primary poster is also stored in Movie.ImageId, and is
+// the one that is shown on the movie card.
+type Artwork struct {
+	Id        int    `gorm:"column:id;primary_key"`
+	MovieId   int    `gorm:"column:movie_id"`
+	ImageId   int    `gorm:"column:image_id"`
+	Kind      string `gorm:"column:kind;size:20"`
+	IsPrimary bool   `gorm:"column:is_primary"`
+
+	Image []byte `gorm:"-"`
+}
+
+// TableName returns the artwork table name.
+func (a *Artwork) TableName() string {
+	return "artwork"
+}
+
+// GetArtwork returns the artwork of a movie, including the images, sorted by
+// kind with the primary image first.
+func (d *Database) GetArtwork(ctx context.Context, movie *Movie) ([]Artwork, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	var artwork []Artwork
+	if err := db.Where("movie_id = ?", movie.Id).Find(&artwork).Error; err != nil {
+		return nil, fmt.Errorf("failed to get artwork: %w", err)
+	}
+
+	imageIds := make([]int, 0, len(artwork))
+	for _, a := range artwork {
+		imageIds = append(imageIds, a.ImageId)
+	}
+	images, err := d.readImages(db, imageIds)
+	if err != nil {
+		return nil, err
+	}
+	for i := range artwork {
+		artwork[i].Image = images[artwork[i].ImageId]
+	}
+
+	sortArtwork(artwork)
+	return artwork, nil
+}
+
+// InsertArtwork adds an image to the artwork of a movie. The first image of
+// a kind becomes the primary one.
+func (d *Database) InsertArtwork(ctx context.Context, movie *Movie, artwork *Artwork) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if !slices.Contains(ArtworkKinds, artwork.Kind) {
+		return fmt.Errorf("unknown artwork kind: %s", artwork.Kind)
+	}
+
+	return d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			var count int64
+			err := tx.Model(&Artwork{}).Where("movie_id = ? AND kind = ? AND is_primary = ?", movie.Id, artwork.Kind, true).
+				Count(&count).Error
+			if err != nil {
+				return fmt.Errorf("failed to count artwork: %w", err)
+			}
+
+			img := imageNew(artwork.Image)
+			if err := d.createImage(tx, img); err != nil {
+				return fmt.Errorf("failed to insert artwork image: %w", err)
+			}
+
+			artwork.Id = 0
+			artwork.MovieId = movie.Id
+			artwork.ImageId = img.Id
+			artwork.IsPrimary = false
+			if err := tx.Create(artwork).Error; err != nil {
+				return fmt.Errorf("failed to insert artwork: %w", err)
+			}
+
+			if count == 0 {
+				return d.setPrimaryArtwork(tx, movie, artwork)
+			}
+			return nil
+		},
+	)
+}
+
+// SetPrimaryArtwork makes an image the primary one of its kind. When it is a
+// poster, it becomes the image of the movie.
+func (d *Database) SetPrimaryArtwork(ctx context.Context, movie *Movie, artwork *Artwork) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	return d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			return d.setPrimaryArtwork(tx, movie, artwork)
+		},
+	)
+}
+
+// DeleteArtwork deletes an image from the artwork of a movie. When the primary
+// image of a kind is deleted, the oldest remaining image of that kind becomes
+// the primary one.
+func (d *Database) DeleteArtwork(ctx context.Context, movie *Movie, artwork *Artwork) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	return d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			// Use the stored artwork, since the primary image may have changed since it was loaded
+			var stored Artwork
+			if err := tx.Where("id = ? AND movie_id = ?", artwork.Id, movie.Id).First(&stored).Error; err != nil {
+				return fmt.Errorf("failed to get artwork: %w", err)
+			}
+
+			if err := tx.Delete(&Artwork{}, stored.Id).Error; err != nil {
+				return fmt.Errorf("failed to delete artwork: %w", err)
+			}
+			if err := d.deleteImageById(tx, stored.ImageId); err != nil {
+				return fmt.Errorf("failed to delete artwork image: %w", err)
+			}
+			if !stored.IsPrimary {
+				return nil
+			}
+
+			var next []Artwork
+			err := tx.Where("movie_id = ? AND kind = ?", movie.Id, stored.Kind).Order("id").Limit(1).Find(&next).Error
+			if err != nil {
+				return fmt.Errorf("failed to get artwork: %w", err)
+			}
+			if len(next) > 0 {
+				return d.setPrimaryArtwork(tx, movie, &next[0])
+			}
+
+			// The last poster was deleted, so the movie no longer has an image
+			if stored.Kind == ArtworkPoster {
+				return d.setMovieImage(tx, movie, 0, nil)
+			}
+			return nil
+		},
+	)
+}
+
+// setPrimaryArtwork marks an image as the primary one of its kind, and
+// updates the image of the movie when it is a poster.
+func (d *Database) setPrimaryArtwork(db *gorm.DB, movie *Movie, artwork *Artwork) error {
+	err := db.Model(&Artwork{}).Where("movie_id = ? AND kind = ?", movie.Id, artwork.Kind).
+		Update("is_primary", gorm.Expr("id = ?", artwork.Id)).Error
+	if err != nil {
+		return fmt.Errorf("failed to set primary artwork: %w", err)
+	}
+	artwork.IsPrimary = true
+
+	if artwork.Kind != ArtworkPoster || movie.ImageId == artwork.ImageId {
+		return nil
+	}
+
+	images, err := d.readImages(db, []int{artwork.ImageId})
+	if err != nil {
+		return err
+	}
+	return d.setMovieImage(db, movie, artwork.ImageId, images[artwork.ImageId])
+}
+
+// setMovieImage sets the image of a movie, and records the change in the movie history.
+func (d *Database) setMovieImage(db *gorm.DB, movie *Movie, imageId int, imageData []byte) error {
+	if err := db.Model(&Movie{}).Where("id = ?", movie.Id).Update("image_id", imageId).Error; err != nil {
+		return fmt.Errorf("failed to update image_id on movie: %w", err)
+	}
+
+	before := *movie
+	movie.ImageId = imageId
+	movie.Image = imageData
+	movie.HasImage = imageId > 0
+	if imageData != nil {
+		d.imageCache.save(imageId, imageData)
+	}
+
+	return d.recordChanges(db, getMovieChanges(&before, movie, []string{"image_id"})...)
+}
+
+// deleteArtworkForMovie deletes all artwork of a movie, including the images.
+func (d *Database) deleteArtworkForMovie(db *gorm.DB, movie *Movie) error {
+	var artwork []Artwork
+	if err := db.Where("movie_id = ?", movie.Id).Find(&artwork).Error; err != nil {
+		return fmt.Errorf("failed to get artwork: %w", err)
+	}
+
+	for _, a := range artwork {
+		if err := d.deleteImageById(db, a.ImageId); err != nil {
+			return fmt.Errorf("failed to delete artwork image: %w", err)
+		}
+	}
+
+	if err := db.Where("movie_id = ?", movie.Id).Delete(&Artwork{}).Error; err != nil {
+		return fmt.Errorf("failed to delete artwork: %w", err)
+	}
+
+	return nil
+}
+
+// sortArtwork sorts artwork by kind, with the primary image of each kind first.
+func sortArtwork(artwork []Artwork) {
+	slices.SortStableFunc(artwork, func(a, b Artwork) int {
+		if c := cmp.Compare(slices.Index(ArtworkKinds, a.Kind), slices.Index(ArtworkKinds, b.Kind)); c != 0 {
+			return c
+		}
+		if a.IsPrimary != b.IsPrimary {
+			if a.IsPrimary {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.Id, b.Id)
+	})
+}
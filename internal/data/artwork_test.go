@@ -0,0 +1,94 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_Artwork(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			gladiator := movies[0]
+			original := gladiator.ImageId
+
+			getArtwork := func() []Artwork {
+				t.Helper()
+				artwork, err := r.GetArtwork(t.Context(), gladiator)
+				if err != nil {
+					t.Fatalf("GetArtwork() error = %v", err)
+				}
+				return artwork
+			}
+
+			artwork := getArtwork()
+			if !assert.Len(t, artwork, 1) {
+				return
+			}
+			assert.Equal(t, ArtworkPoster, artwork[0].Kind)
+			assert.True(t, artwork[0].IsPrimary)
+			assert.Equal(t, []byte{1, 2, 3}, artwork[0].Image)
+
+			// A new poster becomes the primary one, but the original is kept
+			if err := r.UpdateImage(t.Context(), gladiator, []byte{4, 5, 6}); err != nil {
+				t.Fatalf("UpdateImage() error = %v", err)
+			}
+			assert.NotEqual(t, original, gladiator.ImageId)
+			artwork = getArtwork()
+			if !assert.Len(t, artwork, 2) {
+				return
+			}
+			assert.Equal(t, []byte{4, 5, 6}, artwork[0].Image)
+			assert.True(t, artwork[0].IsPrimary)
+			assert.Equal(t, original, artwork[1].ImageId)
+			assert.False(t, artwork[1].IsPrimary)
+
+			// The first image of a kind is the primary one, without changing the poster
+			backdrop := &Artwork{Kind: ArtworkBackdrop, Image: []byte{7}}
+			if err := r.InsertArtwork(t.Context(), gladiator, backdrop); err != nil {
+				t.Fatalf("InsertArtwork() error = %v", err)
+			}
+			assert.True(t, backdrop.IsPrimary)
+			assert.Error(t, r.InsertArtwork(t.Context(), gladiator, &Artwork{Kind: "banner", Image: []byte{8}}))
+
+			// Picking the original poster again
+			if err := r.SetPrimaryArtwork(t.Context(), gladiator, &artwork[1]); err != nil {
+				t.Fatalf("SetPrimaryArtwork() error = %v", err)
+			}
+			assert.Equal(t, original, gladiator.ImageId)
+			found, err := r.SearchMovies(t.Context(), "all", "gladiator", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []byte{1, 2, 3}, found[0].Image)
+
+			// Deleting the primary poster promotes the other one
+			artwork = getArtwork()
+			assert.Equal(t, []string{ArtworkPoster, ArtworkPoster, ArtworkBackdrop},
+				[]string{artwork[0].Kind, artwork[1].Kind, artwork[2].Kind})
+			if err := r.DeleteArtwork(t.Context(), gladiator, &artwork[0]); err != nil {
+				t.Fatalf("DeleteArtwork() error = %v", err)
+			}
+			assert.Equal(t, artwork[1].ImageId, gladiator.ImageId)
+			if err := r.DeleteArtwork(t.Context(), gladiator, &artwork[1]); err != nil {
+				t.Fatalf("DeleteArtwork() error = %v", err)
+			}
+			assert.Equal(t, 0, gladiator.ImageId)
+			assert.False(t, gladiator.HasImage)
+			assert.Len(t, getArtwork(), 1)
+
+			history, err := r.GetMovieHistory(t.Context(), gladiator)
+			if err != nil {
+				t.Fatalf("GetMovieHistory() error = %v", err)
+			}
+			count := 0
+			for _, change := range history {
+				if change.Field == "image_id" {
+					count++
+				}
+			}
+			assert.Equal(t, 4, count, "every change of the poster should be in the history")
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package data
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// backupVersion is the version of the backup archive format. Restore refuses
+// archives with a newer version.
+const backupVersion = 1
+
+// Names in the backup archive, and of the backup files that BackupToFolder writes.
+const (
+	backupManifestName   = "manifest.json"
+	backupTablesDir      = "tables/"
+	backupImagesDir      = "images/"
+	backupImageBatchSize = 50
+	backupFilePrefix     = "softimdb-"
+	backupFileExtension  = ".tar.gz"
+	backupTimeFormat     = "20060102-150405"
+)
+
+// backupTables are the tables in a backup, in the order they are restored.
+// The schema_version table is not backed up, since Restore rebuilds it by
+// running the migrations.
+var backupTables = []string{
+	"genre", "genre_alias", "person", "tag", "pack", "image", "movies", "movie_genre",
+	"movie_person", "movie_tag", "viewing", "movie_history", "artwork", "ignore_paths",
+}
+
+// BackupManifest describes a backup archive. It is stored in the archive as
+// manifest.json, with the SHA-256 checksum of every other file in it.
+type BackupManifest struct {
+	Version       int               `json:"version"`
+	SchemaVersion int               `json:"schemaVersion"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	Tables        []BackupTable     `json:"tables"`
+	Images        int               `json:"images"`
+	Checksums     map[string]string `json:"checksums"`
+}
+
+// BackupTable is a table in a backup, and the number of rows it has.
+type BackupTable struct {
+	Name string `json:"name"`
+	Rows int    `json:"rows"`
+}
+
+// backupWriter writes files to a backup archive, and remembers their checksums.
+type backupWriter struct {
+	archive   *tar.Writer
+	checksums map[string]string
+}
+
+// Backup writes all rows of the database, and the data of all images, to a
+// compressed archive. The rows are read in one transaction, so the backup is
+// consistent even if the library is changed meanwhile. The file is written
+// through a temporary file, so that a failed backup never leaves a broken
+// archive. Backup is not limited by the query timeout, since it may take long.
+func (d *Database) Backup(ctx context.Context, fileName string) (*BackupManifest, error) {
+	schemaVersion, err := d.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create backup folder: %w", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup: %w", err)
+	}
+
+	manifest, writeErr := d.writeBackup(db, file, schemaVersion)
+	closeErr := file.Close()
+	if err := errors.Join(writeErr, closeErr); err != nil {
+		_ = os.Remove(file.Name())
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := os.Rename(file.Name(), fileName); err != nil {
+		_ = os.Remove(file.Name())
+		return nil, fmt.Errorf("failed to save backup: %w", err)
+	}
+
+	return manifest, nil
+}
+
+func (d *Database) writeBackup(db *gorm.DB, w io.Writer, schemaVersion int) (*BackupManifest, error) {
+	compressed := gzip.NewWriter(w)
+	writer := &backupWriter{archive: tar.NewWriter(compressed), checksums: map[string]string{}}
+	manifest := &BackupManifest{
+		Version: backupVersion, SchemaVersion: schemaVersion, CreatedAt: time.Now().UTC(),
+		Checksums: writer.checksums,
+	}
+
+	err := db.Transaction(
+		func(tx *gorm.DB) error {
+			for _, table := range backupTables {
+				if !tx.Migrator().HasTable(table) {
+					continue
+				}
+				rows, err := getBackupRows(tx, table)
+				if err != nil {
+					return err
+				}
+				if err := writer.writeJSON(backupTablesDir+table+".json", rows); err != nil {
+					return err
+				}
+				manifest.Tables = append(manifest.Tables, BackupTable{Name: table, Rows: len(rows)})
+			}
+
+			var ids []int
+			if err := tx.Model(&image{}).Order("id").Pluck("id", &ids).Error; err != nil {
+				return fmt.Errorf("failed to get images: %w", err)
+			}
+			// Load a few images at a time, since all of them might not fit in memory
+			for batch := range slices.Chunk(ids, backupImageBatchSize) {
+				images, err := d.readImages(tx, batch)
+				if err != nil {
+					return err
+				}
+				for _, id := range batch {
+					data, ok := images[id]
+					if !ok {
+						continue
+					}
+					if err := writer.write(getBackupImageName(id), data); err != nil {
+						return err
+					}
+					manifest.Images++
+				}
+			}
+
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := writer.writeFile(backupManifestName, data); err != nil {
+		return nil, err
+	}
+	if err := writer.archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close archive: %w", err)
+	}
+	if err := compressed.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress archive: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// getBackupRows returns all rows of a table, keyed by column name. The data
+// of the images is left out, since it is stored as files in the archive.
+func getBackupRows(tx *gorm.DB, table string) ([]map[string]interface{}, error) {
+	columnTypes, err := tx.Migrator().ColumnTypes(table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns of %s: %w", table, err)
+	}
+	var columns []string
+	for _, columnType := range columnTypes {
+		if table == "image" && columnType.Name() == "image" {
+			continue
+		}
+		columns = append(columns, columnType.Name())
+	}
+
+	rows := []map[string]interface{}{}
+	if err := tx.Table(table).Select(columns).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get rows of %s: %w", table, err)
+	}
+
+	// Text columns may be returned as bytes, which JSON would encode as base64
+	for _, row := range rows {
+		for column, value := range row {
+			if b, ok := value.([]byte); ok {
+				row[column] = string(b)
+			}
+		}
+	}
+
+	return rows, nil
+}
+
+func (w *backupWriter) writeJSON(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	return w.write(name, data)
+}
+
+// write adds a file to the archive, and its checksum to the manifest.
+func (w *backupWriter) write(name string, data []byte) error {
+	if err := w.writeFile(name, data); err != nil {
+		return err
+	}
+	w.checksums[name] = getBackupChecksum(data)
+	return nil
+}
+
+func (w *backupWriter) writeFile(name string, data []byte) error {
+	header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+	if err := w.archive.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := w.archive.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+func getBackupChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func getBackupImageName(id int) string {
+	return fmt.Sprintf("%s%d.jpg", backupImagesDir, id)
+}
+
+// BackupToFolder writes a backup to dir, named by the current time, and then
+// removes the oldest backups in dir, so that at most keep backups are left.
+// It returns the file name of the new backup.
+func (d *Database) BackupToFolder(ctx context.Context, dir string, keep int) (string, error) {
+	fileName := filepath.Join(dir, backupFilePrefix+time.Now().Format(backupTimeFormat)+backupFileExtension)
+	if _, err := d.Backup(ctx, fileName); err != nil {
+		return "", err
+	}
+
+	backups, err := GetBackupFiles(dir)
+	if err != nil {
+		return fileName, err
+	}
+	for len(backups) > max(keep, 1) {
+		if err := os.Remove(backups[0]); err != nil {
+			return fileName, fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		backups = backups[1:]
+	}
+
+	return fileName, nil
+}
+
+// GetBackupFiles returns the backups that BackupToFolder has written to dir, oldest first.
+func GetBackupFiles(dir string) ([]string, error) {
+	backups, err := filepath.Glob(filepath.Join(dir, backupFilePrefix+"*"+backupFileExtension))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	// The names contain the time of the backup, so they sort by age
+	slices.Sort(backups)
+	return backups, nil
+}
+
+// IsBackupDue returns true if dir has no backup that is newer than interval.
+func IsBackupDue(dir string, interval time.Duration, now time.Time) (bool, error) {
+	backups, err := GetBackupFiles(dir)
+	if err != nil {
+		return false, err
+	}
+	if len(backups) == 0 {
+		return true, nil
+	}
+
+	info, err := os.Stat(backups[len(backups)-1])
+	if err != nil {
+		return false, fmt.Errorf("failed to get latest backup: %w", err)
+	}
+	return now.Sub(info.ModTime()) >= interval, nil
+}
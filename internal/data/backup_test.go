@@ -0,0 +1,262 @@
+package data
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func backupTestDatabase(t *testing.T, d *Database) string {
+	t.Helper()
+
+	fileName := filepath.Join(t.TempDir(), "backup.tar.gz")
+	if _, err := d.Backup(t.Context(), fileName); err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+	return fileName
+}
+
+func TestDatabase_BackupRestore(t *testing.T) {
+	d := openTestDatabase(t)
+	movies := insertTestMovies(t, d)
+	watchedAt := time.Date(2024, 5, 1, 20, 30, 0, 0, time.UTC)
+	if err := d.InsertViewing(t.Context(), movies[0], &Viewing{WatchedAt: watchedAt, Note: "Cinema"}); err != nil {
+		t.Fatalf("InsertViewing() error = %v", err)
+	}
+	if err := d.InsertIgnorePath(t.Context(), &IgnoredPath{Path: "Extras", IgnoreCompletely: true}); err != nil {
+		t.Fatalf("InsertIgnorePath() error = %v", err)
+	}
+
+	fileName := backupTestDatabase(t, d)
+	manifest, err := VerifyBackup(fileName)
+	if err != nil {
+		t.Fatalf("VerifyBackup() error = %v", err)
+	}
+	assert.Equal(t, latestSchemaVersion(), manifest.SchemaVersion)
+	assert.Equal(t, 1, manifest.Images)
+	assert.Contains(t, manifest.Tables, BackupTable{Name: "movies", Rows: 3})
+
+	restored := newTestDatabase(t)
+	if _, err := restored.Restore(t.Context(), fileName); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	version, err := restored.SchemaVersion(t.Context())
+	if err != nil {
+		t.Fatalf("SchemaVersion() error = %v", err)
+	}
+	assert.Equal(t, latestSchemaVersion(), version)
+
+	want := exportTestLibrary(t, d, true)
+	got := exportTestLibrary(t, restored, true)
+	got.ExportedAt = want.ExportedAt
+	assert.Equal(t, want, got)
+
+	viewings, err := restored.GetViewings(t.Context(), movies[0])
+	if err != nil {
+		t.Fatalf("GetViewings() error = %v", err)
+	}
+	if assert.Len(t, viewings, 1) {
+		assert.True(t, watchedAt.Equal(viewings[0].WatchedAt))
+		assert.Equal(t, "Cinema", viewings[0].Note)
+	}
+
+	// New rows do not collide with the restored ones
+	movie := &Movie{Title: "Ronin", Year: 1998, MoviePath: "Ronin"}
+	if err := restored.InsertMovie(t.Context(), movie); err != nil {
+		t.Fatalf("InsertMovie() error = %v", err)
+	}
+	assert.Greater(t, movie.Id, movies[2].Id)
+
+	// A database that is not empty is not overwritten
+	_, err = restored.Restore(t.Context(), fileName)
+	assert.Error(t, err)
+}
+
+func TestDatabase_RestoreOlderSchema(t *testing.T) {
+	d := newTestDatabase(t)
+	if err := d.migrateTo(t.Context(), 11); err != nil {
+		t.Fatalf("migrateTo() error = %v", err)
+	}
+	db, err := d.getDatabase(t.Context())
+	if err != nil {
+		t.Fatalf("getDatabase() error = %v", err)
+	}
+	if err := db.Exec("INSERT INTO image (id, image) VALUES (7, ?)", []byte{1, 2, 3}).Error; err != nil {
+		t.Fatalf("failed to insert image: %v", err)
+	}
+	if err := db.Exec("INSERT INTO movies (id, title, path, image_id) VALUES (3, 'Heat', 'Heat', 7)").Error; err != nil {
+		t.Fatalf("failed to insert movie: %v", err)
+	}
+
+	fileName := backupTestDatabase(t, d)
+
+	restored := newTestDatabase(t)
+	manifest, err := restored.Restore(t.Context(), fileName)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	assert.Equal(t, 11, manifest.SchemaVersion)
+
+	// The artwork table of version 12 is filled from the restored movies
+	artwork, err := restored.GetArtwork(t.Context(), &Movie{Id: 3})
+	if err != nil {
+		t.Fatalf("GetArtwork() error = %v", err)
+	}
+	if assert.Len(t, artwork, 1) {
+		assert.Equal(t, 7, artwork[0].ImageId)
+	}
+
+	export := exportTestLibrary(t, restored, true)
+	if assert.Len(t, export.Movies, 1) {
+		assert.Equal(t, []byte{1, 2, 3}, export.Movies[0].Poster)
+	}
+}
+
+func TestDatabase_RestoreBeforeImageHash(t *testing.T) {
+	d := newTestDatabase(t)
+	if err := d.migrateTo(t.Context(), 11); err != nil {
+		t.Fatalf("migrateTo() error = %v", err)
+	}
+	db, err := d.getDatabase(t.Context())
+	if err != nil {
+		t.Fatalf("getDatabase() error = %v", err)
+	}
+	if err := db.Exec("INSERT INTO image (id, image) VALUES (7, ?)", []byte{1, 2, 3}).Error; err != nil {
+		t.Fatalf("failed to insert image: %v", err)
+	}
+	if err := db.Exec("INSERT INTO movies (id, title, path, image_id) VALUES (3, 'Heat', 'Heat', 7)").Error; err != nil {
+		t.Fatalf("failed to insert movie: %v", err)
+	}
+
+	// Rewrite the archive as a backup of schema version 10, whose image table
+	// has no hash column
+	fileName := backupTestDatabase(t, d)
+	older := filepath.Join(t.TempDir(), "older.tar.gz")
+	file, err := os.Create(older)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := gzip.NewWriter(file)
+	writer := &backupWriter{archive: tar.NewWriter(compressed), checksums: map[string]string{}}
+	manifest := &BackupManifest{}
+	err = readBackup(fileName, func(name string, data []byte) error {
+		switch name {
+		case backupManifestName:
+			return json.Unmarshal(data, manifest)
+		case backupTablesDir + "image.json":
+			var rows []map[string]interface{}
+			if err := json.Unmarshal(data, &rows); err != nil {
+				return err
+			}
+			for _, row := range rows {
+				delete(row, "hash")
+			}
+			return writer.writeJSON(name, rows)
+		}
+		return writer.write(name, data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.SchemaVersion = 10
+	manifest.Checksums = writer.checksums
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.writeFile(backupManifestName, data); err != nil {
+		t.Fatal(err)
+	}
+	_ = writer.archive.Close()
+	_ = compressed.Close()
+	_ = file.Close()
+
+	// The image has no hash to name a file by, so it stays in the database
+	restored := newTestDatabase(t)
+	restored.imageStore = fileImageStoreNew(t.TempDir())
+	manifest, err = restored.Restore(t.Context(), older)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	assert.Equal(t, 10, manifest.SchemaVersion)
+
+	export := exportTestLibrary(t, restored, true)
+	if assert.Len(t, export.Movies, 1) {
+		assert.Equal(t, []byte{1, 2, 3}, export.Movies[0].Poster)
+	}
+}
+
+func TestVerifyBackup_Tampered(t *testing.T) {
+	d := openTestDatabase(t)
+	insertTestMovies(t, d)
+	fileName := backupTestDatabase(t, d)
+
+	// Rewrite the archive with a changed movies table, but the same manifest
+	tampered := filepath.Join(t.TempDir(), "tampered.tar.gz")
+	file, err := os.Create(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := gzip.NewWriter(file)
+	writer := &backupWriter{archive: tar.NewWriter(compressed), checksums: map[string]string{}}
+	err = readBackup(fileName, func(name string, data []byte) error {
+		if name == backupTablesDir+"movies.json" {
+			data = []byte("[]")
+		}
+		return writer.writeFile(name, data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = writer.archive.Close()
+	_ = compressed.Close()
+	_ = file.Close()
+
+	_, err = VerifyBackup(tampered)
+	assert.ErrorContains(t, err, "movies.json")
+
+	restored := newTestDatabase(t)
+	_, err = restored.Restore(t.Context(), tampered)
+	assert.Error(t, err)
+	version, _ := restored.SchemaVersion(t.Context())
+	assert.Equal(t, 0, version, "a broken backup is not restored")
+}
+
+func TestDatabase_BackupToFolder(t *testing.T) {
+	d := openTestDatabase(t)
+	dir := t.TempDir()
+
+	due, err := IsBackupDue(dir, time.Hour, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, due)
+
+	// Older backups, named by the time they were made
+	for _, name := range []string{"softimdb-20240101-120000.tar.gz", "softimdb-20240102-120000.tar.gz"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fileName, err := d.BackupToFolder(t.Context(), dir, 2)
+	if err != nil {
+		t.Fatalf("BackupToFolder() error = %v", err)
+	}
+
+	backups, err := GetBackupFiles(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "softimdb-20240102-120000.tar.gz"), fileName}, backups)
+
+	due, err = IsBackupDue(dir, time.Hour, time.Now())
+	assert.NoError(t, err)
+	assert.False(t, due)
+	due, err = IsBackupDue(dir, time.Hour, time.Now().Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, due)
+}
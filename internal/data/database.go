@@ -1,23 +1,52 @@
 package data
 
 import (
+	"context"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
 	"github.com/hultan/crypto"
 	"github.com/hultan/softimdb/internal/config"
 )
 
+// ErrDatabaseOffline is returned when the database server can not be reached,
+// for example when the NAS is asleep. The next call tries to reconnect.
+var ErrDatabaseOffline = errors.New("database offline")
+
+// The connection is checked when it has not been used for pingInterval, or
+// after a query failed with a connection error. Reconnecting is tried
+// reconnectAttempts times, waiting reconnectDelay, doubled every time,
+// between the attempts.
+const (
+	pingInterval      = 30 * time.Second
+	reconnectAttempts = 3
+	reconnectDelay    = 250 * time.Millisecond
+)
+
 // Database represents a connection to the SoftIMDB database.
 type Database struct {
+	mu              sync.Mutex // Guards db and lastPing, since the UI searches from goroutines
 	db              *gorm.DB
-	imageCache      *ImageCache
+	lastPing        time.Time
+	checkConnection atomic.Bool // Set when a query fails with a connection error
+	imageCache      *ImageCache[int]
 	UseTestDatabase bool
 	config          *config.Config
 	genreCache      *GenreCache
+	imageStore      imageStore
 }
 
 // DatabaseNew creates a new SoftIMDB Database object.
@@ -25,8 +54,9 @@ func DatabaseNew(useTestDB bool, config *config.Config) *Database {
 	database := &Database{
 		UseTestDatabase: useTestDB,
 		config:          config,
-		imageCache:      imageCacheNew(),
+		imageCache:      imageCacheNew[int](config.GetImageCacheBytes()),
 		genreCache:      genreCacheNew(),
+		imageStore:      imageStoreNew(config.ImageDir),
 	}
 
 	return database
@@ -34,41 +64,199 @@ func DatabaseNew(useTestDB bool, config *config.Config) *Database {
 
 // CloseDatabase closes the underlying SQL database connection.
 func (d *Database) CloseDatabase() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	if d.db == nil {
 		return
 	}
 
+	// The application is closing, so errors are only logged
 	sqlDB, err := d.db.DB()
 	if err != nil {
-		log.Fatal("failed to get raw DB from GORM:", err)
-	}
-
-	if err := sqlDB.Close(); err != nil {
-		log.Fatal("failed to close database connection:", err)
+		log.Println("failed to get raw DB from GORM:", err)
+	} else if err := sqlDB.Close(); err != nil {
+		log.Println("failed to close database connection:", err)
 	}
 
 	d.db = nil
+	d.lastPing = time.Time{}
 }
 
-func (d *Database) getDatabase() (*gorm.DB, error) {
-	if d.db != nil {
-		if err := d.isOpen(); err != nil {
-			return nil, err
-		}
+// withTimeout returns a context with the configured query timeout, unless
+// the context already has a deadline. The cancel function must always be called.
+func (d *Database) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d.config.Database.GetQueryTimeout())
+}
 
-		return d.db, nil
+// getDatabase returns the database connection, opening it if needed. The
+// returned connection runs its queries with the given context. The connection
+// is only checked now and then, and after connection errors, and is then
+// reconnected if needed. ErrDatabaseOffline is returned when that fails.
+func (d *Database) getDatabase(ctx context.Context) (*gorm.DB, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.db != nil && !d.checkConnection.Load() && time.Since(d.lastPing) < pingInterval {
+		return d.db.WithContext(ctx), nil
 	}
 
-	db, err := d.openDatabase()
+	err := retryConnect(ctx, reconnectAttempts, reconnectDelay, func() error {
+		if d.db == nil {
+			db, err := d.openDatabase()
+			if err != nil {
+				return err
+			}
+			d.db = db
+		}
+		return d.isOpen(ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
-	d.db = db
 
-	return d.db, nil
+	d.lastPing = time.Now()
+	d.checkConnection.Store(false)
+
+	return d.db.WithContext(ctx), nil
+}
+
+// transaction runs fn as one unit of work. Every query in fn must use tx, so
+// that nothing is saved unless fn succeeds. When fn fails, the transaction is
+// rolled back, and the genre and image caches are cleared, since they may hold
+// rows that were never committed.
+func (d *Database) transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database: %w", err)
+	}
+
+	// The data of deleted images is removed when the transaction has committed,
+	// since a rollback brings back the image rows, and the data of created
+	// images is removed when it has been rolled back
+	files := &imageFiles{}
+	tx := db.WithContext(context.WithValue(ctx, imageFilesKey{}, files))
+	if err := tx.Transaction(fn); err != nil {
+		d.genreCache.clear()
+		d.imageCache.clear()
+		d.removeImageData(db, files.created...)
+		return err
+	}
+
+	d.removeImageData(db, files.deleted...)
+
+	return nil
 }
 
 func (d *Database) openDatabase() (*gorm.DB, error) {
+	dialector, err := d.getDialector()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(d.config.Database.GetMaxOpenConns())
+	sqlDB.SetMaxIdleConns(d.config.Database.GetMaxIdleConns())
+	sqlDB.SetConnMaxLifetime(d.config.Database.GetConnMaxLifetime())
+
+	if err := d.registerConnectionCheck(db); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// registerConnectionCheck makes the next call check the connection when a
+// query fails with a connection error. The connection pool replaces broken
+// connections, so the next call works again as soon as the server is back.
+func (d *Database) registerConnectionCheck(db *gorm.DB) error {
+	check := func(tx *gorm.DB) {
+		if tx.Error != nil && isConnectionError(tx.Error) {
+			d.checkConnection.Store(true)
+		}
+	}
+
+	const name = "softimdb:check_connection"
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().After("*").Register(name, check),
+		callbacks.Query().After("*").Register(name, check),
+		callbacks.Update().After("*").Register(name, check),
+		callbacks.Delete().After("*").Register(name, check),
+		callbacks.Row().After("*").Register(name, check),
+		callbacks.Raw().After("*").Register(name, check),
+	} {
+		if err != nil {
+			return fmt.Errorf("failed to register connection check: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// retryConnect calls connect until it succeeds, the context is done or it has
+// been tried the given number of times. The delay between the attempts is
+// doubled every time. Only connection errors are retried, and they are
+// returned as ErrDatabaseOffline.
+func retryConnect(ctx context.Context, attempts int, delay time.Duration, connect func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := connect()
+		if err == nil {
+			return nil
+		}
+
+		// A ping that times out means that the server is not answering,
+		// unless it was the context of the caller that ran out
+		offline := isConnectionError(err) || (errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil)
+		if !offline {
+			return err
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("%w: %w", ErrDatabaseOffline, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ErrDatabaseOffline, err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isConnectionError returns true if the error means that the connection to
+// the database server failed, and that trying again later may work.
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr)
+}
+
+// getDialector returns the GORM dialector for the configured database driver.
+func (d *Database) getDialector() (gorm.Dialector, error) {
+	switch driver := d.config.Database.GetDriver(); driver {
+	case config.DriverMySQL:
+		return d.getMySQLDialector()
+	case config.DriverSQLite:
+		return d.getSQLiteDialector()
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+}
+
+func (d *Database) getMySQLDialector() (gorm.Dialector, error) {
 	decryptedPassword, err := crypto.Decrypt(d.config.Database.Password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt password: %w", err)
@@ -76,31 +264,49 @@ func (d *Database) openDatabase() (*gorm.DB, error) {
 
 	// Create connection string
 	var dsn = fmt.Sprintf(
-		"%s:%s@tcp(%s:%v)/%s?parseTime=True",
+		"%s:%s@tcp(%s:%v)/%s?parseTime=True&timeout=%s",
 		d.config.Database.User,
 		decryptedPassword,
 		d.config.Database.Server,
 		d.config.Database.Port,
 		d.config.Database.Database,
+		d.config.Database.GetConnectTimeout(),
 	)
 
-	db, err := gorm.Open(mysql.New(mysql.Config{
+	return mysql.New(mysql.Config{
 		DriverName: "mysql",
 		DSN:        dsn,
-	}), &gorm.Config{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+	}), nil
+}
+
+func (d *Database) getSQLiteDialector() (gorm.Dialector, error) {
+	dbPath := d.config.Database.Path
+	if dbPath == "" {
+		return nil, fmt.Errorf("no path configured for the sqlite database")
 	}
-	return db, nil
+
+	// Make sure that the folder for the database file exists
+	if err := os.MkdirAll(filepath.Dir(dbPath), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create sqlite database folder: %w", err)
+	}
+
+	// Wait for locks instead of failing, since the UI writes from goroutines
+	dsn := dbPath + "?_busy_timeout=5000"
+
+	return sqlite.Open(dsn), nil
 }
 
-func (d *Database) isOpen() error {
+func (d *Database) isOpen(ctx context.Context) error {
 	sqlDB, err := d.db.DB() // Get the underlying *sql.DB
 	if err != nil {
 		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
 	}
 
-	if err := sqlDB.Ping(); err != nil {
+	// Don't wait for the whole query timeout when the server is gone
+	ctx, cancel := context.WithTimeout(ctx, d.config.Database.GetConnectTimeout())
+	defer cancel()
+
+	if err := sqlDB.PingContext(ctx); err != nil {
 		return fmt.Errorf("database ping failed: %w", err)
 	}
 
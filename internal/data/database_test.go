@@ -0,0 +1,213 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"github.com/hultan/softimdb/internal/config"
+)
+
+// newTestDatabase creates a new, empty SQLite database in a temporary folder.
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	// Keep the disk cache of the images out of the home folder
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	cnf := &config.Config{
+		RootDir: t.TempDir(),
+		Database: config.DatabaseSection{
+			Driver: config.DriverSQLite,
+			Path:   filepath.Join(t.TempDir(), "softimdb.db"),
+		},
+	}
+	d := DatabaseNew(true, cnf)
+	t.Cleanup(d.CloseDatabase)
+
+	return d
+}
+
+// openTestDatabase creates a new SQLite database with all migrations applied.
+func openTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	d := newTestDatabase(t)
+	if err := d.Migrate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+func TestDatabase_UnsupportedDriver(t *testing.T) {
+	cnf := &config.Config{Database: config.DatabaseSection{Driver: "oracle"}}
+	d := DatabaseNew(true, cnf)
+
+	if _, err := d.getDatabase(t.Context()); err == nil {
+		t.Errorf("expected error for unsupported driver")
+	}
+}
+
+func TestDatabase_Cancelled(t *testing.T) {
+	d := openTestDatabase(t)
+	insertTestMovies(t, d)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, err := d.SearchMovies(ctx, "all", "", -1, "title asc")
+	assert.True(t, errors.Is(err, context.Canceled), "expected a cancelled search, got %v", err)
+
+	// The connection can still be used with a new context
+	movies, err := d.SearchMovies(t.Context(), "all", "", -1, "title asc")
+	assert.NoError(t, err)
+	assert.Len(t, movies, 3)
+}
+
+func TestDatabase_withTimeout(t *testing.T) {
+	d := DatabaseNew(true, &config.Config{Database: config.DatabaseSection{QueryTimeout: 7}})
+
+	ctx, cancel := d.withTimeout(t.Context())
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok, "the query timeout should be used without a deadline")
+	assert.WithinDuration(t, time.Now().Add(7*time.Second), deadline, time.Second)
+
+	// A deadline set by the caller is kept
+	own, ownCancel := context.WithTimeout(t.Context(), time.Minute)
+	defer ownCancel()
+	ctx, cancel = d.withTimeout(own)
+	defer cancel()
+	deadline, _ = ctx.Deadline()
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+}
+
+func TestDatabase_IgnoredPaths(t *testing.T) {
+	d := openTestDatabase(t)
+
+	ignored := &IgnoredPath{Path: "/videos/Extras"}
+	if err := d.InsertIgnorePath(t.Context(), ignored); err != nil {
+		t.Fatalf("InsertIgnorePath() error = %v", err)
+	}
+
+	paths, err := d.GetAllIgnoredPaths(t.Context())
+	if err != nil {
+		t.Fatalf("GetAllIgnoredPaths() error = %v", err)
+	}
+	if len(paths) != 1 || paths[0].Path != ignored.Path {
+		t.Fatalf("GetAllIgnoredPaths() = %v, want %s", paths, ignored.Path)
+	}
+
+	if err := d.DeleteIgnorePath(t.Context(), paths[0]); err != nil {
+		t.Fatalf("DeleteIgnorePath() error = %v", err)
+	}
+
+	paths, err = d.GetAllIgnoredPaths(t.Context())
+	if err != nil {
+		t.Fatalf("GetAllIgnoredPaths() error = %v", err)
+	}
+	if len(paths) != 0 {
+		t.Errorf("expected no ignored paths, got %d", len(paths))
+	}
+}
+
+func TestDatabase_Pool(t *testing.T) {
+	d := newTestDatabase(t)
+	d.config.Database.MaxOpenConns = 4
+
+	db, err := d.getDatabase(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 4, sqlDB.Stats().MaxOpenConnections)
+
+	// A connection error makes the next call check the connection
+	d.checkConnection.Store(true)
+	_, err = d.getDatabase(t.Context())
+	assert.NoError(t, err)
+	assert.False(t, d.checkConnection.Load())
+}
+
+func TestRetryConnect(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	broken := errors.New("access denied")
+
+	tests := []struct {
+		name          string
+		errs          []error
+		expectedCalls int
+		expectOffline bool
+		expectErr     error
+	}{
+		{"Connected", []error{nil}, 1, false, nil},
+		{"Reconnected", []error{refused, driver.ErrBadConn, nil}, 3, false, nil},
+		{"Offline", []error{refused, refused, refused, nil}, 3, true, refused},
+		{"Not a connection error", []error{broken, nil}, 1, false, broken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := retryConnect(t.Context(), 3, time.Millisecond, func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+
+			assert.Equal(t, tt.expectedCalls, calls)
+			assert.Equal(t, tt.expectOffline, errors.Is(err, ErrDatabaseOffline))
+			if tt.expectErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expectErr)
+			}
+		})
+	}
+}
+
+func TestRetryConnect_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+
+	calls := 0
+	err := retryConnect(ctx, 10, time.Hour, func() error {
+		calls++
+		cancel()
+		return driver.ErrBadConn
+	})
+
+	assert.Equal(t, 1, calls, "a cancelled context should stop the retries")
+	assert.ErrorIs(t, err, ErrDatabaseOffline)
+}
+
+func Test_isConnectionError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"Bad connection", fmt.Errorf("failed to query: %w", driver.ErrBadConn), true},
+		{"Network", &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}, true},
+		{"Unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"Not found", gorm.ErrRecordNotFound, false},
+		{"Cancelled", context.Canceled, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isConnectionError(tt.err))
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportVersion is the version of the export format. It is increased when
+// the format changes in a way that older versions can not read.
+const exportVersion = 1
+
+// exportDateFormat is the format of the dates in an export.
+const exportDateFormat = time.DateOnly
+
+// Export is a copy of the library that can be written as JSON or CSV, and
+// imported into another database with ImportLibrary. Trashed movies are not
+// exported.
+type Export struct {
+	Version      int                `json:"version"`
+	ExportedAt   time.Time          `json:"exportedAt"`
+	Movies       []ExportMovie      `json:"movies"`
+	Genres       []ExportGenre      `json:"genres,omitempty"`
+	IgnoredPaths []ExportIgnorePath `json:"ignoredPaths,omitempty"`
+}
+
+// ExportMovie is a movie in an export. The poster is only set if the export
+// was made with posters, and is base64 encoded in the JSON document.
+type ExportMovie struct {
+	Title         string          `json:"title"`
+	SubTitle      string          `json:"subTitle,omitempty"`
+	StoryLine     string          `json:"storyLine,omitempty"`
+	Year          int             `json:"year,omitempty"`
+	ImdbId        string          `json:"imdbId,omitempty"`
+	ImdbUrl       string          `json:"imdbUrl,omitempty"`
+	ImdbRating    float32         `json:"imdbRating,omitempty"`
+	MyRating      int             `json:"myRating,omitempty"`
+	Runtime       int             `json:"runtime,omitempty"`
+	Size          int             `json:"size,omitempty"`
+	Path          string          `json:"path"`
+	Pack          string          `json:"pack,omitempty"`
+	ToWatch       bool            `json:"toWatch,omitempty"`
+	NeedsSubtitle bool            `json:"needsSubtitle,omitempty"`
+	WatchedAt     string          `json:"watchedAt,omitempty"`
+	Viewings      []ExportViewing `json:"viewings,omitempty"`
+	Genres        []string        `json:"genres,omitempty"`
+	Tags          []string        `json:"tags,omitempty"`
+	Credits       []ExportCredit  `json:"credits,omitempty"`
+	Poster        []byte          `json:"poster,omitempty"`
+}
+
+// ExportViewing is a viewing of a movie. The viewings are only in the JSON
+// export, the CSV export only has the date of the latest viewing.
+type ExportViewing struct {
+	WatchedAt time.Time `json:"watchedAt"`
+	Rating    int       `json:"rating,omitempty"`
+	Note      string    `json:"note,omitempty"`
+}
+
+// ExportCredit is a credit of a person on a movie. The type is "director",
+// "writer" or "actor".
+type ExportCredit struct {
+	Name      string `json:"name"`
+	ImdbId    string `json:"imdbId,omitempty"`
+	Type      string `json:"type"`
+	Billing   int    `json:"billing,omitempty"`
+	Character string `json:"character,omitempty"`
+}
+
+// ExportGenre holds the settings of a genre. The genres of the movies are
+// exported by name with the movies.
+type ExportGenre struct {
+	Name      string   `json:"name"`
+	IsPrivate bool     `json:"isPrivate,omitempty"`
+	Aliases   []string `json:"aliases,omitempty"`
+}
+
+// ExportIgnorePath is a path that the add window ignores.
+type ExportIgnorePath struct {
+	Path             string `json:"path"`
+	IgnoreCompletely bool   `json:"ignoreCompletely,omitempty"`
+}
+
+// exportCSVHeader is the first row of the CSV export. Lists, like the genres,
+// are separated by exportCSVSeparator.
+var exportCSVHeader = []string{
+	"title", "sub_title", "year", "imdb_id", "imdb_url", "imdb_rating", "my_rating", "runtime", "size",
+	"path", "pack", "to_watch", "needs_subtitle", "watched_at", "genres", "tags",
+	"directors", "writers", "actors", "story_line",
+}
+
+const exportCSVSeparator = "; "
+
+var exportPersonTypes = map[PersonType]string{
+	Director: "director",
+	Writer:   "writer",
+	Actor:    "actor",
+}
+
+// ExportLibrary returns a copy of the library, with the posters if posters is true.
+func ExportLibrary(ctx context.Context, r Repository, posters bool) (*Export, error) {
+	movies, err := r.SearchMovies(ctx, "all", "", -1, "id asc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get movies: %w", err)
+	}
+	movies, err = r.GetPersonsForMovies(ctx, movies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get persons: %w", err)
+	}
+
+	export := &Export{Version: exportVersion, ExportedAt: time.Now().UTC()}
+	for _, movie := range movies {
+		exportMovie := getExportMovie(movie, posters)
+		viewings, err := r.GetViewings(ctx, movie)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get viewings of %s: %w", movie.Title, err)
+		}
+		for _, viewing := range viewings {
+			exportMovie.Viewings = append(exportMovie.Viewings, ExportViewing{
+				WatchedAt: viewing.WatchedAt.UTC(), Rating: viewing.Rating, Note: viewing.Note,
+			})
+		}
+		export.Movies = append(export.Movies, exportMovie)
+	}
+
+	genres, err := r.GetGenres(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get genres: %w", err)
+	}
+	aliases, err := r.GetGenreAliases(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get genre aliases: %w", err)
+	}
+	for _, genre := range genres {
+		exportGenre := ExportGenre{Name: genre.Name, IsPrivate: genre.IsPrivate}
+		for _, alias := range aliases {
+			if alias.GenreId == genre.Id {
+				exportGenre.Aliases = append(exportGenre.Aliases, alias.Name)
+			}
+		}
+		// The names of the genres are already exported with the movies
+		if exportGenre.IsPrivate || len(exportGenre.Aliases) > 0 {
+			export.Genres = append(export.Genres, exportGenre)
+		}
+	}
+
+	ignoredPaths, err := r.GetAllIgnoredPaths(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ignored paths: %w", err)
+	}
+	for _, ignoredPath := range ignoredPaths {
+		export.IgnoredPaths = append(export.IgnoredPaths, ExportIgnorePath{
+			Path: ignoredPath.Path, IgnoreCompletely: ignoredPath.IgnoreCompletely,
+		})
+	}
+
+	return export, nil
+}
+
+func getExportMovie(movie *Movie, posters bool) ExportMovie {
+	exportMovie := ExportMovie{
+		Title: movie.Title, SubTitle: movie.SubTitle, StoryLine: movie.StoryLine, Year: movie.Year,
+		ImdbId: movie.ImdbID, ImdbUrl: movie.ImdbUrl, ImdbRating: movie.ImdbRating, MyRating: movie.MyRating,
+		Runtime: movie.Runtime, Size: movie.Size, Path: movie.MoviePath, Pack: movie.Pack,
+		ToWatch: movie.ToWatch, NeedsSubtitle: movie.NeedsSubtitle, WatchedAt: formatExportDate(movie.WatchedAt),
+	}
+	for _, genre := range movie.Genres {
+		exportMovie.Genres = append(exportMovie.Genres, genre.Name)
+	}
+	for _, tag := range movie.Tags {
+		exportMovie.Tags = append(exportMovie.Tags, tag.Name)
+	}
+	for _, person := range movie.Persons {
+		exportMovie.Credits = append(exportMovie.Credits, ExportCredit{
+			Name: person.Name, ImdbId: person.ImdbId, Type: exportPersonTypes[person.Type],
+			Billing: person.Billing, Character: person.Character,
+		})
+	}
+	if posters && movie.HasImage {
+		exportMovie.Poster = movie.Image
+	}
+	return exportMovie
+}
+
+// WriteJSON writes the export as an indented JSON document.
+func (e *Export) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(e); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+// ReadExportJSON reads an export that was written by WriteJSON. Exports made
+// by newer versions of the format are refused.
+func ReadExportJSON(r io.Reader) (*Export, error) {
+	export := &Export{}
+	if err := json.NewDecoder(r).Decode(export); err != nil {
+		return nil, fmt.Errorf("failed to read export: %w", err)
+	}
+	if export.Version < 1 || export.Version > exportVersion {
+		return nil, fmt.Errorf("failed to read export: unsupported version %d", export.Version)
+	}
+	return export, nil
+}
+
+// WriteCSV writes the movies of the export as CSV, one row per movie. The
+// posters, the viewings, the genre settings and the ignored paths are left
+// out, and the credits are written as names only.
+func (e *Export) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportCSVHeader); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+
+	for _, movie := range e.Movies {
+		record := []string{
+			movie.Title, movie.SubTitle, strconv.Itoa(movie.Year), movie.ImdbId, movie.ImdbUrl,
+			strconv.FormatFloat(float64(movie.ImdbRating), 'f', -1, 32), strconv.Itoa(movie.MyRating),
+			strconv.Itoa(movie.Runtime), strconv.Itoa(movie.Size), movie.Path, movie.Pack,
+			strconv.FormatBool(movie.ToWatch), strconv.FormatBool(movie.NeedsSubtitle), movie.WatchedAt,
+			strings.Join(movie.Genres, exportCSVSeparator), strings.Join(movie.Tags, exportCSVSeparator),
+			getExportCreditNames(movie.Credits, "director"), getExportCreditNames(movie.Credits, "writer"),
+			getExportCreditNames(movie.Credits, "actor"), movie.StoryLine,
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write export: %w", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+// ReadExportCSV reads movies that were written by WriteCSV. The header must
+// have the same columns as WriteCSV writes.
+func ReadExportCSV(r io.Reader) (*Export, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export: %w", err)
+	}
+	if len(records) == 0 || !slices.Equal(records[0], exportCSVHeader) {
+		return nil, fmt.Errorf("failed to read export: the header must be %s", strings.Join(exportCSVHeader, ","))
+	}
+
+	export := &Export{Version: exportVersion}
+	for i, record := range records[1:] {
+		movie, err := parseExportCSVRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read export, row %d: %w", i+2, err)
+		}
+		export.Movies = append(export.Movies, movie)
+	}
+	return export, nil
+}
+
+func parseExportCSVRecord(record []string) (ExportMovie, error) {
+	var errs []error
+	atoi := func(s string) int {
+		if s == "" {
+			return 0
+		}
+		i, err := strconv.Atoi(s)
+		errs = append(errs, err)
+		return i
+	}
+	parseBool := func(s string) bool {
+		b, err := strconv.ParseBool(s)
+		errs = append(errs, err)
+		return b
+	}
+
+	movie := ExportMovie{
+		Title: record[0], SubTitle: record[1], Year: atoi(record[2]), ImdbId: record[3], ImdbUrl: record[4],
+		MyRating: atoi(record[6]), Runtime: atoi(record[7]), Size: atoi(record[8]), Path: record[9],
+		Pack: record[10], ToWatch: parseBool(record[11]), NeedsSubtitle: parseBool(record[12]),
+		WatchedAt: record[13], Genres: splitExportList(record[14]), Tags: splitExportList(record[15]),
+		StoryLine: record[19],
+	}
+	if record[5] != "" {
+		rating, err := strconv.ParseFloat(record[5], 32)
+		errs = append(errs, err)
+		movie.ImdbRating = float32(rating)
+	}
+	for i, personType := range []string{"director", "writer", "actor"} {
+		for billing, name := range splitExportList(record[16+i]) {
+			movie.Credits = append(movie.Credits, ExportCredit{Name: name, Type: personType, Billing: billing})
+		}
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return movie, err
+		}
+	}
+	return movie, nil
+}
+
+func getExportCreditNames(credits []ExportCredit, personType string) string {
+	var names []string
+	for _, credit := range credits {
+		if credit.Type == personType {
+			names = append(names, credit.Name)
+		}
+	}
+	return strings.Join(names, exportCSVSeparator)
+}
+
+func splitExportList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, strings.TrimSpace(exportCSVSeparator)) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func formatExportDate(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format(exportDateFormat)
+}
+
+func parseExportPersonType(s string) (PersonType, error) {
+	for personType, name := range exportPersonTypes {
+		if name == s {
+			return personType, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid person type %q", s)
+}
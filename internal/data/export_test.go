@@ -0,0 +1,194 @@
+package data
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func exportTestLibrary(t *testing.T, r Repository, posters bool) *Export {
+	t.Helper()
+
+	export, err := ExportLibrary(t.Context(), r, posters)
+	if err != nil {
+		t.Fatalf("ExportLibrary() error = %v", err)
+	}
+	return export
+}
+
+func importTestLibrary(t *testing.T, r Repository, export *Export, dryRun bool) *ImportReport {
+	t.Helper()
+
+	report, err := ImportLibrary(t.Context(), r, export, dryRun)
+	if err != nil {
+		t.Fatalf("ImportLibrary() error = %v", err)
+	}
+	return report
+}
+
+func TestRepository_ExportImportJSON(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			watchedAt := time.Date(2024, 5, 1, 20, 30, 0, 0, time.UTC)
+			if err := r.InsertViewing(t.Context(), movies[0], &Viewing{WatchedAt: watchedAt, Rating: 4, Note: "Cinema"}); err != nil {
+				t.Fatalf("InsertViewing() error = %v", err)
+			}
+			horror := getTestGenre(t, r, "Horror")
+			if err := r.SetGenrePrivate(t.Context(), &horror, true); err != nil {
+				t.Fatalf("SetGenrePrivate() error = %v", err)
+			}
+			if err := r.InsertIgnorePath(t.Context(), &IgnoredPath{Path: "Extras", IgnoreCompletely: true}); err != nil {
+				t.Fatalf("InsertIgnorePath() error = %v", err)
+			}
+
+			buf := new(bytes.Buffer)
+			if err := exportTestLibrary(t, r, true).WriteJSON(buf); err != nil {
+				t.Fatalf("WriteJSON() error = %v", err)
+			}
+			export, err := ReadExportJSON(buf)
+			if err != nil {
+				t.Fatalf("ReadExportJSON() error = %v", err)
+			}
+			assert.Equal(t, []string{"Gladiator", "Alien", "Heat"}, getExportTitles(export))
+			assert.Equal(t, []byte{1, 2, 3}, export.Movies[0].Poster)
+			assert.Equal(t, []ExportViewing{{WatchedAt: watchedAt, Rating: 4, Note: "Cinema"}}, export.Movies[0].Viewings)
+
+			target := MemoryDatabaseNew()
+			report := importTestLibrary(t, target, export, false)
+			assert.Equal(t, []string{"Gladiator", "Alien", "Heat"}, report.Added)
+			assert.Equal(t, []string{"Horror"}, report.Genres)
+			assert.Equal(t, []string{"Extras"}, report.IgnoredPaths)
+
+			imported := exportTestLibrary(t, target, true)
+			imported.ExportedAt = export.ExportedAt
+			assert.Equal(t, export, imported)
+		})
+	}
+}
+
+func TestRepository_ExportImportCSV(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			insertTestMovies(t, r)
+
+			buf := new(bytes.Buffer)
+			if err := exportTestLibrary(t, r, false).WriteCSV(buf); err != nil {
+				t.Fatalf("WriteCSV() error = %v", err)
+			}
+			export, err := ReadExportCSV(buf)
+			if err != nil {
+				t.Fatalf("ReadExportCSV() error = %v", err)
+			}
+
+			target := openTestDatabase(t)
+			importTestLibrary(t, target, export, false)
+
+			movies, err := target.SearchMovies(t.Context(), "all", "", -1, "id asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Gladiator", "Alien", "Heat"}, movieTitles(movies))
+			assert.Equal(t, "Alien", movies[1].Pack)
+			assert.True(t, movies[2].NeedsSubtitle)
+
+			persons, err := target.GetPersonsForMovie(t.Context(), movies[2])
+			if err != nil {
+				t.Fatalf("GetPersonsForMovie() error = %v", err)
+			}
+			assert.Len(t, persons, 2)
+		})
+	}
+}
+
+func TestRepository_ImportLibrary(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			insertTestMovies(t, r)
+			ronin := &Movie{Title: "Ronin", Year: 1998, MoviePath: "Ronin (1998)", ImdbID: "tt0122690"}
+			if err := r.InsertMovie(t.Context(), ronin); err != nil {
+				t.Fatalf("InsertMovie() error = %v", err)
+			}
+
+			export := &Export{
+				Version: exportVersion,
+				Movies: []ExportMovie{
+					// Matched by path, gets a new rating, genre and actor
+					{
+						Title: "Heat", Year: 1995, MyRating: 5, Path: "Heat", ImdbRating: 8.3, NeedsSubtitle: true,
+						Genres:  []string{"Action", "Crime", "Thriller"},
+						Credits: []ExportCredit{{Name: "Al Pacino", Type: "actor"}},
+					},
+					// Matched by IMDb id, even though the path is different
+					{Title: "Ronin", Year: 1998, Path: "Ronin", ImdbId: "tt0122690", WatchedAt: "2024-05-01"},
+					{Title: "Aliens", Year: 1986, Path: "Aliens", ImdbId: "tt0090605", Pack: "Alien"},
+				},
+			}
+
+			report := importTestLibrary(t, r, export, true)
+			assert.True(t, report.DryRun)
+			assert.Equal(t, []string{"Aliens"}, report.Added)
+			assert.Equal(t, []ImportUpdate{
+				{Title: "Heat", Fields: []string{"my_rating", "genres", "credits"}},
+				{Title: "Ronin", Fields: []string{"viewings"}},
+			}, report.Updated)
+
+			movies, err := r.SearchMovies(t.Context(), "all", "", -1, "id asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Gladiator", "Alien", "Heat", "Ronin"}, movieTitles(movies), "a dry run changes nothing")
+			assert.Equal(t, 4, movies[2].MyRating)
+
+			assert.Equal(t, report.Updated, importTestLibrary(t, r, export, false).Updated)
+
+			report = importTestLibrary(t, r, export, false)
+			assert.Empty(t, report.Added)
+			assert.Empty(t, report.Updated)
+			assert.Equal(t, []string{"Heat", "Ronin", "Aliens"}, report.Unchanged)
+
+			movies, err = r.SearchMovies(t.Context(), "all", "", -1, "id asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Gladiator", "Alien", "Heat", "Ronin", "Aliens"}, movieTitles(movies))
+			assert.Equal(t, 5, movies[2].MyRating)
+			assert.Len(t, movies[2].Genres, 3)
+			assert.Equal(t, "Ronin (1998)", movies[3].MoviePath)
+			assert.Equal(t, "2024-05-01", formatExportDate(movies[3].WatchedAt))
+
+			// The watched at date is imported as a viewing, so that adding
+			// another viewing does not lose it
+			viewings, err := r.GetViewings(t.Context(), movies[3])
+			if err != nil {
+				t.Fatalf("GetViewings() error = %v", err)
+			}
+			if assert.Len(t, viewings, 1) {
+				assert.Equal(t, "2024-05-01", getViewingDay(viewings[0]))
+			}
+			if err := r.InsertViewing(t.Context(), movies[3], &Viewing{WatchedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)}); err != nil {
+				t.Fatalf("InsertViewing() error = %v", err)
+			}
+			movies, err = r.SearchMovies(t.Context(), "all", "title:Ronin", -1, "id asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, "2024-05-01", formatExportDate(movies[0].WatchedAt))
+		})
+	}
+}
+
+func TestImportLibrary_Version(t *testing.T) {
+	_, err := ImportLibrary(t.Context(), MemoryDatabaseNew(), &Export{Version: exportVersion + 1}, true)
+	assert.Error(t, err)
+}
+
+func getExportTitles(export *Export) []string {
+	var titles []string
+	for _, movie := range export.Movies {
+		titles = append(titles, movie.Title)
+	}
+	return titles
+}
@@ -1,11 +1,14 @@
 package data
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Genre represents a movie genre.
@@ -22,8 +25,11 @@ func (t *Genre) TableName() string {
 }
 
 // GetGenres returns all genres
-func (d *Database) GetGenres() ([]Genre, error) {
-	db, err := d.getDatabase()
+func (d *Database) GetGenres(ctx context.Context) ([]Genre, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get database: %w", err)
 	}
@@ -42,8 +48,211 @@ func (d *Database) GetGenres() ([]Genre, error) {
 	return genres, nil
 }
 
-// getGenreByName returns a genre by name.
-func (d *Database) getGenreByName(name string) (*Genre, error) {
+// ErrGenreInUse is returned when deleting a genre that movies still have.
+var ErrGenreInUse = errors.New("genre is in use")
+
+// ErrGenreExists is returned when renaming a genre to the name of another genre.
+var ErrGenreExists = errors.New("genre already exists")
+
+// GetGenreMovieCounts returns the number of movies that have each genre, keyed by genre id.
+// Genres that no movie has are not included.
+func (d *Database) GetGenreMovieCounts(ctx context.Context) (map[int]int, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	var rows []struct {
+		GenreId int `gorm:"column:genre_id"`
+		Count   int `gorm:"column:count"`
+	}
+	err = db.Table("movie_genre").Select("genre_id, COUNT(*) AS count").Group("genre_id").Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count movies for genres: %w", err)
+	}
+
+	counts := make(map[int]int, len(rows))
+	for _, row := range rows {
+		counts[row.GenreId] = row.Count
+	}
+
+	return counts, nil
+}
+
+// RenameGenre renames a genre. The old name is kept as an alias, so that movies
+// scraped with the old name get the renamed genre. Use MergeGenres if there
+// already is a genre with the new name.
+func (d *Database) RenameGenre(ctx context.Context, genre *Genre, name string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("genre name cannot be empty")
+	}
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database: %w", err)
+	}
+
+	existing, err := d.getGenreByName(db, name)
+	if err != nil {
+		return fmt.Errorf("failed to query genre: %w", err)
+	}
+	if existing != nil && existing.Id != genre.Id {
+		return fmt.Errorf("failed to rename genre %s: %w", genre.Name, ErrGenreExists)
+	}
+
+	err = d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			if err := tx.Model(&Genre{}).Where("id = ?", genre.Id).Update("name", name).Error; err != nil {
+				return fmt.Errorf("failed to rename genre: %w", err)
+			}
+
+			// An alias with the new name would shadow the genre
+			if err := tx.Where("name = ?", name).Delete(&GenreAlias{}).Error; err != nil {
+				return fmt.Errorf("failed to delete genre alias: %w", err)
+			}
+
+			if !strings.EqualFold(genre.Name, name) {
+				return d.insertGenreAlias(tx, &GenreAlias{Name: genre.Name, GenreId: genre.Id})
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	d.genreCache.clear()
+	genre.Name = name
+
+	return nil
+}
+
+// MergeGenres moves the movies of the duplicates to the survivor, and deletes the
+// duplicates. The names of the duplicates become aliases of the survivor.
+func (d *Database) MergeGenres(ctx context.Context, survivor *Genre, duplicates []*Genre) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	err := d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			for _, duplicate := range duplicates {
+				if duplicate.Id == survivor.Id {
+					continue
+				}
+
+				var movieGenres []MovieGenre
+				if err := tx.Where("genre_id = ?", duplicate.Id).Find(&movieGenres).Error; err != nil {
+					return fmt.Errorf("failed to get movies for genre %s: %w", duplicate.Name, err)
+				}
+				for _, mg := range movieGenres {
+					mg.GenreId = survivor.Id
+					if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&mg).Error; err != nil {
+						return fmt.Errorf("failed to move movie to genre %s: %w", survivor.Name, err)
+					}
+				}
+				if err := tx.Where("genre_id = ?", duplicate.Id).Delete(&MovieGenre{}).Error; err != nil {
+					return fmt.Errorf("failed to delete movie genres: %w", err)
+				}
+
+				// Aliases of the duplicate now belong to the survivor
+				err := tx.Model(&GenreAlias{}).Where("genre_id = ?", duplicate.Id).Update("genre_id", survivor.Id).Error
+				if err != nil {
+					return fmt.Errorf("failed to move genre aliases: %w", err)
+				}
+
+				if err := tx.Delete(&Genre{}, duplicate.Id).Error; err != nil {
+					return fmt.Errorf("failed to delete genre: %w", err)
+				}
+
+				// A name that only differs by case would match the survivor itself
+				if strings.EqualFold(duplicate.Name, survivor.Name) {
+					continue
+				}
+				if err := d.insertGenreAlias(tx, &GenreAlias{Name: duplicate.Name, GenreId: survivor.Id}); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	d.genreCache.clear()
+
+	return nil
+}
+
+// DeleteGenre deletes a genre and its aliases. Only genres that no movie
+// has can be deleted, otherwise ErrGenreInUse is returned.
+func (d *Database) DeleteGenre(ctx context.Context, genre *Genre) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database: %w", err)
+	}
+
+	var count int64
+	if err := db.Model(&MovieGenre{}).Where("genre_id = ?", genre.Id).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count movies for genre: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("failed to delete genre %s (%d movies): %w", genre.Name, count, ErrGenreInUse)
+	}
+
+	err = d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			if err := tx.Where("genre_id = ?", genre.Id).Delete(&GenreAlias{}).Error; err != nil {
+				return fmt.Errorf("failed to delete genre aliases: %w", err)
+			}
+			if err := tx.Delete(&Genre{}, genre.Id).Error; err != nil {
+				return fmt.Errorf("failed to delete genre: %w", err)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	d.genreCache.clear()
+
+	return nil
+}
+
+// SetGenrePrivate sets whether a genre is private. Private genres can be hidden in the UI.
+func (d *Database) SetGenrePrivate(ctx context.Context, genre *Genre, isPrivate bool) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database: %w", err)
+	}
+
+	if err := db.Model(&Genre{}).Where("id = ?", genre.Id).Update("is_private", isPrivate).Error; err != nil {
+		return fmt.Errorf("failed to update genre: %w", err)
+	}
+
+	d.genreCache.invalidate(genre.Id)
+	genre.IsPrivate = isPrivate
+
+	return nil
+}
+
+// getGenreByName returns a genre by name, or by one of its aliases.
+func (d *Database) getGenreByName(db *gorm.DB, name string) (*Genre, error) {
 	name = strings.TrimSpace(name)
 	if name == "" {
 		return nil, nil // or return an error if an empty name is invalid
@@ -54,32 +263,38 @@ func (d *Database) getGenreByName(name string) (*Genre, error) {
 		return genre, nil
 	}
 
-	db, err := d.getDatabase()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get database: %w", err)
-	}
-
 	var genre Genre
 	result := db.Where("name = ?", name).First(&genre)
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, nil // Not found is not an error, so return nil, nil in this case
-		}
+	if result.Error == nil {
+		return &genre, nil
+	}
+	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		return nil, fmt.Errorf("database query error: %w", result.Error)
 	}
 
-	return &genre, nil
+	// Not found is not an error, so return nil, nil if there is no alias either
+	var genres []Genre
+	err := db.Joins("JOIN genre_alias ON genre_alias.genre_id = genre.id").
+		Where("genre_alias.name = ?", name).Limit(1).Find(&genres).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query genre alias: %w", err)
+	}
+	if len(genres) == 0 {
+		return nil, nil
+	}
+
+	return &genres[0], nil
 }
 
 // getOrInsertGenre either returns an existing genre or inserts a new genre and returns it.
-func (d *Database) getOrInsertGenre(genre *Genre) (*Genre, error) {
+func (d *Database) getOrInsertGenre(db *gorm.DB, genre *Genre) (*Genre, error) {
 	genre.Name = strings.TrimSpace(genre.Name)
 	if genre.Name == "" {
 		return nil, fmt.Errorf("genre name cannot be empty")
 	}
 
 	// Check if the genre already exists
-	existingGenre, err := d.getGenreByName(genre.Name)
+	existingGenre, err := d.getGenreByName(db, genre.Name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query genre: %w", err)
 	}
@@ -87,11 +302,6 @@ func (d *Database) getOrInsertGenre(genre *Genre) (*Genre, error) {
 		return existingGenre, nil
 	}
 
-	db, err := d.getDatabase()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get database: %w", err)
-	}
-
 	// Insert new genre
 	if result := db.Create(genre); result.Error != nil {
 		return nil, fmt.Errorf("failed to create genre: %w", result.Error)
@@ -100,48 +310,51 @@ func (d *Database) getOrInsertGenre(genre *Genre) (*Genre, error) {
 	return genre, nil
 }
 
-// getGenresForMovie returns a list of genres connected to the given movie.
-func (d *Database) getGenresForMovie(movie *Movie) ([]Genre, error) {
-	db, err := d.getDatabase()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get database: %w", err)
+// getGenresForMovies returns the genres connected to each of the given movies,
+// keyed by movie id. It uses at most two queries regardless of the number of movies.
+func (d *Database) getGenresForMovies(db *gorm.DB, movieIds []int) (map[int][]Genre, error) {
+	result := make(map[int][]Genre, len(movieIds))
+	if len(movieIds) == 0 {
+		return result, nil
 	}
 
-	// Fetch genre IDs associated with the movie
+	// Fetch genre IDs associated with the movies
 	var movieGenres []MovieGenre
-	if result := db.Where("movie_id = ?", movie.Id).Find(&movieGenres); result.Error != nil {
-		return nil, fmt.Errorf("failed to query movie genres: %w", result.Error)
+	err := db.Where("movie_id IN ?", movieIds).Order("movie_id, genre_id").Find(&movieGenres).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query movie genres: %w", err)
 	}
 
-	var genres []Genre
+	// Load the genres that are not in the cache in one go
+	var missingIds []int
 	for _, mg := range movieGenres {
-		// Attempt to get genre from the cache
-		if cachedGenre := d.genreCache.getById(mg.GenreId); cachedGenre != nil {
-			genres = append(genres, *cachedGenre)
-			continue
+		if d.genreCache.getById(mg.GenreId) == nil && !slices.Contains(missingIds, mg.GenreId) {
+			missingIds = append(missingIds, mg.GenreId)
 		}
-
-		// Not in cache, query the genre from DB
-		var genre Genre
-		if result := db.First(&genre, mg.GenreId); result.Error != nil {
-			return nil, fmt.Errorf("failed to query genre with ID %d: %w", mg.GenreId, result.Error)
+	}
+	if len(missingIds) > 0 {
+		var genres []Genre
+		if err := db.Where("id IN ?", missingIds).Find(&genres).Error; err != nil {
+			return nil, fmt.Errorf("failed to query genres: %w", err)
 		}
+		for i := range genres {
+			d.genreCache.add(&genres[i])
+		}
+	}
 
-		// Add to the cache and result list
-		d.genreCache.add(&genre)
-		genres = append(genres, genre)
+	for _, mg := range movieGenres {
+		genre := d.genreCache.getById(mg.GenreId)
+		if genre == nil {
+			return nil, fmt.Errorf("failed to query genre with ID %d: %w", mg.GenreId, gorm.ErrRecordNotFound)
+		}
+		result[mg.MovieId] = append(result[mg.MovieId], *genre)
 	}
 
-	return genres, nil
+	return result, nil
 }
 
 // deleteGenresForMovie deletes all genres for the given movie.
-func (d *Database) deleteGenresForMovie(movie *Movie) error {
-	db, err := d.getDatabase()
-	if err != nil {
-		return fmt.Errorf("failed to get database: %w", err)
-	}
-
+func (d *Database) deleteGenresForMovie(db *gorm.DB, movie *Movie) error {
 	// Delete all MovieGenre entries with the given movie ID in one step
 	if result := db.Where("movie_id = ?", movie.Id).Delete(&MovieGenre{}); result.Error != nil {
 		return fmt.Errorf("failed to delete genres for movie ID %d: %w", movie.Id, result.Error)
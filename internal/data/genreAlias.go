@@ -0,0 +1,96 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// GenreAlias is another name of a genre, like "Sci-Fi" for "Science Fiction".
+// Movies that are scraped with an alias get the genre of the alias.
+type GenreAlias struct {
+	Id      int    `gorm:"column:id;primary_key"`
+	Name    string `gorm:"column:name;size:255"`
+	GenreId int    `gorm:"column:genre_id"`
+}
+
+// TableName returns the genre alias table name.
+func (a *GenreAlias) TableName() string {
+	return "genre_alias"
+}
+
+// GetGenreAliases returns all genre aliases.
+func (d *Database) GetGenreAliases(ctx context.Context) ([]GenreAlias, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	var aliases []GenreAlias
+	if err := db.Order("name").Find(&aliases).Error; err != nil {
+		return nil, fmt.Errorf("failed to get genre aliases: %w", err)
+	}
+
+	return aliases, nil
+}
+
+// InsertGenreAlias adds an alias for a genre. An existing alias with the same
+// name is moved to the genre. The name can not be the name of a genre.
+func (d *Database) InsertGenreAlias(ctx context.Context, alias *GenreAlias) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database: %w", err)
+	}
+
+	return d.insertGenreAlias(db, alias)
+}
+
+// insertGenreAlias inserts a genre alias, using db, which can be a transaction.
+func (d *Database) insertGenreAlias(db *gorm.DB, alias *GenreAlias) error {
+	alias.Name = strings.TrimSpace(alias.Name)
+	if alias.Name == "" {
+		return fmt.Errorf("genre alias cannot be empty")
+	}
+
+	var count int64
+	if err := db.Model(&Genre{}).Where("name = ?", alias.Name).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to query genre: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("failed to insert genre alias %s: %w", alias.Name, ErrGenreExists)
+	}
+
+	if err := db.Where("name = ?", alias.Name).Delete(&GenreAlias{}).Error; err != nil {
+		return fmt.Errorf("failed to delete genre alias: %w", err)
+	}
+	if err := db.Create(alias).Error; err != nil {
+		return fmt.Errorf("failed to insert genre alias: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteGenreAlias deletes a genre alias.
+func (d *Database) DeleteGenreAlias(ctx context.Context, alias *GenreAlias) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database: %w", err)
+	}
+
+	if err := db.Delete(&GenreAlias{}, alias.Id).Error; err != nil {
+		return fmt.Errorf("failed to delete genre alias: %w", err)
+	}
+
+	return nil
+}
@@ -1,31 +1,70 @@
 package data
 
+import "sync"
+
+// GenreCache represents an in-memory cache of genres, looked up by id or name.
+// It stores copies, so that callers can change the genres they get without
+// changing the cache. It is safe for concurrent use.
 type GenreCache struct {
-	genres []*Genre
+	mu     sync.RWMutex
+	byId   map[int]Genre
+	byName map[string]int
 }
 
 func genreCacheNew() *GenreCache {
-	return &GenreCache{}
+	return &GenreCache{byId: make(map[int]Genre), byName: make(map[string]int)}
 }
 
 func (t *GenreCache) getByName(name string) *Genre {
-	for _, genre := range t.genres {
-		if genre.Name == name {
-			return genre
-		}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	id, ok := t.byName[name]
+	if !ok {
+		return nil
+	}
+	genre := t.byId[id]
+	return &genre
+}
+
+func (t *GenreCache) getById(id int) *Genre {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	genre, ok := t.byId[id]
+	if !ok {
+		return nil
 	}
-	return nil
+	return &genre
 }
 
 func (t *GenreCache) add(genre *Genre) {
-	t.genres = append(t.genres, genre)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if old, ok := t.byId[genre.Id]; ok {
+		delete(t.byName, old.Name)
+	}
+	t.byId[genre.Id] = *genre
+	t.byName[genre.Name] = genre.Id
 }
 
-func (t *GenreCache) getById(id int) *Genre {
-	for _, genre := range t.genres {
-		if genre.Id == id {
-			return genre
-		}
+// invalidate removes a genre from the cache, after it has been changed.
+func (t *GenreCache) invalidate(id int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if old, ok := t.byId[id]; ok {
+		delete(t.byName, old.Name)
+		delete(t.byId, id)
 	}
-	return nil
+}
+
+// clear empties the cache, after genres have been renamed, merged or deleted.
+func (t *GenreCache) clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	clear(t.byId)
+	clear(t.byName)
 }
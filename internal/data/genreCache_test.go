@@ -0,0 +1,29 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenreCache(t *testing.T) {
+	cache := genreCacheNew()
+
+	genre := &Genre{Id: 1, Name: "Sci-Fi"}
+	cache.add(genre)
+	genre.Name = "Changed"
+	assert.Equal(t, "Sci-Fi", cache.getById(1).Name, "the cache should keep its own copy")
+
+	cache.add(&Genre{Id: 1, Name: "Science Fiction"})
+	assert.Nil(t, cache.getByName("Sci-Fi"), "the old name should be forgotten")
+	assert.Equal(t, 1, cache.getByName("Science Fiction").Id)
+
+	cache.add(&Genre{Id: 2, Name: "Horror"})
+	cache.invalidate(1)
+	assert.Nil(t, cache.getById(1))
+	assert.Nil(t, cache.getByName("Science Fiction"))
+	assert.NotNil(t, cache.getByName("Horror"))
+
+	cache.clear()
+	assert.Nil(t, cache.getById(2))
+}
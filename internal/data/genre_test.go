@@ -0,0 +1,185 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_RenameGenre(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+
+			horror := getTestGenre(t, r, "Horror")
+			if err := r.RenameGenre(t.Context(), &horror, "Scary"); err != nil {
+				t.Fatalf("RenameGenre() error = %v", err)
+			}
+			assert.Equal(t, "Scary", getTestGenre(t, r, "Scary").Name)
+
+			action := getTestGenre(t, r, "Action")
+			assert.ErrorIs(t, r.RenameGenre(t.Context(), &action, "Scary"), ErrGenreExists)
+
+			// Movies scraped with the old name get the renamed genre
+			alien := movies[1]
+			alien.Genres = []Genre{{Name: "Horror"}}
+			if err := r.UpdateMovie(t.Context(), alien); err != nil {
+				t.Fatalf("UpdateMovie() error = %v", err)
+			}
+
+			genres, err := r.GetGenres(t.Context())
+			if err != nil {
+				t.Fatalf("GetGenres() error = %v", err)
+			}
+			assert.Len(t, genres, 4)
+
+			aliases, err := r.GetGenreAliases(t.Context())
+			if err != nil {
+				t.Fatalf("GetGenreAliases() error = %v", err)
+			}
+			assert.Equal(t, []GenreAlias{{Id: aliases[0].Id, Name: "Horror", GenreId: horror.Id}}, aliases)
+		})
+	}
+}
+
+func TestRepository_MergeGenres(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			insertTestMovies(t, r)
+
+			action := getTestGenre(t, r, "Action")
+			drama := getTestGenre(t, r, "Drama")
+			crime := getTestGenre(t, r, "Crime")
+			if err := r.MergeGenres(t.Context(), &action, []*Genre{&drama, &crime}); err != nil {
+				t.Fatalf("MergeGenres() error = %v", err)
+			}
+
+			found, err := r.SearchMovies(t.Context(), "all", "", action.Id, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Gladiator", "Heat"}, movieTitles(found))
+			for _, movie := range found {
+				assert.Equal(t, []Genre{action}, movie.Genres)
+			}
+
+			counts, err := r.GetGenreMovieCounts(t.Context())
+			if err != nil {
+				t.Fatalf("GetGenreMovieCounts() error = %v", err)
+			}
+			assert.Equal(t, map[int]int{action.Id: 2, getTestGenre(t, r, "Horror").Id: 1}, counts)
+
+			aliases, err := r.GetGenreAliases(t.Context())
+			if err != nil {
+				t.Fatalf("GetGenreAliases() error = %v", err)
+			}
+			if assert.Len(t, aliases, 2) {
+				assert.Equal(t, "Crime", aliases[0].Name)
+				assert.Equal(t, "Drama", aliases[1].Name)
+				assert.Equal(t, action.Id, aliases[1].GenreId)
+			}
+		})
+	}
+}
+
+func TestRepository_MergeGenresCaseOnly(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			survivor := insertTestGenre(t, r, "Sci-Fi")
+			duplicate := insertTestGenre(t, r, "Sci-fi")
+			if err := r.MergeGenres(t.Context(), &survivor, []*Genre{&duplicate}); err != nil {
+				t.Fatalf("MergeGenres() error = %v", err)
+			}
+
+			genres, err := r.GetGenres(t.Context())
+			if err != nil {
+				t.Fatalf("GetGenres() error = %v", err)
+			}
+			assert.Equal(t, []Genre{survivor}, genres)
+
+			// The survivor already matches the name of the duplicate
+			aliases, err := r.GetGenreAliases(t.Context())
+			if err != nil {
+				t.Fatalf("GetGenreAliases() error = %v", err)
+			}
+			assert.Empty(t, aliases)
+		})
+	}
+}
+
+// insertTestGenre adds a genre without looking up the name first, so that
+// genres that only differ by case can be added, like in a database whose
+// collation was case-sensitive when they were inserted.
+func insertTestGenre(t *testing.T, r Repository, name string) Genre {
+	t.Helper()
+
+	genre := Genre{Name: name}
+	switch r := r.(type) {
+	case *Database:
+		db, err := r.getDatabase(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(&genre).Error; err != nil {
+			t.Fatalf("failed to insert genre: %v", err)
+		}
+	case *MemoryDatabase:
+		r.lastGenreId++
+		genre.Id = r.lastGenreId
+		stored := genre
+		r.genres[genre.Id] = &stored
+	}
+	return genre
+}
+
+func TestRepository_DeleteGenre(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+
+			horror := getTestGenre(t, r, "Horror")
+			assert.ErrorIs(t, r.DeleteGenre(t.Context(), &horror), ErrGenreInUse)
+
+			if err := r.InsertGenreAlias(t.Context(), &GenreAlias{Name: "Thriller", GenreId: horror.Id}); err != nil {
+				t.Fatalf("InsertGenreAlias() error = %v", err)
+			}
+			if err := r.RemoveMovieGenre(t.Context(), movies[1], &horror); err != nil {
+				t.Fatalf("RemoveMovieGenre() error = %v", err)
+			}
+			if err := r.DeleteGenre(t.Context(), &horror); err != nil {
+				t.Fatalf("DeleteGenre() error = %v", err)
+			}
+
+			genres, err := r.GetGenres(t.Context())
+			if err != nil {
+				t.Fatalf("GetGenres() error = %v", err)
+			}
+			for _, genre := range genres {
+				assert.NotEqual(t, "Horror", genre.Name)
+			}
+
+			aliases, err := r.GetGenreAliases(t.Context())
+			if err != nil {
+				t.Fatalf("GetGenreAliases() error = %v", err)
+			}
+			assert.Empty(t, aliases)
+		})
+	}
+}
+
+func TestRepository_SetGenrePrivate(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			insertTestMovies(t, r)
+
+			crime := getTestGenre(t, r, "Crime")
+			if err := r.SetGenrePrivate(t.Context(), &crime, true); err != nil {
+				t.Fatalf("SetGenrePrivate() error = %v", err)
+			}
+			assert.True(t, getTestGenre(t, r, "Crime").IsPrivate)
+
+			// An alias can not have the name of a genre
+			assert.ErrorIs(t, r.InsertGenreAlias(t.Context(), &GenreAlias{Name: "Crime", GenreId: crime.Id}), ErrGenreExists)
+		})
+	}
+}
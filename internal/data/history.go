@@ -0,0 +1,335 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sources of the changes recorded in the movie history. Tools
+// that change movies use their own name as the source.
+const (
+	ChangeSourceUI       = "ui"
+	ChangeSourceRescrape = "rescrape"
+	ChangeSourceRevert   = "revert"
+)
+
+// changeSourceKey is the context key of the change source.
+type changeSourceKey struct{}
+
+// WithChangeSource returns a copy of ctx, that makes the changes done with it
+// recorded in the movie history with source, for example ChangeSourceRescrape
+// or the name of a tool. Changes are recorded as ChangeSourceUI otherwise.
+func WithChangeSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, changeSourceKey{}, source)
+}
+
+func getChangeSource(ctx context.Context) string {
+	if ctx != nil {
+		if source, ok := ctx.Value(changeSourceKey{}).(string); ok && source != "" {
+			return source
+		}
+	}
+	return ChangeSourceUI
+}
+
+// Fields in the movie history that are not movie columns.
+const (
+	historyFieldCreated = "created"
+	historyFieldGenre   = "genre"
+	historyFieldPerson  = "person"
+	historyFieldTag     = "tag"
+)
+
+// MovieChange is a field level change of a movie, recorded in the movie history.
+type MovieChange struct {
+	Id        int       `gorm:"column:id;primary_key"`
+	MovieId   int       `gorm:"column:movie_id"`
+	ChangedAt time.Time `gorm:"column:changed_at"`
+	Source    string    `gorm:"column:source;size:50"`
+	Field     string    `gorm:"column:field;size:50"`
+	OldValue  string    `gorm:"column:old_value;type:text"`
+	NewValue  string    `gorm:"column:new_value;type:text"`
+}
+
+// TableName returns the name of the table.
+func (c *MovieChange) TableName() string {
+	return "movie_history"
+}
+
+// CanRevert returns true if the change can be reverted with RevertChange.
+// Changes of the image, the watched at date and the trash can not be reverted,
+// since the old image is deleted, and the other two have their own undo.
+func (c *MovieChange) CanRevert() bool {
+	if c.Field == historyFieldGenre {
+		return true
+	}
+	column, ok := historyColumns[c.Field]
+	return ok && column.parse != nil
+}
+
+// historyColumn describes how a movie column is recorded in the history, and how it is reverted.
+type historyColumn struct {
+	format func(movie *Movie) string
+	parse  func(movie *Movie, value string) error // nil if the column can not be reverted
+	value  func(movie *Movie) interface{}
+}
+
+// historyColumns are the movie columns that are recorded in the history.
+var historyColumns = map[string]historyColumn{
+	"title":         stringColumn(func(m *Movie) *string { return &m.Title }),
+	"sub_title":     stringColumn(func(m *Movie) *string { return &m.SubTitle }),
+	"story_line":    stringColumn(func(m *Movie) *string { return &m.StoryLine }),
+	"imdb_url":      stringColumn(func(m *Movie) *string { return &m.ImdbUrl }),
+	"pack":          stringColumn(func(m *Movie) *string { return &m.Pack }),
+	"year":          intColumn(func(m *Movie) *int { return &m.Year }),
+	"my_rating":     intColumn(func(m *Movie) *int { return &m.MyRating }),
+	"length":        intColumn(func(m *Movie) *int { return &m.Runtime }),
+	"imdb_rating":   floatColumn(func(m *Movie) *float32 { return &m.ImdbRating }),
+	"to_watch":      boolColumn(func(m *Movie) *bool { return &m.ToWatch }),
+	"needsSubtitle": boolColumn(func(m *Movie) *bool { return &m.NeedsSubtitle }),
+	"processed":     boolColumn(func(m *Movie) *bool { return &m.Processed }),
+	"image_id":      readOnlyColumn(func(m *Movie) string { return strconv.Itoa(m.ImageId) }),
+	"watched_at":    readOnlyColumn(func(m *Movie) string { return formatHistoryTime(m.WatchedAt) }),
+	"trashed_at":    readOnlyColumn(func(m *Movie) string { return formatHistoryTime(m.TrashedAt) }),
+}
+
+func stringColumn(field func(m *Movie) *string) historyColumn {
+	return historyColumn{
+		format: func(m *Movie) string { return *field(m) },
+		parse: func(m *Movie, value string) error {
+			*field(m) = value
+			return nil
+		},
+		value: func(m *Movie) interface{} { return *field(m) },
+	}
+}
+
+func intColumn(field func(m *Movie) *int) historyColumn {
+	return historyColumn{
+		format: func(m *Movie) string { return strconv.Itoa(*field(m)) },
+		parse: func(m *Movie, value string) error {
+			i, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("failed to parse history value: %w", err)
+			}
+			*field(m) = i
+			return nil
+		},
+		value: func(m *Movie) interface{} { return *field(m) },
+	}
+}
+
+func floatColumn(field func(m *Movie) *float32) historyColumn {
+	return historyColumn{
+		format: func(m *Movie) string { return strconv.FormatFloat(float64(*field(m)), 'f', -1, 32) },
+		parse: func(m *Movie, value string) error {
+			f, err := strconv.ParseFloat(value, 32)
+			if err != nil {
+				return fmt.Errorf("failed to parse history value: %w", err)
+			}
+			*field(m) = float32(f)
+			return nil
+		},
+		value: func(m *Movie) interface{} { return *field(m) },
+	}
+}
+
+func boolColumn(field func(m *Movie) *bool) historyColumn {
+	return historyColumn{
+		format: func(m *Movie) string { return strconv.FormatBool(*field(m)) },
+		parse: func(m *Movie, value string) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("failed to parse history value: %w", err)
+			}
+			*field(m) = b
+			return nil
+		},
+		value: func(m *Movie) interface{} { return *field(m) },
+	}
+}
+
+func readOnlyColumn(format func(m *Movie) string) historyColumn {
+	return historyColumn{format: format}
+}
+
+func formatHistoryTime(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Local().Format("2006-01-02 15:04:05")
+}
+
+// getMovieChanges returns the changes of the given columns between before and after.
+func getMovieChanges(before, after *Movie, columns []string) []MovieChange {
+	var changes []MovieChange
+	for _, name := range columns {
+		column, ok := historyColumns[name]
+		if !ok {
+			continue
+		}
+
+		oldValue, newValue := column.format(before), column.format(after)
+		if oldValue != newValue {
+			changes = append(changes, MovieChange{MovieId: after.Id, Field: name, OldValue: oldValue, NewValue: newValue})
+		}
+	}
+	return changes
+}
+
+// getPersonHistoryValue returns how a person is shown in the history, like "Ridley Scott (director)".
+func getPersonHistoryValue(person *Person) string {
+	for name, t := range personType {
+		if t == int(person.Type) && t >= 0 {
+			return fmt.Sprintf("%s (%s)", person.Name, name)
+		}
+	}
+	return person.Name
+}
+
+// sortMovieHistory sorts changes with the latest change first.
+func sortMovieHistory(changes []MovieChange) {
+	slices.SortStableFunc(changes, func(a, b MovieChange) int {
+		if c := b.ChangedAt.Compare(a.ChangedAt); c != 0 {
+			return c
+		}
+		return b.Id - a.Id
+	})
+}
+
+//
+// Database
+//
+
+// GetMovieHistory returns the recorded changes of a movie, the latest change first.
+func (d *Database) GetMovieHistory(ctx context.Context, movie *Movie) ([]MovieChange, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	var changes []MovieChange
+	if err := db.Where("movie_id = ?", movie.Id).Find(&changes).Error; err != nil {
+		return nil, fmt.Errorf("failed to get movie history: %w", err)
+	}
+	sortMovieHistory(changes)
+
+	return changes, nil
+}
+
+// RevertChange sets a field of the movie back to the value it had before the change.
+// The revert is itself recorded in the history.
+func (d *Database) RevertChange(ctx context.Context, movie *Movie, change *MovieChange) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if !change.CanRevert() || change.MovieId != movie.Id {
+		return fmt.Errorf("failed to revert change: the change of %s can not be reverted", change.Field)
+	}
+
+	ctx = WithChangeSource(ctx, ChangeSourceRevert)
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database: %w", err)
+	}
+
+	if change.Field == historyFieldGenre {
+		return d.revertGenreChange(db, movie, change)
+	}
+
+	before := Movie{}
+	if err := db.First(&before, movie.Id).Error; err != nil {
+		return fmt.Errorf("failed to get movie: %w", err)
+	}
+
+	after := before
+	column := historyColumns[change.Field]
+	if err := column.parse(&after, change.OldValue); err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{change.Field: column.value(&after)}
+	if change.Field == "pack" {
+		// The pack name decides which pack the movie belongs to
+		if err := d.assignPack(db, &after); err != nil {
+			return fmt.Errorf("failed to get or insert pack: %w", err)
+		}
+		updates["pack"], updates["pack_id"], updates["pack_position"] = after.Pack, after.PackId, after.PackPosition
+		movie.PackId, movie.PackPosition = after.PackId, after.PackPosition
+	}
+
+	if err := db.Model(&Movie{}).Where("id = ?", movie.Id).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to revert change: %w", err)
+	}
+	if err := column.parse(movie, column.format(&after)); err != nil {
+		return err
+	}
+
+	return d.recordChanges(db, getMovieChanges(&before, &after, []string{change.Field})...)
+}
+
+// revertGenreChange removes a genre that was added, or adds a genre that was removed.
+func (d *Database) revertGenreChange(db *gorm.DB, movie *Movie, change *MovieChange) error {
+	if change.NewValue != "" {
+		genre, err := d.getGenreByName(db, change.NewValue)
+		if err != nil {
+			return fmt.Errorf("failed to get genre: %w", err)
+		}
+		if genre == nil {
+			return nil
+		}
+		return d.removeMovieGenre(db, movie, genre)
+	}
+
+	genre, err := d.getOrInsertGenre(db, &Genre{Name: change.OldValue})
+	if err != nil {
+		return fmt.Errorf("failed to get genre: %w", err)
+	}
+
+	added, err := d.getOrInsertMovieGenre(db, movie, genre)
+	if err != nil || !added {
+		return err
+	}
+
+	return d.recordChanges(db, MovieChange{MovieId: movie.Id, Field: historyFieldGenre, NewValue: genre.Name})
+}
+
+// recordChanges adds changes to the movie history, using db, which can be a transaction.
+// The source of the changes is taken from the context of db.
+func (d *Database) recordChanges(db *gorm.DB, changes ...MovieChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	source := getChangeSource(db.Statement.Context)
+	for i := range changes {
+		changes[i].ChangedAt = now
+		changes[i].Source = source
+	}
+
+	if err := db.Create(&changes).Error; err != nil {
+		return fmt.Errorf("failed to record movie history: %w", err)
+	}
+
+	return nil
+}
+
+// deleteHistoryForMovie removes the history of a movie.
+func (d *Database) deleteHistoryForMovie(db *gorm.DB, movie *Movie) error {
+	if err := db.Where("movie_id = ?", movie.Id).Delete(&MovieChange{}).Error; err != nil {
+		return fmt.Errorf("failed to delete movie history: %w", err)
+	}
+
+	return nil
+}
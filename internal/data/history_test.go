@@ -0,0 +1,155 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_MovieHistory(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			gladiator := movies[0]
+
+			gladiator.Title = "Gladiator (Extended)"
+			gladiator.MyRating = 4
+			if err := r.UpdateMovie(WithChangeSource(t.Context(), ChangeSourceRescrape), gladiator); err != nil {
+				t.Fatalf("UpdateMovie() error = %v", err)
+			}
+
+			history, err := r.GetMovieHistory(t.Context(), gladiator)
+			if err != nil {
+				t.Fatalf("GetMovieHistory() error = %v", err)
+			}
+
+			changes := getTestChanges(history, ChangeSourceRescrape)
+			if assert.Len(t, changes, 2) {
+				assert.Equal(t, MovieChange{Field: "title", OldValue: "Gladiator", NewValue: "Gladiator (Extended)"}, changes[0])
+				assert.Equal(t, MovieChange{Field: "my_rating", OldValue: "5", NewValue: "4"}, changes[1])
+			}
+
+			// Inserting the movie records its creation, genres and persons
+			created := getTestChanges(history, ChangeSourceUI)
+			assert.Contains(t, created, MovieChange{Field: historyFieldCreated, NewValue: "Gladiator"})
+			assert.Contains(t, created, MovieChange{Field: historyFieldGenre, NewValue: "Drama"})
+			assert.Contains(t, created, MovieChange{Field: historyFieldPerson, NewValue: "Ridley Scott (director)"})
+
+			// Revert the title change only
+			for _, change := range history {
+				if change.Field == "title" {
+					if err := r.RevertChange(t.Context(), gladiator, &change); err != nil {
+						t.Fatalf("RevertChange() error = %v", err)
+					}
+				}
+			}
+			assert.Equal(t, "Gladiator", gladiator.Title)
+
+			found, err := r.SearchMovies(t.Context(), "all", "title:Gladiator", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			if assert.Len(t, found, 1) {
+				assert.Equal(t, "Gladiator", found[0].Title)
+				assert.Equal(t, 4, found[0].MyRating)
+			}
+
+			history, err = r.GetMovieHistory(t.Context(), gladiator)
+			if err != nil {
+				t.Fatalf("GetMovieHistory() error = %v", err)
+			}
+			assert.Equal(t, []MovieChange{{Field: "title", OldValue: "Gladiator (Extended)", NewValue: "Gladiator"}},
+				getTestChanges(history, ChangeSourceRevert))
+		})
+	}
+}
+
+func TestRepository_RevertGenreChange(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			heat := movies[2]
+
+			crime := getTestGenre(t, r, "Crime")
+			if err := r.RemoveMovieGenre(t.Context(), heat, &crime); err != nil {
+				t.Fatalf("RemoveMovieGenre() error = %v", err)
+			}
+
+			history, err := r.GetMovieHistory(t.Context(), heat)
+			if err != nil {
+				t.Fatalf("GetMovieHistory() error = %v", err)
+			}
+			latest := history[0]
+			assert.Equal(t, historyFieldGenre, latest.Field)
+			assert.Equal(t, "Crime", latest.OldValue)
+			assert.True(t, latest.CanRevert())
+
+			if err := r.RevertChange(t.Context(), heat, &latest); err != nil {
+				t.Fatalf("RevertChange() error = %v", err)
+			}
+
+			found, err := r.SearchMovies(t.Context(), "all", "", crime.Id, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Heat"}, movieTitles(found))
+		})
+	}
+}
+
+func TestRepository_RevertChangeNotRevertible(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			gladiator := movies[0]
+
+			if err := r.UpdateImage(t.Context(), gladiator, []byte{4, 5, 6}); err != nil {
+				t.Fatalf("UpdateImage() error = %v", err)
+			}
+
+			history, err := r.GetMovieHistory(t.Context(), gladiator)
+			if err != nil {
+				t.Fatalf("GetMovieHistory() error = %v", err)
+			}
+			latest := history[0]
+			assert.Equal(t, "image_id", latest.Field)
+			assert.False(t, latest.CanRevert())
+			assert.Error(t, r.RevertChange(t.Context(), gladiator, &latest))
+		})
+	}
+}
+
+func TestMovieChange_CanRevert(t *testing.T) {
+	tests := []struct {
+		field string
+		want  bool
+	}{
+		{"title", true},
+		{"imdb_rating", true},
+		{"needsSubtitle", true},
+		{historyFieldGenre, true},
+		{historyFieldPerson, false},
+		{historyFieldTag, false},
+		{historyFieldCreated, false},
+		{"watched_at", false},
+		{"trashed_at", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			change := MovieChange{Field: tt.field}
+			assert.Equal(t, tt.want, change.CanRevert())
+		})
+	}
+}
+
+// getTestChanges returns the changes from the given source, without
+// the fields that differ between runs, so they can be compared.
+func getTestChanges(history []MovieChange, source string) []MovieChange {
+	var changes []MovieChange
+	for _, change := range history {
+		if change.Source == source {
+			changes = append(changes, MovieChange{Field: change.Field, OldValue: change.OldValue, NewValue: change.NewValue})
+		}
+	}
+	return changes
+}
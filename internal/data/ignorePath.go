@@ -1,6 +1,9 @@
 package data
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // IgnoredPath represents the table IgnoredPath.
 type IgnoredPath struct {
@@ -15,8 +18,11 @@ func (i *IgnoredPath) TableName() string {
 }
 
 // GetAllIgnoredPaths returns all ignored paths.
-func (d *Database) GetAllIgnoredPaths() ([]*IgnoredPath, error) {
-	db, err := d.getDatabase()
+func (d *Database) GetAllIgnoredPaths(ctx context.Context) ([]*IgnoredPath, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get database: %w", err)
 	}
@@ -29,8 +35,11 @@ func (d *Database) GetAllIgnoredPaths() ([]*IgnoredPath, error) {
 }
 
 // InsertIgnorePath inserts a path to be ignored.
-func (d *Database) InsertIgnorePath(ignorePath *IgnoredPath) error {
-	db, err := d.getDatabase()
+func (d *Database) InsertIgnorePath(ctx context.Context, ignorePath *IgnoredPath) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get database: %w", err)
 	}
@@ -42,8 +51,11 @@ func (d *Database) InsertIgnorePath(ignorePath *IgnoredPath) error {
 }
 
 // DeleteIgnorePath deletes a path from the ignored paths
-func (d *Database) DeleteIgnorePath(ignorePath *IgnoredPath) error {
-	db, err := d.getDatabase()
+func (d *Database) DeleteIgnorePath(ctx context.Context, ignorePath *IgnoredPath) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get database: %w", err)
 	}
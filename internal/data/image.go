@@ -1,118 +1,191 @@
 package data
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
+	"log"
 	"os"
-	"path"
+	"path/filepath"
 
 	"gorm.io/gorm"
 )
 
-// image represents a movie image.
+// image represents a movie image. Hash is the SHA-256 of the image data,
+// and names the image in the disk cache and the file image store. Data is
+// empty when the image store keeps the data outside the database.
 type image struct {
 	Id   int    `gorm:"column:id;primary_key"`
 	Data []byte `gorm:"column:image;"`
+	Hash string `gorm:"column:hash;size:64"`
 }
 
-const imageCachePath = "/home/per/.cache/"
-
 // TableName returns the name of the table.
 func (i *image) TableName() string {
 	return "image"
 }
 
-// createImage inserts an image into the database.
-func (d *Database) createImage(image *image) error {
-	db, err := d.getDatabase()
-	if err != nil {
-		return fmt.Errorf("failed to get database: %w", err)
+// imageNew creates a new image with the given data.
+func imageNew(data []byte) *image {
+	return &image{Data: data, Hash: getImageHash(data)}
+}
+
+// getImageHash returns the content hash of image data.
+func getImageHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// createImage stores the data of an image in the image store, and inserts the image into the database.
+// Inside a transaction, the data is removed from the image store again if the transaction is rolled back.
+func (d *Database) createImage(db *gorm.DB, image *image) error {
+	if err := d.imageStore.save(image); err != nil {
+		return err
+	}
+
+	created := *image
+	files, ok := db.Statement.Context.Value(imageFilesKey{}).(*imageFiles)
+	if ok {
+		files.created = append(files.created, created)
 	}
 	if err := db.Create(image).Error; err != nil {
+		if !ok {
+			d.removeImageData(db, created)
+		}
 		return fmt.Errorf("failed to insert image: %w", err)
 	}
 
 	return nil
 }
 
-// readImage returns an image from the database.
-func (d *Database) readImage(imageId int) (*image, error) {
-	img := image{}
-
-	// Load from cache
-	cachePath := path.Join(imageCachePath, "softimdb", fmt.Sprintf("%d.jpg", imageId))
-	if d.existCachedImage(cachePath) {
-		img.Id = imageId
-		err := d.getCachedImage(&img, cachePath)
-		if err == nil {
-			return &img, nil
-		}
+// readImages returns the image data for the given image ids, keyed by image id.
+// Images found in the disk cache are read from there, the rest are loaded from
+// the image store in one go. Missing images are left out of the result.
+func (d *Database) readImages(db *gorm.DB, imageIds []int) (map[int][]byte, error) {
+	result := make(map[int][]byte, len(imageIds))
+	if len(imageIds) == 0 {
+		return result, nil
 	}
 
-	db, err := d.getDatabase()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get database: %w", err)
+	// Get the hashes, without the image data, to look the images up in the disk cache
+	var hashes []image
+	if err := db.Select("id, hash").Where("id IN ?", imageIds).Find(&hashes).Error; err != nil {
+		return nil, fmt.Errorf("failed to get image hashes: %w", err)
 	}
 
-	if err := db.Where("Id=?", imageId).First(&img).Error; err != nil {
-		return nil, fmt.Errorf("failed to get image: %w", err)
+	var missing []image
+	for _, img := range hashes {
+		if data := d.readCachedImage(img.Hash); data != nil {
+			result[img.Id] = data
+			continue
+		}
+		missing = append(missing, img)
 	}
 
-	// Store in cache
-	if !d.existCachedImage(cachePath) {
-		d.storeCachedImage(&img, cachePath)
+	if len(missing) == 0 {
+		return result, nil
 	}
 
-	return &img, nil
-}
-
-// UpdateImage replaces an image in the database.
-func (d *Database) UpdateImage(movie *Movie, imageData []byte) error {
-	db, err := d.getDatabase()
+	stored, err := d.imageStore.load(db, missing)
 	if err != nil {
-		return fmt.Errorf("failed to get database: %w", err)
+		return nil, err
 	}
 
-	err = db.Transaction(
-		func(tx *gorm.DB) error {
-			if err := db.Delete(&image{}, movie.ImageId).Error; err != nil {
-				return fmt.Errorf("failed to delete old image: %w", err)
-			}
+	for _, img := range missing {
+		data, ok := stored[img.Id]
+		if !ok {
+			continue
+		}
+		result[img.Id] = data
 
-			img := &image{Data: imageData}
-			if err := db.Create(img).Error; err != nil {
-				return fmt.Errorf("failed to insert new image: %w", err)
+		// Images from before the hash column get their hash on first use
+		if img.Hash == "" {
+			img.Hash = getImageHash(data)
+			if err := db.Model(&image{}).Where("id = ?", img.Id).Update("hash", img.Hash).Error; err != nil {
+				return nil, fmt.Errorf("failed to update image hash: %w", err)
 			}
+		}
 
-			if err := db.Model(&movie).Update("image_id", img.Id).Error; err != nil {
-				return fmt.Errorf("failed to update image_id on movie: %w", err)
-			}
+		d.storeCachedImage(img.Hash, data)
+	}
 
-			// TODO : Update cache
+	return result, nil
+}
 
-			return nil
-		},
-	)
+// UpdateImage adds a new poster to a movie, and makes it the primary poster.
+// The old poster is kept in the artwork of the movie.
+func (d *Database) UpdateImage(ctx context.Context, movie *Movie, imageData []byte) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 
-	// Check transaction error
-	if err != nil {
+	artwork := &Artwork{Kind: ArtworkPoster, Image: imageData}
+	if err := d.InsertArtwork(ctx, movie, artwork); err != nil {
 		return err
 	}
 
+	return d.SetPrimaryArtwork(ctx, movie, artwork)
+}
+
+// deleteImage deletes the image of a movie from the database and the caches.
+func (d *Database) deleteImage(db *gorm.DB, movie *Movie) error {
+	if err := d.deleteImageById(db, movie.ImageId); err != nil {
+		return fmt.Errorf("failed to delete image: %w", err)
+	}
+
 	return nil
 }
 
-// deleteImage inserts an image into the database.
-func (d *Database) deleteImage(movie *Movie) error {
-	db, err := d.getDatabase()
-	if err != nil {
-		return fmt.Errorf("failed to get database: %w", err)
+// imageFilesKey is the context key of the imageFiles of a transaction.
+type imageFilesKey struct{}
+
+// imageFiles are the images that were created and deleted in a transaction. The
+// data of the deleted images is removed from the image store when the
+// transaction has committed, and the data of the created images when it has
+// been rolled back.
+type imageFiles struct {
+	created []image
+	deleted []image
+}
+
+// removeImageData removes the data of images without rows from the image store.
+// An image that can not be removed is only logged, since the rows are gone.
+func (d *Database) removeImageData(db *gorm.DB, images ...image) {
+	for _, img := range images {
+		if err := d.imageStore.remove(db, img); err != nil {
+			log.Println("failed to remove image data:", err)
+		}
 	}
+}
 
-	if err := db.Delete(&image{}, movie.ImageId).Error; err != nil {
-		return fmt.Errorf("failed to delete image: %w", err)
+// deleteImageById deletes an image from the database and the image store, and
+// removes it from the memory and disk caches, since the database may hand out
+// its id again. Inside a transaction, the data is removed from the image store
+// when the transaction has committed.
+func (d *Database) deleteImageById(db *gorm.DB, imageId int) error {
+	if imageId <= 0 {
+		return nil
+	}
+
+	var img image
+	err := db.Select("id, hash").Where("id = ?", imageId).First(&img).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to get image hash: %w", err)
 	}
 
+	if err := db.Delete(&image{}, imageId).Error; err != nil {
+		return err
+	}
+	if files, ok := db.Statement.Context.Value(imageFilesKey{}).(*imageFiles); ok {
+		files.deleted = append(files.deleted, img)
+	} else if err := d.imageStore.remove(db, img); err != nil {
+		return err
+	}
+
+	d.imageCache.invalidate(imageId)
+	d.removeCachedImage(img.Hash)
+
 	return nil
 }
 
@@ -120,54 +193,101 @@ func (d *Database) deleteImage(movie *Movie) error {
 // Cached images
 //
 
-// existCachedImage returns true if an image exists in the cache.
-func (d *Database) existCachedImage(cachePath string) bool {
-	if _, err := os.Stat(cachePath); os.IsNotExist(err) {
-		return false
+// getImageCacheDir returns the folder of the disk cache, in the XDG cache
+// folder ($XDG_CACHE_HOME, or ~/.cache).
+func getImageCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get cache folder: %w", err)
 	}
-	return true
+	return filepath.Join(cacheDir, "softimdb", "posters"), nil
 }
 
-// getCachedImage returns an image from the cache.
-func (d *Database) getCachedImage(image *image, cachePath string) error {
-	file, err := os.Open(cachePath)
+// getCachedImagePath returns the path of an image in the disk cache, or
+// an empty string if the image has no hash or there is no cache folder.
+func getCachedImagePath(hash string) string {
+	if hash == "" {
+		return ""
+	}
+	cacheDir, err := getImageCacheDir()
 	if err != nil {
-		return fmt.Errorf("failed to open cached image: %w", err)
+		return ""
+	}
+	return filepath.Join(cacheDir, hash+".jpg")
+}
+
+// readCachedImage returns an image from the disk cache, or nil if it is not
+// cached. Files that do not match their hash, for example after a crash
+// while writing, are removed and never returned.
+func (d *Database) readCachedImage(hash string) []byte {
+	cachePath := getCachedImagePath(hash)
+	if cachePath == "" {
+		return nil
 	}
-	defer func() {
-		if closeErr := file.Close(); closeErr != nil && err == nil {
-			err = fmt.Errorf("close failed: %w", closeErr)
-		}
-	}()
 
-	data, err := io.ReadAll(file)
+	data, err := readImageFile(cachePath, hash)
 	if err != nil {
-		return fmt.Errorf("failed to get cached image: %w", err)
+		_ = os.Remove(cachePath)
+		return nil
 	}
-	image.Data = data
-	return nil
+	return data
 }
 
-func (d *Database) storeCachedImage(image *image, cachePath string) {
-	if !d.existCachedImage(path.Join(imageCachePath, "softimdb")) {
-		err := os.Mkdir(path.Join(imageCachePath, "softimdb"), os.ModePerm)
-		if err != nil {
-			return
-		}
+// storeCachedImage stores an image in the disk cache. The cache is only an
+// optimization, so failures are ignored.
+func (d *Database) storeCachedImage(hash string, data []byte) {
+	cachePath := getCachedImagePath(hash)
+	if cachePath == "" {
+		return
+	}
+	if _, err := os.Stat(cachePath); err == nil {
+		return
+	}
+
+	_ = writeFileAtomic(cachePath, data)
+}
+
+// removeCachedImage removes an image, and the sizes that were made from
+// it, from the disk cache.
+func (d *Database) removeCachedImage(hash string) {
+	if cachePath := getCachedImagePath(hash); cachePath != "" {
+		_ = os.Remove(cachePath)
 	}
+	removeResizedImages(hash)
+}
 
-	file, err := os.Create(cachePath)
+// readImageFile reads an image file, and returns an error if the data does not match the hash.
+func readImageFile(imagePath, hash string) ([]byte, error) {
+	data, err := os.ReadFile(imagePath)
 	if err != nil {
-		return
+		return nil, err
+	}
+	if getImageHash(data) != hash {
+		return nil, fmt.Errorf("image file %s does not match its hash", imagePath)
+	}
+	return data, nil
+}
+
+// writeFileAtomic writes a file through a temporary file in the same folder,
+// so that a half written file is never read.
+func writeFileAtomic(filePath string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return err
 	}
-	defer func() {
-		if closeErr := file.Close(); closeErr != nil && err == nil {
-			err = fmt.Errorf("close failed: %w", closeErr)
-		}
-	}()
 
-	_, err = file.Write(image.Data)
+	file, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
 	if err != nil {
-		return
+		return err
 	}
+	_, writeErr := file.Write(data)
+	closeErr := file.Close()
+	if err := errors.Join(writeErr, closeErr); err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+	if err := os.Rename(file.Name(), filePath); err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+	return nil
 }
@@ -1,28 +1,88 @@
 package data
 
-// ImageCache represents an image cache that loads the images from the local filesystem.
-type ImageCache struct {
-	data map[int][]byte
+import (
+	"container/list"
+	"sync"
+)
+
+// ImageCache represents an in-memory image cache with a byte budget. When
+// the budget is exceeded, the least recently used images are evicted. It is
+// safe for concurrent use. Images are keyed by K, the image id for posters.
+type ImageCache[K comparable] struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	order    *list.List // Most recently used first, values are *imageCacheEntry[K]
+	entries  map[K]*list.Element
+}
+
+type imageCacheEntry[K comparable] struct {
+	id    K
+	image []byte
 }
 
-// imageCacheNew creates a new ImageCache.
-func imageCacheNew() *ImageCache {
-	return &ImageCache{data: make(map[int][]byte, 2000)}
+// imageCacheNew creates a new ImageCache that holds at most maxBytes of image data.
+func imageCacheNew[K comparable](maxBytes int64) *ImageCache[K] {
+	return &ImageCache[K]{maxBytes: maxBytes, order: list.New(), entries: make(map[K]*list.Element)}
 }
 
-// save saves the image to the cache.
-func (i *ImageCache) save(index int, image []byte) {
-	if i.load(index) != nil {
+// save saves the image to the cache, replacing any image with the same id.
+// Images that are larger than the budget are not cached.
+func (i *ImageCache[K]) save(id K, image []byte) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(id)
+	if int64(len(image)) > i.maxBytes {
 		return
 	}
 
-	i.data[index] = image
+	i.entries[id] = i.order.PushFront(&imageCacheEntry[K]{id: id, image: image})
+	i.size += int64(len(image))
+
+	for i.size > i.maxBytes {
+		i.remove(i.order.Back().Value.(*imageCacheEntry[K]).id)
+	}
 }
 
-// load loads the image from the cache.
-func (i *ImageCache) load(index int) []byte {
-	if value, ok := i.data[index]; ok {
-		return value
+// load loads the image from the cache, or returns nil if it is not cached.
+func (i *ImageCache[K]) load(id K) []byte {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	element, ok := i.entries[id]
+	if !ok {
+		return nil
+	}
+	i.order.MoveToFront(element)
+	return element.Value.(*imageCacheEntry[K]).image
+}
+
+// invalidate removes an image from the cache, after it has been replaced or deleted.
+func (i *ImageCache[K]) invalidate(id K) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(id)
+}
+
+// clear empties the cache.
+func (i *ImageCache[K]) clear() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.order.Init()
+	clear(i.entries)
+	i.size = 0
+}
+
+// remove removes an image from the cache. The caller must hold the lock.
+func (i *ImageCache[K]) remove(id K) {
+	element, ok := i.entries[id]
+	if !ok {
+		return
 	}
-	return nil
+	i.order.Remove(element)
+	delete(i.entries, id)
+	i.size -= int64(len(element.Value.(*imageCacheEntry[K]).image))
 }
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageCache_Eviction(t *testing.T) {
+	cache := imageCacheNew[int](10)
+
+	cache.save(1, []byte("1234"))
+	cache.save(2, []byte("1234"))
+	assert.NotNil(t, cache.load(1)) // 1 is now used more recently than 2
+
+	cache.save(3, []byte("1234"))
+	assert.Equal(t, []byte("1234"), cache.load(1))
+	assert.Nil(t, cache.load(2), "the least recently used image should be evicted")
+	assert.NotNil(t, cache.load(3))
+	assert.Equal(t, int64(8), cache.size)
+
+	cache.save(4, []byte("12345678901"))
+	assert.Nil(t, cache.load(4), "images larger than the budget should not be cached")
+	assert.NotNil(t, cache.load(1))
+}
+
+func TestImageCache_ReplaceAndInvalidate(t *testing.T) {
+	cache := imageCacheNew[int](100)
+
+	cache.save(1, []byte("old"))
+	cache.save(1, []byte("newer"))
+	assert.Equal(t, []byte("newer"), cache.load(1))
+	assert.Equal(t, int64(5), cache.size)
+
+	cache.invalidate(1)
+	assert.Nil(t, cache.load(1))
+	assert.Equal(t, int64(0), cache.size)
+
+	cache.save(2, []byte("2"))
+	cache.clear()
+	assert.Nil(t, cache.load(2))
+	assert.Equal(t, int64(0), cache.size)
+}
+
+func TestImageCache_Concurrent(t *testing.T) {
+	cache := imageCacheNew[int](50)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := 0; id < 100; id++ {
+				cache.save(id, []byte("12345"))
+				cache.load(id - 1)
+				if id%7 == 0 {
+					cache.invalidate(id)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, cache.size, int64(50))
+	assert.Equal(t, len(cache.entries), cache.order.Len())
+}
@@ -0,0 +1,171 @@
+package data
+
+import (
+	"bytes"
+	"fmt"
+	imagepkg "image"
+	"os"
+	"path/filepath"
+
+	"github.com/disintegration/imaging"
+)
+
+// ImageSize is a size that an image is shown in. The original image is kept
+// in the database, and the sizes are made from it when they are needed.
+type ImageSize int
+
+const (
+	// ImageSizeThumbnail fits the image in 270x150, for image galleries.
+	ImageSizeThumbnail ImageSize = iota
+	// ImageSizeCard crops the image to 190x280, the size of the movie cards.
+	ImageSizeCard
+	// ImageSizeLarge fits the image in 600x900, for detail views and exports.
+	ImageSizeLarge
+)
+
+// imageSizeInfo describes how an image is resized to an ImageSize. Cropped
+// images get exactly the given size, other images are fitted inside it and
+// are never enlarged.
+type imageSizeInfo struct {
+	name   string
+	width  int
+	height int
+	crop   bool
+}
+
+var imageSizes = map[ImageSize]imageSizeInfo{
+	ImageSizeThumbnail: {name: "thumbnail", width: 270, height: 150},
+	ImageSizeCard:      {name: "card", width: 190, height: 280, crop: true},
+	ImageSizeLarge:     {name: "large", width: 600, height: 900},
+}
+
+// resizedImageCacheBytes is the size of the in-memory cache of resized images.
+const resizedImageCacheBytes = 64 * 1024 * 1024
+
+// resizedImageCache holds the most recently used resized images, keyed by
+// size name and the hash of the original image.
+var resizedImageCache = imageCacheNew[string](resizedImageCacheBytes)
+
+// String returns the name of the image size.
+func (s ImageSize) String() string {
+	return imageSizes[s].name
+}
+
+// GetImageOfSize returns an image in the given size. Resized images are kept
+// in memory and in the disk cache, named by the hash of the original image,
+// so they are only made once. Images that already have the right size are
+// returned as they are.
+func GetImageOfSize(imageData []byte, size ImageSize) ([]byte, error) {
+	info, ok := imageSizes[size]
+	if !ok {
+		return nil, fmt.Errorf("unknown image size: %d", size)
+	}
+	if len(imageData) == 0 {
+		return nil, nil
+	}
+
+	hash := getImageHash(imageData)
+	key := info.name + "/" + hash
+	if data := resizedImageCache.load(key); data != nil {
+		return data, nil
+	}
+
+	config, _, err := imagepkg.DecodeConfig(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image size: %w", err)
+	}
+	if info.hasSize(config.Width, config.Height) {
+		return imageData, nil
+	}
+
+	cachePath := getResizedImagePath(info.name, hash)
+	if data := readResizedImage(cachePath); data != nil {
+		resizedImageCache.save(key, data)
+		return data, nil
+	}
+
+	data, err := resizeImage(imageData, info)
+	if err != nil {
+		return nil, err
+	}
+
+	resizedImageCache.save(key, data)
+	if cachePath != "" {
+		// The cache is only an optimization, so failures are ignored
+		_ = writeFileAtomic(cachePath, data)
+	}
+
+	return data, nil
+}
+
+// hasSize returns true if an image of the given size can be used as it is.
+func (i imageSizeInfo) hasSize(width, height int) bool {
+	if i.crop {
+		return width == i.width && height == i.height
+	}
+	return width <= i.width && height <= i.height
+}
+
+// resizeImage resizes an image and encodes it as a JPG image.
+func resizeImage(imageData []byte, info imageSizeInfo) ([]byte, error) {
+	img, err := imaging.Decode(bytes.NewReader(imageData), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	var resized *imagepkg.NRGBA
+	if info.crop {
+		resized = imaging.Fill(img, info.width, info.height, imaging.Center, imaging.Lanczos)
+	} else {
+		resized = imaging.Fit(img, info.width, info.height, imaging.Lanczos)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := imaging.Encode(buf, resized, imaging.JPEG, imaging.JPEGQuality(90)); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// getResizedImagePath returns the path of a resized image in the disk cache,
+// in a sub folder of the poster cache named by the size, or an empty string
+// if there is no cache folder.
+func getResizedImagePath(sizeName, hash string) string {
+	cacheDir, err := getImageCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cacheDir, sizeName, hash+".jpg")
+}
+
+// removeResizedImages removes the resized images that were made from an
+// image from the memory and disk caches.
+func removeResizedImages(hash string) {
+	if hash == "" {
+		return
+	}
+	for _, info := range imageSizes {
+		resizedImageCache.invalidate(info.name + "/" + hash)
+		if cachePath := getResizedImagePath(info.name, hash); cachePath != "" {
+			_ = os.Remove(cachePath)
+		}
+	}
+}
+
+// readResizedImage returns a resized image from the disk cache, or nil if it
+// is not cached or can not be read as an image.
+func readResizedImage(cachePath string) []byte {
+	if cachePath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil
+	}
+	if _, _, err := imagepkg.DecodeConfig(bytes.NewReader(data)); err != nil {
+		_ = os.Remove(cachePath)
+		return nil
+	}
+	return data
+}
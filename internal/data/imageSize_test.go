@@ -0,0 +1,117 @@
+package data
+
+import (
+	"bytes"
+	imagepkg "image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetImageOfSize(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	tests := []struct {
+		name       string
+		width      int
+		height     int
+		size       ImageSize
+		wantWidth  int
+		wantHeight int
+		unchanged  bool
+	}{
+		{"card from large poster", 1000, 1500, ImageSizeCard, 190, 280, false},
+		{"card from backdrop", 1920, 1080, ImageSizeCard, 190, 280, false},
+		{"card from card", 190, 280, ImageSizeCard, 190, 280, true},
+		{"thumbnail from poster", 1000, 1500, ImageSizeThumbnail, 100, 150, false},
+		{"thumbnail from backdrop", 1920, 1080, ImageSizeThumbnail, 266, 150, false},
+		{"large from large poster", 1000, 1500, ImageSizeLarge, 600, 900, false},
+		{"large is never enlarged", 190, 280, ImageSizeLarge, 190, 280, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := newTestImage(t, tt.width, tt.height)
+
+			got, err := GetImageOfSize(original, tt.size)
+			if !assert.NoError(t, err) {
+				return
+			}
+			width, height := getTestImageSize(t, got)
+			assert.Equal(t, tt.wantWidth, width)
+			assert.Equal(t, tt.wantHeight, height)
+
+			cachePath := getResizedImagePath(tt.size.String(), getImageHash(original))
+			if tt.unchanged {
+				assert.Equal(t, original, got)
+				assert.NoFileExists(t, cachePath)
+				return
+			}
+			assert.FileExists(t, cachePath)
+
+			// The second time the image comes from the disk cache
+			resizedImageCache.clear()
+			again, err := GetImageOfSize(original, tt.size)
+			assert.NoError(t, err)
+			assert.Equal(t, got, again)
+		})
+	}
+}
+
+func TestGetImageOfSize_Errors(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	got, err := GetImageOfSize(nil, ImageSizeCard)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	_, err = GetImageOfSize([]byte{1, 2, 3}, ImageSizeCard)
+	assert.Error(t, err)
+
+	_, err = GetImageOfSize(newTestImage(t, 10, 10), ImageSize(42))
+	assert.Error(t, err)
+}
+
+func TestGetImageOfSize_BrokenCacheFile(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	resizedImageCache.clear()
+
+	original := newTestImage(t, 400, 600)
+	cachePath := getResizedImagePath(ImageSizeCard.String(), getImageHash(original))
+	if err := os.MkdirAll(filepath.Dir(cachePath), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cachePath, []byte{9, 9}, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := GetImageOfSize(original, ImageSizeCard)
+	assert.NoError(t, err)
+	width, height := getTestImageSize(t, got)
+	assert.Equal(t, 190, width)
+	assert.Equal(t, 280, height)
+}
+
+func newTestImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	img := imaging.New(width, height, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+	if err := imaging.Encode(buf, img, imaging.JPEG); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func getTestImageSize(t *testing.T, data []byte) (int, int) {
+	t.Helper()
+
+	config, _, err := imagepkg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config.Width, config.Height
+}
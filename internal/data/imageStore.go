@@ -0,0 +1,235 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gorm.io/gorm"
+)
+
+// imageStore stores the data of the images. Every image has a row in the
+// image table, with its id and hash, that movies and packs refer to. The
+// store decides whether the data is kept in that row or somewhere else.
+type imageStore interface {
+	// save stores the data of a new image, before its row is inserted.
+	save(img *image) error
+	// load returns the data of the images, keyed by image id. Images
+	// without data are left out of the result.
+	load(db *gorm.DB, images []image) (map[int][]byte, error)
+	// remove removes the data of an image, after its row has been deleted.
+	remove(db *gorm.DB, img image) error
+}
+
+// imageStoreNew returns the file image store if an image folder is
+// configured, and the database image store otherwise.
+func imageStoreNew(imageDir string) imageStore {
+	if imageDir == "" {
+		return &databaseImageStore{}
+	}
+	return fileImageStoreNew(imageDir)
+}
+
+//
+// Database image store
+//
+
+// databaseImageStore keeps the data of the images as BLOBs in the image table.
+type databaseImageStore struct{}
+
+func (s *databaseImageStore) save(*image) error {
+	return nil
+}
+
+func (s *databaseImageStore) load(db *gorm.DB, images []image) (map[int][]byte, error) {
+	return loadImageData(db, getImageIds(images))
+}
+
+func (s *databaseImageStore) remove(*gorm.DB, image) error {
+	return nil
+}
+
+//
+// File image store
+//
+
+// fileImageStore keeps the data of the images as files in a folder, named by
+// their hash, so that an image that is used twice is only stored once. Images
+// that still have their data in the database, because they have not been
+// moved with MoveImagesToFiles yet, are read from the database.
+type fileImageStore struct {
+	dir string
+}
+
+func fileImageStoreNew(dir string) *fileImageStore {
+	return &fileImageStore{dir: dir}
+}
+
+// getPath returns the path of an image, in a sub folder named by the first
+// two characters of the hash, to keep the folders small.
+func (s *fileImageStore) getPath(hash string) string {
+	if len(hash) < 2 {
+		return filepath.Join(s.dir, hash+".jpg")
+	}
+	return filepath.Join(s.dir, hash[:2], hash+".jpg")
+}
+
+func (s *fileImageStore) save(img *image) error {
+	if img.Hash == "" {
+		img.Hash = getImageHash(img.Data)
+	}
+
+	if err := s.write(img.Hash, img.Data); err != nil {
+		return err
+	}
+	img.Data = nil
+
+	return nil
+}
+
+// write writes the data of an image to the store, unless it already is
+// there, and verifies that the file can be read back.
+func (s *fileImageStore) write(hash string, data []byte) error {
+	imagePath := s.getPath(hash)
+	if _, err := readImageFile(imagePath, hash); err == nil {
+		return nil
+	}
+
+	if err := writeFileAtomic(imagePath, data); err != nil {
+		return fmt.Errorf("failed to store image: %w", err)
+	}
+	if _, err := readImageFile(imagePath, hash); err != nil {
+		return fmt.Errorf("failed to verify stored image: %w", err)
+	}
+
+	return nil
+}
+
+func (s *fileImageStore) load(db *gorm.DB, images []image) (map[int][]byte, error) {
+	result := make(map[int][]byte, len(images))
+
+	var missingIds []int
+	for _, img := range images {
+		data, err := readImageFile(s.getPath(img.Hash), img.Hash)
+		if err != nil || img.Hash == "" {
+			missingIds = append(missingIds, img.Id)
+			continue
+		}
+		result[img.Id] = data
+	}
+
+	if len(missingIds) == 0 {
+		return result, nil
+	}
+
+	stored, err := loadImageData(db, missingIds)
+	if err != nil {
+		return nil, err
+	}
+	for id, data := range stored {
+		result[id] = data
+	}
+
+	return result, nil
+}
+
+func (s *fileImageStore) remove(db *gorm.DB, img image) error {
+	if img.Hash == "" {
+		return nil
+	}
+
+	// Keep the file if another image has the same content
+	var count int64
+	if err := db.Model(&image{}).Where("hash = ? AND id <> ?", img.Hash, img.Id).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count images: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if err := os.Remove(s.getPath(img.Hash)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove image file: %w", err)
+	}
+
+	return nil
+}
+
+// MoveImagesToFiles moves the images that are stored in the database to the
+// image folder, and clears them in the database when the files have been
+// verified. It returns the number of images that were moved. The progress
+// function, if any, is called after every image. It is not limited by the
+// query timeout, but stops when the context is cancelled.
+func (d *Database) MoveImagesToFiles(ctx context.Context, progress func(done, total int)) (int, error) {
+	store, ok := d.imageStore.(*fileImageStore)
+	if !ok {
+		return 0, fmt.Errorf("failed to move images: no image folder is configured")
+	}
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	var ids []int
+	if err := db.Model(&image{}).Where("image IS NOT NULL").Order("id").Pluck("id", &ids).Error; err != nil {
+		return 0, fmt.Errorf("failed to get images: %w", err)
+	}
+
+	// Load one image at a time, since all of them might not fit in memory
+	moved := 0
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return moved, fmt.Errorf("failed to move images: %w", err)
+		}
+
+		var img image
+		if err := db.Where("id = ?", id).First(&img).Error; err != nil {
+			return moved, fmt.Errorf("failed to get image %d: %w", id, err)
+		}
+
+		img.Hash = getImageHash(img.Data)
+		if err := store.write(img.Hash, img.Data); err != nil {
+			return moved, fmt.Errorf("failed to move image %d: %w", id, err)
+		}
+
+		updates := map[string]interface{}{"hash": img.Hash, "image": nil}
+		if err := db.Model(&image{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+			return moved, fmt.Errorf("failed to clear image %d: %w", id, err)
+		}
+
+		moved++
+		if progress != nil {
+			progress(moved, len(ids))
+		}
+	}
+
+	return moved, nil
+}
+
+// loadImageData loads the data of images that are stored in the database.
+func loadImageData(db *gorm.DB, imageIds []int) (map[int][]byte, error) {
+	result := make(map[int][]byte, len(imageIds))
+	if len(imageIds) == 0 {
+		return result, nil
+	}
+
+	var images []image
+	if err := db.Where("id IN ? AND image IS NOT NULL", imageIds).Find(&images).Error; err != nil {
+		return nil, fmt.Errorf("failed to get images: %w", err)
+	}
+	for _, img := range images {
+		result[img.Id] = img.Data
+	}
+
+	return result, nil
+}
+
+func getImageIds(images []image) []int {
+	ids := make([]int, 0, len(images))
+	for _, img := range images {
+		ids = append(ids, img.Id)
+	}
+	return ids
+}
@@ -0,0 +1,176 @@
+package data
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// readTestImage reads an image through the image store, skipping the memory and disk caches.
+func readTestImage(t *testing.T, d *Database, imageId int) []byte {
+	t.Helper()
+
+	d.imageCache.clear()
+	cacheDir, err := getImageCacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(cacheDir); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := d.getDatabase(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	images, err := d.readImages(db, []int{imageId})
+	if err != nil {
+		t.Fatalf("readImages() error = %v", err)
+	}
+	return images[imageId]
+}
+
+func TestDatabase_FileImageStore(t *testing.T) {
+	d := openTestDatabase(t)
+	store := fileImageStoreNew(t.TempDir())
+	d.imageStore = store
+
+	movies := insertTestMovies(t, d)
+	gladiator := movies[0]
+
+	db, err := d.getDatabase(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var img image
+	if err := db.First(&img, gladiator.ImageId).Error; err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, img.Data, "the data should not be stored in the database")
+	oldPath := store.getPath(img.Hash)
+	assert.FileExists(t, oldPath)
+	assert.Equal(t, []byte{1, 2, 3}, readTestImage(t, d, gladiator.ImageId))
+
+	// A poster that is shared by two movies is kept until both have deleted it
+	heat := movies[2]
+	if err := d.UpdateImage(t.Context(), heat, []byte{1, 2, 3}); err != nil {
+		t.Fatalf("UpdateImage() error = %v", err)
+	}
+	if err := d.UpdateImage(t.Context(), gladiator, []byte{4, 5, 6}); err != nil {
+		t.Fatalf("UpdateImage() error = %v", err)
+	}
+	assert.Equal(t, []byte{4, 5, 6}, readTestImage(t, d, gladiator.ImageId))
+
+	artwork, err := d.GetArtwork(t.Context(), gladiator)
+	if err != nil {
+		t.Fatalf("GetArtwork() error = %v", err)
+	}
+	assert.Equal(t, img.Id, artwork[1].ImageId)
+	if err := d.DeleteArtwork(t.Context(), gladiator, &artwork[1]); err != nil {
+		t.Fatalf("DeleteArtwork() error = %v", err)
+	}
+	assert.FileExists(t, oldPath)
+	assert.Equal(t, []byte{1, 2, 3}, readTestImage(t, d, heat.ImageId))
+
+	if err := d.deleteImage(db, heat); err != nil {
+		t.Fatalf("deleteImage() error = %v", err)
+	}
+	assert.NoFileExists(t, oldPath)
+}
+
+func TestDatabase_FileImageStoreRollback(t *testing.T) {
+	d := openTestDatabase(t)
+	store := fileImageStoreNew(t.TempDir())
+	d.imageStore = store
+	insertTestMovies(t, d)
+
+	pack, err := d.GetPack(t.Context(), "Alien")
+	if err != nil {
+		t.Fatalf("GetPack() error = %v", err)
+	}
+	if err := d.UpdatePackImage(t.Context(), pack, []byte{7, 8, 9}); err != nil {
+		t.Fatalf("UpdatePackImage() error = %v", err)
+	}
+	oldImageId := pack.ImageId
+	oldPath := store.getPath(getImageHash([]byte{7, 8, 9}))
+	assert.FileExists(t, oldPath)
+
+	// The old poster is deleted, and then inserting the new one fails
+	failCreate(t, d, "image")
+	err = d.UpdatePackImage(t.Context(), pack, []byte{4, 5, 6})
+	assert.Error(t, err)
+
+	assert.FileExists(t, oldPath, "the file of a poster is kept when the transaction is rolled back")
+	assert.Equal(t, []byte{7, 8, 9}, readTestImage(t, d, oldImageId))
+	assert.NoFileExists(t, store.getPath(getImageHash([]byte{4, 5, 6})),
+		"the file of a poster is removed when its insert is rolled back")
+}
+
+func TestDatabase_FileImageStoreDeleteRollback(t *testing.T) {
+	d := openTestDatabase(t)
+	store := fileImageStoreNew(t.TempDir())
+	d.imageStore = store
+	gladiator := insertTestMovies(t, d)[0]
+	imagePath := store.getPath(getImageHash([]byte{1, 2, 3}))
+
+	// The image is deleted, and then deleting the movie fails
+	db, err := d.getDatabase(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fail := func(tx *gorm.DB) {
+		if tx.Statement.Table == "movies" {
+			_ = tx.AddError(errors.New("delete from movies failed"))
+		}
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("test:fail_delete", fail); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Callback().Delete().Remove("test:fail_delete") })
+
+	assert.Error(t, d.DeleteMovie(t.Context(), t.TempDir(), gladiator))
+	assert.FileExists(t, imagePath, "the file of a poster is kept when the transaction is rolled back")
+	assert.Equal(t, []byte{1, 2, 3}, readTestImage(t, d, gladiator.ImageId))
+}
+
+func TestDatabase_MoveImagesToFiles(t *testing.T) {
+	d := openTestDatabase(t)
+	movies := insertTestMovies(t, d)
+	gladiator := movies[0]
+
+	_, err := d.MoveImagesToFiles(t.Context(), nil)
+	assert.Error(t, err, "moving images requires an image folder")
+
+	store := fileImageStoreNew(t.TempDir())
+	d.imageStore = store
+
+	var progress []int
+	moved, err := d.MoveImagesToFiles(t.Context(), func(done, total int) {
+		progress = append(progress, done, total)
+	})
+	if err != nil {
+		t.Fatalf("MoveImagesToFiles() error = %v", err)
+	}
+	assert.Equal(t, 1, moved)
+	assert.Equal(t, []int{1, 1}, progress)
+
+	db, err := d.getDatabase(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var img image
+	if err := db.First(&img, gladiator.ImageId).Error; err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, img.Data)
+	assert.FileExists(t, store.getPath(img.Hash))
+	assert.Equal(t, []byte{1, 2, 3}, readTestImage(t, d, gladiator.ImageId))
+
+	// Running it again does nothing
+	moved, err = d.MoveImagesToFiles(t.Context(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, moved)
+}
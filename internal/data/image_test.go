@@ -0,0 +1,90 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatabase_ImageDiskCache(t *testing.T) {
+	d := openTestDatabase(t)
+	movies := insertTestMovies(t, d)
+	gladiator := movies[0]
+
+	getImage := func() []byte {
+		t.Helper()
+
+		// Skip the memory cache, so that the images come from the disk cache or the database
+		d.imageCache.clear()
+		found, err := d.SearchMovies(t.Context(), "all", "gladiator", -1, "title asc")
+		if err != nil {
+			t.Fatalf("SearchMovies() error = %v", err)
+		}
+		if !assert.Len(t, found, 1) {
+			t.FailNow()
+		}
+		return found[0].Image
+	}
+
+	oldPath := getCachedImagePath(getImageHash([]byte{1, 2, 3}))
+	assert.Equal(t, []byte{1, 2, 3}, getImage())
+	assert.FileExists(t, oldPath)
+
+	// A file that does not match its hash is never served
+	if err := os.WriteFile(oldPath, []byte{9, 9}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte{1, 2, 3}, getImage())
+	cached, err := os.ReadFile(oldPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3}, cached)
+
+	// Images from before the hash column get their hash when they are read
+	db, err := d.getDatabase(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&image{}).Where("id = ?", gladiator.ImageId).Update("hash", "").Error; err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte{1, 2, 3}, getImage())
+	var img image
+	if err := db.First(&img, gladiator.ImageId).Error; err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, getImageHash([]byte{1, 2, 3}), img.Hash)
+
+	// A new poster is shown at once, and a deleted poster leaves the cache
+	if err := d.UpdateImage(t.Context(), gladiator, []byte{4, 5, 6}); err != nil {
+		t.Fatalf("UpdateImage() error = %v", err)
+	}
+	assert.Equal(t, []byte{4, 5, 6}, getImage())
+	assert.FileExists(t, getCachedImagePath(getImageHash([]byte{4, 5, 6})))
+
+	// The sizes made from the old poster are removed with it
+	var resizedPaths []string
+	for _, info := range imageSizes {
+		resizedPath := getResizedImagePath(info.name, getImageHash([]byte{1, 2, 3}))
+		if err := os.MkdirAll(filepath.Dir(resizedPath), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(resizedPath, []byte{7}, 0600); err != nil {
+			t.Fatal(err)
+		}
+		resizedPaths = append(resizedPaths, resizedPath)
+	}
+
+	artwork, err := d.GetArtwork(t.Context(), gladiator)
+	if err != nil {
+		t.Fatalf("GetArtwork() error = %v", err)
+	}
+	if err := d.DeleteArtwork(t.Context(), gladiator, &artwork[1]); err != nil {
+		t.Fatalf("DeleteArtwork() error = %v", err)
+	}
+	assert.NoFileExists(t, oldPath)
+	for _, resizedPath := range resizedPaths {
+		assert.NoFileExists(t, resizedPath)
+	}
+}
@@ -0,0 +1,438 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// importColumns are the movie columns that ImportLibrary updates on movies
+// that already exist. The path, the IMDb id and the size are left alone.
+var importColumns = []string{
+	"title", "sub_title", "story_line", "year", "imdb_url", "imdb_rating", "my_rating",
+	"length", "pack", "to_watch", "needsSubtitle",
+}
+
+// ImportReport describes what ImportLibrary changed, or would have changed in a dry run.
+type ImportReport struct {
+	DryRun       bool
+	Added        []string
+	Updated      []ImportUpdate
+	Unchanged    []string
+	Genres       []string
+	IgnoredPaths []string
+}
+
+// ImportUpdate is a movie that is updated by an import, and the fields that change.
+type ImportUpdate struct {
+	Title  string
+	Fields []string
+}
+
+// importTarget is a movie in the database that imported movies are matched against.
+type importTarget struct {
+	movie    *Movie
+	persons  []Person
+	viewings []Viewing
+}
+
+// ImportLibrary imports an export into the library. A movie is matched with
+// an existing movie by IMDb id, or by path if either has no IMDb id. Movies
+// that do not exist are added. Existing movies get the values of the export,
+// and the genres, tags, credits and poster of the export are added to them,
+// but nothing is removed. The viewings of the export are added on the days
+// that the movie has no viewing, or when the export only has the date the
+// movie was last watched, a viewing on that day. Importing the same export twice changes nothing
+// the second time. In a dry run nothing is changed, and the report tells
+// what the import would do.
+func ImportLibrary(ctx context.Context, r Repository, export *Export, dryRun bool) (*ImportReport, error) {
+	if export.Version < 1 || export.Version > exportVersion {
+		return nil, fmt.Errorf("failed to import: unsupported version %d", export.Version)
+	}
+
+	targets, err := getImportTargets(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{DryRun: dryRun}
+	for i := range export.Movies {
+		imported, err := getImportMovie(&export.Movies[i])
+		if err != nil {
+			return report, fmt.Errorf("failed to import %s: %w", export.Movies[i].Title, err)
+		}
+		viewings, err := getImportViewings(&export.Movies[i])
+		if err != nil {
+			return report, fmt.Errorf("failed to import %s: %w", export.Movies[i].Title, err)
+		}
+
+		target := findImportTarget(targets, imported)
+		if target == nil {
+			report.Added = append(report.Added, imported.Title)
+			if !dryRun {
+				if err := r.InsertMovie(ctx, imported); err != nil {
+					return report, fmt.Errorf("failed to import %s: %w", imported.Title, err)
+				}
+				if err := insertImportViewings(ctx, r, imported, viewings); err != nil {
+					return report, fmt.Errorf("failed to import %s: %w", imported.Title, err)
+				}
+			}
+			targets = append(targets, &importTarget{movie: imported, persons: imported.Persons, viewings: viewings})
+			continue
+		}
+
+		fields := getImportChanges(target, imported, viewings)
+		if len(fields) == 0 {
+			report.Unchanged = append(report.Unchanged, imported.Title)
+			continue
+		}
+		report.Updated = append(report.Updated, ImportUpdate{Title: imported.Title, Fields: fields})
+		if !dryRun {
+			if err := applyImport(ctx, r, target, imported, viewings, fields); err != nil {
+				return report, fmt.Errorf("failed to import %s: %w", imported.Title, err)
+			}
+		}
+	}
+
+	if err := importGenres(ctx, r, export, report); err != nil {
+		return report, err
+	}
+	if err := importIgnoredPaths(ctx, r, export, report); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// getImportTargets returns all the movies, including the trashed movies, so
+// that an import never adds a second movie with the same path.
+func getImportTargets(ctx context.Context, r Repository) ([]*importTarget, error) {
+	var movies []*Movie
+	for _, view := range []string{"all", "trash"} {
+		found, err := r.SearchMovies(ctx, view, "", -1, "id asc")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get movies: %w", err)
+		}
+		movies = append(movies, found...)
+	}
+
+	var targets []*importTarget
+	for _, movie := range movies {
+		persons, err := r.GetPersonsForMovie(ctx, movie)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get persons for %s: %w", movie.Title, err)
+		}
+		viewings, err := r.GetViewings(ctx, movie)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get viewings of %s: %w", movie.Title, err)
+		}
+		targets = append(targets, &importTarget{movie: movie, persons: persons, viewings: viewings})
+	}
+	return targets, nil
+}
+
+func findImportTarget(targets []*importTarget, movie *Movie) *importTarget {
+	for _, target := range targets {
+		if movie.ImdbID != "" && target.movie.ImdbID != "" {
+			if movie.ImdbID == target.movie.ImdbID {
+				return target
+			}
+			continue
+		}
+		if movie.MoviePath != "" && movie.MoviePath == target.movie.MoviePath {
+			return target
+		}
+	}
+	return nil
+}
+
+// getImportMovie returns a new movie with the values of an exported movie.
+// The watched at date is left out, since it follows the viewings of the movie.
+func getImportMovie(exported *ExportMovie) (*Movie, error) {
+	movie := &Movie{
+		Title: exported.Title, SubTitle: exported.SubTitle, StoryLine: exported.StoryLine, Year: exported.Year,
+		ImdbID: exported.ImdbId, ImdbUrl: exported.ImdbUrl, ImdbRating: exported.ImdbRating,
+		MyRating: exported.MyRating, Runtime: exported.Runtime, Size: exported.Size, MoviePath: exported.Path,
+		Pack: exported.Pack, ToWatch: exported.ToWatch, NeedsSubtitle: exported.NeedsSubtitle,
+		HasImage: len(exported.Poster) > 0, Image: exported.Poster,
+	}
+	for _, name := range exported.Genres {
+		movie.Genres = append(movie.Genres, Genre{Name: name})
+	}
+	for _, name := range exported.Tags {
+		movie.Tags = append(movie.Tags, Tag{Name: name})
+	}
+	for _, credit := range exported.Credits {
+		personType, err := parseExportPersonType(credit.Type)
+		if err != nil {
+			return nil, err
+		}
+		movie.Persons = append(movie.Persons, Person{
+			Name: credit.Name, ImdbId: credit.ImdbId, Type: personType,
+			Billing: credit.Billing, Character: credit.Character,
+		})
+	}
+	return movie, nil
+}
+
+// getImportViewings returns the viewings of an exported movie. An export
+// without viewings, like the CSV export, only has the date the movie was last
+// watched, which is imported as a viewing on that day.
+func getImportViewings(exported *ExportMovie) ([]Viewing, error) {
+	var viewings []Viewing
+	for _, viewing := range exported.Viewings {
+		viewings = append(viewings, Viewing{WatchedAt: viewing.WatchedAt, Rating: viewing.Rating, Note: viewing.Note})
+	}
+	if len(viewings) > 0 || exported.WatchedAt == "" {
+		return viewings, nil
+	}
+
+	watchedAt, err := time.ParseInLocation(exportDateFormat, exported.WatchedAt, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q: %w", exported.WatchedAt, err)
+	}
+	return []Viewing{{WatchedAt: watchedAt}}, nil
+}
+
+// getMissingViewings returns the imported viewings on days that the movie has no viewing.
+func getMissingViewings(stored, imported []Viewing) []Viewing {
+	watchedOn := map[string]bool{}
+	for _, viewing := range stored {
+		watchedOn[getViewingDay(viewing)] = true
+	}
+
+	var missing []Viewing
+	for _, viewing := range imported {
+		if !watchedOn[getViewingDay(viewing)] {
+			missing = append(missing, viewing)
+		}
+	}
+	return missing
+}
+
+func getViewingDay(viewing Viewing) string {
+	return viewing.WatchedAt.In(time.Local).Format(exportDateFormat)
+}
+
+// insertImportViewings adds viewings to a movie, which also sets its watched at date.
+func insertImportViewings(ctx context.Context, r Repository, movie *Movie, viewings []Viewing) error {
+	for _, viewing := range viewings {
+		if err := r.InsertViewing(ctx, movie, &viewing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getImportChanges returns the fields of an existing movie that an import changes.
+func getImportChanges(target *importTarget, imported *Movie, viewings []Viewing) []string {
+	var fields []string
+	for _, change := range getMovieChanges(target.movie, getImportedValues(target.movie, imported), importColumns) {
+		fields = append(fields, change.Field)
+	}
+	if len(getMissingViewings(target.viewings, viewings)) > 0 {
+		fields = append(fields, "viewings")
+	}
+	if len(getMissingGenres(target.movie, imported)) > 0 {
+		fields = append(fields, "genres")
+	}
+	if len(getMissingTags(target.movie, imported)) > 0 {
+		fields = append(fields, "tags")
+	}
+	if len(getMissingCredits(target.persons, imported)) > 0 {
+		fields = append(fields, "credits")
+	}
+	if imported.HasImage && !bytes.Equal(imported.Image, target.movie.Image) {
+		fields = append(fields, "poster")
+	}
+	return fields
+}
+
+// getImportedValues returns a copy of the stored movie, with the values of
+// the imported movie in the columns that an import updates.
+func getImportedValues(stored, imported *Movie) *Movie {
+	movie := *stored
+	movie.Title, movie.SubTitle, movie.StoryLine = imported.Title, imported.SubTitle, imported.StoryLine
+	movie.Year, movie.ImdbUrl, movie.ImdbRating = imported.Year, imported.ImdbUrl, imported.ImdbRating
+	movie.MyRating, movie.Runtime, movie.Pack = imported.MyRating, imported.Runtime, imported.Pack
+	movie.ToWatch, movie.NeedsSubtitle = imported.ToWatch, imported.NeedsSubtitle
+	return &movie
+}
+
+// applyImport updates an existing movie with the changed fields of an imported movie.
+func applyImport(ctx context.Context, r Repository, target *importTarget, imported *Movie, viewings []Viewing, fields []string) error {
+	movie := getImportedValues(target.movie, imported)
+	movie.Genres = getMissingGenres(target.movie, imported)
+	tags := getMissingTags(target.movie, imported)
+	movie.Tags = append(slices.Clone(target.movie.Tags), tags...)
+	if slices.ContainsFunc(fields, func(field string) bool { return slices.Contains(importColumns, field) }) ||
+		len(movie.Genres) > 0 || len(tags) > 0 {
+		if err := r.UpdateMovie(ctx, movie); err != nil {
+			return err
+		}
+	}
+
+	if credits := getMissingCredits(target.persons, imported); len(credits) > 0 {
+		movie.Persons = credits
+		if err := r.UpdateMoviePersons(ctx, movie); err != nil {
+			return err
+		}
+	}
+
+	if slices.Contains(fields, "poster") {
+		if err := r.UpdateImage(ctx, movie, imported.Image); err != nil {
+			return err
+		}
+	}
+
+	return insertImportViewings(ctx, r, movie, getMissingViewings(target.viewings, viewings))
+}
+
+func getMissingGenres(stored, imported *Movie) []Genre {
+	var missing []Genre
+	for _, genre := range imported.Genres {
+		if !slices.ContainsFunc(stored.Genres, func(g Genre) bool { return strings.EqualFold(g.Name, genre.Name) }) {
+			missing = append(missing, genre)
+		}
+	}
+	return missing
+}
+
+func getMissingTags(stored, imported *Movie) []Tag {
+	var missing []Tag
+	for _, tag := range imported.Tags {
+		if !slices.ContainsFunc(stored.Tags, func(t Tag) bool { return strings.EqualFold(t.Name, tag.Name) }) {
+			missing = append(missing, tag)
+		}
+	}
+	return missing
+}
+
+// getMissingCredits returns the imported credits that the movie does not have.
+// Persons are compared by IMDb id when both have one, otherwise by name.
+func getMissingCredits(stored []Person, imported *Movie) []Person {
+	var missing []Person
+	for _, credit := range imported.Persons {
+		found := slices.ContainsFunc(stored, func(p Person) bool {
+			if p.Type != credit.Type {
+				return false
+			}
+			if p.ImdbId != "" && credit.ImdbId != "" {
+				return p.ImdbId == credit.ImdbId
+			}
+			return strings.EqualFold(p.Name, credit.Name)
+		})
+		if !found {
+			missing = append(missing, credit)
+		}
+	}
+	return missing
+}
+
+// importGenres applies the private flags and aliases of the exported genres.
+// Genres that do not exist, and are not added by the movies of the import, are skipped.
+func importGenres(ctx context.Context, r Repository, export *Export, report *ImportReport) error {
+	genres, err := r.GetGenres(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get genres: %w", err)
+	}
+	aliases, err := r.GetGenreAliases(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get genre aliases: %w", err)
+	}
+
+	for _, exported := range export.Genres {
+		index := slices.IndexFunc(genres, func(g Genre) bool { return strings.EqualFold(g.Name, exported.Name) })
+		if index < 0 {
+			if report.DryRun && isImportedGenre(export, exported.Name) {
+				report.Genres = append(report.Genres, exported.Name)
+			}
+			continue
+		}
+		genre := &genres[index]
+
+		var missing []string
+		for _, name := range exported.Aliases {
+			if !slices.ContainsFunc(aliases, func(a GenreAlias) bool { return strings.EqualFold(a.Name, name) }) {
+				missing = append(missing, name)
+			}
+		}
+		if genre.IsPrivate == exported.IsPrivate && len(missing) == 0 {
+			continue
+		}
+		report.Genres = append(report.Genres, genre.Name)
+		if report.DryRun {
+			continue
+		}
+
+		if genre.IsPrivate != exported.IsPrivate {
+			if err := r.SetGenrePrivate(ctx, genre, exported.IsPrivate); err != nil {
+				return fmt.Errorf("failed to import genre %s: %w", genre.Name, err)
+			}
+		}
+		for _, name := range missing {
+			if err := r.InsertGenreAlias(ctx, &GenreAlias{Name: name, GenreId: genre.Id}); err != nil {
+				return fmt.Errorf("failed to import alias %s of genre %s: %w", name, genre.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isImportedGenre returns true if any movie of the export has the genre.
+func isImportedGenre(export *Export, name string) bool {
+	return slices.ContainsFunc(export.Movies, func(m ExportMovie) bool {
+		return slices.ContainsFunc(m.Genres, func(g string) bool { return strings.EqualFold(g, name) })
+	})
+}
+
+func importIgnoredPaths(ctx context.Context, r Repository, export *Export, report *ImportReport) error {
+	ignoredPaths, err := r.GetAllIgnoredPaths(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get ignored paths: %w", err)
+	}
+
+	for _, exported := range export.IgnoredPaths {
+		if slices.ContainsFunc(ignoredPaths, func(p *IgnoredPath) bool { return p.Path == exported.Path }) {
+			continue
+		}
+		report.IgnoredPaths = append(report.IgnoredPaths, exported.Path)
+		if report.DryRun {
+			continue
+		}
+
+		ignoredPath := &IgnoredPath{Path: exported.Path, IgnoreCompletely: exported.IgnoreCompletely}
+		if err := r.InsertIgnorePath(ctx, ignoredPath); err != nil {
+			return fmt.Errorf("failed to import ignored path %s: %w", exported.Path, err)
+		}
+		ignoredPaths = append(ignoredPaths, ignoredPath)
+	}
+
+	return nil
+}
+
+// String returns the report as text, with one line for each change.
+func (r *ImportReport) String() string {
+	var b strings.Builder
+	if r.DryRun {
+		b.WriteString("Dry run, nothing was changed\n")
+	}
+	for _, title := range r.Added {
+		fmt.Fprintf(&b, "+ %s\n", title)
+	}
+	for _, update := range r.Updated {
+		fmt.Fprintf(&b, "~ %s: %s\n", update.Title, strings.Join(update.Fields, ", "))
+	}
+	for _, name := range r.Genres {
+		fmt.Fprintf(&b, "~ genre %s\n", name)
+	}
+	for _, path := range r.IgnoredPaths {
+		fmt.Fprintf(&b, "+ ignored path %s\n", path)
+	}
+	fmt.Fprintf(&b, "%d added, %d updated, %d unchanged\n", len(r.Added), len(r.Updated), len(r.Unchanged))
+	return b.String()
+}
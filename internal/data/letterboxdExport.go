@@ -0,0 +1,100 @@
+package data
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// letterboxdCSVHeader is the header of Letterboxd's import format.
+var letterboxdCSVHeader = []string{"imdbID", "Title", "Year", "Directors", "Rating10", "WatchedDate", "Rewatch"}
+
+// WriteLetterboxdCSV writes the ratings and viewings of the movies in the
+// format that Letterboxd imports, one row per viewing, oldest first. A movie
+// that is rated but has no viewings gets one row without a date. Movies that
+// are neither rated nor watched are left out, since Letterboxd would log them
+// as watched. It returns the number of rows written.
+func WriteLetterboxdCSV(ctx context.Context, r Repository, w io.Writer) (int, error) {
+	movies, err := r.SearchMovies(ctx, "all", "", -1, "title asc")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get movies: %w", err)
+	}
+	movies, err = r.GetPersonsForMovies(ctx, movies)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get persons: %w", err)
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(letterboxdCSVHeader); err != nil {
+		return 0, fmt.Errorf("failed to write Letterboxd export: %w", err)
+	}
+
+	rows := 0
+	for _, movie := range movies {
+		viewings, err := r.GetViewings(ctx, movie)
+		if err != nil {
+			return rows, fmt.Errorf("failed to get viewings of %s: %w", movie.Title, err)
+		}
+		for _, record := range getLetterboxdRecords(movie, viewings) {
+			if err := writer.Write(record); err != nil {
+				return rows, fmt.Errorf("failed to write Letterboxd export: %w", err)
+			}
+			rows++
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return rows, fmt.Errorf("failed to write Letterboxd export: %w", err)
+	}
+	return rows, nil
+}
+
+// getLetterboxdRecords returns the rows of a movie, oldest viewing first. The
+// viewings are latest first, and every viewing but the oldest is a rewatch.
+func getLetterboxdRecords(movie *Movie, viewings []Viewing) [][]string {
+	var directors []string
+	for _, person := range movie.Persons {
+		if person.Type == Director {
+			directors = append(directors, person.Name)
+		}
+	}
+	record := func(rating int, watchedAt string, rewatch bool) []string {
+		return []string{
+			movie.ImdbID, movie.Title, strconv.Itoa(movie.Year), strings.Join(directors, ", "),
+			formatLetterboxdRating(rating), watchedAt, strconv.FormatBool(rewatch),
+		}
+	}
+
+	if len(viewings) == 0 {
+		if movie.MyRating == 0 {
+			return nil
+		}
+		return [][]string{record(movie.MyRating, "", false)}
+	}
+
+	var records [][]string
+	for i, viewing := range slices.Backward(viewings) {
+		rating := viewing.Rating
+		// The latest viewing gets the current rating, if it was not rated then
+		if i == 0 && rating == 0 {
+			rating = movie.MyRating
+		}
+		watchedAt := viewing.WatchedAt.In(time.Local).Format(ratingDateFormat)
+		records = append(records, record(rating, watchedAt, i < len(viewings)-1))
+	}
+	return records
+}
+
+// formatLetterboxdRating converts my rating of one to five to a ten point rating.
+func formatLetterboxdRating(rating int) string {
+	if rating == 0 {
+		return ""
+	}
+	return strconv.Itoa(rating * 2)
+}
@@ -0,0 +1,1854 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MemoryDatabase is an in-memory implementation of Repository. It has the
+// same semantics as Database, including view filtering and search prefixes,
+// but nothing is persisted, which makes it useful in tests and demos. The
+// contexts are ignored, since nothing blocks.
+type MemoryDatabase struct {
+	mu sync.Mutex
+
+	movies       map[int]*Movie
+	genres       map[int]*Genre
+	genreAliases map[int]*GenreAlias
+	movieGenres  []MovieGenre
+	persons      map[int]*Person
+	moviePersons []MoviePerson
+	tags         map[int]*Tag
+	movieTags    []MovieTag
+	packs        map[int]*Pack
+	artwork      map[int]*Artwork
+	images       map[int][]byte
+	ignoredPaths map[int]*IgnoredPath
+	viewings     map[int]*Viewing
+	history      []MovieChange
+
+	lastMovieId, lastGenreId, lastGenreAliasId, lastTagId, lastPackId, lastArtworkId, lastPersonId, lastImageId, lastIgnoredPathId, lastViewingId, lastChangeId int
+}
+
+// MemoryDatabaseNew creates a new, empty MemoryDatabase.
+func MemoryDatabaseNew() *MemoryDatabase {
+	return &MemoryDatabase{
+		movies:       make(map[int]*Movie),
+		genres:       make(map[int]*Genre),
+		genreAliases: make(map[int]*GenreAlias),
+		tags:         make(map[int]*Tag),
+		packs:        make(map[int]*Pack),
+		artwork:      make(map[int]*Artwork),
+		persons:      make(map[int]*Person),
+		images:       make(map[int][]byte),
+		ignoredPaths: make(map[int]*IgnoredPath),
+		viewings:     make(map[int]*Viewing),
+	}
+}
+
+// Migrate does nothing, since a MemoryDatabase is always up to date.
+func (m *MemoryDatabase) Migrate(ctx context.Context) error {
+	return nil
+}
+
+// CloseDatabase does nothing, since there is no connection to close.
+func (m *MemoryDatabase) CloseDatabase() {}
+
+//
+// Movies
+//
+
+// SearchMovies returns all movies that matches the search criteria.
+func (m *MemoryDatabase) SearchMovies(ctx context.Context, currentView string, searchFor string, genreId int, orderBy string) ([]*Movie, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if currentView == "packs" && orderBy == "title asc" {
+		orderBy = "pack asc, pack_position asc, " + orderBy
+	}
+
+	compare, err := getMemoryOrder(orderBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	search, err := ParseQuery(searchFor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse search: %w", err)
+	}
+
+	matchView := getViewMatcher(currentView)
+	// Trashed movies are only shown in the trash view
+	showTrashed := currentView == "trash"
+
+	var movies []*Movie
+	for _, movie := range m.getMoviesById() {
+		if genreId != -1 && !m.hasMovieGenre(movie.Id, genreId) {
+			continue
+		}
+		if !search.match(m, movie) || !matchView(movie) || movie.TrashedAt.Valid != showTrashed {
+			continue
+		}
+
+		result := copyMovie(movie)
+		result.Genres = m.getGenresForMovie(movie.Id)
+		result.Tags = m.getTagsForMovie(movie.Id)
+		if img, ok := m.images[movie.ImageId]; ok && movie.ImageId > 0 {
+			result.Image = img
+			result.HasImage = true
+		}
+		movies = append(movies, result)
+	}
+
+	slices.SortStableFunc(movies, compare)
+
+	return movies, nil
+}
+
+// GetAllMoviePaths returns a list of all the movie paths.
+func (m *MemoryDatabase) GetAllMoviePaths(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var paths []string
+	for _, movie := range m.getMoviesById() {
+		paths = append(paths, movie.MoviePath)
+	}
+	return paths, nil
+}
+
+// GetAllMovieTitles returns a list of all the movie titles.
+func (m *MemoryDatabase) GetAllMovieTitles(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var titles []string
+	for _, movie := range m.getMoviesById() {
+		if movie.SubTitle != "" {
+			titles = append(titles, fmt.Sprintf("%s (%s)", movie.Title, movie.SubTitle))
+		} else {
+			titles = append(titles, movie.Title)
+		}
+	}
+	return titles, nil
+}
+
+// InsertMovie adds a new movie, including its image, genres and persons.
+func (m *MemoryDatabase) InsertMovie(ctx context.Context, movie *Movie) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Insert image
+	if movie.HasImage && len(movie.Image) > 0 {
+		m.lastImageId++
+		m.images[m.lastImageId] = movie.Image
+		movie.ImageId = m.lastImageId
+	}
+
+	m.lastMovieId++
+	movie.Id = m.lastMovieId
+	if err := m.assignPack(movie); err != nil {
+		return fmt.Errorf("failed to get or insert pack: %w", err)
+	}
+	m.movies[movie.Id] = copyMovie(movie)
+	if movie.ImageId > 0 {
+		m.lastArtworkId++
+		m.artwork[m.lastArtworkId] = &Artwork{Id: m.lastArtworkId, MovieId: movie.Id, ImageId: movie.ImageId, Kind: ArtworkPoster, IsPrimary: true}
+	}
+	m.recordChanges(ctx, MovieChange{MovieId: movie.Id, Field: historyFieldCreated, NewValue: movie.Title})
+
+	// Handle genres
+	for i := range movie.Genres {
+		genre, err := m.getOrInsertGenre(&movie.Genres[i])
+		if err != nil {
+			return fmt.Errorf("failed to get or create movie genre: %w", err)
+		}
+
+		if err := m.insertMovieGenre(ctx, movie, genre); err != nil {
+			return fmt.Errorf("failed to insert movie genre id: %w", err)
+		}
+	}
+
+	// Handle persons
+	for _, person := range movie.Persons {
+		p := m.getOrInsertPerson(&person)
+		m.insertMoviePerson(ctx, movie, p, &person)
+	}
+
+	// Handle tags
+	if len(movie.Tags) > 0 {
+		if err := m.setMovieTags(ctx, movie, movie.Tags); err != nil {
+			return fmt.Errorf("failed to insert movie tags: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// UpdateMovie updates a movie and adds any new genres. The tags of the movie
+// are replaced with movie.Tags, unless it is nil.
+func (m *MemoryDatabase) UpdateMovie(ctx context.Context, movie *Movie) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.movies[movie.Id]
+	if !ok {
+		return fmt.Errorf("failed to get movie: %w", gorm.ErrRecordNotFound)
+	}
+
+	if err := m.assignPack(movie); err != nil {
+		return fmt.Errorf("failed to get or insert pack: %w", err)
+	}
+
+	before := *stored
+	stored.Title = movie.Title
+	stored.SubTitle = movie.SubTitle
+	stored.StoryLine = movie.StoryLine
+	stored.ImdbRating = movie.ImdbRating
+	stored.ImdbUrl = movie.ImdbUrl
+	stored.Year = movie.Year
+	stored.MyRating = movie.MyRating
+	stored.ToWatch = movie.ToWatch
+	stored.ImageId = movie.ImageId
+	stored.Pack = movie.Pack
+	stored.PackId = movie.PackId
+	stored.PackPosition = movie.PackPosition
+	stored.NeedsSubtitle = movie.NeedsSubtitle
+	stored.Runtime = movie.Runtime
+	if movie.WatchedAt.Valid {
+		stored.WatchedAt = movie.WatchedAt
+	}
+	m.recordChanges(ctx, getMovieChanges(&before, stored, slices.Sorted(maps.Keys(getMovieUpdates(movie))))...)
+
+	// Handle genres
+	for i := range movie.Genres {
+		genre, err := m.getOrInsertGenre(&movie.Genres[i])
+		if err != nil {
+			return fmt.Errorf("failed to get or insert movie genre: %w", err)
+		}
+
+		if !m.hasMovieGenre(movie.Id, genre.Id) {
+			_ = m.insertMovieGenre(ctx, movie, genre)
+		}
+	}
+
+	if movie.Tags != nil {
+		return m.setMovieTags(ctx, movie, movie.Tags)
+	}
+	return nil
+}
+
+// UpdateWatchedAt adds a viewing of the movie with the current date and time.
+func (m *MemoryDatabase) UpdateWatchedAt(ctx context.Context, movie *Movie) error {
+	viewing := &Viewing{WatchedAt: time.Now(), Rating: movie.MyRating}
+
+	if err := m.InsertViewing(ctx, movie, viewing); err != nil {
+		return fmt.Errorf("failed to update watched_at : %w", err)
+	}
+
+	return nil
+}
+
+// UpdateMoviePersons update a movie with its directors, writers and actors.
+func (m *MemoryDatabase) UpdateMoviePersons(ctx context.Context, movie *Movie) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range movie.Persons {
+		person := m.getOrInsertPerson(&movie.Persons[i])
+		m.insertMoviePerson(ctx, movie, person, &movie.Persons[i])
+	}
+
+	return nil
+}
+
+// DeleteMovie removes a movie, and its folder under rootDir.
+func (m *MemoryDatabase) DeleteMovie(ctx context.Context, rootDir string, movie *Movie) error {
+	m.mu.Lock()
+	delete(m.images, movie.ImageId)
+	for id, artwork := range m.artwork {
+		if artwork.MovieId == movie.Id {
+			delete(m.images, artwork.ImageId)
+			delete(m.artwork, id)
+		}
+	}
+	m.movieGenres = slices.DeleteFunc(m.movieGenres, func(mg MovieGenre) bool {
+		return mg.MovieId == movie.Id
+	})
+	m.moviePersons = slices.DeleteFunc(m.moviePersons, func(mp MoviePerson) bool {
+		return mp.MovieId == movie.Id
+	})
+	m.movieTags = slices.DeleteFunc(m.movieTags, func(mt MovieTag) bool {
+		return mt.MovieId == movie.Id
+	})
+	for id, viewing := range m.viewings {
+		if viewing.MovieId == movie.Id {
+			delete(m.viewings, id)
+		}
+	}
+	m.history = slices.DeleteFunc(m.history, func(c MovieChange) bool {
+		return c.MovieId == movie.Id
+	})
+	delete(m.movies, movie.Id)
+	m.mu.Unlock()
+
+	moviePath := path.Join(rootDir, movie.MoviePath)
+	return os.RemoveAll(moviePath)
+}
+
+// TrashMovie moves the movie folder from rootDir into trashDir, and marks the movie as trashed.
+func (m *MemoryDatabase) TrashMovie(ctx context.Context, rootDir, trashDir string, movie *Movie) error {
+	if err := moveToTrash(rootDir, trashDir, movie); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := *movie
+	movie.TrashedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	if stored, ok := m.movies[movie.Id]; ok {
+		stored.TrashedAt = movie.TrashedAt
+	}
+	m.recordChanges(ctx, getMovieChanges(&before, movie, []string{"trashed_at"})...)
+
+	return nil
+}
+
+// RestoreMovie moves a trashed movie's folder back from trashDir to rootDir.
+func (m *MemoryDatabase) RestoreMovie(ctx context.Context, rootDir, trashDir string, movie *Movie) error {
+	if err := restoreFromTrash(rootDir, trashDir, movie); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := *movie
+	movie.TrashedAt = sql.NullTime{}
+	if stored, ok := m.movies[movie.Id]; ok {
+		stored.TrashedAt = movie.TrashedAt
+	}
+	m.recordChanges(ctx, getMovieChanges(&before, movie, []string{"trashed_at"})...)
+
+	return nil
+}
+
+// EmptyTrash permanently deletes the movies that were trashed more than olderThan ago.
+func (m *MemoryDatabase) EmptyTrash(ctx context.Context, trashDir string, olderThan time.Duration) (int, error) {
+	m.mu.Lock()
+	var trashed []*Movie
+	for _, movie := range m.getMoviesById() {
+		if movie.TrashedAt.Valid {
+			trashed = append(trashed, copyMovie(movie))
+		}
+	}
+	m.mu.Unlock()
+
+	deleted := 0
+	for _, movie := range getExpiredMovies(trashed, olderThan) {
+		// The folder has been moved to the trash, so delete it from there
+		movie.MoviePath = filepath.Base(getTrashPath(trashDir, movie))
+		if err := m.DeleteMovie(ctx, trashDir, movie); err != nil {
+			return deleted, fmt.Errorf("failed to delete movie (%d: %s): %w", movie.Id, movie.Title, err)
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// SetProcessed sets the movie as processed.
+func (m *MemoryDatabase) SetProcessed(ctx context.Context, movie *Movie) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if stored, ok := m.movies[movie.Id]; ok {
+		before := *stored
+		stored.Processed = true
+		m.recordChanges(ctx, getMovieChanges(&before, stored, []string{"processed"})...)
+	}
+	movie.Processed = true
+
+	return nil
+}
+
+// UpdateImage adds a new poster to a movie, and makes it the primary poster.
+func (m *MemoryDatabase) UpdateImage(ctx context.Context, movie *Movie, imageData []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	artwork := &Artwork{Kind: ArtworkPoster, Image: imageData}
+	if err := m.insertArtwork(ctx, movie, artwork); err != nil {
+		return err
+	}
+	m.setPrimaryArtwork(ctx, movie, artwork)
+
+	return nil
+}
+
+//
+// Artwork
+//
+
+// GetArtwork returns the artwork of a movie, sorted by kind with the primary image first.
+func (m *MemoryDatabase) GetArtwork(ctx context.Context, movie *Movie) ([]Artwork, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []Artwork
+	for _, id := range sortedKeys(m.artwork) {
+		if artwork := m.artwork[id]; artwork.MovieId == movie.Id {
+			a := *artwork
+			a.Image = m.images[a.ImageId]
+			result = append(result, a)
+		}
+	}
+	sortArtwork(result)
+
+	return result, nil
+}
+
+// InsertArtwork adds an image to the artwork of a movie.
+func (m *MemoryDatabase) InsertArtwork(ctx context.Context, movie *Movie, artwork *Artwork) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insertArtwork(ctx, movie, artwork)
+}
+
+// SetPrimaryArtwork makes an image the primary one of its kind.
+func (m *MemoryDatabase) SetPrimaryArtwork(ctx context.Context, movie *Movie, artwork *Artwork) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setPrimaryArtwork(ctx, movie, artwork)
+	return nil
+}
+
+// DeleteArtwork deletes an image from the artwork of a movie.
+func (m *MemoryDatabase) DeleteArtwork(ctx context.Context, movie *Movie, artwork *Artwork) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.artwork[artwork.Id]
+	if !ok || stored.MovieId != movie.Id {
+		return fmt.Errorf("failed to get artwork: artwork %d does not exist", artwork.Id)
+	}
+
+	delete(m.artwork, stored.Id)
+	delete(m.images, stored.ImageId)
+	if !stored.IsPrimary {
+		return nil
+	}
+
+	for _, id := range sortedKeys(m.artwork) {
+		if next := m.artwork[id]; next.MovieId == movie.Id && next.Kind == stored.Kind {
+			m.setPrimaryArtwork(ctx, movie, next)
+			return nil
+		}
+	}
+	if stored.Kind == ArtworkPoster {
+		m.setMovieImage(ctx, movie, 0)
+	}
+	return nil
+}
+
+// insertArtwork adds an image to the artwork of a movie. The caller must hold the lock.
+func (m *MemoryDatabase) insertArtwork(ctx context.Context, movie *Movie, artwork *Artwork) error {
+	if !slices.Contains(ArtworkKinds, artwork.Kind) {
+		return fmt.Errorf("unknown artwork kind: %s", artwork.Kind)
+	}
+
+	hasPrimary := false
+	for _, a := range m.artwork {
+		if a.MovieId == movie.Id && a.Kind == artwork.Kind && a.IsPrimary {
+			hasPrimary = true
+		}
+	}
+
+	m.lastImageId++
+	m.images[m.lastImageId] = artwork.Image
+	m.lastArtworkId++
+	artwork.Id = m.lastArtworkId
+	artwork.MovieId = movie.Id
+	artwork.ImageId = m.lastImageId
+	artwork.IsPrimary = false
+	stored := *artwork
+	stored.Image = nil
+	m.artwork[artwork.Id] = &stored
+
+	if !hasPrimary {
+		m.setPrimaryArtwork(ctx, movie, artwork)
+	}
+	return nil
+}
+
+// setPrimaryArtwork marks an image as the primary one of its kind. The caller must hold the lock.
+func (m *MemoryDatabase) setPrimaryArtwork(ctx context.Context, movie *Movie, artwork *Artwork) {
+	for _, a := range m.artwork {
+		if a.MovieId == movie.Id && a.Kind == artwork.Kind {
+			a.IsPrimary = a.Id == artwork.Id
+		}
+	}
+	artwork.IsPrimary = true
+
+	if artwork.Kind == ArtworkPoster && movie.ImageId != artwork.ImageId {
+		m.setMovieImage(ctx, movie, artwork.ImageId)
+	}
+}
+
+// setMovieImage sets the image of a movie. The caller must hold the lock.
+func (m *MemoryDatabase) setMovieImage(ctx context.Context, movie *Movie, imageId int) {
+	before := *movie
+	movie.ImageId = imageId
+	movie.Image = m.images[imageId]
+	movie.HasImage = imageId > 0
+
+	if stored, ok := m.movies[movie.Id]; ok {
+		stored.ImageId = imageId
+	}
+	m.recordChanges(ctx, getMovieChanges(&before, movie, []string{"image_id"})...)
+}
+
+//
+// Genres
+//
+
+// GetGenres returns all genres.
+func (m *MemoryDatabase) GetGenres(ctx context.Context) ([]Genre, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var genres []Genre
+	for _, id := range sortedKeys(m.genres) {
+		genres = append(genres, *m.genres[id])
+	}
+	return genres, nil
+}
+
+// InsertMovieGenre connects a genre to a movie.
+func (m *MemoryDatabase) InsertMovieGenre(ctx context.Context, movie *Movie, genre *Genre) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insertMovieGenre(ctx, movie, genre)
+}
+
+// RemoveMovieGenre removes a genre association from a movie.
+func (m *MemoryDatabase) RemoveMovieGenre(ctx context.Context, movie *Movie, genre *Genre) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.hasMovieGenre(movie.Id, genre.Id) {
+		return nil
+	}
+
+	m.movieGenres = slices.DeleteFunc(m.movieGenres, func(mg MovieGenre) bool {
+		return mg.MovieId == movie.Id && mg.GenreId == genre.Id
+	})
+	m.recordChanges(ctx, MovieChange{MovieId: movie.Id, Field: historyFieldGenre, OldValue: genre.Name})
+	return nil
+}
+
+// GetGenreMovieCounts returns the number of movies that have each genre, keyed by genre id.
+func (m *MemoryDatabase) GetGenreMovieCounts(ctx context.Context) (map[int]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[int]int)
+	for _, mg := range m.movieGenres {
+		counts[mg.GenreId]++
+	}
+	return counts, nil
+}
+
+// RenameGenre renames a genre, and keeps the old name as an alias.
+func (m *MemoryDatabase) RenameGenre(ctx context.Context, genre *Genre, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("genre name cannot be empty")
+	}
+	if existing := m.getGenreByName(name); existing != nil && existing.Id != genre.Id {
+		return fmt.Errorf("failed to rename genre %s: %w", genre.Name, ErrGenreExists)
+	}
+	stored, ok := m.genres[genre.Id]
+	if !ok {
+		return fmt.Errorf("failed to rename genre: genre %d does not exist", genre.Id)
+	}
+
+	m.deleteGenreAliases(func(a *GenreAlias) bool { return strings.EqualFold(a.Name, name) })
+	oldName := stored.Name
+	stored.Name = name
+	genre.Name = name
+
+	if !strings.EqualFold(oldName, name) {
+		return m.insertGenreAlias(&GenreAlias{Name: oldName, GenreId: genre.Id})
+	}
+	return nil
+}
+
+// MergeGenres moves the movies of the duplicates to the survivor, and deletes the duplicates.
+func (m *MemoryDatabase) MergeGenres(ctx context.Context, survivor *Genre, duplicates []*Genre) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, duplicate := range duplicates {
+		if duplicate.Id == survivor.Id {
+			continue
+		}
+
+		for i, mg := range m.movieGenres {
+			if mg.GenreId == duplicate.Id && !m.hasMovieGenre(mg.MovieId, survivor.Id) {
+				m.movieGenres[i].GenreId = survivor.Id
+			}
+		}
+		m.movieGenres = slices.DeleteFunc(m.movieGenres, func(mg MovieGenre) bool {
+			return mg.GenreId == duplicate.Id
+		})
+
+		for _, alias := range m.genreAliases {
+			if alias.GenreId == duplicate.Id {
+				alias.GenreId = survivor.Id
+			}
+		}
+
+		delete(m.genres, duplicate.Id)
+		if strings.EqualFold(duplicate.Name, survivor.Name) {
+			continue
+		}
+		if err := m.insertGenreAlias(&GenreAlias{Name: duplicate.Name, GenreId: survivor.Id}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteGenre deletes a genre and its aliases, if no movie has the genre.
+func (m *MemoryDatabase) DeleteGenre(ctx context.Context, genre *Genre) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, mg := range m.movieGenres {
+		if mg.GenreId == genre.Id {
+			count++
+		}
+	}
+	if count > 0 {
+		return fmt.Errorf("failed to delete genre %s (%d movies): %w", genre.Name, count, ErrGenreInUse)
+	}
+
+	m.deleteGenreAliases(func(a *GenreAlias) bool { return a.GenreId == genre.Id })
+	delete(m.genres, genre.Id)
+	return nil
+}
+
+// SetGenrePrivate sets whether a genre is private.
+func (m *MemoryDatabase) SetGenrePrivate(ctx context.Context, genre *Genre, isPrivate bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.genres[genre.Id]
+	if !ok {
+		return fmt.Errorf("failed to update genre: genre %d does not exist", genre.Id)
+	}
+	stored.IsPrivate = isPrivate
+	genre.IsPrivate = isPrivate
+	return nil
+}
+
+// GetGenreAliases returns all genre aliases, ordered by name.
+func (m *MemoryDatabase) GetGenreAliases(ctx context.Context) ([]GenreAlias, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var aliases []GenreAlias
+	for _, id := range sortedKeys(m.genreAliases) {
+		aliases = append(aliases, *m.genreAliases[id])
+	}
+	slices.SortStableFunc(aliases, func(a, b GenreAlias) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return aliases, nil
+}
+
+// InsertGenreAlias adds an alias for a genre.
+func (m *MemoryDatabase) InsertGenreAlias(ctx context.Context, alias *GenreAlias) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insertGenreAlias(alias)
+}
+
+// DeleteGenreAlias deletes a genre alias.
+func (m *MemoryDatabase) DeleteGenreAlias(ctx context.Context, alias *GenreAlias) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.genreAliases, alias.Id)
+	return nil
+}
+
+//
+// Packs
+//
+
+// GetPacks returns all packs, ordered by name, without their posters.
+func (m *MemoryDatabase) GetPacks(ctx context.Context) ([]Pack, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var packs []Pack
+	for _, id := range sortedKeys(m.packs) {
+		pack := *m.packs[id]
+		pack.Image = nil
+		packs = append(packs, pack)
+	}
+	slices.SortStableFunc(packs, func(a, b Pack) int {
+		return compareFold(a.Name, b.Name)
+	})
+	return packs, nil
+}
+
+// GetPack returns a pack, including its poster, by name, or nil if the pack does not exist.
+func (m *MemoryDatabase) GetPack(ctx context.Context, name string) (*Pack, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pack := m.getPackByName(name)
+	if pack == nil {
+		return nil, nil
+	}
+	result := *pack
+	result.Image = m.images[pack.ImageId]
+	return &result, nil
+}
+
+// GetPackMovies returns the movies in a pack, in the order of the pack.
+func (m *MemoryDatabase) GetPackMovies(ctx context.Context, pack *Pack) ([]*Movie, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var movies []*Movie
+	for _, movie := range m.getMoviesById() {
+		if movie.PackId == pack.Id {
+			movies = append(movies, copyMovie(movie))
+		}
+	}
+	slices.SortStableFunc(movies, func(a, b *Movie) int {
+		if c := cmp.Compare(a.PackPosition, b.PackPosition); c != 0 {
+			return c
+		}
+		return compareFold(a.Title, b.Title)
+	})
+	return movies, nil
+}
+
+// InsertPack inserts a new pack.
+func (m *MemoryDatabase) InsertPack(ctx context.Context, pack *Pack) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insertPack(pack)
+}
+
+// UpdatePack updates the name and description of a pack, and renames the movies in the pack.
+func (m *MemoryDatabase) UpdatePack(ctx context.Context, pack *Pack) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pack.Name = strings.TrimSpace(pack.Name)
+	if pack.Name == "" {
+		return fmt.Errorf("pack name cannot be empty")
+	}
+	if existing := m.getPackByName(pack.Name); existing != nil && existing.Id != pack.Id {
+		return fmt.Errorf("failed to rename pack to %s: %w", pack.Name, ErrPackExists)
+	}
+	stored, ok := m.packs[pack.Id]
+	if !ok {
+		return fmt.Errorf("failed to update pack: pack %d does not exist", pack.Id)
+	}
+
+	stored.Name, stored.Description = pack.Name, pack.Description
+	m.setPackNameForMovies(ctx, pack.Id, pack.Name)
+	return nil
+}
+
+// DeletePack deletes a pack and its poster, and removes the movies from the pack.
+func (m *MemoryDatabase) DeletePack(ctx context.Context, pack *Pack) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setPackNameForMovies(ctx, pack.Id, "")
+	for _, movie := range m.movies {
+		if movie.PackId == pack.Id {
+			movie.PackId, movie.PackPosition = 0, 0
+		}
+	}
+	delete(m.images, pack.ImageId)
+	delete(m.packs, pack.Id)
+	return nil
+}
+
+// SetPackOrder sets the order of the movies in a pack.
+func (m *MemoryDatabase) SetPackOrder(ctx context.Context, pack *Pack, movies []*Movie) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, movie := range movies {
+		if stored, ok := m.movies[movie.Id]; !ok || stored.PackId != pack.Id {
+			return fmt.Errorf("failed to update pack position: %s is not in the pack %s", movie.Title, pack.Name)
+		}
+	}
+	for i, movie := range movies {
+		m.movies[movie.Id].PackPosition = i + 1
+		movie.PackPosition = i + 1
+	}
+	return nil
+}
+
+// UpdatePackImage replaces the poster of a pack.
+func (m *MemoryDatabase) UpdatePackImage(ctx context.Context, pack *Pack, imageData []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.packs[pack.Id]
+	if !ok {
+		return fmt.Errorf("failed to update pack poster: pack %d does not exist", pack.Id)
+	}
+
+	delete(m.images, stored.ImageId)
+	m.lastImageId++
+	m.images[m.lastImageId] = imageData
+	stored.ImageId = m.lastImageId
+	pack.ImageId = m.lastImageId
+	pack.Image = imageData
+	return nil
+}
+
+//
+// Tags
+//
+
+// GetTags returns all tags, ordered by name.
+func (m *MemoryDatabase) GetTags(ctx context.Context) ([]Tag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tags []Tag
+	for _, id := range sortedKeys(m.tags) {
+		tags = append(tags, *m.tags[id])
+	}
+	sortTags(tags)
+	return tags, nil
+}
+
+// InsertTag inserts a new tag.
+func (m *MemoryDatabase) InsertTag(ctx context.Context, tag *Tag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insertTag(tag)
+}
+
+// UpdateTag updates the name and colour of a tag.
+func (m *MemoryDatabase) UpdateTag(ctx context.Context, tag *Tag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := normalizeTag(tag); err != nil {
+		return err
+	}
+	if existing := m.getTagByName(tag.Name); existing != nil && existing.Id != tag.Id {
+		return fmt.Errorf("failed to rename tag to %s: %w", tag.Name, ErrTagExists)
+	}
+	stored, ok := m.tags[tag.Id]
+	if !ok {
+		return fmt.Errorf("failed to update tag: tag %d does not exist", tag.Id)
+	}
+
+	stored.Name, stored.Color = tag.Name, tag.Color
+	return nil
+}
+
+// DeleteTag deletes a tag, and removes it from all movies.
+func (m *MemoryDatabase) DeleteTag(ctx context.Context, tag *Tag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.movieTags = slices.DeleteFunc(m.movieTags, func(mt MovieTag) bool {
+		return mt.TagId == tag.Id
+	})
+	delete(m.tags, tag.Id)
+	return nil
+}
+
+// ConvertGenreToTag replaces a genre with a tag of the same name.
+func (m *MemoryDatabase) ConvertGenreToTag(ctx context.Context, genre *Genre) (*Tag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tag := m.getTagByName(genre.Name)
+	if tag == nil {
+		created := Tag{Name: genre.Name}
+		if err := m.insertTag(&created); err != nil {
+			return nil, fmt.Errorf("failed to get or insert tag: %w", err)
+		}
+		tag = m.tags[created.Id]
+	}
+
+	for _, mg := range m.movieGenres {
+		if mg.GenreId != genre.Id {
+			continue
+		}
+		m.recordChanges(ctx, MovieChange{MovieId: mg.MovieId, Field: historyFieldGenre, OldValue: genre.Name})
+		if !slices.Contains(m.movieTags, MovieTag{MovieId: mg.MovieId, TagId: tag.Id}) {
+			m.movieTags = append(m.movieTags, MovieTag{MovieId: mg.MovieId, TagId: tag.Id})
+			m.recordChanges(ctx, MovieChange{MovieId: mg.MovieId, Field: historyFieldTag, NewValue: tag.Name})
+		}
+	}
+
+	m.movieGenres = slices.DeleteFunc(m.movieGenres, func(mg MovieGenre) bool {
+		return mg.GenreId == genre.Id
+	})
+	m.deleteGenreAliases(func(a *GenreAlias) bool { return a.GenreId == genre.Id })
+	delete(m.genres, genre.Id)
+
+	result := *tag
+	return &result, nil
+}
+
+// SetMovieTags replaces the tags of a movie, and inserts tags that do not exist yet.
+func (m *MemoryDatabase) SetMovieTags(ctx context.Context, movie *Movie, tags []Tag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.setMovieTags(ctx, movie, tags)
+}
+
+//
+// Persons
+//
+
+// GetPerson returns a person by name, or nil if the person does not exist.
+func (m *MemoryDatabase) GetPerson(ctx context.Context, name string) (*Person, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	person := m.getPerson(name)
+	if person == nil {
+		return nil, nil
+	}
+
+	result := *person
+	return &result, nil
+}
+
+// GetPersonById returns a person by id, or nil if there is no such person.
+func (m *MemoryDatabase) GetPersonById(ctx context.Context, id int) (*Person, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	person, ok := m.persons[id]
+	if !ok {
+		return nil, nil
+	}
+
+	result := *person
+	return &result, nil
+}
+
+// GetPersonByImdbId returns a person by IMDb name id, or nil if there is no such person.
+func (m *MemoryDatabase) GetPersonByImdbId(ctx context.Context, imdbId string) (*Person, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	person := m.getPersonByImdbId(imdbId)
+	if person == nil {
+		return nil, nil
+	}
+
+	result := *person
+	return &result, nil
+}
+
+// InsertPerson inserts a new person and returns it.
+func (m *MemoryDatabase) InsertPerson(ctx context.Context, person *Person) (*Person, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.insertPerson(person)
+	return person, nil
+}
+
+// RemovePerson removes a person, including associations.
+func (m *MemoryDatabase) RemovePerson(ctx context.Context, person *Person) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.moviePersons = slices.DeleteFunc(m.moviePersons, func(mp MoviePerson) bool {
+		return mp.PersonId == person.Id
+	})
+	delete(m.persons, person.Id)
+
+	return nil
+}
+
+// GetDuplicatePersons returns groups of persons that share a name, ignoring case.
+func (m *MemoryDatabase) GetDuplicatePersons(ctx context.Context) ([][]Person, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var persons []Person
+	for _, id := range sortedKeys(m.persons) {
+		persons = append(persons, *m.persons[id])
+	}
+
+	return groupDuplicatePersons(persons), nil
+}
+
+// MergePersons moves the credits of the duplicates to the survivor, and removes the duplicates.
+func (m *MemoryDatabase) MergePersons(ctx context.Context, survivor *Person, duplicates []*Person) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, duplicate := range duplicates {
+		if duplicate.Id == survivor.Id {
+			continue
+		}
+
+		var credits []MoviePerson
+		for _, mp := range m.moviePersons {
+			if mp.PersonId == duplicate.Id {
+				credits = append(credits, mp)
+			}
+		}
+		m.moviePersons = slices.DeleteFunc(m.moviePersons, func(mp MoviePerson) bool {
+			return mp.PersonId == duplicate.Id
+		})
+
+		for _, credit := range credits {
+			credit.PersonId = survivor.Id
+			if !slices.ContainsFunc(m.moviePersons, func(mp MoviePerson) bool {
+				return mp.MovieId == credit.MovieId && mp.PersonId == credit.PersonId && mp.Type == credit.Type
+			}) {
+				m.moviePersons = append(m.moviePersons, credit)
+			}
+			if change, ok := getMergeChange(survivor, duplicate, credit); ok {
+				m.recordChanges(ctx, change)
+			}
+		}
+
+		if survivor.ImdbId == "" && duplicate.ImdbId != "" {
+			survivor.ImdbId = duplicate.ImdbId
+		}
+		delete(m.persons, duplicate.Id)
+	}
+
+	if stored, ok := m.persons[survivor.Id]; ok {
+		stored.ImdbId = survivor.ImdbId
+	}
+
+	return nil
+}
+
+// InsertMoviePerson connects a person (director, writer or actor) to a movie.
+func (m *MemoryDatabase) InsertMoviePerson(ctx context.Context, movie *Movie, person *Person) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.insertMoviePerson(ctx, movie, person, person)
+	return nil
+}
+
+// GetPersonsForMovie returns the persons connected to the given movie.
+func (m *MemoryDatabase) GetPersonsForMovie(ctx context.Context, movie *Movie) ([]Person, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.getPersonsForMovie(movie.Id), nil
+}
+
+// GetPersonsForMovies loads the persons for all the given movies.
+func (m *MemoryDatabase) GetPersonsForMovies(ctx context.Context, movies []*Movie) ([]*Movie, error) {
+	for _, movie := range movies {
+		persons, err := m.GetPersonsForMovie(ctx, movie)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get person for movie (%d: %s): %w", movie.Id, movie.Title, err)
+		}
+		movie.Persons = persons
+	}
+	return movies, nil
+}
+
+//
+// Statistics
+//
+
+// GetStatistics returns aggregates of the movies in the library.
+func (m *MemoryDatabase) GetStatistics(ctx context.Context) (*Statistics, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var movies []*Movie
+	for _, stored := range m.getMoviesById() {
+		if stored.TrashedAt.Valid {
+			continue
+		}
+		movie := *stored
+		movie.Genres = m.getGenresForMovie(movie.Id)
+		movie.Persons = m.getPersonsForMovie(movie.Id)
+		movies = append(movies, &movie)
+	}
+
+	var viewings []Viewing
+	for _, id := range sortedKeys(m.viewings) {
+		viewings = append(viewings, *m.viewings[id])
+	}
+
+	return computeStatistics(movies, viewings), nil
+}
+
+//
+// Viewings
+//
+
+// GetViewings returns all viewings of a movie, the latest viewing first.
+func (m *MemoryDatabase) GetViewings(ctx context.Context, movie *Movie) ([]Viewing, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.getViewings(movie.Id), nil
+}
+
+// InsertViewing adds a viewing to a movie, and updates the movie's watched at date.
+func (m *MemoryDatabase) InsertViewing(ctx context.Context, movie *Movie, viewing *Viewing) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastViewingId++
+	viewing.Id = m.lastViewingId
+	viewing.MovieId = movie.Id
+	stored := *viewing
+	m.viewings[viewing.Id] = &stored
+
+	m.updateLatestViewing(ctx, movie)
+	return nil
+}
+
+// UpdateViewing updates a viewing of a movie, and updates the movie's watched at date.
+func (m *MemoryDatabase) UpdateViewing(ctx context.Context, movie *Movie, viewing *Viewing) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if stored, ok := m.viewings[viewing.Id]; ok && stored.MovieId == movie.Id {
+		stored.WatchedAt = viewing.WatchedAt
+		stored.Note = viewing.Note
+		stored.Rating = viewing.Rating
+	}
+
+	m.updateLatestViewing(ctx, movie)
+	return nil
+}
+
+// DeleteViewing removes a viewing of a movie, and updates the movie's watched at date.
+func (m *MemoryDatabase) DeleteViewing(ctx context.Context, movie *Movie, viewing *Viewing) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if stored, ok := m.viewings[viewing.Id]; ok && stored.MovieId == movie.Id {
+		delete(m.viewings, viewing.Id)
+	}
+
+	m.updateLatestViewing(ctx, movie)
+	return nil
+}
+
+//
+// History
+//
+
+// GetMovieHistory returns the recorded changes of a movie, the latest change first.
+func (m *MemoryDatabase) GetMovieHistory(ctx context.Context, movie *Movie) ([]MovieChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var changes []MovieChange
+	for _, change := range m.history {
+		if change.MovieId == movie.Id {
+			changes = append(changes, change)
+		}
+	}
+	sortMovieHistory(changes)
+
+	return changes, nil
+}
+
+// RevertChange sets a field of the movie back to the value it had before the change.
+func (m *MemoryDatabase) RevertChange(ctx context.Context, movie *Movie, change *MovieChange) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.movies[movie.Id]
+	if !change.CanRevert() || change.MovieId != movie.Id || !ok {
+		return fmt.Errorf("failed to revert change: the change of %s can not be reverted", change.Field)
+	}
+
+	ctx = WithChangeSource(ctx, ChangeSourceRevert)
+
+	if change.Field == historyFieldGenre {
+		if change.NewValue != "" {
+			genre := m.getGenreByName(change.NewValue)
+			if genre == nil || !m.hasMovieGenre(movie.Id, genre.Id) {
+				return nil
+			}
+			m.movieGenres = slices.DeleteFunc(m.movieGenres, func(mg MovieGenre) bool {
+				return mg.MovieId == movie.Id && mg.GenreId == genre.Id
+			})
+			m.recordChanges(ctx, MovieChange{MovieId: movie.Id, Field: historyFieldGenre, OldValue: genre.Name})
+			return nil
+		}
+
+		genre, err := m.getOrInsertGenre(&Genre{Name: change.OldValue})
+		if err != nil {
+			return fmt.Errorf("failed to get genre: %w", err)
+		}
+		if !m.hasMovieGenre(movie.Id, genre.Id) {
+			return m.insertMovieGenre(ctx, movie, genre)
+		}
+		return nil
+	}
+
+	before := *stored
+	column := historyColumns[change.Field]
+	if err := column.parse(stored, change.OldValue); err != nil {
+		return err
+	}
+	if change.Field == "pack" {
+		if err := m.assignPack(stored); err != nil {
+			return fmt.Errorf("failed to get or insert pack: %w", err)
+		}
+		movie.PackId, movie.PackPosition = stored.PackId, stored.PackPosition
+	}
+	if err := column.parse(movie, column.format(stored)); err != nil {
+		return err
+	}
+	m.recordChanges(ctx, getMovieChanges(&before, stored, []string{change.Field})...)
+
+	return nil
+}
+
+//
+// Ignored paths
+//
+
+// GetAllIgnoredPaths returns all ignored paths.
+func (m *MemoryDatabase) GetAllIgnoredPaths(ctx context.Context) ([]*IgnoredPath, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ignoredPaths []*IgnoredPath
+	for _, id := range sortedKeys(m.ignoredPaths) {
+		ignoredPath := *m.ignoredPaths[id]
+		ignoredPaths = append(ignoredPaths, &ignoredPath)
+	}
+	return ignoredPaths, nil
+}
+
+// InsertIgnorePath inserts a path to be ignored.
+func (m *MemoryDatabase) InsertIgnorePath(ctx context.Context, ignorePath *IgnoredPath) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastIgnoredPathId++
+	ignorePath.Id = m.lastIgnoredPathId
+	stored := *ignorePath
+	m.ignoredPaths[ignorePath.Id] = &stored
+
+	return nil
+}
+
+// DeleteIgnorePath deletes a path from the ignored paths.
+func (m *MemoryDatabase) DeleteIgnorePath(ctx context.Context, ignorePath *IgnoredPath) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.ignoredPaths, ignorePath.Id)
+	return nil
+}
+
+//
+// Helpers, the caller must hold the lock
+//
+
+func (m *MemoryDatabase) getMoviesById() []*Movie {
+	movies := make([]*Movie, 0, len(m.movies))
+	for _, id := range sortedKeys(m.movies) {
+		movies = append(movies, m.movies[id])
+	}
+	return movies
+}
+
+func (m *MemoryDatabase) getViewings(movieId int) []Viewing {
+	var viewings []Viewing
+	for _, id := range sortedKeys(m.viewings) {
+		if m.viewings[id].MovieId == movieId {
+			viewings = append(viewings, *m.viewings[id])
+		}
+	}
+
+	slices.SortStableFunc(viewings, func(a, b Viewing) int {
+		if c := b.WatchedAt.Compare(a.WatchedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.Id, a.Id)
+	})
+
+	return viewings
+}
+
+// updateLatestViewing mirrors the Database version, by setting watched at
+// to the date of the latest viewing of the movie.
+func (m *MemoryDatabase) updateLatestViewing(ctx context.Context, movie *Movie) {
+	before := *movie
+	if stored, ok := m.movies[movie.Id]; ok {
+		before = *stored
+	}
+
+	movie.WatchedAt = sql.NullTime{}
+	if viewings := m.getViewings(movie.Id); len(viewings) > 0 {
+		movie.WatchedAt = sql.NullTime{Time: viewings[0].WatchedAt, Valid: true}
+	}
+
+	if stored, ok := m.movies[movie.Id]; ok {
+		stored.WatchedAt = movie.WatchedAt
+	}
+	m.recordChanges(ctx, getMovieChanges(&before, movie, []string{"watched_at"})...)
+}
+
+// recordChanges mirrors the Database version, by adding changes to the movie history.
+func (m *MemoryDatabase) recordChanges(ctx context.Context, changes ...MovieChange) {
+	source := getChangeSource(ctx)
+
+	now := time.Now()
+	for _, change := range changes {
+		m.lastChangeId++
+		change.Id = m.lastChangeId
+		change.ChangedAt = now
+		change.Source = source
+		m.history = append(m.history, change)
+	}
+}
+
+func (m *MemoryDatabase) getGenresForMovie(movieId int) []Genre {
+	var genres []Genre
+	for _, mg := range m.movieGenres {
+		if mg.MovieId != movieId {
+			continue
+		}
+		if genre, ok := m.genres[mg.GenreId]; ok {
+			genres = append(genres, *genre)
+		}
+	}
+
+	slices.SortFunc(genres, func(a, b Genre) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+
+	return genres
+}
+
+func (m *MemoryDatabase) getPersonsForMovie(movieId int) []Person {
+	var persons []Person
+	for _, mp := range m.moviePersons {
+		if mp.MovieId != movieId {
+			continue
+		}
+
+		person := Person{Id: mp.PersonId}
+		if stored, ok := m.persons[mp.PersonId]; ok {
+			person = *stored
+		}
+		person.Type = PersonType(mp.Type)
+		person.Billing = mp.Billing
+		person.Character = mp.Character
+		persons = append(persons, person)
+	}
+
+	slices.SortStableFunc(persons, func(a, b Person) int {
+		return cmp.Or(cmp.Compare(a.Type, b.Type), cmp.Compare(a.Billing, b.Billing), cmp.Compare(a.Id, b.Id))
+	})
+
+	return persons
+}
+
+func (m *MemoryDatabase) getPackByName(name string) *Pack {
+	for _, id := range sortedKeys(m.packs) {
+		if strings.EqualFold(m.packs[id].Name, strings.TrimSpace(name)) {
+			return m.packs[id]
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDatabase) insertPack(pack *Pack) error {
+	pack.Name = strings.TrimSpace(pack.Name)
+	if pack.Name == "" {
+		return fmt.Errorf("pack name cannot be empty")
+	}
+	if m.getPackByName(pack.Name) != nil {
+		return fmt.Errorf("failed to insert pack %s: %w", pack.Name, ErrPackExists)
+	}
+
+	m.lastPackId++
+	pack.Id = m.lastPackId
+	stored := *pack
+	stored.Image = nil
+	m.packs[pack.Id] = &stored
+	return nil
+}
+
+// assignPack mirrors Database.assignPack.
+func (m *MemoryDatabase) assignPack(movie *Movie) error {
+	name := strings.TrimSpace(movie.Pack)
+	if name == "" {
+		movie.Pack, movie.PackId, movie.PackPosition = "", 0, 0
+		return nil
+	}
+
+	pack := m.getPackByName(name)
+	if pack == nil {
+		created := Pack{Name: name}
+		if err := m.insertPack(&created); err != nil {
+			return err
+		}
+		pack = m.packs[created.Id]
+	}
+
+	movie.Pack = pack.Name
+	if movie.PackId == pack.Id {
+		return nil
+	}
+
+	last := 0
+	for _, other := range m.movies {
+		if other.PackId == pack.Id && other.Id != movie.Id {
+			last = max(last, other.PackPosition)
+		}
+	}
+	movie.PackId = pack.Id
+	movie.PackPosition = last + 1
+	return nil
+}
+
+func (m *MemoryDatabase) setPackNameForMovies(ctx context.Context, packId int, name string) {
+	for _, id := range sortedKeys(m.movies) {
+		movie := m.movies[id]
+		if movie.PackId != packId {
+			continue
+		}
+		before := *movie
+		movie.Pack = name
+		m.recordChanges(ctx, getMovieChanges(&before, movie, []string{"pack"})...)
+	}
+}
+
+func (m *MemoryDatabase) getTagsForMovie(movieId int) []Tag {
+	var tags []Tag
+	for _, mt := range m.movieTags {
+		if tag, ok := m.tags[mt.TagId]; ok && mt.MovieId == movieId {
+			tags = append(tags, *tag)
+		}
+	}
+	sortTags(tags)
+	return tags
+}
+
+func (m *MemoryDatabase) getTagByName(name string) *Tag {
+	for _, id := range sortedKeys(m.tags) {
+		if strings.EqualFold(m.tags[id].Name, strings.TrimSpace(name)) {
+			return m.tags[id]
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDatabase) insertTag(tag *Tag) error {
+	if err := normalizeTag(tag); err != nil {
+		return err
+	}
+	if m.getTagByName(tag.Name) != nil {
+		return fmt.Errorf("failed to insert tag %s: %w", tag.Name, ErrTagExists)
+	}
+
+	m.lastTagId++
+	tag.Id = m.lastTagId
+	stored := *tag
+	m.tags[tag.Id] = &stored
+	return nil
+}
+
+func (m *MemoryDatabase) setMovieTags(ctx context.Context, movie *Movie, tags []Tag) error {
+	var result []Tag
+	for i := range tags {
+		tag := m.getTagByName(tags[i].Name)
+		if tag == nil {
+			if err := m.insertTag(&tags[i]); err != nil {
+				return fmt.Errorf("failed to get or insert tag: %w", err)
+			}
+			tag = m.tags[tags[i].Id]
+		}
+		if slices.ContainsFunc(result, func(t Tag) bool { return t.Id == tag.Id }) {
+			continue
+		}
+		result = append(result, *tag)
+
+		if !slices.Contains(m.movieTags, MovieTag{MovieId: movie.Id, TagId: tag.Id}) {
+			m.movieTags = append(m.movieTags, MovieTag{MovieId: movie.Id, TagId: tag.Id})
+			m.recordChanges(ctx, MovieChange{MovieId: movie.Id, Field: historyFieldTag, NewValue: tag.Name})
+		}
+	}
+
+	for _, tag := range m.getTagsForMovie(movie.Id) {
+		if slices.ContainsFunc(result, func(t Tag) bool { return t.Id == tag.Id }) {
+			continue
+		}
+		m.movieTags = slices.DeleteFunc(m.movieTags, func(mt MovieTag) bool {
+			return mt.MovieId == movie.Id && mt.TagId == tag.Id
+		})
+		m.recordChanges(ctx, MovieChange{MovieId: movie.Id, Field: historyFieldTag, OldValue: tag.Name})
+	}
+
+	sortTags(result)
+	movie.Tags = result
+	return nil
+}
+
+func (m *MemoryDatabase) getGenreByName(name string) *Genre {
+	for _, id := range sortedKeys(m.genres) {
+		if strings.EqualFold(m.genres[id].Name, name) {
+			return m.genres[id]
+		}
+	}
+	for _, id := range sortedKeys(m.genreAliases) {
+		if alias := m.genreAliases[id]; strings.EqualFold(alias.Name, name) {
+			return m.genres[alias.GenreId]
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDatabase) insertGenreAlias(alias *GenreAlias) error {
+	alias.Name = strings.TrimSpace(alias.Name)
+	if alias.Name == "" {
+		return fmt.Errorf("genre alias cannot be empty")
+	}
+	for _, genre := range m.genres {
+		if strings.EqualFold(genre.Name, alias.Name) {
+			return fmt.Errorf("failed to insert genre alias %s: %w", alias.Name, ErrGenreExists)
+		}
+	}
+
+	m.deleteGenreAliases(func(a *GenreAlias) bool { return strings.EqualFold(a.Name, alias.Name) })
+	m.lastGenreAliasId++
+	alias.Id = m.lastGenreAliasId
+	stored := *alias
+	m.genreAliases[alias.Id] = &stored
+	return nil
+}
+
+func (m *MemoryDatabase) deleteGenreAliases(match func(a *GenreAlias) bool) {
+	maps.DeleteFunc(m.genreAliases, func(_ int, a *GenreAlias) bool { return match(a) })
+}
+
+func (m *MemoryDatabase) getOrInsertGenre(genre *Genre) (*Genre, error) {
+	genre.Name = strings.TrimSpace(genre.Name)
+	if genre.Name == "" {
+		return nil, fmt.Errorf("genre name cannot be empty")
+	}
+
+	if existing := m.getGenreByName(genre.Name); existing != nil {
+		return existing, nil
+	}
+
+	m.lastGenreId++
+	genre.Id = m.lastGenreId
+	stored := *genre
+	m.genres[genre.Id] = &stored
+
+	return genre, nil
+}
+
+func (m *MemoryDatabase) hasMovieGenre(movieId, genreId int) bool {
+	return slices.Contains(m.movieGenres, MovieGenre{MovieId: movieId, GenreId: genreId})
+}
+
+func (m *MemoryDatabase) insertMovieGenre(ctx context.Context, movie *Movie, genre *Genre) error {
+	if m.hasMovieGenre(movie.Id, genre.Id) {
+		return fmt.Errorf("failed to insert movie genre: duplicate movie genre (%d, %d)", movie.Id, genre.Id)
+	}
+
+	m.movieGenres = append(m.movieGenres, MovieGenre{MovieId: movie.Id, GenreId: genre.Id})
+	m.recordChanges(ctx, MovieChange{MovieId: movie.Id, Field: historyFieldGenre, NewValue: genre.Name})
+	return nil
+}
+
+func (m *MemoryDatabase) getPerson(name string) *Person {
+	name = strings.TrimSpace(name)
+	for _, id := range sortedKeys(m.persons) {
+		if strings.EqualFold(m.persons[id].Name, name) {
+			return m.persons[id]
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDatabase) getPersonByImdbId(imdbId string) *Person {
+	for _, id := range sortedKeys(m.persons) {
+		if m.persons[id].ImdbId == imdbId {
+			return m.persons[id]
+		}
+	}
+	return nil
+}
+
+// getOrInsertPerson mirrors the Database version, by preferring the IMDb id of the credit.
+func (m *MemoryDatabase) getOrInsertPerson(credit *Person) *Person {
+	if credit.ImdbId == "" {
+		if person := m.getPerson(credit.Name); person != nil {
+			return person
+		}
+		return m.insertPerson(&Person{Name: credit.Name})
+	}
+
+	if person := m.getPersonByImdbId(credit.ImdbId); person != nil {
+		return person
+	}
+
+	name := strings.TrimSpace(credit.Name)
+	for _, id := range sortedKeys(m.persons) {
+		if person := m.persons[id]; person.ImdbId == "" && strings.EqualFold(person.Name, name) {
+			person.ImdbId = credit.ImdbId
+			return person
+		}
+	}
+
+	return m.insertPerson(&Person{Name: credit.Name, ImdbId: credit.ImdbId})
+}
+
+func (m *MemoryDatabase) insertPerson(person *Person) *Person {
+	person.Name = strings.TrimSpace(person.Name)
+
+	m.lastPersonId++
+	person.Id = m.lastPersonId
+	stored := *person
+	m.persons[person.Id] = &stored
+
+	return person
+}
+
+// insertMoviePerson adds a credit for person to the movie, taking the type, billing
+// and character from credit, since person may be the stored person.
+func (m *MemoryDatabase) insertMoviePerson(ctx context.Context, movie *Movie, person *Person, credit *Person) {
+	for _, mp := range m.moviePersons {
+		if mp.MovieId == movie.Id && mp.PersonId == person.Id && mp.Type == int(credit.Type) {
+			return
+		}
+	}
+
+	m.moviePersons = append(m.moviePersons, MoviePerson{
+		MovieId: movie.Id, PersonId: person.Id, Type: int(credit.Type), Billing: credit.Billing, Character: credit.Character,
+	})
+	m.recordChanges(ctx, MovieChange{MovieId: movie.Id, Field: historyFieldPerson, NewValue: getPersonHistoryValue(&Person{Name: person.Name, Type: credit.Type})})
+}
+
+// hasPersonLike reports whether the movie has a person of the given type (any type if
+// negative) with a name matching the LIKE pattern. Used when matching search queries.
+func (m *MemoryDatabase) hasPersonLike(movieId int, pattern string, typ int) bool {
+	for _, mp := range m.moviePersons {
+		person, ok := m.persons[mp.PersonId]
+		if !ok || mp.MovieId != movieId || !likeMatch(person.Name, pattern) {
+			continue
+		}
+		if typ < 0 || mp.Type == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// hasGenreLike reports whether the movie has a genre with a name matching the LIKE
+// pattern. Used when matching search queries.
+func (m *MemoryDatabase) hasGenreLike(movieId int, pattern string) bool {
+	for _, mg := range m.movieGenres {
+		genre, ok := m.genres[mg.GenreId]
+		if ok && mg.MovieId == movieId && likeMatch(genre.Name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTagLike reports whether the movie has a tag with a name matching the LIKE
+// pattern. Used when matching search queries.
+func (m *MemoryDatabase) hasTagLike(movieId int, pattern string) bool {
+	for _, mt := range m.movieTags {
+		tag, ok := m.tags[mt.TagId]
+		if ok && mt.MovieId == movieId && likeMatch(tag.Name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// getViewMatcher mirrors the view conditions in addViewSQL.
+func getViewMatcher(view string) func(*Movie) bool {
+	switch view {
+	case "packs":
+		return func(movie *Movie) bool { return movie.Pack != "" }
+	case "toWatch":
+		return func(movie *Movie) bool { return movie.ToWatch && !movie.NeedsSubtitle }
+	case "noRating":
+		return func(movie *Movie) bool { return movie.MyRating == 0 && !movie.NeedsSubtitle }
+	case "needsSubtitles":
+		return func(movie *Movie) bool { return movie.NeedsSubtitle }
+	default:
+		return func(*Movie) bool { return true }
+	}
+}
+
+// memoryOrderColumns compares two movies on the columns that can be used in an ORDER BY.
+var memoryOrderColumns = map[string]func(a, b *Movie) int{
+	"id":            func(a, b *Movie) int { return cmp.Compare(a.Id, b.Id) },
+	"title":         func(a, b *Movie) int { return compareFold(a.Title, b.Title) },
+	"sub_title":     func(a, b *Movie) int { return compareFold(a.SubTitle, b.SubTitle) },
+	"pack":          func(a, b *Movie) int { return compareFold(a.Pack, b.Pack) },
+	"pack_position": func(a, b *Movie) int { return cmp.Compare(a.PackPosition, b.PackPosition) },
+	"year":          func(a, b *Movie) int { return cmp.Compare(a.Year, b.Year) },
+	"my_rating":     func(a, b *Movie) int { return cmp.Compare(a.MyRating, b.MyRating) },
+	"imdb_rating":   func(a, b *Movie) int { return cmp.Compare(a.ImdbRating, b.ImdbRating) },
+	"length":        func(a, b *Movie) int { return cmp.Compare(a.Runtime, b.Runtime) },
+	"size":          func(a, b *Movie) int { return cmp.Compare(a.Size, b.Size) },
+	"watched_at":    func(a, b *Movie) int { return compareNullTime(a.WatchedAt, b.WatchedAt) },
+}
+
+// getMemoryOrder parses an SQL ORDER BY clause, like "pack asc, title asc",
+// into a compare function. Ties are broken by the movie id.
+func getMemoryOrder(orderBy string) (func(a, b *Movie) int, error) {
+	var compares []func(a, b *Movie) int
+
+	for _, part := range strings.Split(orderBy, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+
+		compare, ok := memoryOrderColumns[strings.ToLower(fields[0])]
+		if !ok {
+			return nil, fmt.Errorf("unknown order by column: %s", fields[0])
+		}
+		if len(fields) > 1 && strings.EqualFold(fields[1], "desc") {
+			asc := compare
+			compare = func(a, b *Movie) int { return asc(b, a) }
+		}
+		compares = append(compares, compare)
+	}
+
+	return func(a, b *Movie) int {
+		for _, compare := range compares {
+			if c := compare(a, b); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(a.Id, b.Id)
+	}, nil
+}
+
+func compareFold(a, b string) int {
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// compareNullTime sorts NULL values first, like MySQL and SQLite do.
+func compareNullTime(a, b sql.NullTime) int {
+	switch {
+	case !a.Valid && !b.Valid:
+		return 0
+	case !a.Valid:
+		return -1
+	case !b.Valid:
+		return 1
+	default:
+		return a.Time.Compare(b.Time)
+	}
+}
+
+// likeMatch reports whether value matches the SQL LIKE pattern, where % matches
+// any sequence of characters, _ matches a single character and likeEscape makes
+// the next character match itself. Like MySQL, the match is case-insensitive.
+func likeMatch(value, pattern string) bool {
+	v := []rune(strings.ToLower(value))
+	p := []rune(strings.ToLower(pattern))
+
+	// Classic wildcard matching with backtracking to the last %
+	vi, pi := 0, 0
+	starPi, starVi := -1, 0
+	for vi < len(v) {
+		switch {
+		case pi+1 < len(p) && p[pi] == likeEscape && p[pi+1] == v[vi]:
+			vi++
+			pi += 2
+		case pi < len(p) && p[pi] != likeEscape && (p[pi] == '_' || p[pi] == v[vi]):
+			vi++
+			pi++
+		case pi < len(p) && p[pi] == '%':
+			starPi, starVi = pi, vi
+			pi++
+		case starPi >= 0:
+			starVi++
+			vi = starVi
+			pi = starPi + 1
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '%' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+func copyMovie(movie *Movie) *Movie {
+	result := *movie
+	result.Genres = nil
+	result.Persons = nil
+	result.Tags = nil
+	result.Image = nil
+	result.HasImage = false
+	return &result
+}
+
+func sortedKeys[T any](m map[int]T) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
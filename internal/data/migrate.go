@@ -0,0 +1,137 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// schemaVersion represents a migration that has been applied to the database.
+type schemaVersion struct {
+	Version   int       `gorm:"column:version;primary_key;autoIncrement:false"`
+	Name      string    `gorm:"column:name;size:255"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+// TableName returns the schema version table name.
+func (s *schemaVersion) TableName() string {
+	return "schema_version"
+}
+
+// migration represents a single versioned change to the database schema.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *gorm.DB) error
+}
+
+// Migrate brings the database schema up to date by applying all migrations
+// that have not yet been applied. It works both on an empty database and on
+// an existing database that was created before migrations were introduced.
+// Migrations are not limited by the query timeout, since they may take long.
+func (d *Database) Migrate(ctx context.Context) error {
+	return d.migrateTo(ctx, latestSchemaVersion())
+}
+
+// migrateTo applies the migrations that have not yet been applied, up to and
+// including the given version.
+func (d *Database) migrateTo(ctx context.Context, target int) error {
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database: %w", err)
+	}
+
+	if err := db.AutoMigrate(&schemaVersion{}); err != nil {
+		return fmt.Errorf("failed to create schema version table: %w", err)
+	}
+
+	current, err := d.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if m.version > target {
+			break
+		}
+
+		err = db.Transaction(
+			func(tx *gorm.DB) error {
+				if err := m.up(tx); err != nil {
+					return err
+				}
+
+				version := schemaVersion{Version: m.version, Name: m.name, AppliedAt: time.Now()}
+				if err := tx.Create(&version).Error; err != nil {
+					return fmt.Errorf("failed to save schema version: %w", err)
+				}
+
+				return nil
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// SchemaVersion returns the version of the latest applied migration,
+// or zero if no migrations have been applied.
+func (d *Database) SchemaVersion(ctx context.Context) (int, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	if !db.Migrator().HasTable(&schemaVersion{}) {
+		return 0, nil
+	}
+
+	var version schemaVersion
+	if err := db.Order("version desc").First(&version).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	return version.Version, nil
+}
+
+// latestSchemaVersion returns the version of the last known migration.
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// createTableIfMissing creates the table for the given model, unless it already exists.
+func createTableIfMissing(tx *gorm.DB, model interface{}) error {
+	if tx.Migrator().HasTable(model) {
+		return nil
+	}
+	if err := tx.Migrator().CreateTable(model); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+	return nil
+}
+
+// addColumnIfMissing adds the column for the given model field, unless it already exists.
+func addColumnIfMissing(tx *gorm.DB, model interface{}, field string) error {
+	if tx.Migrator().HasColumn(model, field) {
+		return nil
+	}
+	if err := tx.Migrator().AddColumn(model, field); err != nil {
+		return fmt.Errorf("failed to add column %s: %w", field, err)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package data
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatabase_MigrateEmptyDatabase(t *testing.T) {
+	d := newTestDatabase(t)
+
+	version, err := d.SchemaVersion(t.Context())
+	if err != nil {
+		t.Fatalf("SchemaVersion() error = %v", err)
+	}
+	assert.Equal(t, 0, version)
+
+	if err := d.Migrate(t.Context()); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	version, err = d.SchemaVersion(t.Context())
+	if err != nil {
+		t.Fatalf("SchemaVersion() error = %v", err)
+	}
+	assert.Equal(t, latestSchemaVersion(), version)
+
+	db, err := d.getDatabase(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"movies", "genre", "person", "movie_genre", "movie_person", "image", "ignore_paths", "viewing", "movie_history", "genre_alias", "tag", "movie_tag", "pack", "artwork"} {
+		assert.True(t, db.Migrator().HasTable(table), "table %s should exist", table)
+	}
+	assert.True(t, db.Migrator().HasColumn(&Movie{}, "processed"))
+	assert.True(t, db.Migrator().HasColumn(&image{}, "hash"))
+
+	// Running the migrations again should be a no-op
+	if err := d.Migrate(t.Context()); err != nil {
+		t.Fatalf("Migrate() second run error = %v", err)
+	}
+	var count int64
+	db.Model(&schemaVersion{}).Count(&count)
+	assert.Equal(t, int64(len(migrations)), count)
+}
+
+func TestDatabase_MigrateExistingDatabase(t *testing.T) {
+	d := newTestDatabase(t)
+
+	// Simulate a database created before migrations existed
+	db, err := d.getDatabase(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateInitialTables(db); err != nil {
+		t.Fatal(err)
+	}
+	watchedAt := time.Date(2020, 5, 17, 20, 0, 0, 0, time.UTC)
+	legacy := movieV1{Title: "Heat", Year: 1995, MoviePath: "Heat", WatchedAt: sql.NullTime{Time: watchedAt, Valid: true}}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+	person := personV1{Name: "Michael Mann"}
+	if err := db.Create(&person).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&moviePersonV1{MovieId: legacy.Id, PersonId: person.Id, Type: int(Director)}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Migrate(t.Context()); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	movies, err := d.SearchMovies(t.Context(), "all", "", -1, "title asc")
+	if err != nil {
+		t.Fatalf("SearchMovies() error = %v", err)
+	}
+	assert.Equal(t, []string{"Heat"}, movieTitles(movies))
+
+	if err := d.SetProcessed(t.Context(), movies[0]); err != nil {
+		t.Errorf("SetProcessed() error = %v", err)
+	}
+
+	// The old watched_at date should have been copied to the viewing history
+	viewings, err := d.GetViewings(t.Context(), movies[0])
+	if err != nil {
+		t.Fatalf("GetViewings() error = %v", err)
+	}
+	if assert.Len(t, viewings, 1) {
+		assert.True(t, watchedAt.Equal(viewings[0].WatchedAt))
+	}
+
+	// The old credits should have been copied, and more roles can be added
+	writer := Person{Id: person.Id, Name: person.Name, Type: Writer, Billing: 1}
+	if err := d.InsertMoviePerson(t.Context(), movies[0], &writer); err != nil {
+		t.Fatalf("InsertMoviePerson() error = %v", err)
+	}
+	persons, err := d.GetPersonsForMovie(t.Context(), movies[0])
+	if err != nil {
+		t.Fatalf("GetPersonsForMovie() error = %v", err)
+	}
+	if assert.Len(t, persons, 2) {
+		assert.Equal(t, Director, persons[0].Type)
+		assert.Equal(t, Writer, persons[1].Type)
+	}
+}
+
+func TestDatabase_MigratePacks(t *testing.T) {
+	d := newTestDatabase(t)
+
+	db, err := d.getDatabase(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateInitialTables(db); err != nil {
+		t.Fatal(err)
+	}
+	legacy := []movieV1{
+		{Title: "Aliens", Year: 1986, MoviePath: "Aliens", Pack: "Alien"},
+		{Title: "Alien", Year: 1979, MoviePath: "Alien", Pack: "alien "},
+		{Title: "Alien 3", Year: 1992, MoviePath: "Alien 3", Pack: "Alien"},
+		{Title: "Heat", Year: 1995, MoviePath: "Heat"},
+	}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Migrate(t.Context()); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	packs, err := d.GetPacks(t.Context())
+	if err != nil {
+		t.Fatalf("GetPacks() error = %v", err)
+	}
+	if !assert.Len(t, packs, 1) {
+		return
+	}
+	assert.Equal(t, "Alien", packs[0].Name)
+
+	// The spellings are merged, and the movies are in release order
+	movies, err := d.GetPackMovies(t.Context(), &packs[0])
+	if err != nil {
+		t.Fatalf("GetPackMovies() error = %v", err)
+	}
+	assert.Equal(t, []string{"Alien", "Aliens", "Alien 3"}, movieTitles(movies))
+	for _, movie := range movies {
+		assert.Equal(t, "Alien", movie.Pack)
+	}
+}
+
+func TestDatabase_MigrateArtwork(t *testing.T) {
+	d := newTestDatabase(t)
+
+	db, err := d.getDatabase(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateInitialTables(db); err != nil {
+		t.Fatal(err)
+	}
+	legacy := []movieV1{
+		{Title: "Alien", Year: 1979, MoviePath: "Alien", ImageId: 7},
+		{Title: "Heat", Year: 1995, MoviePath: "Heat"},
+	}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Migrate(t.Context()); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	var artwork []Artwork
+	if err := db.Find(&artwork).Error; err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []Artwork{{Id: 1, MovieId: legacy[0].Id, ImageId: 7, Kind: ArtworkPoster, IsPrimary: true}}, artwork)
+}
+
+func TestDatabase_MigrateMoviePersonCreditsResume(t *testing.T) {
+	tests := []struct {
+		name   string
+		copied bool
+	}{
+		{"failed before the copy", false},
+		{"failed before the drop", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDatabase(t)
+			if err := d.migrateTo(t.Context(), 5); err != nil {
+				t.Fatalf("migrateTo() error = %v", err)
+			}
+			db, err := d.getDatabase(t.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+			legacy := movieV1{Title: "Heat", Year: 1995, MoviePath: "Heat"}
+			if err := db.Create(&legacy).Error; err != nil {
+				t.Fatal(err)
+			}
+			person := personV1{Name: "Michael Mann"}
+			if err := db.Create(&person).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Create(&moviePersonV1{MovieId: legacy.Id, PersonId: person.Id, Type: int(Director)}).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			// Simulate a run that stopped after the new table was created, which
+			// MySQL does not roll back
+			if err := db.Migrator().RenameTable("movie_person", "movie_person_v1"); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Migrator().CreateTable(&moviePersonV6{}); err != nil {
+				t.Fatal(err)
+			}
+			if tt.copied {
+				err := db.Exec("INSERT INTO movie_person (movie_id, person_id, type) SELECT movie_id, person_id, type FROM movie_person_v1").Error
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := d.Migrate(t.Context()); err != nil {
+				t.Fatalf("Migrate() error = %v", err)
+			}
+
+			assert.False(t, db.Migrator().HasTable("movie_person_v1"))
+			persons, err := d.GetPersonsForMovie(t.Context(), &Movie{Id: legacy.Id})
+			if err != nil {
+				t.Fatalf("GetPersonsForMovie() error = %v", err)
+			}
+			if assert.Len(t, persons, 1) {
+				assert.Equal(t, "Michael Mann", persons[0].Name)
+				assert.Equal(t, Director, persons[0].Type)
+			}
+		})
+	}
+}
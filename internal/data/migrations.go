@@ -0,0 +1,451 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrations is the ordered list of all schema migrations. New migrations
+// must be appended with the next version number, and existing migrations
+// must never be changed once they have been released.
+//
+// Each migration uses its own copy of the table structs, so that the
+// migration keeps creating the same schema when the models change.
+var migrations = []migration{
+	{version: 1, name: "create initial tables", up: migrateInitialTables},
+	{version: 2, name: "add processed column to movies", up: migrateProcessedColumn},
+	{version: 3, name: "create viewing table", up: migrateViewingTable},
+	{version: 4, name: "add trashed_at column to movies", up: migrateTrashedAtColumn},
+	{version: 5, name: "create movie_history table", up: migrateMovieHistoryTable},
+	{version: 6, name: "add credits to movie_person", up: migrateMoviePersonCredits},
+	{version: 7, name: "add imdb_id column to person", up: migratePersonImdbId},
+	{version: 8, name: "create genre_alias table", up: migrateGenreAliasTable},
+	{version: 9, name: "create tag tables", up: migrateTagTables},
+	{version: 10, name: "create pack table", up: migratePackTable},
+	{version: 11, name: "add hash column to image", up: migrateImageHashColumn},
+	{version: 12, name: "create artwork table", up: migrateArtworkTable},
+}
+
+//
+// Version 1
+//
+
+type movieV1 struct {
+	Id            int          `gorm:"column:id;primary_key"`
+	Title         string       `gorm:"column:title;size:100"`
+	SubTitle      string       `gorm:"column:sub_title;size:100"`
+	StoryLine     string       `gorm:"column:story_line;type:text"`
+	Year          int          `gorm:"column:year"`
+	MyRating      int          `gorm:"column:my_rating"`
+	MoviePath     string       `gorm:"column:path;size:1024"`
+	Runtime       int          `gorm:"column:length"`
+	Size          int          `gorm:"column:size"`
+	ImdbRating    float32      `gorm:"column:imdb_rating"`
+	ImdbUrl       string       `gorm:"column:imdb_url;size:1024"`
+	ImdbID        string       `gorm:"column:imdb_id;size:9"`
+	ImageId       int          `gorm:"column:image_id"`
+	ToWatch       bool         `gorm:"column:to_watch"`
+	Pack          string       `gorm:"column:pack;size:255"`
+	NeedsSubtitle bool         `gorm:"column:needsSubtitle"`
+	WatchedAt     sql.NullTime `gorm:"column:watched_at"`
+}
+
+func (m *movieV1) TableName() string { return "movies" }
+
+type genreV1 struct {
+	Id        int    `gorm:"column:id;primary_key"`
+	Name      string `gorm:"column:name;size:255"`
+	IsPrivate bool   `gorm:"column:is_private"`
+}
+
+func (g *genreV1) TableName() string { return "genre" }
+
+type movieGenreV1 struct {
+	MovieId int `gorm:"column:movie_id;primary_key;autoIncrement:false"`
+	GenreId int `gorm:"column:genre_id;primary_key;autoIncrement:false"`
+}
+
+func (m *movieGenreV1) TableName() string { return "movie_genre" }
+
+type personV1 struct {
+	Id   int    `gorm:"column:id;primary_key"`
+	Name string `gorm:"column:name;size:50"`
+}
+
+func (p *personV1) TableName() string { return "person" }
+
+type moviePersonV1 struct {
+	MovieId  int `gorm:"column:movie_id;primary_key;autoIncrement:false"`
+	PersonId int `gorm:"column:person_id;primary_key;autoIncrement:false"`
+	Type     int `gorm:"column:type"`
+}
+
+func (m *moviePersonV1) TableName() string { return "movie_person" }
+
+type imageV1 struct {
+	Id   int    `gorm:"column:id;primary_key"`
+	Data []byte `gorm:"column:image"`
+}
+
+func (i *imageV1) TableName() string { return "image" }
+
+type ignoredPathV1 struct {
+	Id               int    `gorm:"column:id;primary_key"`
+	Path             string `gorm:"column:path;size:1024"`
+	IgnoreCompletely bool   `gorm:"column:ignore_completely"`
+}
+
+func (i *ignoredPathV1) TableName() string { return "ignore_paths" }
+
+// migrateInitialTables creates the tables that existed before migrations were
+// introduced. Tables that already exist are left untouched.
+func migrateInitialTables(tx *gorm.DB) error {
+	models := []interface{}{
+		&movieV1{}, &genreV1{}, &movieGenreV1{}, &personV1{}, &moviePersonV1{}, &imageV1{}, &ignoredPathV1{},
+	}
+
+	for _, model := range models {
+		if err := createTableIfMissing(tx, model); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//
+// Version 2
+//
+
+type movieV2 struct {
+	Processed bool `gorm:"column:processed"`
+}
+
+func (m *movieV2) TableName() string { return "movies" }
+
+// migrateProcessedColumn adds the processed column used by SetProcessed.
+func migrateProcessedColumn(tx *gorm.DB) error {
+	return addColumnIfMissing(tx, &movieV2{}, "Processed")
+}
+
+//
+// Version 3
+//
+
+type viewingV3 struct {
+	Id        int       `gorm:"column:id;primary_key"`
+	MovieId   int       `gorm:"column:movie_id;index"`
+	WatchedAt time.Time `gorm:"column:watched_at"`
+	Note      string    `gorm:"column:note;size:1024"`
+	Rating    int       `gorm:"column:rating"`
+}
+
+func (v *viewingV3) TableName() string { return "viewing" }
+
+// migrateViewingTable creates the viewing table, and adds a viewing for
+// every movie that has a watched_at date.
+func migrateViewingTable(tx *gorm.DB) error {
+	if err := createTableIfMissing(tx, &viewingV3{}); err != nil {
+		return err
+	}
+
+	err := tx.Exec(`INSERT INTO viewing (movie_id, watched_at, note, rating)
+		SELECT id, watched_at, '', 0 FROM movies WHERE watched_at IS NOT NULL`).Error
+	if err != nil {
+		return fmt.Errorf("failed to copy watched_at to viewing: %w", err)
+	}
+
+	return nil
+}
+
+//
+// Version 4
+//
+
+type movieV4 struct {
+	TrashedAt sql.NullTime `gorm:"column:trashed_at"`
+}
+
+func (m *movieV4) TableName() string { return "movies" }
+
+// migrateTrashedAtColumn adds the trashed_at column used by TrashMovie.
+func migrateTrashedAtColumn(tx *gorm.DB) error {
+	return addColumnIfMissing(tx, &movieV4{}, "TrashedAt")
+}
+
+//
+// Version 5
+//
+
+type movieHistoryV5 struct {
+	Id        int       `gorm:"column:id;primary_key"`
+	MovieId   int       `gorm:"column:movie_id;index"`
+	ChangedAt time.Time `gorm:"column:changed_at"`
+	Source    string    `gorm:"column:source;size:50"`
+	Field     string    `gorm:"column:field;size:50"`
+	OldValue  string    `gorm:"column:old_value;type:text"`
+	NewValue  string    `gorm:"column:new_value;type:text"`
+}
+
+func (m *movieHistoryV5) TableName() string { return "movie_history" }
+
+// migrateMovieHistoryTable creates the movie_history table used by the change history.
+func migrateMovieHistoryTable(tx *gorm.DB) error {
+	return createTableIfMissing(tx, &movieHistoryV5{})
+}
+
+//
+// Version 6
+//
+
+type moviePersonV6 struct {
+	MovieId   int    `gorm:"column:movie_id;primary_key;autoIncrement:false"`
+	PersonId  int    `gorm:"column:person_id;primary_key;autoIncrement:false"`
+	Type      int    `gorm:"column:type;primary_key;autoIncrement:false"`
+	Billing   int    `gorm:"column:billing"`
+	Character string `gorm:"column:character_name;size:255"`
+}
+
+func (m *moviePersonV6) TableName() string { return "movie_person" }
+
+// migrateMoviePersonCredits rebuilds movie_person with the credit type as part of
+// the primary key, so that a person can have several roles on the same movie.
+// The primary key can not be changed in place in SQLite, so the old table is
+// renamed, and its rows are copied to the new table. MySQL commits every step
+// on its own, so if movie_person_v1 is left by a failed run, the copy is redone
+// from it, since the new table may be missing some or all of the rows.
+func migrateMoviePersonCredits(tx *gorm.DB) error {
+	if !tx.Migrator().HasTable("movie_person_v1") {
+		if tx.Migrator().HasColumn(&moviePersonV6{}, "Billing") {
+			return nil
+		}
+		if err := tx.Migrator().RenameTable("movie_person", "movie_person_v1"); err != nil {
+			return fmt.Errorf("failed to rename movie_person: %w", err)
+		}
+	}
+
+	if err := createTableIfMissing(tx, &moviePersonV6{}); err != nil {
+		return err
+	}
+	if err := tx.Exec("DELETE FROM movie_person").Error; err != nil {
+		return fmt.Errorf("failed to clear movie_person: %w", err)
+	}
+
+	err := tx.Exec(`INSERT INTO movie_person (movie_id, person_id, type, billing, character_name)
+		SELECT movie_id, person_id, type, 0, '' FROM movie_person_v1`).Error
+	if err != nil {
+		return fmt.Errorf("failed to copy movie_person: %w", err)
+	}
+
+	if err := tx.Migrator().DropTable("movie_person_v1"); err != nil {
+		return fmt.Errorf("failed to drop movie_person_v1: %w", err)
+	}
+
+	return nil
+}
+
+//
+// Version 7
+//
+
+type personV7 struct {
+	ImdbId string `gorm:"column:imdb_id;size:10;not null;default:'';index"`
+}
+
+func (p *personV7) TableName() string { return "person" }
+
+// migratePersonImdbId adds the imdb_id column used to tell persons with the same name apart.
+func migratePersonImdbId(tx *gorm.DB) error {
+	if err := addColumnIfMissing(tx, &personV7{}, "ImdbId"); err != nil {
+		return err
+	}
+
+	if tx.Migrator().HasIndex(&personV7{}, "ImdbId") {
+		return nil
+	}
+	if err := tx.Migrator().CreateIndex(&personV7{}, "ImdbId"); err != nil {
+		return fmt.Errorf("failed to create index on imdb_id: %w", err)
+	}
+
+	return nil
+}
+
+//
+// Version 8
+//
+
+type genreAliasV8 struct {
+	Id      int    `gorm:"column:id;primary_key"`
+	Name    string `gorm:"column:name;size:255;uniqueIndex"`
+	GenreId int    `gorm:"column:genre_id;index"`
+}
+
+func (a *genreAliasV8) TableName() string { return "genre_alias" }
+
+// migrateGenreAliasTable creates the genre_alias table used when genres are renamed or merged.
+func migrateGenreAliasTable(tx *gorm.DB) error {
+	return createTableIfMissing(tx, &genreAliasV8{})
+}
+
+//
+// Version 9
+//
+
+type tagV9 struct {
+	Id    int    `gorm:"column:id;primary_key"`
+	Name  string `gorm:"column:name;size:100;uniqueIndex"`
+	Color string `gorm:"column:color;size:7"`
+}
+
+func (t *tagV9) TableName() string { return "tag" }
+
+type movieTagV9 struct {
+	MovieId int `gorm:"column:movie_id;primary_key"`
+	TagId   int `gorm:"column:tag_id;primary_key;index"`
+}
+
+func (m *movieTagV9) TableName() string { return "movie_tag" }
+
+// migrateTagTables creates the tag and movie_tag tables used by movie tags.
+func migrateTagTables(tx *gorm.DB) error {
+	if err := createTableIfMissing(tx, &tagV9{}); err != nil {
+		return err
+	}
+	return createTableIfMissing(tx, &movieTagV9{})
+}
+
+//
+// Version 10
+//
+
+type packV10 struct {
+	Id          int    `gorm:"column:id;primary_key"`
+	Name        string `gorm:"column:name;size:255;uniqueIndex"`
+	Description string `gorm:"column:description;type:text"`
+	ImageId     int    `gorm:"column:image_id"`
+}
+
+func (p *packV10) TableName() string { return "pack" }
+
+type movieV10 struct {
+	Id           int    `gorm:"column:id;primary_key"`
+	Pack         string `gorm:"column:pack;size:255"`
+	PackId       int    `gorm:"column:pack_id;not null;default:0;index"`
+	PackPosition int    `gorm:"column:pack_position;not null;default:0"`
+}
+
+func (m *movieV10) TableName() string { return "movies" }
+
+// migratePackTable creates the pack table, and a pack for every pack name used by
+// the movies. Names that only differ in case or surrounding spaces become one pack,
+// named by the most common spelling. The movies are ordered by release year.
+func migratePackTable(tx *gorm.DB) error {
+	if err := createTableIfMissing(tx, &packV10{}); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, &movieV10{}, "PackId"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, &movieV10{}, "PackPosition"); err != nil {
+		return err
+	}
+
+	var movies []movieV10
+	err := tx.Where("pack IS NOT NULL AND TRIM(pack) <> '' AND pack_id = 0").Order("year, title, id").Find(&movies).Error
+	if err != nil {
+		return fmt.Errorf("failed to get movies in packs: %w", err)
+	}
+
+	// Group the movies by pack, keeping the order of the packs and the movies
+	var keys []string
+	groups := make(map[string][]movieV10)
+	for _, movie := range movies {
+		key := strings.ToLower(strings.TrimSpace(movie.Pack))
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], movie)
+	}
+
+	for _, key := range keys {
+		pack := packV10{Name: getMostCommonPackName(groups[key])}
+		if err := tx.Create(&pack).Error; err != nil {
+			return fmt.Errorf("failed to create pack %s: %w", pack.Name, err)
+		}
+
+		for i, movie := range groups[key] {
+			updates := map[string]interface{}{"pack": pack.Name, "pack_id": pack.Id, "pack_position": i + 1}
+			if err := tx.Model(&movieV10{}).Where("id = ?", movie.Id).Updates(updates).Error; err != nil {
+				return fmt.Errorf("failed to add movie to pack %s: %w", pack.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// getMostCommonPackName returns the most common spelling of a pack name, the first one on a tie.
+func getMostCommonPackName(movies []movieV10) string {
+	counts := make(map[string]int)
+	best := ""
+	for _, movie := range movies {
+		name := strings.TrimSpace(movie.Pack)
+		counts[name]++
+		if counts[name] > counts[best] {
+			best = name
+		}
+	}
+	return best
+}
+
+//
+// Version 11
+//
+
+type imageV11 struct {
+	Id   int    `gorm:"column:id;primary_key"`
+	Hash string `gorm:"column:hash;size:64"`
+}
+
+func (i *imageV11) TableName() string { return "image" }
+
+// migrateImageHashColumn adds the content hash of the images, that names the
+// images in the disk cache. Existing images get their hash when they are first
+// read, so that the migration does not have to load every image.
+func migrateImageHashColumn(tx *gorm.DB) error {
+	return addColumnIfMissing(tx, &imageV11{}, "Hash")
+}
+
+//
+// Version 12
+//
+
+type artworkV12 struct {
+	Id        int    `gorm:"column:id;primary_key"`
+	MovieId   int    `gorm:"column:movie_id;index"`
+	ImageId   int    `gorm:"column:image_id"`
+	Kind      string `gorm:"column:kind;size:20"`
+	IsPrimary bool   `gorm:"column:is_primary"`
+}
+
+func (a *artworkV12) TableName() string { return "artwork" }
+
+// migrateArtworkTable creates the artwork table, with the image of every movie as its primary poster.
+func migrateArtworkTable(tx *gorm.DB) error {
+	if err := createTableIfMissing(tx, &artworkV12{}); err != nil {
+		return err
+	}
+
+	err := tx.Exec(`INSERT INTO artwork (movie_id, image_id, kind, is_primary)
+		SELECT id, image_id, 'poster', ? FROM movies
+		WHERE image_id > 0 AND id NOT IN (SELECT movie_id FROM artwork)`, true).Error
+	if err != nil {
+		return fmt.Errorf("failed to add posters to artwork: %w", err)
+	}
+
+	return nil
+}
@@ -1,12 +1,14 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"maps"
 	"os"
 	"path"
+	"slices"
 	"strings"
-	"time"
 
 	"gorm.io/gorm"
 )
@@ -25,6 +27,7 @@ type Movie struct {
 	Size      int      `gorm:"column:size"`
 	Genres    []Genre  `gorm:"-"`
 	Persons   []Person `gorm:"-"`
+	Tags      []Tag    `gorm:"-"`
 
 	ImdbRating float32 `gorm:"column:imdb_rating;"`
 	ImdbUrl    string  `gorm:"column:imdb_url;size:1024"`
@@ -36,8 +39,12 @@ type Movie struct {
 
 	ToWatch       bool         `gorm:"column:to_watch"`
 	Pack          string       `gorm:"column:pack"`
+	PackId        int          `gorm:"column:pack_id"`
+	PackPosition  int          `gorm:"column:pack_position"`
 	NeedsSubtitle bool         `gorm:"column:needsSubtitle"`
 	WatchedAt     sql.NullTime `gorm:"column:watched_at;type=date"`
+	Processed     bool         `gorm:"column:processed"`
+	TrashedAt     sql.NullTime `gorm:"column:trashed_at"`
 }
 
 var personType = map[string]int{
@@ -53,47 +60,54 @@ func (m *Movie) TableName() string {
 }
 
 // SearchMovies returns all movies in the database that matches the search criteria.
-func (d *Database) SearchMovies(currentView string, searchFor string, genreId int, orderBy string) ([]*Movie, error) {
+// The search is parsed with ParseQuery, and a *QuerySyntaxError is returned if it is malformed.
+func (d *Database) SearchMovies(ctx context.Context, currentView string, searchFor string, genreId int, orderBy string) ([]*Movie, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	var (
-		movies                        []*Movie
-		sqlJoin, sqlWhere, sqlOrderBy string
-		sqlArgs                       map[string]interface{}
+		movies     []*Movie
+		sqlOrderBy string
 	)
 
 	if currentView == "packs" && orderBy == "title asc" {
-		sqlOrderBy = "pack asc, " + orderBy
+		sqlOrderBy = "pack asc, pack_position asc, " + orderBy
 	} else {
 		sqlOrderBy = orderBy
 	}
 
-	parts := strings.Split(searchFor, ":")
-	typ, ok := personType[parts[0]]
-	if ok {
-		searchFor = searchFor[len(parts[0])+1:]
-		sqlJoin, sqlWhere, sqlArgs = getPersonSearch(searchFor, typ)
-	} else if genreId == -1 {
-		sqlWhere, sqlArgs = getStandardSearch(searchFor)
-	} else {
-		sqlJoin, sqlWhere, sqlArgs = getGenreSearch(searchFor, genreId)
+	search, err := ParseQuery(searchFor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse search: %w", err)
 	}
 
+	sqlWhere, sqlArgs := search.sql()
+	if genreId != -1 {
+		sqlWhere, sqlArgs = addGenreSQL(genreId, sqlWhere, sqlArgs)
+	}
 	sqlWhere = addViewSQL(currentView, sqlWhere)
 
-	query, err := d.getQuery(sqlJoin, sqlWhere, sqlArgs, sqlOrderBy)
+	db, err := d.getDatabase(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get query : %w", err)
+		return nil, fmt.Errorf("failed to get database: %w", err)
 	}
 
-	if err := query.Distinct().Find(&movies).Error; err != nil {
+	query := getQuery(db, sqlWhere, sqlArgs, sqlOrderBy)
+	if err := query.Find(&movies).Error; err != nil {
 		return nil, fmt.Errorf("failed to find movies: %w", err)
 	}
 
-	movies, err = d.getGenresForMovies(movies)
+	movies, err = d.getGenresForMovieList(db, movies)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get genres for movies: %w", err)
 	}
 
-	movies, err = d.getImagesForMovies(movies)
+	movies, err = d.getTagsForMovieList(db, movies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags for movies: %w", err)
+	}
+
+	movies, err = d.getImagesForMovies(db, movies)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get images for movies: %w", err)
 	}
@@ -101,31 +115,20 @@ func (d *Database) SearchMovies(currentView string, searchFor string, genreId in
 	return movies, nil
 }
 
-func (d *Database) getQuery(sqlJoin string, sqlWhere string, sqlArgs map[string]interface{}, sqlOrderBy string) (*gorm.DB, error) {
-	db, err := d.getDatabase()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get database: %w", err)
-	}
-
-	if sqlJoin != "" {
-		db = db.Joins(sqlJoin)
-	}
+func getQuery(db *gorm.DB, sqlWhere string, sqlArgs []interface{}, sqlOrderBy string) *gorm.DB {
 	if sqlWhere != "" {
-		if len(sqlArgs) == 0 {
-			db = db.Where(sqlWhere)
-		} else {
-			db = db.Where(sqlWhere, sqlArgs)
-		}
+		db = db.Where(sqlWhere, sqlArgs...)
 	}
 
-	db = db.Order(sqlOrderBy)
-
-	return db, nil
+	return db.Order(sqlOrderBy)
 }
 
 // GetAllMoviePaths returns a list of all the movie paths in the database. Used when adding new movies.
-func (d *Database) GetAllMoviePaths() ([]string, error) {
-	db, err := d.getDatabase()
+func (d *Database) GetAllMoviePaths(ctx context.Context) ([]string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get database: %w", err)
 	}
@@ -143,8 +146,11 @@ func (d *Database) GetAllMoviePaths() ([]string, error) {
 }
 
 // GetAllMovieTitles returns a list of all the movie titles in the database. Used when adding new movies.
-func (d *Database) GetAllMovieTitles() ([]string, error) {
-	db, err := d.getDatabase()
+func (d *Database) GetAllMovieTitles(ctx context.Context) ([]string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get database: %w", err)
 	}
@@ -166,36 +172,52 @@ func (d *Database) GetAllMovieTitles() ([]string, error) {
 }
 
 // InsertMovie adds a new movie to the database.
-func (d *Database) InsertMovie(movie *Movie) error {
-	db, err := d.getDatabase()
-	if err != nil {
-		return fmt.Errorf("failed to get database: %w", err)
-	}
+func (d *Database) InsertMovie(ctx context.Context, movie *Movie) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 
-	err = db.Transaction(
+	// The ids that are set during the insert are not valid if it is rolled back
+	id, imageId, packId, packPosition := movie.Id, movie.ImageId, movie.PackId, movie.PackPosition
+
+	err := d.transaction(ctx,
 		func(tx *gorm.DB) error {
 			// Insert image
 			if movie.HasImage && len(movie.Image) > 0 {
-				image := image{Data: movie.Image}
-				err = d.createImage(&image)
-				if err != nil {
+				image := imageNew(movie.Image)
+				if err := d.createImage(tx, image); err != nil {
 					return fmt.Errorf("failed to create image: %w", err)
 				}
 				movie.ImageId = image.Id
 			}
 
-			if err := db.Create(movie).Error; err != nil {
+			if err := d.assignPack(tx, movie); err != nil {
+				return fmt.Errorf("failed to get or insert pack: %w", err)
+			}
+
+			if err := tx.Create(movie).Error; err != nil {
 				return fmt.Errorf("failed to create movie: %w", err)
 			}
 
+			if movie.ImageId > 0 {
+				poster := &Artwork{MovieId: movie.Id, ImageId: movie.ImageId, Kind: ArtworkPoster, IsPrimary: true}
+				if err := tx.Create(poster).Error; err != nil {
+					return fmt.Errorf("failed to create poster artwork: %w", err)
+				}
+			}
+
+			created := MovieChange{MovieId: movie.Id, Field: historyFieldCreated, NewValue: movie.Title}
+			if err := d.recordChanges(tx, created); err != nil {
+				return err
+			}
+
 			// Handle genres
 			for i := range movie.Genres {
-				genre, err := d.getOrInsertGenre(&movie.Genres[i])
+				genre, err := d.getOrInsertGenre(tx, &movie.Genres[i])
 				if err != nil {
 					return fmt.Errorf("failed to get or create movie genre: %w", err)
 				}
 
-				err = d.InsertMovieGenre(movie, genre)
+				err = d.insertMovieGenre(tx, movie, genre)
 				if err != nil {
 					return fmt.Errorf("failed to insert movie genre id: %w", err)
 				}
@@ -203,137 +225,139 @@ func (d *Database) InsertMovie(movie *Movie) error {
 
 			// Handle persons
 			for _, person := range movie.Persons {
-				// To prevent a problem with the type getting overwritten
-				// with the zero value (0 = Director) for existing persons
-				t := person.Type
+				// To prevent a problem with the credit getting overwritten
+				// with the zero values (0 = Director) for existing persons
+				t, billing, character := person.Type, person.Billing, person.Character
 
-				p, err := d.GetPerson(person.Name)
+				p, err := d.getOrInsertPerson(tx, &person)
 				if err != nil {
-					return fmt.Errorf("failed to get person: %w", err)
-				}
-
-				if p == nil {
-					p, err = d.InsertPerson(&person)
-					if err != nil {
-						return fmt.Errorf("failed to insert person: %w", err)
-					}
+					return fmt.Errorf("failed to get or insert person: %w", err)
 				}
 
-				p.Type = t
+				p.Type, p.Billing, p.Character = t, billing, character
 
-				err = d.InsertMoviePerson(movie, p)
+				err = d.insertMoviePerson(tx, movie, p)
 				if err != nil {
 					return fmt.Errorf("failed to update movie person id: %w", err)
 				}
 			}
 
+			// Handle tags
+			if len(movie.Tags) > 0 {
+				if err := d.setMovieTags(tx, movie, movie.Tags); err != nil {
+					return fmt.Errorf("failed to insert movie tags: %w", err)
+				}
+			}
+
 			return nil
 		},
 	)
-
-	// Check transaction error
 	if err != nil {
+		movie.Id, movie.ImageId, movie.PackId, movie.PackPosition = id, imageId, packId, packPosition
 		return err
 	}
 
 	return nil
 }
 
-// UpdateMovie update a movie.
-func (d *Database) UpdateMovie(movie *Movie) error {
-	db, err := d.getDatabase()
-	if err != nil {
-		return fmt.Errorf("failed to get database: %w", err)
-	}
+// UpdateMovie updates a movie and adds any new genres. The tags of the movie
+// are replaced with movie.Tags, unless it is nil.
+func (d *Database) UpdateMovie(ctx context.Context, movie *Movie) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 
-	err = db.Transaction(
+	return d.transaction(ctx,
 		func(tx *gorm.DB) error {
-			updates := make(map[string]interface{}, 12)
-
-			updates["title"] = movie.Title
-			updates["sub_title"] = movie.SubTitle
-			updates["story_line"] = movie.StoryLine
-			updates["imdb_rating"] = movie.ImdbRating
-			updates["imdb_url"] = movie.ImdbUrl
-			updates["year"] = movie.Year
-			updates["my_rating"] = movie.MyRating
-			updates["to_watch"] = movie.ToWatch
-			updates["image_id"] = movie.ImageId
-			updates["pack"] = movie.Pack
-			updates["needsSubtitle"] = movie.NeedsSubtitle
-			updates["length"] = movie.Runtime
-			if movie.WatchedAt.Valid {
-				updates["watched_at"] = movie.WatchedAt.Time
+			before := Movie{}
+			if err := tx.First(&before, movie.Id).Error; err != nil {
+				return fmt.Errorf("failed to get movie: %w", err)
 			}
 
-			if err := db.Model(&movie).Updates(updates).Error; err != nil {
+			if err := d.assignPack(tx, movie); err != nil {
+				return fmt.Errorf("failed to get or insert pack: %w", err)
+			}
+
+			updates := getMovieUpdates(movie)
+			if err := tx.Model(&movie).Updates(updates).Error; err != nil {
 				return fmt.Errorf("failed to update movie: %w", err)
 			}
 
+			changes := getMovieChanges(&before, movie, slices.Sorted(maps.Keys(updates)))
+			if err := d.recordChanges(tx, changes...); err != nil {
+				return err
+			}
+
 			// Handle genres
 			for i := range movie.Genres {
-				genre, err := d.getOrInsertGenre(&movie.Genres[i])
+				genre, err := d.getOrInsertGenre(tx, &movie.Genres[i])
 				if err != nil {
 					return fmt.Errorf("failed to get or insert movie genre: %w", err)
 				}
 
-				err = d.getOrInsertMovieGenre(movie, genre)
+				added, err := d.getOrInsertMovieGenre(tx, movie, genre)
 				if err != nil {
 					return fmt.Errorf("failed to update movie genre id: %w", err)
 				}
+				if added {
+					change := MovieChange{MovieId: movie.Id, Field: historyFieldGenre, NewValue: genre.Name}
+					if err := d.recordChanges(tx, change); err != nil {
+						return err
+					}
+				}
 			}
 
+			if movie.Tags != nil {
+				return d.setMovieTags(tx, movie, movie.Tags)
+			}
 			return nil
 		},
 	)
-
-	// Check transaction error
-	if err != nil {
-		return err
-	}
-
-	return nil
 }
 
-func (d *Database) UpdateWatchedAt(movie *Movie) error {
-	movie.WatchedAt = sql.NullTime{
-		Time:  time.Now(),
-		Valid: true,
-	}
-
-	err := d.UpdateMovie(movie)
-	if err != nil {
-		return fmt.Errorf("failed to update watched_at : %w", err)
-	}
-
-	return nil
+// getMovieUpdates returns the columns that UpdateMovie updates, and their new values.
+func getMovieUpdates(movie *Movie) map[string]interface{} {
+	updates := make(map[string]interface{}, 15)
+
+	updates["title"] = movie.Title
+	updates["sub_title"] = movie.SubTitle
+	updates["story_line"] = movie.StoryLine
+	updates["imdb_rating"] = movie.ImdbRating
+	updates["imdb_url"] = movie.ImdbUrl
+	updates["year"] = movie.Year
+	updates["my_rating"] = movie.MyRating
+	updates["to_watch"] = movie.ToWatch
+	updates["image_id"] = movie.ImageId
+	updates["pack"] = movie.Pack
+	updates["pack_id"] = movie.PackId
+	updates["pack_position"] = movie.PackPosition
+	updates["needsSubtitle"] = movie.NeedsSubtitle
+	updates["length"] = movie.Runtime
+	if movie.WatchedAt.Valid {
+		updates["watched_at"] = movie.WatchedAt.Time
+	}
+
+	return updates
 }
 
 // UpdateMoviePersons update a movie with its directors, writers and actors.
-func (d *Database) UpdateMoviePersons(movie *Movie) error {
-	db, err := d.getDatabase()
-	if err != nil {
-		return fmt.Errorf("failed to get database: %w", err)
-	}
+func (d *Database) UpdateMoviePersons(ctx context.Context, movie *Movie) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 
-	err = db.Transaction(
+	return d.transaction(ctx,
 		func(tx *gorm.DB) error {
 			// Handle persons
 			for i := range movie.Persons {
-				person, err := d.GetPerson(movie.Persons[i].Name)
+				person, err := d.getOrInsertPerson(tx, &movie.Persons[i])
 				if err != nil {
-					return fmt.Errorf("failed to get person: %w", err)
-				}
-				if person == nil {
-					person, err = d.InsertPerson(&movie.Persons[i])
-					if err != nil {
-						return fmt.Errorf("failed to insert person: %w", err)
-					}
+					return fmt.Errorf("failed to get or insert person: %w", err)
 				}
 
 				person.Type = movie.Persons[i].Type
+				person.Billing = movie.Persons[i].Billing
+				person.Character = movie.Persons[i].Character
 
-				err = d.InsertMoviePerson(movie, person)
+				err = d.insertMoviePerson(tx, movie, person)
 				if err != nil {
 					return fmt.Errorf("failed to update movie person id: %w", err)
 				}
@@ -342,8 +366,20 @@ func (d *Database) UpdateMoviePersons(movie *Movie) error {
 			return nil
 		},
 	)
+}
+
+// DeleteMovie removes a movie from the database, and its folder under rootDir.
+// Use TrashMovie to delete a movie in a way that can be undone.
+func (d *Database) DeleteMovie(ctx context.Context, rootDir string, movie *Movie) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if err := d.deleteMovieData(ctx, movie); err != nil {
+		return err
+	}
 
-	// Check transaction error
+	moviePath := path.Join(rootDir, movie.MoviePath)
+	err := os.RemoveAll(moviePath)
 	if err != nil {
 		return err
 	}
@@ -351,46 +387,45 @@ func (d *Database) UpdateMoviePersons(movie *Movie) error {
 	return nil
 }
 
-// DeleteMovie removes a movie from the database.
-func (d *Database) DeleteMovie(rootDir string, movie *Movie) error {
-	db, err := d.getDatabase()
-	if err != nil {
-		return fmt.Errorf("failed to get database: %w", err)
-	}
-
-	err = db.Transaction(
+// deleteMovieData removes a movie, including its image, genres, persons, tags and viewings, from the database.
+func (d *Database) deleteMovieData(ctx context.Context, movie *Movie) error {
+	return d.transaction(ctx,
 		func(tx *gorm.DB) error {
-			if err = d.deleteImage(movie); err != nil {
+			if err := d.deleteArtworkForMovie(tx, movie); err != nil {
+				return fmt.Errorf("failed to delete movie artwork: %w", err)
+			}
+
+			if err := d.deleteImage(tx, movie); err != nil {
 				return fmt.Errorf("failed to delete movie image: %w", err)
 			}
 
-			if err = d.deleteGenresForMovie(movie); err != nil {
+			if err := d.deleteGenresForMovie(tx, movie); err != nil {
 				return fmt.Errorf("failed to delete movie genres: %w", err)
 			}
 
-			if err = d.deletePersonsForMovie(movie); err != nil {
+			if err := d.deletePersonsForMovie(tx, movie); err != nil {
 				return fmt.Errorf("failed to delete movie persons: %w", err)
 			}
 
-			if result := db.Delete(movie, movie.Id); result.Error != nil {
+			if err := d.deleteTagsForMovie(tx, movie); err != nil {
+				return fmt.Errorf("failed to delete movie tags: %w", err)
+			}
+
+			if err := d.deleteViewingsForMovie(tx, movie); err != nil {
+				return fmt.Errorf("failed to delete movie viewings: %w", err)
+			}
+
+			if err := d.deleteHistoryForMovie(tx, movie); err != nil {
+				return fmt.Errorf("failed to delete movie history: %w", err)
+			}
+
+			if result := tx.Delete(movie, movie.Id); result.Error != nil {
 				return fmt.Errorf("failed to delete movie: %w", result.Error)
 			}
 
 			return nil
 		},
 	)
-
-	if err != nil {
-		return err
-	}
-
-	moviePath := path.Join(rootDir, movie.MoviePath)
-	err = os.RemoveAll(moviePath)
-	if err != nil {
-		return err
-	}
-
-	return nil
 }
 
 // addViewSQL returns a combined SQL WHERE clause based on the given view and optional base clause.
@@ -407,6 +442,12 @@ func addViewSQL(view, baseWhere string) string {
 		viewWhere = ""
 	}
 
+	// Trashed movies are only shown in the trash view
+	trashWhere := "trashed_at IS NULL"
+	if view == "trash" {
+		trashWhere = "trashed_at IS NOT NULL"
+	}
+
 	var clauses []string
 
 	if baseWhere != "" {
@@ -415,163 +456,113 @@ func addViewSQL(view, baseWhere string) string {
 	if viewWhere != "" {
 		clauses = append(clauses, viewWhere)
 	}
+	clauses = append(clauses, trashWhere)
 
 	return strings.Join(clauses, " AND ")
 }
 
-func getGenreSearch(searchFor string, genreId int) (join string, where string, args map[string]interface{}) {
-	join = "JOIN movie_genre ON movies.id = movie_genre.movie_id"
-	args = map[string]interface{}{
-		"genre": genreId,
-	}
+// addGenreSQL adds a condition for the genre selected in the genre menu to the WHERE clause.
+func addGenreSQL(genreId int, baseWhere string, args []interface{}) (string, []interface{}) {
+	where := "EXISTS (SELECT 1 FROM movie_genre WHERE movie_genre.movie_id = movies.id AND movie_genre.genre_id = ?)"
+	args = append(args, genreId)
 
-	if searchFor == "" {
-		where = "movie_genre.genre_id = @genre"
-	} else {
-		where = `(title LIKE @search OR sub_title LIKE @search OR year LIKE @search OR story_line LIKE @search)
-		         AND movie_genre.genre_id = @genre`
-		args["search"] = "%" + searchFor + "%"
+	if baseWhere != "" {
+		where = baseWhere + " AND " + where
 	}
 
-	return
+	return where, args
 }
 
-func getPersonSearch(searchFor string, typ int) (join string, where string, args map[string]interface{}) {
-	join = `
-		JOIN movie_person ON movies.id = movie_person.movie_id
-		JOIN person ON person.id = movie_person.person_id
-	`
+func (d *Database) getImagesForMovies(db *gorm.DB, movies []*Movie) ([]*Movie, error) {
+	// Collect the images that are not in the memory cache
+	var imageIds []int
+	for _, movie := range movies {
+		if movie.ImageId <= 0 {
+			continue
+		}
 
-	where = "person.name LIKE @search"
-	args = map[string]interface{}{
-		"search": "%" + searchFor + "%",
+		// Check cache for image
+		if img := d.imageCache.load(movie.ImageId); img != nil {
+			movie.Image = img
+			movie.HasImage = true
+			continue
+		}
+		imageIds = append(imageIds, movie.ImageId)
 	}
 
-	if typ >= 0 && typ <= 2 {
-		where += " AND movie_person.type = @type"
-		args["type"] = typ
+	// Load the missing images from the disk cache or the database,
+	// and store them in the memory cache
+	images, err := d.readImages(db, imageIds)
+	if err != nil {
+		return nil, err
 	}
-
-	return
-}
-
-func getStandardSearch(searchFor string) (string, map[string]interface{}) {
-	sqlArgs := make(map[string]interface{})
-	var conditions []string
-
-	if searchFor != "" {
-		prefix, search := getSearchPrefix(searchFor)
-		var condition string
-
-		switch prefix {
-		case "title":
-			condition = "title LIKE @search OR sub_title LIKE @search"
-		case "year":
-			condition = "year LIKE @search"
-		case "pack":
-			condition = "pack LIKE @search"
-		case "imdb":
-			condition = "imdb_rating >= @search"
-		case "myrating":
-			condition = "my_rating >= @search"
-		default:
-			condition = "title LIKE @search OR sub_title LIKE @search OR year LIKE @search OR story_line LIKE @search"
+	for _, movie := range movies {
+		if img, ok := images[movie.ImageId]; ok {
+			movie.Image = img
+			movie.HasImage = true
+			d.imageCache.save(movie.ImageId, img)
 		}
-
-		conditions = append(conditions, "("+condition+")")
-		sqlArgs["search"] = search
 	}
 
-	sqlWhere := strings.Join(conditions, " AND ")
-
-	return sqlWhere, sqlArgs
+	return movies, nil
 }
 
-func getSearchPrefix(searchFor string) (string, string) {
-	before, after, _ := strings.Cut(searchFor, ":")
-	before = strings.TrimSpace(before)
-	after = strings.TrimSpace(after)
-
-	switch before {
-	case "title", "pack":
-		return before, "%" + after + "%"
-	case "year", "imdb", "myrating":
-		return before, after
-	default:
-		return "", "%" + searchFor + "%"
+func (d *Database) getGenresForMovieList(db *gorm.DB, movies []*Movie) ([]*Movie, error) {
+	genres, err := d.getGenresForMovies(db, getMovieIds(movies))
+	if err != nil {
+		return nil, err
 	}
-}
-
-func (d *Database) getImagesForMovies(movies []*Movie) ([]*Movie, error) {
-	// Get images for movies
-	for i := range movies {
-		movie := movies[i]
-
-		// Check cache for image
-		img := d.imageCache.load(movie.ImageId)
-		if img != nil {
-			movie.Image = img
-			continue
-		}
 
-		// The image is not in the cache, so load it from the database
-		// and store it in the cache
-		d.getImageForMovie(movie)
-		d.imageCache.save(movie.ImageId, movie.Image)
+	for _, movie := range movies {
+		movie.Genres = genres[movie.Id]
 	}
 	return movies, nil
 }
 
-func (d *Database) getGenresForMovies(movies []*Movie) ([]*Movie, error) {
-	// Get images for movies
-	for i := range movies {
-		movie := movies[i]
+// GetPersonsForMovies loads the persons for all the given movies.
+func (d *Database) GetPersonsForMovies(ctx context.Context, movies []*Movie) ([]*Movie, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 
-		// Load genres
-		genres, err := d.getGenresForMovie(movie)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get genres for movie (%d: %s): %w", movie.Id, movie.Title, err)
-		}
-		movie.Genres = genres
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
 	}
-	return movies, nil
-}
 
-func (d *Database) GetPersonsForMovies(movies []*Movie) ([]*Movie, error) {
-	// Get images for movies
-	for i := range movies {
-		movie := movies[i]
+	persons, err := d.getPersonsForMovies(db, getMovieIds(movies))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get persons for movies: %w", err)
+	}
 
-		// Load persons
-		persons, err := d.GetPersonsForMovie(movie)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get person for movie (%d: %s): %w", movie.Id, movie.Title, err)
-		}
-		movie.Persons = persons
+	for _, movie := range movies {
+		movie.Persons = persons[movie.Id]
 	}
 	return movies, nil
 }
 
-func (d *Database) getImageForMovie(movie *Movie) {
-
-	// Get image (if it exists)
-	if movie.ImageId > 0 {
-		img, err := d.readImage(movie.ImageId)
-		if err != nil {
-			return
-		}
-		movie.Image = img.Data
-		movie.HasImage = true
+func getMovieIds(movies []*Movie) []int {
+	ids := make([]int, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.Id
 	}
+	return ids
 }
 
 // SetProcessed sets the movie as processed
-func (d *Database) SetProcessed(movie *Movie) error {
-	db, err := d.getDatabase()
+func (d *Database) SetProcessed(ctx context.Context, movie *Movie) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get database: %w", err)
 	}
 
+	before := Movie{}
+	if err := db.First(&before, movie.Id).Error; err != nil {
+		return fmt.Errorf("failed to get movie: %w", err)
+	}
+
 	updates := make(map[string]interface{}, 1)
 
 	updates["processed"] = true
@@ -580,5 +571,7 @@ func (d *Database) SetProcessed(movie *Movie) error {
 		return fmt.Errorf("failed to movie as processed: %w", err)
 	}
 
-	return nil
+	after := before
+	after.Processed = true
+	return d.recordChanges(db, getMovieChanges(&before, &after, []string{"processed"})...)
 }
@@ -1,7 +1,10 @@
 package data
 
 import (
+	"context"
 	"fmt"
+
+	"gorm.io/gorm"
 )
 
 // MovieGenre represents a Genre and a movie.
@@ -16,12 +19,20 @@ func (m *MovieGenre) TableName() string {
 }
 
 // InsertMovieGenre inserts a movie Genre into the database.
-func (d *Database) InsertMovieGenre(movie *Movie, Genre *Genre) error {
-	db, err := d.getDatabase()
+func (d *Database) InsertMovieGenre(ctx context.Context, movie *Movie, Genre *Genre) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get database: %w", err)
 	}
 
+	return d.insertMovieGenre(db, movie, Genre)
+}
+
+// insertMovieGenre inserts a movie genre, using db, which can be a transaction.
+func (d *Database) insertMovieGenre(db *gorm.DB, movie *Movie, Genre *Genre) error {
 	movieGenre := MovieGenre{
 		MovieId: movie.Id,
 		GenreId: Genre.Id,
@@ -31,39 +42,48 @@ func (d *Database) InsertMovieGenre(movie *Movie, Genre *Genre) error {
 		return fmt.Errorf("failed to insert movie genre: %w", err)
 	}
 
-	return nil
+	return d.recordChanges(db, MovieChange{MovieId: movie.Id, Field: historyFieldGenre, NewValue: Genre.Name})
 }
 
 // RemoveMovieGenre removes a movie genre from the database.
 // RemoveMovieGenre removes a genre association from a movie.
-func (d *Database) RemoveMovieGenre(movie *Movie, genre *Genre) error {
-	db, err := d.getDatabase()
+func (d *Database) RemoveMovieGenre(ctx context.Context, movie *Movie, genre *Genre) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get database: %w", err)
 	}
 
-	if err := db.Exec("DELETE FROM movie_genre WHERE movie_id = ? AND genre_id = ?", movie.Id, genre.Id).Error; err != nil {
-		return fmt.Errorf("failed to delete movie_genre for movie ID %d and genre ID %d: %w", movie.Id, genre.Id, err)
+	return d.removeMovieGenre(db, movie, genre)
+}
+
+// removeMovieGenre removes a genre association from a movie, using db, which can be a transaction.
+func (d *Database) removeMovieGenre(db *gorm.DB, movie *Movie, genre *Genre) error {
+	result := db.Exec("DELETE FROM movie_genre WHERE movie_id = ? AND genre_id = ?", movie.Id, genre.Id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete movie_genre for movie ID %d and genre ID %d: %w", movie.Id, genre.Id, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
 	}
 
-	return nil
+	return d.recordChanges(db, MovieChange{MovieId: movie.Id, Field: historyFieldGenre, OldValue: genre.Name})
 }
 
 // getOrInsertMovieGenre creates a movie_genre record if it does not exist.
-func (d *Database) getOrInsertMovieGenre(movie *Movie, genre *Genre) error {
-	db, err := d.getDatabase()
-	if err != nil {
-		return fmt.Errorf("failed to get database: %w", err)
-	}
-
+// It returns true if the record was created.
+func (d *Database) getOrInsertMovieGenre(db *gorm.DB, movie *Movie, genre *Genre) (bool, error) {
 	movieGenre := MovieGenre{
 		MovieId: movie.Id,
 		GenreId: genre.Id,
 	}
 
-	if err := db.FirstOrCreate(&movieGenre).Error; err != nil {
-		return fmt.Errorf("failed to get or insert movie genre: %w", err)
+	result := db.FirstOrCreate(&movieGenre)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to get or insert movie genre: %w", result.Error)
 	}
 
-	return nil
+	return result.RowsAffected > 0, nil
 }
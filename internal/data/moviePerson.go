@@ -1,12 +1,22 @@
 package data
 
-import "fmt"
+import (
+	"context"
+	"fmt"
 
-// MoviePerson represents a person (director, writer or actor) and a movie.
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MoviePerson represents a credit of a person (director, writer or actor) on a movie.
+// Billing is the order of the credit within its type, and Character is the
+// name of the character that an actor plays.
 type MoviePerson struct {
-	MovieId  int `gorm:"column:movie_id;primary_key;"`
-	PersonId int `gorm:"column:person_id;primary_key;"`
-	Type     int `gorm:"column:type;"`
+	MovieId   int    `gorm:"column:movie_id;primary_key;"`
+	PersonId  int    `gorm:"column:person_id;primary_key;"`
+	Type      int    `gorm:"column:type;primary_key;"`
+	Billing   int    `gorm:"column:billing"`
+	Character string `gorm:"column:character_name;size:255"`
 }
 
 // TableName returns the person's table name.
@@ -14,21 +24,37 @@ func (m *MoviePerson) TableName() string {
 	return "movie_person"
 }
 
-// InsertMoviePerson inserts a person (director, writer or actor) into the database.
-func (d *Database) InsertMoviePerson(movie *Movie, person *Person) error {
-	db, err := d.getDatabase()
+// InsertMoviePerson adds a credit for a person (director, writer or actor) to a movie, using
+// the person's Type, Billing and Character. Existing credits are left untouched.
+func (d *Database) InsertMoviePerson(ctx context.Context, movie *Movie, person *Person) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get database: %w", err)
 	}
 
+	return d.insertMoviePerson(db, movie, person)
+}
+
+// insertMoviePerson adds a credit to a movie, using db, which can be a transaction.
+func (d *Database) insertMoviePerson(db *gorm.DB, movie *Movie, person *Person) error {
 	moviePerson := MoviePerson{
-		MovieId:  movie.Id,
-		PersonId: person.Id,
-		Type:     int(person.Type),
+		MovieId:   movie.Id,
+		PersonId:  person.Id,
+		Type:      int(person.Type),
+		Billing:   person.Billing,
+		Character: person.Character,
 	}
 
-	if err := db.FirstOrCreate(&moviePerson).Error; err != nil {
-		return fmt.Errorf("failed to get or insert movie person: %w", err)
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&moviePerson)
+	if result.Error != nil {
+		return fmt.Errorf("failed to insert movie person: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
 	}
-	return nil
+
+	return d.recordChanges(db, MovieChange{MovieId: movie.Id, Field: historyFieldPerson, NewValue: getPersonHistoryValue(person)})
 }
@@ -3,6 +3,8 @@ package data
 import (
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+
 	"github.com/hultan/softimdb/internal/config"
 )
 
@@ -21,7 +23,7 @@ func TestDatabase_InsertMoviePerson(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	movie, err := getMovie(d)
+	movie, err := getMovie(t.Context(), d)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -31,9 +33,56 @@ func TestDatabase_InsertMoviePerson(t *testing.T) {
 		Type: 0,
 	}
 
-	if err := d.InsertMoviePerson(movie, person); err != nil {
+	if err := d.InsertMoviePerson(t.Context(), movie, person); err != nil {
 		t.Errorf("InsertMoviePerson() error = %v", err)
 	}
 
 	d.CloseDatabase()
 }
+
+func TestRepository_MultiRoleCredits(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			heat := movies[2]
+
+			heat.Persons = []Person{
+				{Name: "Robert De Niro", Type: Actor, Billing: 2, Character: "Neil McCauley"},
+				{Name: "Al Pacino", Type: Actor, Billing: 1, Character: "Vincent Hanna"},
+				// Already credited, so the credit is left as it is
+				{Name: "Michael Mann", Type: Writer, Billing: 5},
+			}
+			if err := r.UpdateMoviePersons(t.Context(), heat); err != nil {
+				t.Fatalf("UpdateMoviePersons() error = %v", err)
+			}
+
+			persons, err := r.GetPersonsForMovie(t.Context(), heat)
+			if err != nil {
+				t.Fatalf("GetPersonsForMovie() error = %v", err)
+			}
+
+			type credit struct {
+				name      string
+				typ       PersonType
+				billing   int
+				character string
+			}
+			var credits []credit
+			for _, person := range persons {
+				credits = append(credits, credit{person.Name, person.Type, person.Billing, person.Character})
+			}
+			assert.Equal(t, []credit{
+				{"Michael Mann", Director, 0, ""},
+				{"Michael Mann", Writer, 0, ""},
+				{"Al Pacino", Actor, 1, "Vincent Hanna"},
+				{"Robert De Niro", Actor, 2, "Neil McCauley"},
+			}, credits)
+
+			found, err := r.SearchMovies(t.Context(), "all", "writer:mann", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Heat"}, movieTitles(found))
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MovieTag represents a tag on a movie.
+type MovieTag struct {
+	MovieId int `gorm:"column:movie_id;primary_key"`
+	TagId   int `gorm:"column:tag_id;primary_key"`
+}
+
+// TableName returns the movie_tag table name.
+func (m *MovieTag) TableName() string {
+	return "movie_tag"
+}
+
+// SetMovieTags replaces the tags of a movie. Tags that do not exist yet are inserted,
+// using the tag names. The added and removed tags are recorded in the movie history.
+func (d *Database) SetMovieTags(ctx context.Context, movie *Movie, tags []Tag) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	return d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			return d.setMovieTags(tx, movie, tags)
+		},
+	)
+}
+
+// setMovieTags replaces the tags of a movie, using db, which should be a transaction.
+func (d *Database) setMovieTags(db *gorm.DB, movie *Movie, tags []Tag) error {
+	current, err := d.getTagsForMovies(db, []int{movie.Id})
+	if err != nil {
+		return err
+	}
+
+	var result []Tag
+	var changes []MovieChange
+	for i := range tags {
+		tag, err := d.getOrInsertTag(db, &tags[i])
+		if err != nil {
+			return fmt.Errorf("failed to get or insert tag: %w", err)
+		}
+		if slices.ContainsFunc(result, func(t Tag) bool { return t.Id == tag.Id }) {
+			continue
+		}
+		result = append(result, *tag)
+
+		insert := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&MovieTag{MovieId: movie.Id, TagId: tag.Id})
+		if insert.Error != nil {
+			return fmt.Errorf("failed to insert movie tag: %w", insert.Error)
+		}
+		if insert.RowsAffected > 0 {
+			changes = append(changes, MovieChange{MovieId: movie.Id, Field: historyFieldTag, NewValue: tag.Name})
+		}
+	}
+
+	for _, tag := range current[movie.Id] {
+		if slices.ContainsFunc(result, func(t Tag) bool { return t.Id == tag.Id }) {
+			continue
+		}
+		if err := db.Where("movie_id = ? AND tag_id = ?", movie.Id, tag.Id).Delete(&MovieTag{}).Error; err != nil {
+			return fmt.Errorf("failed to delete movie tag: %w", err)
+		}
+		changes = append(changes, MovieChange{MovieId: movie.Id, Field: historyFieldTag, OldValue: tag.Name})
+	}
+
+	if err := d.recordChanges(db, changes...); err != nil {
+		return err
+	}
+
+	sortTags(result)
+	movie.Tags = result
+
+	return nil
+}
+
+// getTagsForMovies returns the tags of each of the given movies, keyed by movie id.
+func (d *Database) getTagsForMovies(db *gorm.DB, movieIds []int) (map[int][]Tag, error) {
+	result := make(map[int][]Tag, len(movieIds))
+	if len(movieIds) == 0 {
+		return result, nil
+	}
+
+	var rows []struct {
+		MovieId int `gorm:"column:movie_id"`
+		Tag
+	}
+	err := db.Table("movie_tag").
+		Select("movie_tag.movie_id, tag.id, tag.name, tag.color").
+		Joins("JOIN tag ON tag.id = movie_tag.tag_id").
+		Where("movie_tag.movie_id IN ?", movieIds).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query movie tags: %w", err)
+	}
+
+	for _, row := range rows {
+		result[row.MovieId] = append(result[row.MovieId], row.Tag)
+	}
+	for _, tags := range result {
+		sortTags(tags)
+	}
+
+	return result, nil
+}
+
+// getTagsForMovieList loads the tags for all the given movies.
+func (d *Database) getTagsForMovieList(db *gorm.DB, movies []*Movie) ([]*Movie, error) {
+	tags, err := d.getTagsForMovies(db, getMovieIds(movies))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, movie := range movies {
+		movie.Tags = tags[movie.Id]
+	}
+	return movies, nil
+}
+
+// deleteTagsForMovie removes all tags from the given movie.
+func (d *Database) deleteTagsForMovie(db *gorm.DB, movie *Movie) error {
+	if err := db.Where("movie_id = ?", movie.Id).Delete(&MovieTag{}).Error; err != nil {
+		return fmt.Errorf("failed to delete movie tags: %w", err)
+	}
+
+	return nil
+}
+
+// sortTags sorts tags by name, ignoring case.
+func sortTags(tags []Tag) {
+	slices.SortFunc(tags, func(a, b Tag) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+}
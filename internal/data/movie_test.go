@@ -0,0 +1,442 @@
+package data
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// testRepositories returns one empty instance of every Repository implementation,
+// so that the tests can verify that they behave the same.
+func testRepositories(t *testing.T) map[string]Repository {
+	t.Helper()
+
+	return map[string]Repository{
+		"Database":       openTestDatabase(t),
+		"MemoryDatabase": MemoryDatabaseNew(),
+	}
+}
+
+func insertTestMovies(t *testing.T, r Repository) []*Movie {
+	t.Helper()
+
+	movies := []*Movie{
+		{
+			Title: "Gladiator", Year: 2000, MyRating: 5, MoviePath: "Gladiator", ImdbRating: 8.5,
+			Genres:   []Genre{{Name: "Action"}, {Name: "Drama"}},
+			Persons:  []Person{{Name: "Ridley Scott", Type: Director}, {Name: "Russell Crowe", Type: Actor}},
+			HasImage: true, Image: []byte{1, 2, 3},
+		},
+		{
+			Title: "Alien", Year: 1979, MoviePath: "Alien", ImdbRating: 8.5, ToWatch: true,
+			Genres:  []Genre{{Name: "Horror"}},
+			Persons: []Person{{Name: "Ridley Scott", Type: Director}, {Name: "Sigourney Weaver", Type: Actor}},
+			Pack:    "Alien",
+		},
+		{
+			Title: "Heat", Year: 1995, MyRating: 4, MoviePath: "Heat", ImdbRating: 8.3, NeedsSubtitle: true,
+			Genres:  []Genre{{Name: "Action"}, {Name: "Crime"}},
+			Persons: []Person{{Name: "Michael Mann", Type: Director}, {Name: "Michael Mann", Type: Writer}},
+		},
+	}
+
+	for _, movie := range movies {
+		if err := r.InsertMovie(t.Context(), movie); err != nil {
+			t.Fatalf("InsertMovie() error = %v", err)
+		}
+	}
+
+	return movies
+}
+
+func getTestGenre(t *testing.T, r Repository, name string) Genre {
+	t.Helper()
+
+	genres, err := r.GetGenres(t.Context())
+	if err != nil {
+		t.Fatalf("GetGenres() error = %v", err)
+	}
+	for _, genre := range genres {
+		if genre.Name == name {
+			return genre
+		}
+	}
+
+	t.Fatalf("genre %s not found", name)
+	return Genre{}
+}
+
+func movieTitles(movies []*Movie) []string {
+	var titles []string
+	for _, movie := range movies {
+		titles = append(titles, movie.Title)
+	}
+	return titles
+}
+
+func TestRepository_SearchMovies(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			insertTestMovies(t, r)
+			action := getTestGenre(t, r, "Action")
+
+			tests := []struct {
+				name    string
+				view    string
+				search  string
+				genreId int
+				orderBy string
+				want    []string
+			}{
+				{"All", "all", "", -1, "title asc", []string{"Alien", "Gladiator", "Heat"}},
+				{"Free text", "all", "glad", -1, "title asc", []string{"Gladiator"}},
+				{"Title prefix", "all", "title:hea", -1, "title asc", []string{"Heat"}},
+				{"Year prefix", "all", "year:1979", -1, "title asc", []string{"Alien"}},
+				{"My rating prefix", "all", "myrating:4", -1, "title asc", []string{"Gladiator", "Heat"}},
+				{"IMDB prefix", "all", "imdb:8.4", -1, "title asc", []string{"Alien", "Gladiator"}},
+				{"Pack prefix", "all", "pack:ali", -1, "title asc", []string{"Alien"}},
+				{"Director", "all", "director:ridley", -1, "title asc", []string{"Alien", "Gladiator"}},
+				{"Actor", "all", "actor:weaver", -1, "title asc", []string{"Alien"}},
+				{"Person", "all", "person:mann", -1, "title asc", []string{"Heat"}},
+				{"Quoted person", "all", `director:"michael mann"`, -1, "title asc", []string{"Heat"}},
+				{"Person and genre", "all", "director:ridley genre:horror", -1, "title asc", []string{"Alien"}},
+				{"Person and not genre", "all", "director:ridley -genre:horror", -1, "title asc", []string{"Gladiator"}},
+				{"Year range", "all", "year:1990..1999", -1, "title asc", []string{"Heat"}},
+				{"Open year range", "all", "year:..1995", -1, "title asc", []string{"Alien", "Heat"}},
+				{"Or", "all", "year:<1990 OR year:>=2000", -1, "title asc", []string{"Alien", "Gladiator"}},
+				{"IMDB comparison", "all", "imdb:>8.4", -1, "title asc", []string{"Alien", "Gladiator"}},
+				{"Flag", "all", "towatch", -1, "title asc", []string{"Alien"}},
+				{"Not flag", "all", "NOT towatch", -1, "title asc", []string{"Gladiator", "Heat"}},
+				{"Quoted flag is text", "all", `"towatch"`, -1, "title asc", nil},
+				{"Parentheses", "all", "(alien OR heat) -subtitles", -1, "title asc", []string{"Alien"}},
+				{"Percent is not a wildcard", "all", "%", -1, "title asc", nil},
+				{"Underscore is not a wildcard", "all", "title:gl_d", -1, "title asc", nil},
+				{"Quoted pack", "all", "pack:" + QuoteQueryValue("Alien"), -1, "title asc", []string{"Alien"}},
+				{"Genre", "all", "", action.Id, "title asc", []string{"Gladiator", "Heat"}},
+				{"Genre and text", "all", "heat", action.Id, "title asc", []string{"Heat"}},
+				{"Packs view", "packs", "", -1, "title asc", []string{"Alien"}},
+				{"To watch view", "toWatch", "", -1, "title asc", []string{"Alien"}},
+				{"No rating view", "noRating", "", -1, "title asc", []string{"Alien"}},
+				{"Needs subtitles view", "needsSubtitles", "", -1, "title asc", []string{"Heat"}},
+				{"Order by year", "all", "", -1, "year desc", []string{"Gladiator", "Heat", "Alien"}},
+				{"Order by rating", "all", "", -1, "imdb_rating desc, title desc", []string{"Gladiator", "Alien", "Heat"}},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					movies, err := r.SearchMovies(t.Context(), tt.view, tt.search, tt.genreId, tt.orderBy)
+					if err != nil {
+						t.Fatalf("SearchMovies() error = %v", err)
+					}
+					assert.Equal(t, tt.want, movieTitles(movies))
+				})
+			}
+		})
+	}
+}
+
+func TestRepository_SearchMoviesSyntaxError(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := r.SearchMovies(t.Context(), "all", "(alien", -1, "title asc")
+
+			var syntaxErr *QuerySyntaxError
+			assert.ErrorAs(t, err, &syntaxErr)
+		})
+	}
+}
+
+func TestRepository_SearchMoviesLoadsGenresAndImages(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			insertTestMovies(t, r)
+
+			movies, err := r.SearchMovies(t.Context(), "all", "title:gladiator", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			if len(movies) != 1 {
+				t.Fatalf("expected one movie, got %d", len(movies))
+			}
+
+			assert.Equal(t, []Genre{{Id: 1, Name: "Action"}, {Id: 2, Name: "Drama"}}, movies[0].Genres)
+			assert.Equal(t, []byte{1, 2, 3}, movies[0].Image)
+
+			persons, err := r.GetPersonsForMovie(t.Context(), movies[0])
+			if err != nil {
+				t.Fatalf("GetPersonsForMovie() error = %v", err)
+			}
+			assert.Len(t, persons, 2)
+			assert.Equal(t, "Ridley Scott", persons[0].Name)
+			assert.Equal(t, Director, persons[0].Type)
+			assert.Equal(t, "Russell Crowe", persons[1].Name)
+			assert.Equal(t, Actor, persons[1].Type)
+		})
+	}
+}
+
+// countQueries runs f and returns the number of queries it sent to the database.
+func countQueries(t *testing.T, d *Database, f func()) int {
+	t.Helper()
+
+	db, err := d.getDatabase(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+	counter := func(*gorm.DB) { count++ }
+	name := "test:count_queries"
+	if err := db.Callback().Query().Before("gorm:query").Register(name, counter); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register(name, counter); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = db.Callback().Query().Remove(name)
+		_ = db.Callback().Row().Remove(name)
+	}()
+
+	f()
+	return count
+}
+
+func TestDatabase_SearchMoviesQueryCount(t *testing.T) {
+	d := openTestDatabase(t)
+
+	search := func() int {
+		// Start with empty caches, so that genres and images are loaded from the database
+		d.genreCache.clear()
+		d.imageCache.clear()
+
+		return countQueries(t, d, func() {
+			movies, err := d.SearchMovies(t.Context(), "all", "", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			if _, err := d.GetPersonsForMovies(t.Context(), movies); err != nil {
+				t.Fatalf("GetPersonsForMovies() error = %v", err)
+			}
+		})
+	}
+
+	insertTestMovies(t, d)
+	few := search()
+
+	for i := 0; i < 20; i++ {
+		movie := &Movie{
+			Title:     fmt.Sprintf("Movie %d", i),
+			MoviePath: fmt.Sprintf("Movie %d", i),
+			Genres:    []Genre{{Name: fmt.Sprintf("Genre %d", i)}},
+			Persons:   []Person{{Name: fmt.Sprintf("Actor %d", i), Type: Actor}},
+			HasImage:  true, Image: []byte{byte(i)},
+		}
+		if err := d.InsertMovie(t.Context(), movie); err != nil {
+			t.Fatalf("InsertMovie() error = %v", err)
+		}
+	}
+	many := search()
+
+	assert.Equal(t, few, many, "number of queries should not depend on the number of movies")
+}
+
+func TestRepository_UpdateAndDeleteMovie(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+
+			heat := movies[2]
+			heat.SubTitle = "Director's cut"
+			heat.Genres = append(heat.Genres, Genre{Name: "Thriller"})
+			if err := r.UpdateMovie(t.Context(), heat); err != nil {
+				t.Fatalf("UpdateMovie() error = %v", err)
+			}
+
+			found, err := r.SearchMovies(t.Context(), "all", "director's cut", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Heat"}, movieTitles(found))
+			assert.Len(t, found[0].Genres, 3)
+
+			rootDir := t.TempDir()
+			moviePath := path.Join(rootDir, heat.MoviePath)
+			if err := os.MkdirAll(moviePath, os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := r.DeleteMovie(t.Context(), rootDir, heat); err != nil {
+				t.Fatalf("DeleteMovie() error = %v", err)
+			}
+			if _, err := os.Stat(moviePath); !os.IsNotExist(err) {
+				t.Errorf("expected movie folder to be removed")
+			}
+
+			found, err = r.SearchMovies(t.Context(), "all", "", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Alien", "Gladiator"}, movieTitles(found))
+
+			persons, err := r.GetPersonsForMovie(t.Context(), heat)
+			if err != nil {
+				t.Fatalf("GetPersonsForMovie() error = %v", err)
+			}
+			assert.Empty(t, persons)
+
+			// A deleted movie can not be updated
+			heat.SubTitle = ""
+			assert.ErrorIs(t, r.UpdateMovie(t.Context(), heat), gorm.ErrRecordNotFound)
+		})
+	}
+}
+
+// failCreate makes every insert into the given table fail, until the test ends.
+func failCreate(t *testing.T, d *Database, table string) {
+	t.Helper()
+
+	db, err := d.getDatabase(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := "test:fail_create"
+	fail := func(tx *gorm.DB) {
+		if tx.Statement.Table == table {
+			_ = tx.AddError(fmt.Errorf("insert into %s failed", table))
+		}
+	}
+	if err := db.Callback().Create().Before("gorm:create").Register(name, fail); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Callback().Create().Remove(name) })
+}
+
+// countTestRows returns the number of rows in each of the given tables.
+func countTestRows(t *testing.T, d *Database, tables ...string) map[string]int64 {
+	t.Helper()
+
+	db, err := d.getDatabase(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		var count int64
+		if err := db.Table(table).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		counts[table] = count
+	}
+	return counts
+}
+
+var transactionTestTables = []string{
+	"movies", "image", "artwork", "genre", "movie_genre", "person", "movie_person",
+	"tag", "movie_tag", "pack", "movie_history",
+}
+
+func TestDatabase_InsertMovieRollback(t *testing.T) {
+	d := openTestDatabase(t)
+	insertTestMovies(t, d)
+	before := countTestRows(t, d, transactionTestTables...)
+
+	// Tags are inserted last, so everything else must be rolled back
+	failCreate(t, d, "movie_tag")
+	movie := &Movie{
+		Title: "Blade Runner", Year: 1982, MoviePath: "Blade Runner", Pack: "Blade Runner",
+		Genres:   []Genre{{Name: "Action"}, {Name: "Sci-Fi"}},
+		Persons:  []Person{{Name: "Ridley Scott", Type: Director}, {Name: "Harrison Ford", Type: Actor}},
+		Tags:     []Tag{{Name: "Classic"}},
+		HasImage: true, Image: []byte{4, 5, 6},
+	}
+	if err := d.InsertMovie(t.Context(), movie); err == nil {
+		t.Fatal("InsertMovie() expected an error")
+	}
+
+	assert.Equal(t, before, countTestRows(t, d, transactionTestTables...))
+	assert.Zero(t, movie.Id)
+	assert.Zero(t, movie.ImageId)
+	assert.Zero(t, movie.PackId)
+
+	genres, err := d.GetGenres(t.Context())
+	if err != nil {
+		t.Fatalf("GetGenres() error = %v", err)
+	}
+	for _, genre := range genres {
+		assert.NotEqual(t, "Sci-Fi", genre.Name)
+	}
+}
+
+func TestDatabase_UpdateMoviePersonsRollback(t *testing.T) {
+	d := openTestDatabase(t)
+	heat := insertTestMovies(t, d)[2]
+	before := countTestRows(t, d, transactionTestTables...)
+
+	failCreate(t, d, "movie_person")
+	heat.Persons = append(heat.Persons, Person{Name: "Al Pacino", Type: Actor})
+	if err := d.UpdateMoviePersons(t.Context(), heat); err == nil {
+		t.Fatal("UpdateMoviePersons() expected an error")
+	}
+
+	assert.Equal(t, before, countTestRows(t, d, transactionTestTables...))
+	person, err := d.GetPerson(t.Context(), "Al Pacino")
+	assert.NoError(t, err)
+	assert.Nil(t, person)
+}
+
+func TestDatabase_UpdateMovieTagsRollback(t *testing.T) {
+	d := openTestDatabase(t)
+	heat := insertTestMovies(t, d)[2]
+	before := countTestRows(t, d, transactionTestTables...)
+
+	failCreate(t, d, "movie_tag")
+	heat.SubTitle = "Director's cut"
+	heat.Tags = []Tag{{Name: "Favourite"}}
+	if err := d.UpdateMovie(t.Context(), heat); err == nil {
+		t.Fatal("UpdateMovie() expected an error")
+	}
+
+	assert.Equal(t, before, countTestRows(t, d, transactionTestTables...))
+	found, err := d.SearchMovies(t.Context(), "all", "title:Heat", -1, "title asc")
+	if err != nil {
+		t.Fatalf("SearchMovies() error = %v", err)
+	}
+	if assert.Len(t, found, 1) {
+		assert.Empty(t, found[0].SubTitle, "the movie is not saved without its tags")
+		assert.Empty(t, found[0].Tags)
+	}
+}
+
+func TestLikeMatch(t *testing.T) {
+	tests := []struct {
+		value, pattern string
+		want           bool
+	}{
+		{"Gladiator", "%glad%", true},
+		{"Gladiator", "glad", false},
+		{"Gladiator", "gladiator", true},
+		{"1999", "199_", true},
+		{"1999", "%", true},
+		{"", "%%", true},
+		{"Alien", "%lie", false},
+		{"Aliens", "a%n%s", true},
+		{"100% Wolf", "%100!%%", true},
+		{"1000 Wolves", "%100!%%", false},
+		{"a_b", "a!_b", true},
+		{"axb", "a!_b", false},
+		{"Yes!", "%!!", true},
+	}
+
+	for _, tt := range tests {
+		if got := likeMatch(tt.value, tt.pattern); got != tt.want {
+			t.Errorf("likeMatch(%q, %q) = %v, want %v", tt.value, tt.pattern, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrPackExists is returned when inserting or renaming a pack to the name of another pack.
+var ErrPackExists = errors.New("pack already exists")
+
+// Pack is a collection of movies, like a franchise, with the movies in a defined
+// order. The name of the pack is also stored in Movie.Pack, so that the pack
+// can be searched and shown without loading the pack.
+type Pack struct {
+	Id          int    `gorm:"column:id;primary_key"`
+	Name        string `gorm:"column:name;size:255"`
+	Description string `gorm:"column:description;type:text"`
+	ImageId     int    `gorm:"column:image_id"`
+
+	Image []byte `gorm:"-"`
+}
+
+// TableName returns the pack table name.
+func (p *Pack) TableName() string {
+	return "pack"
+}
+
+// GetPacks returns all packs, ordered by name, without their posters.
+func (d *Database) GetPacks(ctx context.Context) ([]Pack, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	var packs []Pack
+	if err := db.Order("name").Find(&packs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get packs: %w", err)
+	}
+
+	return packs, nil
+}
+
+// GetPack returns a pack, including its poster, by name ignoring case, or nil if the pack does not exist.
+func (d *Database) GetPack(ctx context.Context, name string) (*Pack, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	pack, err := d.getPackByName(db, name)
+	if err != nil || pack == nil {
+		return nil, err
+	}
+
+	if pack.ImageId > 0 {
+		images, err := d.readImages(db, []int{pack.ImageId})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pack poster: %w", err)
+		}
+		pack.Image = images[pack.ImageId]
+	}
+
+	return pack, nil
+}
+
+// GetPackMovies returns the movies in a pack, in the order of the pack. Only the
+// movie columns are loaded, not the genres, persons, tags or images.
+func (d *Database) GetPackMovies(ctx context.Context, pack *Pack) ([]*Movie, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	var movies []*Movie
+	if err := db.Where("pack_id = ?", pack.Id).Order("pack_position, title, id").Find(&movies).Error; err != nil {
+		return nil, fmt.Errorf("failed to get movies in pack: %w", err)
+	}
+
+	return movies, nil
+}
+
+// InsertPack inserts a new pack. ErrPackExists is returned if there already is a pack with the same name.
+func (d *Database) InsertPack(ctx context.Context, pack *Pack) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database: %w", err)
+	}
+
+	return d.insertPack(db, pack)
+}
+
+// insertPack inserts a new pack, using db, which can be a transaction.
+func (d *Database) insertPack(db *gorm.DB, pack *Pack) error {
+	pack.Name = strings.TrimSpace(pack.Name)
+	if pack.Name == "" {
+		return fmt.Errorf("pack name cannot be empty")
+	}
+
+	existing, err := d.getPackByName(db, pack.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("failed to insert pack %s: %w", pack.Name, ErrPackExists)
+	}
+
+	if err := db.Create(pack).Error; err != nil {
+		return fmt.Errorf("failed to insert pack: %w", err)
+	}
+
+	return nil
+}
+
+// UpdatePack updates the name and description of a pack. When the pack is
+// renamed, the movies in the pack are renamed as well.
+func (d *Database) UpdatePack(ctx context.Context, pack *Pack) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	pack.Name = strings.TrimSpace(pack.Name)
+	if pack.Name == "" {
+		return fmt.Errorf("pack name cannot be empty")
+	}
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database: %w", err)
+	}
+
+	existing, err := d.getPackByName(db, pack.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Id != pack.Id {
+		return fmt.Errorf("failed to rename pack to %s: %w", pack.Name, ErrPackExists)
+	}
+
+	return d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			updates := map[string]interface{}{"name": pack.Name, "description": pack.Description}
+			if err := tx.Model(&Pack{}).Where("id = ?", pack.Id).Updates(updates).Error; err != nil {
+				return fmt.Errorf("failed to update pack: %w", err)
+			}
+
+			return d.setPackNameForMovies(tx, pack.Id, pack.Name)
+		},
+	)
+}
+
+// DeletePack deletes a pack and its poster. The movies in the pack are kept, but no longer belong to a pack.
+func (d *Database) DeletePack(ctx context.Context, pack *Pack) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	return d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			if err := d.setPackNameForMovies(tx, pack.Id, ""); err != nil {
+				return err
+			}
+
+			err := tx.Model(&Movie{}).Where("pack_id = ?", pack.Id).
+				Updates(map[string]interface{}{"pack_id": 0, "pack_position": 0}).Error
+			if err != nil {
+				return fmt.Errorf("failed to remove movies from pack: %w", err)
+			}
+
+			if err := d.deleteImageById(tx, pack.ImageId); err != nil {
+				return fmt.Errorf("failed to delete pack poster: %w", err)
+			}
+
+			if err := tx.Delete(&Pack{}, pack.Id).Error; err != nil {
+				return fmt.Errorf("failed to delete pack: %w", err)
+			}
+
+			return nil
+		},
+	)
+}
+
+// SetPackOrder sets the order of the movies in a pack. The movies must all belong to the pack.
+func (d *Database) SetPackOrder(ctx context.Context, pack *Pack, movies []*Movie) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	return d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			for i, movie := range movies {
+				result := tx.Model(&Movie{}).Where("id = ? AND pack_id = ?", movie.Id, pack.Id).Update("pack_position", i+1)
+				if result.Error != nil {
+					return fmt.Errorf("failed to update pack position: %w", result.Error)
+				}
+				if result.RowsAffected == 0 {
+					return fmt.Errorf("failed to update pack position: %s is not in the pack %s", movie.Title, pack.Name)
+				}
+				movie.PackPosition = i + 1
+			}
+
+			return nil
+		},
+	)
+}
+
+// UpdatePackImage replaces the poster of a pack.
+func (d *Database) UpdatePackImage(ctx context.Context, pack *Pack, imageData []byte) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	return d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			if err := d.deleteImageById(tx, pack.ImageId); err != nil {
+				return fmt.Errorf("failed to delete old pack poster: %w", err)
+			}
+
+			img := imageNew(imageData)
+			if err := d.createImage(tx, img); err != nil {
+				return fmt.Errorf("failed to insert pack poster: %w", err)
+			}
+
+			if err := tx.Model(&Pack{}).Where("id = ?", pack.Id).Update("image_id", img.Id).Error; err != nil {
+				return fmt.Errorf("failed to update image_id on pack: %w", err)
+			}
+
+			pack.ImageId = img.Id
+			pack.Image = imageData
+
+			return nil
+		},
+	)
+}
+
+// assignPack connects a movie to the pack named in movie.Pack, inserting the pack
+// if it does not exist. Names are matched ignoring case and surrounding spaces, so
+// movie.Pack is set to the name of the pack. A movie that joins a pack is placed last.
+func (d *Database) assignPack(db *gorm.DB, movie *Movie) error {
+	name := strings.TrimSpace(movie.Pack)
+	if name == "" {
+		movie.Pack, movie.PackId, movie.PackPosition = "", 0, 0
+		return nil
+	}
+
+	pack, err := d.getPackByName(db, name)
+	if err != nil {
+		return err
+	}
+	if pack == nil {
+		pack = &Pack{Name: name}
+		if err := d.insertPack(db, pack); err != nil {
+			return err
+		}
+	}
+
+	movie.Pack = pack.Name
+	if movie.PackId == pack.Id {
+		return nil
+	}
+
+	var last int
+	err = db.Model(&Movie{}).Where("pack_id = ? AND id <> ?", pack.Id, movie.Id).
+		Select("COALESCE(MAX(pack_position), 0)").Scan(&last).Error
+	if err != nil {
+		return fmt.Errorf("failed to get pack position: %w", err)
+	}
+
+	movie.PackId = pack.Id
+	movie.PackPosition = last + 1
+
+	return nil
+}
+
+// getPackByName returns a pack by name, ignoring case, or nil if there is no such pack.
+func (d *Database) getPackByName(db *gorm.DB, name string) (*Pack, error) {
+	var packs []Pack
+	if err := db.Where("LOWER(name) = LOWER(?)", strings.TrimSpace(name)).Limit(1).Find(&packs).Error; err != nil {
+		return nil, fmt.Errorf("failed to query pack: %w", err)
+	}
+	if len(packs) == 0 {
+		return nil, nil
+	}
+
+	return &packs[0], nil
+}
+
+// setPackNameForMovies sets the pack name of the movies in a pack, and records the change in their history.
+func (d *Database) setPackNameForMovies(db *gorm.DB, packId int, name string) error {
+	var movies []Movie
+	if err := db.Where("pack_id = ?", packId).Find(&movies).Error; err != nil {
+		return fmt.Errorf("failed to get movies in pack: %w", err)
+	}
+
+	var changes []MovieChange
+	for i := range movies {
+		after := movies[i]
+		after.Pack = name
+		changes = append(changes, getMovieChanges(&movies[i], &after, []string{"pack"})...)
+	}
+
+	if err := db.Model(&Movie{}).Where("pack_id = ?", packId).Update("pack", name).Error; err != nil {
+		return fmt.Errorf("failed to rename pack on movies: %w", err)
+	}
+
+	return d.recordChanges(db, changes...)
+}
@@ -0,0 +1,163 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_PackMembership(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			gladiator, heat := movies[0], movies[2]
+
+			// Pack names are matched ignoring case and spaces, so typos do not split the pack
+			heat.Pack = " alien"
+			if err := r.UpdateMovie(t.Context(), heat); err != nil {
+				t.Fatalf("UpdateMovie() error = %v", err)
+			}
+			assert.Equal(t, "Alien", heat.Pack)
+
+			gladiator.Pack = "ALIEN"
+			if err := r.UpdateMovie(t.Context(), gladiator); err != nil {
+				t.Fatalf("UpdateMovie() error = %v", err)
+			}
+
+			packs, err := r.GetPacks(t.Context())
+			if err != nil {
+				t.Fatalf("GetPacks() error = %v", err)
+			}
+			if !assert.Len(t, packs, 1) {
+				return
+			}
+			pack := packs[0]
+
+			// New members are placed last
+			members, err := r.GetPackMovies(t.Context(), &pack)
+			if err != nil {
+				t.Fatalf("GetPackMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Alien", "Heat", "Gladiator"}, movieTitles(members))
+
+			// The packs view shows the members in the order of the pack
+			if err := r.SetPackOrder(t.Context(), &pack, []*Movie{members[2], members[0], members[1]}); err != nil {
+				t.Fatalf("SetPackOrder() error = %v", err)
+			}
+			found, err := r.SearchMovies(t.Context(), "packs", "", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Gladiator", "Alien", "Heat"}, movieTitles(found))
+
+			// Leaving the pack
+			heat.Pack = ""
+			if err := r.UpdateMovie(t.Context(), heat); err != nil {
+				t.Fatalf("UpdateMovie() error = %v", err)
+			}
+			members, err = r.GetPackMovies(t.Context(), &pack)
+			if err != nil {
+				t.Fatalf("GetPackMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Gladiator", "Alien"}, movieTitles(members))
+			assert.Error(t, r.SetPackOrder(t.Context(), &pack, []*Movie{heat}))
+		})
+	}
+}
+
+func TestRepository_UpdateAndDeletePack(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			alien := movies[1]
+
+			pack, err := r.GetPack(t.Context(), "alien")
+			if err != nil {
+				t.Fatalf("GetPack() error = %v", err)
+			}
+			if !assert.NotNil(t, pack) {
+				return
+			}
+
+			assert.ErrorIs(t, r.InsertPack(t.Context(), &Pack{Name: "ALIEN"}), ErrPackExists)
+
+			pack.Name = "Alien Quadrilogy"
+			pack.Description = "The four Alien movies"
+			if err := r.UpdatePack(t.Context(), pack); err != nil {
+				t.Fatalf("UpdatePack() error = %v", err)
+			}
+			if err := r.UpdatePackImage(t.Context(), pack, []byte{7, 8, 9}); err != nil {
+				t.Fatalf("UpdatePackImage() error = %v", err)
+			}
+
+			found, err := r.SearchMovies(t.Context(), "all", `pack:"alien quadrilogy"`, -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Alien"}, movieTitles(found))
+
+			// Renaming the pack is recorded in the history of the movies
+			history, err := r.GetMovieHistory(t.Context(), alien)
+			if err != nil {
+				t.Fatalf("GetMovieHistory() error = %v", err)
+			}
+			assert.Equal(t, MovieChange{Field: "pack", OldValue: "Alien", NewValue: "Alien Quadrilogy"},
+				getTestChanges(history, ChangeSourceUI)[0])
+
+			loaded, err := r.GetPack(t.Context(), "Alien Quadrilogy")
+			if err != nil {
+				t.Fatalf("GetPack() error = %v", err)
+			}
+			assert.Equal(t, "The four Alien movies", loaded.Description)
+			assert.Equal(t, []byte{7, 8, 9}, loaded.Image)
+
+			if err := r.DeletePack(t.Context(), loaded); err != nil {
+				t.Fatalf("DeletePack() error = %v", err)
+			}
+			found, err = r.SearchMovies(t.Context(), "packs", "", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Empty(t, found)
+
+			packs, err := r.GetPacks(t.Context())
+			if err != nil {
+				t.Fatalf("GetPacks() error = %v", err)
+			}
+			assert.Empty(t, packs)
+		})
+	}
+}
+
+func TestRepository_RevertPackChange(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			alien := movies[1]
+
+			alien.Pack = "Ridley Scott"
+			if err := r.UpdateMovie(t.Context(), alien); err != nil {
+				t.Fatalf("UpdateMovie() error = %v", err)
+			}
+
+			history, err := r.GetMovieHistory(t.Context(), alien)
+			if err != nil {
+				t.Fatalf("GetMovieHistory() error = %v", err)
+			}
+			if err := r.RevertChange(t.Context(), alien, &history[0]); err != nil {
+				t.Fatalf("RevertChange() error = %v", err)
+			}
+			assert.Equal(t, "Alien", alien.Pack)
+
+			pack, err := r.GetPack(t.Context(), "Alien")
+			if err != nil {
+				t.Fatalf("GetPack() error = %v", err)
+			}
+			members, err := r.GetPackMovies(t.Context(), pack)
+			if err != nil {
+				t.Fatalf("GetPackMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Alien"}, movieTitles(members))
+		})
+	}
+}
@@ -1,13 +1,13 @@
 package data
 
 import (
-	"cmp"
+	"context"
 	"errors"
 	"fmt"
-	"slices"
 	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PersonType int
@@ -18,12 +18,18 @@ const (
 	Actor
 )
 
-// Person represents a person (director, writer or actor).
+// Person represents a person (director, writer or actor). Type, Billing
+// and Character describe the person's credit on a movie, and are stored
+// in movie_person, so the same person can have several credits.
+// ImdbId is the IMDb name id (nm…), which identifies persons that share a name.
 type Person struct {
-	Id     int        `gorm:"column:id;primary_key"`
-	Name   string     `gorm:"column:name;size:50"`
-	Type   PersonType `gorm:"-"`
-	Movies []Movie    `gorm:"-"`
+	Id        int        `gorm:"column:id;primary_key"`
+	Name      string     `gorm:"column:name;size:50"`
+	ImdbId    string     `gorm:"column:imdb_id;size:10"`
+	Type      PersonType `gorm:"-"`
+	Billing   int        `gorm:"-"`
+	Character string     `gorm:"-"`
+	Movies    []Movie    `gorm:"-"`
 }
 
 // TableName returns the person's table name.
@@ -32,14 +38,22 @@ func (m *Person) TableName() string {
 }
 
 // GetPerson returns a person by name.
-func (d *Database) GetPerson(name string) (*Person, error) {
-	name = strings.TrimSpace(name)
+func (d *Database) GetPerson(ctx context.Context, name string) (*Person, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 
-	db, err := d.getDatabase()
+	db, err := d.getDatabase(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get database: %w", err)
 	}
 
+	return getPerson(db, name)
+}
+
+// getPerson returns a person by name, using db, which can be a transaction.
+func getPerson(db *gorm.DB, name string) (*Person, error) {
+	name = strings.TrimSpace(name)
+
 	person := Person{}
 	if err := db.Where("name=?", name).First(&person).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -51,13 +65,104 @@ func (d *Database) GetPerson(name string) (*Person, error) {
 	return &person, nil
 }
 
+// GetPersonById returns a person by id, or nil if there is no such person.
+func (d *Database) GetPersonById(ctx context.Context, id int) (*Person, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	person := Person{}
+	if err := db.First(&person, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get person: %w", err)
+	}
+
+	return &person, nil
+}
+
+// GetPersonByImdbId returns a person by IMDb name id, or nil if there is no such person.
+func (d *Database) GetPersonByImdbId(ctx context.Context, imdbId string) (*Person, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	return getPersonByImdbId(db, imdbId)
+}
+
+// getPersonByImdbId returns a person by IMDb name id, using db, which can be a transaction.
+func getPersonByImdbId(db *gorm.DB, imdbId string) (*Person, error) {
+	person := Person{}
+	if err := db.Where("imdb_id = ?", imdbId).First(&person).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get person: %w", err)
+	}
+
+	return &person, nil
+}
+
+// getOrInsertPerson returns the stored person for a credit, and inserts the person if
+// it does not exist. The IMDb id is preferred, since different persons can share a name.
+// A person found by name is only used if it has no IMDb id yet, and is then given the
+// credit's IMDb id.
+func (d *Database) getOrInsertPerson(db *gorm.DB, credit *Person) (*Person, error) {
+	if credit.ImdbId == "" {
+		person, err := getPerson(db, credit.Name)
+		if err != nil || person != nil {
+			return person, err
+		}
+		return insertPerson(db, &Person{Name: credit.Name})
+	}
+
+	person, err := getPersonByImdbId(db, credit.ImdbId)
+	if err != nil || person != nil {
+		return person, err
+	}
+
+	var persons []Person
+	err = db.Where("name = ? AND imdb_id = ''", strings.TrimSpace(credit.Name)).
+		Order("id").Limit(1).Find(&persons).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get person: %w", err)
+	}
+	if len(persons) == 0 {
+		return insertPerson(db, &Person{Name: credit.Name, ImdbId: credit.ImdbId})
+	}
+
+	person = &persons[0]
+	if err := db.Model(person).Update("imdb_id", credit.ImdbId).Error; err != nil {
+		return nil, fmt.Errorf("failed to update person imdb id: %w", err)
+	}
+
+	return person, nil
+}
+
 // InsertPerson inserts a new person and returns it.
-func (d *Database) InsertPerson(person *Person) (*Person, error) {
-	db, err := d.getDatabase()
+func (d *Database) InsertPerson(ctx context.Context, person *Person) (*Person, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get database: %w", err)
 	}
 
+	return insertPerson(db, person)
+}
+
+// insertPerson inserts a person, using db, which can be a transaction.
+func insertPerson(db *gorm.DB, person *Person) (*Person, error) {
 	person.Name = strings.TrimSpace(person.Name)
 
 	if err := db.Create(person).Error; err != nil {
@@ -68,44 +173,82 @@ func (d *Database) InsertPerson(person *Person) (*Person, error) {
 	return person, nil
 }
 
-// GetPersonsForMovie returns a list of persons (director, writer or actor) connected to the given movie.
-func (d *Database) GetPersonsForMovie(movie *Movie) ([]Person, error) {
-	db, err := d.getDatabase()
+// moviePersonRow is a movie_person row joined with its person.
+type moviePersonRow struct {
+	MovieId   int    `gorm:"column:movie_id"`
+	PersonId  int    `gorm:"column:person_id"`
+	Name      string `gorm:"column:name"`
+	ImdbId    string `gorm:"column:imdb_id"`
+	Type      int    `gorm:"column:type"`
+	Billing   int    `gorm:"column:billing"`
+	Character string `gorm:"column:character_name"`
+}
+
+// GetPersonsForMovie returns a list of persons (director, writer or actor) connected to the given movie,
+// ordered by type and billing. A person with several credits is returned once for each credit.
+func (d *Database) GetPersonsForMovie(ctx context.Context, movie *Movie) ([]Person, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get database: %w", err)
 	}
 
-	// Get person id:s for the movie
-	var moviePersons []MoviePerson
-	if err := db.Where("movie_id=?", movie.Id).Find(&moviePersons).Error; err != nil {
-		return nil, fmt.Errorf("failed to get person ids for movie: %w", err)
+	persons, err := d.getPersonsForMovies(db, []int{movie.Id})
+	if err != nil {
+		return nil, err
 	}
 
-	var persons []Person
+	return persons[movie.Id], nil
+}
 
-	for i := range moviePersons {
-		var person Person
-		if err := db.Where("id=?", moviePersons[i].PersonId).Find(&person).Error; err != nil {
-			return nil, fmt.Errorf("failed to get person for movie: %w", err)
-		}
-		person.Type = PersonType(moviePersons[i].Type)
-		persons = append(persons, person)
+// getPersonsForMovies returns the persons connected to each of the given movies,
+// keyed by movie id, using a single query.
+func (d *Database) getPersonsForMovies(db *gorm.DB, movieIds []int) (map[int][]Person, error) {
+	result := make(map[int][]Person, len(movieIds))
+	if len(movieIds) == 0 {
+		return result, nil
 	}
 
-	slices.SortFunc(persons, func(a, b Person) int {
-		return cmp.Compare(a.Type, b.Type)
-	})
+	var rows []moviePersonRow
+	err := db.Table("movie_person").
+		Select("movie_person.movie_id, movie_person.person_id, person.name, person.imdb_id, movie_person.type, "+
+			"movie_person.billing, movie_person.character_name").
+		Joins("JOIN person ON person.id = movie_person.person_id").
+		Where("movie_person.movie_id IN ?", movieIds).
+		Order("movie_person.movie_id, movie_person.type, movie_person.billing, movie_person.person_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get persons for movies: %w", err)
+	}
+
+	for _, row := range rows {
+		person := Person{
+			Id: row.PersonId, Name: row.Name, ImdbId: row.ImdbId,
+			Type: PersonType(row.Type), Billing: row.Billing, Character: row.Character,
+		}
+		result[row.MovieId] = append(result[row.MovieId], person)
+	}
 
-	return persons, nil
+	return result, nil
 }
 
 // RemovePerson removes a person from the database, including associations.
-func (d *Database) RemovePerson(person *Person) error {
-	db, err := d.getDatabase()
+func (d *Database) RemovePerson(ctx context.Context, person *Person) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get database: %w", err)
 	}
 
+	return d.removePerson(db, person)
+}
+
+// removePerson removes a person and its credits, using db, which can be a transaction.
+func (d *Database) removePerson(db *gorm.DB, person *Person) error {
 	// Use parameterized queries for safety
 	if err := db.Exec("DELETE FROM movie_person WHERE person_id = ?", person.Id).Error; err != nil {
 		return fmt.Errorf("failed to delete movie_person entries: %w", err)
@@ -118,13 +261,107 @@ func (d *Database) RemovePerson(person *Person) error {
 	return nil
 }
 
-// deletePersonsForMovie removes all person associations for the given movie.
-func (d *Database) deletePersonsForMovie(movie *Movie) error {
-	db, err := d.getDatabase()
+// GetDuplicatePersons returns groups of persons that share a name, ignoring case,
+// which are candidates for MergePersons.
+func (d *Database) GetDuplicatePersons(ctx context.Context) ([][]Person, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get database: %w", err)
+		return nil, fmt.Errorf("failed to get database: %w", err)
 	}
 
+	var persons []Person
+	if err := db.Order("id").Find(&persons).Error; err != nil {
+		return nil, fmt.Errorf("failed to get persons: %w", err)
+	}
+
+	return groupDuplicatePersons(persons), nil
+}
+
+// MergePersons moves the credits of the duplicates to the survivor, and removes the
+// duplicates. The survivor takes the IMDb id of a duplicate if it has none itself.
+func (d *Database) MergePersons(ctx context.Context, survivor *Person, duplicates []*Person) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	return d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			for _, duplicate := range duplicates {
+				if duplicate.Id == survivor.Id {
+					continue
+				}
+
+				var credits []MoviePerson
+				if err := tx.Where("person_id = ?", duplicate.Id).Find(&credits).Error; err != nil {
+					return fmt.Errorf("failed to get credits for person %d: %w", duplicate.Id, err)
+				}
+
+				for _, credit := range credits {
+					credit.PersonId = survivor.Id
+					if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&credit).Error; err != nil {
+						return fmt.Errorf("failed to move credit to person %d: %w", survivor.Id, err)
+					}
+					if change, ok := getMergeChange(survivor, duplicate, credit); ok {
+						if err := d.recordChanges(tx, change); err != nil {
+							return err
+						}
+					}
+				}
+
+				if survivor.ImdbId == "" && duplicate.ImdbId != "" {
+					survivor.ImdbId = duplicate.ImdbId
+					duplicate.ImdbId = ""
+				}
+
+				if err := d.removePerson(tx, duplicate); err != nil {
+					return err
+				}
+			}
+
+			if err := tx.Model(survivor).Update("imdb_id", survivor.ImdbId).Error; err != nil {
+				return fmt.Errorf("failed to update person imdb id: %w", err)
+			}
+
+			return nil
+		},
+	)
+}
+
+// groupDuplicatePersons returns groups of persons that share a name, ignoring case.
+func groupDuplicatePersons(persons []Person) [][]Person {
+	groups := make(map[string][]Person)
+	var names []string
+	for _, person := range persons {
+		name := strings.ToLower(strings.TrimSpace(person.Name))
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], person)
+	}
+
+	var duplicates [][]Person
+	for _, name := range names {
+		if len(groups[name]) > 1 {
+			duplicates = append(duplicates, groups[name])
+		}
+	}
+	return duplicates
+}
+
+// getMergeChange returns the history change for a credit that is moved from the
+// duplicate to the survivor, if the credit is shown with a different name.
+func getMergeChange(survivor, duplicate *Person, credit MoviePerson) (MovieChange, bool) {
+	oldValue := getPersonHistoryValue(&Person{Name: duplicate.Name, Type: PersonType(credit.Type)})
+	newValue := getPersonHistoryValue(&Person{Name: survivor.Name, Type: PersonType(credit.Type)})
+
+	change := MovieChange{MovieId: credit.MovieId, Field: historyFieldPerson, OldValue: oldValue, NewValue: newValue}
+	return change, oldValue != newValue
+}
+
+// deletePersonsForMovie removes all person associations for the given movie.
+func (d *Database) deletePersonsForMovie(db *gorm.DB, movie *Movie) error {
 	if err := db.Exec("DELETE FROM movie_person WHERE movie_id = ?", movie.Id).Error; err != nil {
 		return fmt.Errorf("failed to delete movie_person entries for movie ID %d: %w", movie.Id, err)
 	}
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -17,14 +18,14 @@ func TestDatabase_Person(t *testing.T) {
 		Name: "John Doe",
 	}
 
-	got, err := db.GetPerson(person.Name)
+	got, err := db.GetPerson(t.Context(), person.Name)
 	if err != nil {
 		t.Errorf("GetPerson() error = %v", err)
 		return
 	}
 
 	if got == nil {
-		got, err = db.InsertPerson(person)
+		got, err = db.InsertPerson(t.Context(), person)
 		if err != nil {
 			t.Errorf("InsertPerson() error = %v", err)
 			return
@@ -33,24 +34,24 @@ func TestDatabase_Person(t *testing.T) {
 
 	assert.GreaterOrEqual(t, got.Id, 0, "person id should not be zero")
 
-	got, err = db.GetPerson(person.Name)
+	got, err = db.GetPerson(t.Context(), person.Name)
 	if err != nil {
 		t.Errorf("GetPerson() error = %v", err)
 	}
 
 	assert.Equal(t, person.Name, got.Name, "person name should be John Doe")
 
-	movie, err := getMovie(db)
+	movie, err := getMovie(t.Context(), db)
 	if err != nil {
 		t.Errorf("getMovie() error = %v", err)
 	}
 
-	err = db.InsertMoviePerson(movie, got)
+	err = db.InsertMoviePerson(t.Context(), movie, got)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	movie, err = getMovie(db)
+	movie, err = getMovie(t.Context(), db)
 	if err != nil {
 		t.Errorf("getMovie() error = %v", err)
 	}
@@ -59,17 +60,122 @@ func TestDatabase_Person(t *testing.T) {
 	assert.Equal(t, person.Name, movie.Persons[0].Name, "person name should be John Doe")
 	assert.Equal(t, person.Type, movie.Persons[0].Type, "person type should be Writer")
 
-	err = db.RemovePerson(person)
+	err = db.RemovePerson(t.Context(), person)
 	if err != nil {
 		t.Errorf("RemovePerson() error = %v", err)
 	}
 }
 
-func getMovie(db *Database) (*Movie, error) {
-	movies, err := db.SearchMovies("all", "gladiator", -1, "title")
+func getMovie(ctx context.Context, db *Database) (*Movie, error) {
+	movies, err := db.SearchMovies(ctx, "all", "gladiator", -1, "title")
 	if err != nil {
 		return nil, err
 	}
 
 	return movies[0], nil
 }
+
+func TestRepository_PersonImdbId(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			gladiator, heat := movies[0], movies[2]
+
+			// Two different persons with the same name
+			gladiator.Persons = []Person{{Name: "John Smith", ImdbId: "nm0000001", Type: Actor}}
+			heat.Persons = []Person{{Name: "John Smith", ImdbId: "nm0000002", Type: Actor}}
+			for _, movie := range []*Movie{gladiator, heat} {
+				if err := r.UpdateMoviePersons(t.Context(), movie); err != nil {
+					t.Fatalf("UpdateMoviePersons() error = %v", err)
+				}
+			}
+
+			first, err := r.GetPersonByImdbId(t.Context(), "nm0000001")
+			if err != nil {
+				t.Fatalf("GetPersonByImdbId() error = %v", err)
+			}
+			second, err := r.GetPersonByImdbId(t.Context(), "nm0000002")
+			if err != nil {
+				t.Fatalf("GetPersonByImdbId() error = %v", err)
+			}
+			if assert.NotNil(t, first) && assert.NotNil(t, second) {
+				assert.NotEqual(t, first.Id, second.Id)
+			}
+
+			// A person that was added by name only gets the IMDb id on the next scrape
+			heat.Persons = []Person{{Name: "Michael Mann", ImdbId: "nm0000520", Type: Director}}
+			if err := r.UpdateMoviePersons(t.Context(), heat); err != nil {
+				t.Fatalf("UpdateMoviePersons() error = %v", err)
+			}
+			mann, err := r.GetPerson(t.Context(), "Michael Mann")
+			if err != nil {
+				t.Fatalf("GetPerson() error = %v", err)
+			}
+			assert.Equal(t, "nm0000520", mann.ImdbId)
+
+			missing, err := r.GetPersonByImdbId(t.Context(), "nm9999999")
+			assert.NoError(t, err)
+			assert.Nil(t, missing)
+		})
+	}
+}
+
+func TestRepository_MergePersons(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			alien := movies[1]
+
+			// A spelling variant of Ridley Scott, with a credit Ridley Scott already has
+			variant, err := r.InsertPerson(t.Context(), &Person{Name: "RIDLEY SCOTT", ImdbId: "nm0000631"})
+			if err != nil {
+				t.Fatalf("InsertPerson() error = %v", err)
+			}
+			for _, typ := range []PersonType{Director, Writer} {
+				credit := Person{Id: variant.Id, Name: variant.Name, Type: typ}
+				if err := r.InsertMoviePerson(t.Context(), alien, &credit); err != nil {
+					t.Fatalf("InsertMoviePerson() error = %v", err)
+				}
+			}
+
+			duplicates, err := r.GetDuplicatePersons(t.Context())
+			if err != nil {
+				t.Fatalf("GetDuplicatePersons() error = %v", err)
+			}
+			if !assert.Len(t, duplicates, 1) || !assert.Len(t, duplicates[0], 2) {
+				return
+			}
+
+			survivor, duplicate := duplicates[0][0], duplicates[0][1]
+			assert.Equal(t, "Ridley Scott", survivor.Name)
+			if err := r.MergePersons(t.Context(), &survivor, []*Person{&duplicate}); err != nil {
+				t.Fatalf("MergePersons() error = %v", err)
+			}
+
+			persons, err := r.GetPersonsForMovie(t.Context(), alien)
+			if err != nil {
+				t.Fatalf("GetPersonsForMovie() error = %v", err)
+			}
+			var credits []string
+			for _, person := range persons {
+				credits = append(credits, getPersonHistoryValue(&person))
+			}
+			assert.Equal(t, []string{"Ridley Scott (director)", "Ridley Scott (writer)", "Sigourney Weaver (actor)"}, credits)
+			assert.Equal(t, "nm0000631", persons[0].ImdbId)
+
+			duplicates, err = r.GetDuplicatePersons(t.Context())
+			if err != nil {
+				t.Fatalf("GetDuplicatePersons() error = %v", err)
+			}
+			assert.Empty(t, duplicates)
+
+			// The moved credits are recorded in the history of the movie
+			history, err := r.GetMovieHistory(t.Context(), alien)
+			if err != nil {
+				t.Fatalf("GetMovieHistory() error = %v", err)
+			}
+			assert.Contains(t, getTestChanges(history, ChangeSourceUI),
+				MovieChange{Field: historyFieldPerson, OldValue: "RIDLEY SCOTT (writer)", NewValue: "Ridley Scott (writer)"})
+		})
+	}
+}
@@ -0,0 +1,710 @@
+package data
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query is a parsed search query from the main search box. The query language supports:
+//
+//	heat                      free text search in title, sub title, year and story line
+//	"the dark knight"         quoted phrases
+//	title:alien pack:alien    field searches
+//	director:"ridley scott"   person searches (person, director, writer and actor)
+//	genre:thriller            genre searches
+//	tag:4k tag:christmas      tag searches
+//	year:1990..1999           ranges, either end can be left out (year:1990..)
+//	runtime:<100 imdb:>=7.5   comparisons (<, <=, >, >= and =)
+//	watched towatch           flags (watched, towatch, subtitles and rated), also as is:watched
+//	a b, a AND b              both a and b must match
+//	a OR b                    either a or b must match
+//	NOT a, -a                 a must not match
+//	(a OR b) c                parentheses for grouping
+//
+// The operators AND, OR and NOT must be written in upper case.
+type Query struct {
+	root queryNode
+}
+
+// QuerySyntaxError is returned by ParseQuery if the search query is malformed.
+type QuerySyntaxError struct {
+	Pos int // Position (in runes) of the error in the query
+	Msg string
+}
+
+// Error returns the error message.
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Pos+1, e.Msg)
+}
+
+// ParseQuery parses a search query. An empty query matches all movies.
+func ParseQuery(query string) (*Query, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens, length: len([]rune(query))}
+	if len(tokens) == 0 {
+		return &Query{}, nil
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok != nil {
+		return nil, p.errorf(tok.pos, "unexpected %s", tok)
+	}
+
+	return &Query{root: root}, nil
+}
+
+// QuoteQueryValue returns value as a quoted phrase, so that it can be used as
+// a value in a search query, for example "pack:" + QuoteQueryValue(pack).
+func QuoteQueryValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+// sql returns the query as an SQL WHERE clause, using ? for the arguments.
+// An empty query returns an empty clause.
+func (q *Query) sql() (string, []interface{}) {
+	if q.root == nil {
+		return "", nil
+	}
+
+	var args []interface{}
+	where := q.root.sql(&args)
+	return where, args
+}
+
+// match reports whether the movie matches the query, using
+// the matcher to look up persons and genres for the movie.
+func (q *Query) match(matcher queryMatcher, movie *Movie) bool {
+	if q.root == nil {
+		return true
+	}
+	return q.root.match(matcher, movie)
+}
+
+// queryMatcher looks up the persons and genres of a movie,
+// when a query is matched against a movie in memory.
+type queryMatcher interface {
+	hasPersonLike(movieId int, pattern string, typ int) bool
+	hasGenreLike(movieId int, pattern string) bool
+	hasTagLike(movieId int, pattern string) bool
+}
+
+//
+// Syntax tree
+//
+
+type queryNode interface {
+	sql(args *[]interface{}) string
+	match(matcher queryMatcher, movie *Movie) bool
+}
+
+type andNode struct {
+	left, right queryNode
+}
+
+func (n *andNode) sql(args *[]interface{}) string {
+	return "(" + n.left.sql(args) + " AND " + n.right.sql(args) + ")"
+}
+
+func (n *andNode) match(matcher queryMatcher, movie *Movie) bool {
+	return n.left.match(matcher, movie) && n.right.match(matcher, movie)
+}
+
+type orNode struct {
+	left, right queryNode
+}
+
+func (n *orNode) sql(args *[]interface{}) string {
+	return "(" + n.left.sql(args) + " OR " + n.right.sql(args) + ")"
+}
+
+func (n *orNode) match(matcher queryMatcher, movie *Movie) bool {
+	return n.left.match(matcher, movie) || n.right.match(matcher, movie)
+}
+
+type notNode struct {
+	node queryNode
+}
+
+func (n *notNode) sql(args *[]interface{}) string {
+	return "NOT " + n.node.sql(args)
+}
+
+func (n *notNode) match(matcher queryMatcher, movie *Movie) bool {
+	return !n.node.match(matcher, movie)
+}
+
+// likeEscape makes the next character of a LIKE pattern match itself. MySQL
+// and SQLite do not agree on a default, so likeEscapeClause is added to every LIKE.
+const (
+	likeEscape       = '!'
+	likeEscapeClause = "ESCAPE '!'"
+)
+
+// escapeLike escapes the wildcards of a search value, so that a search for
+// 100% does not match every title that contains 100.
+func escapeLike(value string) string {
+	var sb strings.Builder
+	for _, r := range value {
+		if r == '%' || r == '_' || r == likeEscape {
+			sb.WriteRune(likeEscape)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// textNode matches a LIKE pattern against one or more text columns.
+type textNode struct {
+	columns []string
+	values  func(movie *Movie) []string
+	pattern string
+}
+
+func (n *textNode) sql(args *[]interface{}) string {
+	var conditions []string
+	for _, column := range n.columns {
+		conditions = append(conditions, column+" LIKE ? "+likeEscapeClause)
+		*args = append(*args, n.pattern)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")"
+}
+
+func (n *textNode) match(_ queryMatcher, movie *Movie) bool {
+	for _, value := range n.values(movie) {
+		if likeMatch(value, n.pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeNode compares a numeric column with one or two values.
+type rangeNode struct {
+	column string
+	value  func(movie *Movie) float64
+	ops    []string
+	limits []float64
+}
+
+func (n *rangeNode) sql(args *[]interface{}) string {
+	var conditions []string
+	for i, op := range n.ops {
+		conditions = append(conditions, n.column+" "+op+" ?")
+		*args = append(*args, n.limits[i])
+	}
+	return "(" + strings.Join(conditions, " AND ") + ")"
+}
+
+func (n *rangeNode) match(_ queryMatcher, movie *Movie) bool {
+	// Compare as float32, since that is how the IMDB rating is stored
+	value := float32(n.value(movie))
+	for i, op := range n.ops {
+		limit := float32(n.limits[i])
+		var ok bool
+		switch op {
+		case "<":
+			ok = value < limit
+		case "<=":
+			ok = value <= limit
+		case ">":
+			ok = value > limit
+		case ">=":
+			ok = value >= limit
+		default:
+			ok = value == limit
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// personNode matches movies with a person (optionally of a given type) whose name is like the pattern.
+type personNode struct {
+	typ     int
+	pattern string
+}
+
+func (n *personNode) sql(args *[]interface{}) string {
+	where := "person.name LIKE ? " + likeEscapeClause
+	*args = append(*args, n.pattern)
+	if n.typ >= 0 {
+		where += " AND movie_person.type = ?"
+		*args = append(*args, n.typ)
+	}
+
+	return "EXISTS (SELECT 1 FROM movie_person JOIN person ON person.id = movie_person.person_id " +
+		"WHERE movie_person.movie_id = movies.id AND " + where + ")"
+}
+
+func (n *personNode) match(matcher queryMatcher, movie *Movie) bool {
+	return matcher.hasPersonLike(movie.Id, n.pattern, n.typ)
+}
+
+// genreNode matches movies with a genre whose name is like the pattern.
+type genreNode struct {
+	pattern string
+}
+
+func (n *genreNode) sql(args *[]interface{}) string {
+	*args = append(*args, n.pattern)
+	return "EXISTS (SELECT 1 FROM movie_genre JOIN genre ON genre.id = movie_genre.genre_id " +
+		"WHERE movie_genre.movie_id = movies.id AND genre.name LIKE ? " + likeEscapeClause + ")"
+}
+
+func (n *genreNode) match(matcher queryMatcher, movie *Movie) bool {
+	return matcher.hasGenreLike(movie.Id, n.pattern)
+}
+
+// tagNode matches movies with a tag whose name is like the pattern.
+type tagNode struct {
+	pattern string
+}
+
+func (n *tagNode) sql(args *[]interface{}) string {
+	*args = append(*args, n.pattern)
+	return "EXISTS (SELECT 1 FROM movie_tag JOIN tag ON tag.id = movie_tag.tag_id " +
+		"WHERE movie_tag.movie_id = movies.id AND tag.name LIKE ? " + likeEscapeClause + ")"
+}
+
+func (n *tagNode) match(matcher queryMatcher, movie *Movie) bool {
+	return matcher.hasTagLike(movie.Id, n.pattern)
+}
+
+// flagNode matches movies with a flag, like watched or to watch, set.
+type flagNode struct {
+	where string
+	value func(movie *Movie) bool
+}
+
+func (n *flagNode) sql(_ *[]interface{}) string {
+	return "(" + n.where + ")"
+}
+
+func (n *flagNode) match(_ queryMatcher, movie *Movie) bool {
+	return n.value(movie)
+}
+
+//
+// Fields
+//
+
+// queryFlags are the flags that can be used as a bare word, or after is:
+var queryFlags = map[string]*flagNode{
+	"watched": {
+		where: "movies.watched_at IS NOT NULL",
+		value: func(movie *Movie) bool { return movie.WatchedAt.Valid },
+	},
+	"towatch": {
+		where: "movies.to_watch = true",
+		value: func(movie *Movie) bool { return movie.ToWatch },
+	},
+	"subtitles": {
+		where: "movies.needsSubtitle = true",
+		value: func(movie *Movie) bool { return movie.NeedsSubtitle },
+	},
+	"rated": {
+		where: "movies.my_rating > 0",
+		value: func(movie *Movie) bool { return movie.MyRating > 0 },
+	},
+}
+
+// queryRange describes a numeric field, and the operator used when no operator is given.
+type queryRange struct {
+	column    string
+	value     func(movie *Movie) float64
+	defaultOp string
+}
+
+var queryRanges = map[string]queryRange{
+	"year": {
+		column:    "movies.year",
+		value:     func(movie *Movie) float64 { return float64(movie.Year) },
+		defaultOp: "=",
+	},
+	"runtime": {
+		column:    "movies.length",
+		value:     func(movie *Movie) float64 { return float64(movie.Runtime) },
+		defaultOp: "=",
+	},
+	"imdb": {
+		column:    "movies.imdb_rating",
+		value:     func(movie *Movie) float64 { return float64(movie.ImdbRating) },
+		defaultOp: ">=",
+	},
+	"myrating": {
+		column:    "movies.my_rating",
+		value:     func(movie *Movie) float64 { return float64(movie.MyRating) },
+		defaultOp: ">=",
+	},
+}
+
+// newTermNode creates the node for a single search term, like title:alien or year:1990..1999.
+func (p *queryParser) newTermNode(tok *queryToken) (queryNode, error) {
+	pattern := "%" + escapeLike(tok.value) + "%"
+
+	if tok.value == "" && tok.field != "" {
+		return nil, p.errorf(tok.pos, "missing value for %s", tok.field)
+	}
+
+	switch tok.field {
+	case "":
+		if flag, ok := queryFlags[strings.ToLower(tok.value)]; ok && !tok.quoted {
+			return flag, nil
+		}
+		return &textNode{
+			columns: []string{"movies.title", "COALESCE(movies.sub_title, '')", "movies.year", "COALESCE(movies.story_line, '')"},
+			values: func(movie *Movie) []string {
+				return []string{movie.Title, movie.SubTitle, strconv.Itoa(movie.Year), movie.StoryLine}
+			},
+			pattern: pattern,
+		}, nil
+	case "title":
+		return &textNode{
+			columns: []string{"movies.title", "COALESCE(movies.sub_title, '')"},
+			values:  func(movie *Movie) []string { return []string{movie.Title, movie.SubTitle} },
+			pattern: pattern,
+		}, nil
+	case "pack":
+		return &textNode{
+			columns: []string{"COALESCE(movies.pack, '')"},
+			values:  func(movie *Movie) []string { return []string{movie.Pack} },
+			pattern: pattern,
+		}, nil
+	case "genre":
+		return &genreNode{pattern: escapeLike(tok.value)}, nil
+	case "tag":
+		return &tagNode{pattern: escapeLike(tok.value)}, nil
+	case "is":
+		flag, ok := queryFlags[strings.ToLower(tok.value)]
+		if !ok {
+			return nil, p.errorf(tok.pos, "unknown flag %q", tok.value)
+		}
+		return flag, nil
+	}
+
+	if typ, ok := personType[tok.field]; ok {
+		return &personNode{typ: typ, pattern: pattern}, nil
+	}
+
+	if r, ok := queryRanges[tok.field]; ok {
+		return p.newRangeNode(tok, r)
+	}
+
+	return nil, p.errorf(tok.pos, "unknown field %q", tok.field)
+}
+
+// newRangeNode parses values like 1990, 1990..1999, ..1999, <100 and >=7.5.
+func (p *queryParser) newRangeNode(tok *queryToken, r queryRange) (queryNode, error) {
+	node := &rangeNode{column: r.column, value: r.value}
+
+	parse := func(value string) (float64, error) {
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return 0, p.errorf(tok.pos, "invalid number %q for %s", value, tok.field)
+		}
+		return number, nil
+	}
+
+	if from, to, ok := strings.Cut(tok.value, ".."); ok {
+		if from == "" && to == "" {
+			return nil, p.errorf(tok.pos, "empty range for %s", tok.field)
+		}
+		for _, limit := range []struct{ op, value string }{{">=", from}, {"<=", to}} {
+			if limit.value == "" {
+				continue
+			}
+			number, err := parse(limit.value)
+			if err != nil {
+				return nil, err
+			}
+			node.ops = append(node.ops, limit.op)
+			node.limits = append(node.limits, number)
+		}
+		return node, nil
+	}
+
+	op, value := r.defaultOp, tok.value
+	for _, prefix := range []string{"<=", ">=", "<", ">", "="} {
+		if strings.HasPrefix(value, prefix) {
+			op, value = prefix, value[len(prefix):]
+			break
+		}
+	}
+
+	number, err := parse(value)
+	if err != nil {
+		return nil, err
+	}
+	node.ops = []string{op}
+	node.limits = []float64{number}
+
+	return node, nil
+}
+
+//
+// Tokenizer
+//
+
+type queryTokenType int
+
+const (
+	tokenTerm queryTokenType = iota
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type queryToken struct {
+	typ    queryTokenType
+	pos    int
+	field  string
+	value  string
+	quoted bool
+}
+
+// String returns a description of the token, used in error messages.
+func (t *queryToken) String() string {
+	switch t.typ {
+	case tokenAnd:
+		return "AND"
+	case tokenOr:
+		return "OR"
+	case tokenNot:
+		return "NOT"
+	case tokenOpen:
+		return "'('"
+	case tokenClose:
+		return "')'"
+	default:
+		if t.field != "" {
+			return fmt.Sprintf("%q", t.field+":"+t.value)
+		}
+		return fmt.Sprintf("%q", t.value)
+	}
+}
+
+// tokenizeQuery splits a query into tokens.
+func tokenizeQuery(query string) ([]*queryToken, error) {
+	var tokens []*queryToken
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, &queryToken{typ: tokenOpen, pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, &queryToken{typ: tokenClose, pos: i})
+			i++
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != ')':
+			tokens = append(tokens, &queryToken{typ: tokenNot, pos: i})
+			i++
+		case r == '"':
+			value, end, err := readQuotedValue(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, &queryToken{typ: tokenTerm, pos: i, value: value, quoted: true})
+			i = end
+		default:
+			token, end, err := readTerm(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token)
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
+
+// readTerm reads a word, like heat, title:alien or director:"ridley scott",
+// starting at start. It returns the token and the position after it.
+func readTerm(runes []rune, start int) (*queryToken, int, error) {
+	i := start
+	for i < len(runes) && !isQueryDelimiter(runes[i]) {
+		i++
+	}
+	word := string(runes[start:i])
+
+	switch word {
+	case "AND":
+		return &queryToken{typ: tokenAnd, pos: start}, i, nil
+	case "OR":
+		return &queryToken{typ: tokenOr, pos: start}, i, nil
+	case "NOT":
+		return &queryToken{typ: tokenNot, pos: start}, i, nil
+	}
+
+	token := &queryToken{typ: tokenTerm, pos: start, value: word}
+
+	field, value, ok := strings.Cut(word, ":")
+	if !ok {
+		return token, i, nil
+	}
+	token.field = strings.ToLower(field)
+	token.value = value
+
+	// A quoted value directly after the colon, like director:"ridley scott"
+	if value == "" && i < len(runes) && runes[i] == '"' {
+		value, end, err := readQuotedValue(runes, i)
+		if err != nil {
+			return nil, 0, err
+		}
+		token.value = value
+		token.quoted = true
+		i = end
+	}
+
+	return token, i, nil
+}
+
+// readQuotedValue reads a quoted phrase starting at the quote at start,
+// and returns the unquoted value and the position after the closing quote.
+// Backslash can be used to escape a quote or a backslash in the phrase.
+func readQuotedValue(runes []rune, start int) (string, int, error) {
+	var value strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+			}
+			value.WriteRune(runes[i])
+		case '"':
+			return value.String(), i + 1, nil
+		default:
+			value.WriteRune(runes[i])
+		}
+	}
+
+	return "", 0, &QuerySyntaxError{Pos: start, Msg: "missing closing quote"}
+}
+
+func isQueryDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+}
+
+//
+// Parser
+//
+
+// queryParser is a recursive descent parser for the grammar:
+//
+//	or   = and { "OR" and }
+//	and  = not { ["AND"] not }
+//	not  = ("NOT" | "-") not | atom
+//	atom = "(" or ")" | term
+type queryParser struct {
+	tokens []*queryToken
+	next   int
+	length int
+}
+
+func (p *queryParser) peek() *queryToken {
+	if p.next >= len(p.tokens) {
+		return nil
+	}
+	return p.tokens[p.next]
+}
+
+func (p *queryParser) errorf(pos int, format string, args ...any) error {
+	return &QuerySyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for tok := p.peek(); tok != nil && tok.typ == tokenOr; tok = p.peek() {
+		p.next++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for tok := p.peek(); tok != nil && tok.typ != tokenOr && tok.typ != tokenClose; tok = p.peek() {
+		if tok.typ == tokenAnd {
+			p.next++
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	tok := p.peek()
+	if tok != nil && tok.typ == tokenNot {
+		p.next++
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{node: node}, nil
+	}
+
+	return p.parseAtom()
+}
+
+func (p *queryParser) parseAtom() (queryNode, error) {
+	tok := p.peek()
+	if tok == nil {
+		return nil, p.errorf(p.length, "unexpected end of query")
+	}
+	p.next++
+
+	switch tok.typ {
+	case tokenOpen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing := p.peek()
+		if closing == nil || closing.typ != tokenClose {
+			return nil, p.errorf(tok.pos, "missing closing parenthesis")
+		}
+		p.next++
+		return node, nil
+	case tokenTerm:
+		return p.newTermNode(tok)
+	default:
+		return nil, p.errorf(tok.pos, "unexpected %s", tok)
+	}
+}
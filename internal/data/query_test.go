@@ -0,0 +1,97 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuery_SQL(t *testing.T) {
+	tests := []struct {
+		query    string
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{"", "", nil},
+		{"   ", "", nil},
+		{"title:alien", "(movies.title LIKE ? ESCAPE '!' OR COALESCE(movies.sub_title, '') LIKE ? ESCAPE '!')", []interface{}{"%alien%", "%alien%"}},
+		{"pack:alien", "(COALESCE(movies.pack, '') LIKE ? ESCAPE '!')", []interface{}{"%alien%"}},
+		{"year:1990..1999", "(movies.year >= ? AND movies.year <= ?)", []interface{}{1990.0, 1999.0}},
+		{"year:1990..", "(movies.year >= ?)", []interface{}{1990.0}},
+		{"runtime:<100", "(movies.length < ?)", []interface{}{100.0}},
+		{"imdb:7.5", "(movies.imdb_rating >= ?)", []interface{}{7.5}},
+		{"myrating:=3", "(movies.my_rating = ?)", []interface{}{3.0}},
+		{"genre:drama", "EXISTS (SELECT 1 FROM movie_genre JOIN genre ON genre.id = movie_genre.genre_id " +
+			"WHERE movie_genre.movie_id = movies.id AND genre.name LIKE ? ESCAPE '!')", []interface{}{"drama"}},
+		{"tag:4k", "EXISTS (SELECT 1 FROM movie_tag JOIN tag ON tag.id = movie_tag.tag_id " +
+			"WHERE movie_tag.movie_id = movies.id AND tag.name LIKE ? ESCAPE '!')", []interface{}{"4k"}},
+		{`director:"christopher nolan"`, "EXISTS (SELECT 1 FROM movie_person JOIN person ON person.id = movie_person.person_id " +
+			"WHERE movie_person.movie_id = movies.id AND person.name LIKE ? ESCAPE '!' AND movie_person.type = ?)",
+			[]interface{}{"%christopher nolan%", 0}},
+		{"-watched", "NOT (movies.watched_at IS NOT NULL)", nil},
+		{"is:towatch subtitles", "((movies.to_watch = true) AND (movies.needsSubtitle = true))", nil},
+		{"year:2000 OR year:2001 rated", "((movies.year = ?) OR ((movies.year = ?) AND (movies.my_rating > 0)))", []interface{}{2000.0, 2001.0}},
+		{"(year:2000 OR year:2001) AND rated", "(((movies.year = ?) OR (movies.year = ?)) AND (movies.my_rating > 0))", []interface{}{2000.0, 2001.0}},
+		{"title:100%", "(movies.title LIKE ? ESCAPE '!' OR COALESCE(movies.sub_title, '') LIKE ? ESCAPE '!')", []interface{}{"%100!%%", "%100!%%"}},
+		{"tag:a_b!", "EXISTS (SELECT 1 FROM movie_tag JOIN tag ON tag.id = movie_tag.tag_id " +
+			"WHERE movie_tag.movie_id = movies.id AND tag.name LIKE ? ESCAPE '!')", []interface{}{"a!_b!!"}},
+		{`pack:"a \"quoted\" pack"`, "(COALESCE(movies.pack, '') LIKE ? ESCAPE '!')", []interface{}{`%a "quoted" pack%`}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			query, err := ParseQuery(test.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+
+			sql, args := query.sql()
+			assert.Equal(t, test.wantSQL, sql)
+			assert.Equal(t, test.wantArgs, args)
+		})
+	}
+}
+
+func TestParseQuery_SyntaxErrors(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantPos int
+	}{
+		{"(alien", 0},
+		{"alien)", 5},
+		{"alien OR", 8},
+		{"AND alien", 0},
+		{"NOT", 3},
+		{`title:"alien`, 6},
+		{"foo:bar", 0},
+		{"title:", 0},
+		{"year:nineties", 0},
+		{"year:..", 0},
+		{"is:old", 0},
+		{"()", 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			_, err := ParseQuery(test.query)
+
+			var syntaxErr *QuerySyntaxError
+			if !assert.ErrorAs(t, err, &syntaxErr) {
+				return
+			}
+			assert.Equal(t, test.wantPos, syntaxErr.Pos)
+		})
+	}
+}
+
+func TestQuoteQueryValue(t *testing.T) {
+	for _, value := range []string{"Alien", "Star Wars", `The "Best" Of`, `back\slash`, "(OR)"} {
+		query, err := ParseQuery("pack:" + QuoteQueryValue(value))
+		if err != nil {
+			t.Fatalf("ParseQuery() error = %v", err)
+		}
+
+		_, args := query.sql()
+		assert.Equal(t, []interface{}{"%" + value + "%"}, args)
+	}
+}
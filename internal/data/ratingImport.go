@@ -0,0 +1,329 @@
+package data
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RatingSource is the site and kind of file that ratings are imported from.
+type RatingSource string
+
+// The files that ReadRatings can read.
+const (
+	ImdbRatings       RatingSource = "IMDb ratings"
+	ImdbWatchlist     RatingSource = "IMDb watchlist"
+	LetterboxdRatings RatingSource = "Letterboxd ratings"
+	LetterboxdDiary   RatingSource = "Letterboxd diary"
+	LetterboxdWatched RatingSource = "Letterboxd watched"
+)
+
+// RatingRow is a row of an IMDb or Letterboxd export.
+type RatingRow struct {
+	ImdbId string
+	Title  string
+	Year   int
+	// Rating is on a ten point scale, 0 if the row has no rating
+	Rating int
+	// Date is the date of the viewing for a diary row, otherwise when the
+	// movie was rated, logged or added to the watchlist
+	Date    time.Time
+	Viewing bool
+	Watched bool
+	ToWatch bool
+}
+
+// RatingImport is the result of matching the rows of a file to the movies,
+// which is shown to the user before any changes are made.
+type RatingImport struct {
+	Source    RatingSource
+	Changes   []RatingChange
+	Unmatched []RatingRow
+}
+
+// RatingChange is what an import changes on a movie. MyRating and ToWatch are
+// the new values, and Viewings are the viewings that are added.
+type RatingChange struct {
+	Movie    *Movie
+	MyRating int
+	ToWatch  bool
+	Viewings []Viewing
+}
+
+// ratingDateFormat is the date format of both IMDb and Letterboxd exports.
+const ratingDateFormat = time.DateOnly
+
+// ReadRatings reads an IMDb ratings or watchlist export, or a Letterboxd
+// ratings, diary or watched export. The kind of file is recognised by its header.
+func ReadRatings(r io.Reader) (RatingSource, []RatingRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read ratings: %w", err)
+	}
+	if len(records) == 0 {
+		return "", nil, fmt.Errorf("failed to read ratings: the file is empty")
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	source, err := getRatingSource(columns)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var rows []RatingRow
+	for i, record := range records[1:] {
+		row, err := parseRatingRecord(source, columns, record)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read ratings, row %d: %w", i+2, err)
+		}
+		rows = append(rows, row)
+	}
+
+	return source, rows, nil
+}
+
+func getRatingSource(columns map[string]int) (RatingSource, error) {
+	has := func(name string) bool {
+		_, ok := columns[name]
+		return ok
+	}
+
+	switch {
+	case has("Const") && has("Position"):
+		return ImdbWatchlist, nil
+	case has("Const") && has("Your Rating"):
+		return ImdbRatings, nil
+	case has("Letterboxd URI") && has("Watched Date"):
+		return LetterboxdDiary, nil
+	case has("Letterboxd URI") && has("Rating"):
+		return LetterboxdRatings, nil
+	case has("Letterboxd URI"):
+		return LetterboxdWatched, nil
+	}
+	return "", fmt.Errorf("failed to read ratings: not an IMDb or Letterboxd export")
+}
+
+func parseRatingRecord(source RatingSource, columns map[string]int, record []string) (RatingRow, error) {
+	get := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var row RatingRow
+	var err error
+	switch source {
+	case ImdbRatings, ImdbWatchlist:
+		row.ImdbId, row.Title = get("Const"), get("Title")
+		if row.Rating, err = parseTenPointRating(get("Your Rating")); err != nil {
+			return row, err
+		}
+		if source == ImdbRatings {
+			row.Date, err = parseRatingDate(get("Date Rated"))
+			row.Watched = true
+		} else {
+			row.Date, err = parseRatingDate(get("Created"))
+			row.ToWatch = true
+		}
+	default:
+		row.Title = get("Name")
+		if row.Rating, err = parseStarRating(get("Rating")); err != nil {
+			return row, err
+		}
+		row.Date, err = parseRatingDate(get("Date"))
+		row.Watched = true
+		if source == LetterboxdDiary && get("Watched Date") != "" {
+			row.Date, err = parseRatingDate(get("Watched Date"))
+			row.Viewing = true
+		}
+	}
+	if err != nil {
+		return row, err
+	}
+
+	if year := get("Year"); year != "" {
+		if row.Year, err = strconv.Atoi(year); err != nil {
+			return row, fmt.Errorf("invalid year %q", year)
+		}
+	}
+
+	return row, nil
+}
+
+func parseTenPointRating(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	rating, err := strconv.Atoi(s)
+	if err != nil || rating < 0 || rating > 10 {
+		return 0, fmt.Errorf("invalid rating %q", s)
+	}
+	return rating, nil
+}
+
+// parseStarRating converts a Letterboxd rating of half to five stars to a ten point rating.
+func parseStarRating(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	stars, err := strconv.ParseFloat(s, 64)
+	if err != nil || stars < 0 || stars > 5 {
+		return 0, fmt.Errorf("invalid rating %q", s)
+	}
+	return int(math.Round(stars * 2)), nil
+}
+
+func parseRatingDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.ParseInLocation(ratingDateFormat, s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+	return date, nil
+}
+
+// getMyRating converts a ten point rating to my rating of one to five, so that
+// a rating of 1 is not lost. A ten point rating of 0 means not rated.
+func getMyRating(rating int) int {
+	return (rating + 1) / 2
+}
+
+// PrepareRatingImport matches the rows to the movies, by IMDb id, or by title
+// and year when the row has no IMDb id or no movie has it, and returns what
+// would change, without changing anything. The rating of the latest row of a
+// movie is used. Diary rows add viewings on days the movie has no viewing.
+// Other watched rows add a viewing only if the movie has never been watched.
+// Watchlist rows put the movie on the to watch list.
+func PrepareRatingImport(ctx context.Context, r Repository, source RatingSource, rows []RatingRow) (*RatingImport, error) {
+	movies, err := r.SearchMovies(ctx, "all", "", -1, "id asc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get movies: %w", err)
+	}
+
+	result := &RatingImport{Source: source}
+	matched := map[int][]RatingRow{}
+	var order []*Movie
+	for _, row := range rows {
+		movie := findRatingMovie(movies, row)
+		if movie == nil {
+			result.Unmatched = append(result.Unmatched, row)
+			continue
+		}
+		if _, ok := matched[movie.Id]; !ok {
+			order = append(order, movie)
+		}
+		matched[movie.Id] = append(matched[movie.Id], row)
+	}
+
+	for _, movie := range order {
+		viewings, err := r.GetViewings(ctx, movie)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get viewings of %s: %w", movie.Title, err)
+		}
+		change := getRatingChange(movie, viewings, matched[movie.Id])
+		if change.MyRating != movie.MyRating || change.ToWatch != movie.ToWatch || len(change.Viewings) > 0 {
+			result.Changes = append(result.Changes, change)
+		}
+	}
+
+	return result, nil
+}
+
+func findRatingMovie(movies []*Movie, row RatingRow) *Movie {
+	if row.ImdbId != "" {
+		index := slices.IndexFunc(movies, func(m *Movie) bool { return m.ImdbID == row.ImdbId })
+		if index >= 0 {
+			return movies[index]
+		}
+	}
+
+	index := slices.IndexFunc(movies, func(m *Movie) bool {
+		return m.Year == row.Year && strings.EqualFold(strings.TrimSpace(m.Title), row.Title)
+	})
+	if index >= 0 {
+		return movies[index]
+	}
+	return nil
+}
+
+func getRatingChange(movie *Movie, viewings []Viewing, rows []RatingRow) RatingChange {
+	change := RatingChange{Movie: movie, MyRating: movie.MyRating, ToWatch: movie.ToWatch}
+
+	// Use the rating of the latest row, and of the last one of rows on the same day
+	var ratedAt time.Time
+	for _, row := range rows {
+		if row.Rating > 0 && !row.Date.Before(ratedAt) {
+			change.MyRating = getMyRating(row.Rating)
+			ratedAt = row.Date
+		}
+		if row.ToWatch {
+			change.ToWatch = true
+		}
+	}
+
+	watchedOn := map[string]bool{}
+	for _, viewing := range viewings {
+		watchedOn[viewing.WatchedAt.In(time.Local).Format(ratingDateFormat)] = true
+	}
+	for _, row := range rows {
+		day := row.Date.Format(ratingDateFormat)
+		if !row.Viewing || watchedOn[day] {
+			continue
+		}
+		watchedOn[day] = true
+		change.Viewings = append(change.Viewings, Viewing{WatchedAt: row.Date, Rating: getMyRating(row.Rating)})
+	}
+
+	// A movie that has been rated or logged as watched has been watched, at
+	// the latest on that day
+	if len(watchedOn) == 0 {
+		for _, row := range rows {
+			if row.Watched && !row.Date.IsZero() {
+				change.Viewings = append(change.Viewings, Viewing{WatchedAt: row.Date, Rating: change.MyRating})
+				break
+			}
+		}
+	}
+
+	return change
+}
+
+// ApplyRatingImport makes the changes of a rating import. Each movie is
+// updated on its own, so the changes that were made before an error are kept.
+func ApplyRatingImport(ctx context.Context, r Repository, changes []RatingChange) error {
+	for _, change := range changes {
+		movie := change.Movie
+		if movie.MyRating != change.MyRating || movie.ToWatch != change.ToWatch {
+			updated := *movie
+			updated.MyRating, updated.ToWatch = change.MyRating, change.ToWatch
+			// Only update the columns, the genres of the movie are already saved
+			updated.Genres = nil
+			if err := r.UpdateMovie(ctx, &updated); err != nil {
+				return fmt.Errorf("failed to import rating of %s: %w", movie.Title, err)
+			}
+			movie.MyRating, movie.ToWatch = change.MyRating, change.ToWatch
+		}
+
+		for _, viewing := range change.Viewings {
+			if err := r.InsertViewing(ctx, movie, &viewing); err != nil {
+				return fmt.Errorf("failed to import viewing of %s: %w", movie.Title, err)
+			}
+		}
+	}
+
+	return nil
+}
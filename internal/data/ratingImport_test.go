@@ -0,0 +1,193 @@
+package data
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getRatingDate(s string) time.Time {
+	date, _ := time.ParseInLocation(time.DateOnly, s, time.Local)
+	return date
+}
+
+func TestReadRatings(t *testing.T) {
+	tests := []struct {
+		name       string
+		csv        string
+		wantSource RatingSource
+		wantRows   []RatingRow
+	}{
+		{
+			"IMDb ratings",
+			"\ufeffConst,Your Rating,Date Rated,Title,Original Title,URL,Title Type,IMDb Rating,Runtime (mins),Year\n" +
+				"tt0113277,9,2024-05-01,Heat,Heat,https://www.imdb.com/title/tt0113277/,Movie,8.3,170,1995\n",
+			ImdbRatings,
+			[]RatingRow{{ImdbId: "tt0113277", Title: "Heat", Year: 1995, Rating: 9, Date: getRatingDate("2024-05-01"), Watched: true}},
+		},
+		{
+			"IMDb watchlist",
+			"Position,Const,Created,Modified,Description,Title,URL,Title Type,IMDb Rating,Runtime (mins),Year\n" +
+				"1,tt0122690,2024-02-03,2024-02-03,,Ronin,https://www.imdb.com/title/tt0122690/,Movie,7.2,122,1998\n",
+			ImdbWatchlist,
+			[]RatingRow{{ImdbId: "tt0122690", Title: "Ronin", Year: 1998, Date: getRatingDate("2024-02-03"), ToWatch: true}},
+		},
+		{
+			"Letterboxd ratings",
+			"Date,Name,Year,Letterboxd URI,Rating\n2024-05-01,Heat,1995,https://boxd.it/1,4.5\n",
+			LetterboxdRatings,
+			[]RatingRow{{Title: "Heat", Year: 1995, Rating: 9, Date: getRatingDate("2024-05-01"), Watched: true}},
+		},
+		{
+			"Letterboxd diary",
+			"Date,Name,Year,Letterboxd URI,Rating,Rewatch,Tags,Watched Date\n" +
+				"2024-05-02,Heat,1995,https://boxd.it/2,0.5,Yes,,2024-04-30\n",
+			LetterboxdDiary,
+			[]RatingRow{{Title: "Heat", Year: 1995, Rating: 1, Date: getRatingDate("2024-04-30"), Viewing: true, Watched: true}},
+		},
+		{
+			"Letterboxd watched",
+			"Date,Name,Year,Letterboxd URI\n2024-05-01,Heat,1995,https://boxd.it/1\n",
+			LetterboxdWatched,
+			[]RatingRow{{Title: "Heat", Year: 1995, Date: getRatingDate("2024-05-01"), Watched: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, rows, err := ReadRatings(strings.NewReader(tt.csv))
+			if err != nil {
+				t.Fatalf("ReadRatings() error = %v", err)
+			}
+			assert.Equal(t, tt.wantSource, source)
+			assert.Equal(t, tt.wantRows, rows)
+		})
+	}
+
+	_, _, err := ReadRatings(strings.NewReader("title,year\nHeat,1995\n"))
+	assert.Error(t, err)
+	_, _, err = ReadRatings(strings.NewReader("Date,Name,Year,Letterboxd URI,Rating\n2024-05-01,Heat,1995,x,6\n"))
+	assert.Error(t, err)
+}
+
+func Test_getMyRating(t *testing.T) {
+	tests := []struct {
+		rating int
+		want   int
+	}{
+		{0, 0}, {1, 1}, {2, 1}, {3, 2}, {6, 3}, {8, 4}, {9, 5}, {10, 5},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, getMyRating(tt.rating), "getMyRating(%d)", tt.rating)
+	}
+}
+
+func TestRepository_RatingImport(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			insertTestMovies(t, r)
+			ronin := &Movie{Title: "Ronin", Year: 1998, MoviePath: "Ronin", ImdbID: "tt0122690"}
+			if err := r.InsertMovie(t.Context(), ronin); err != nil {
+				t.Fatalf("InsertMovie() error = %v", err)
+			}
+			if err := r.InsertViewing(t.Context(), ronin, &Viewing{WatchedAt: getRatingDate("2023-01-01")}); err != nil {
+				t.Fatalf("InsertViewing() error = %v", err)
+			}
+
+			rows := []RatingRow{
+				// Matched by title and year, watched twice, rated 3 and then 4 stars
+				{Title: "heat", Year: 1995, Rating: 6, Date: getRatingDate("2024-01-10"), Viewing: true, Watched: true},
+				{Title: "Heat", Year: 1995, Rating: 8, Date: getRatingDate("2024-05-01"), Viewing: true, Watched: true},
+				// Matched by IMDb id, already watched, so no viewing on the day it was rated
+				{ImdbId: "tt0122690", Title: "Ronin (1998)", Rating: 7, Date: getRatingDate("2024-03-03"), Watched: true},
+				// Never watched, gets a viewing on the day it was rated
+				{Title: "Alien", Year: 1979, Rating: 10, Date: getRatingDate("2024-02-02"), Watched: true},
+				// Unchanged
+				{Title: "Gladiator", Year: 2000, Rating: 10, Watched: true},
+				{Title: "Heat", Year: 1986},
+			}
+
+			result, err := PrepareRatingImport(t.Context(), r, LetterboxdDiary, rows)
+			if err != nil {
+				t.Fatalf("PrepareRatingImport() error = %v", err)
+			}
+			assert.Equal(t, []RatingRow{rows[5]}, result.Unmatched)
+			if assert.Len(t, result.Changes, 3) {
+				heat := result.Changes[0]
+				assert.Equal(t, "Heat", heat.Movie.Title)
+				assert.Equal(t, 4, heat.MyRating)
+				assert.Equal(t, []Viewing{
+					{WatchedAt: getRatingDate("2024-01-10"), Rating: 3},
+					{WatchedAt: getRatingDate("2024-05-01"), Rating: 4},
+				}, heat.Viewings)
+				assert.Equal(t, 4, result.Changes[1].MyRating)
+				assert.Empty(t, result.Changes[1].Viewings)
+				assert.Equal(t, []Viewing{{WatchedAt: getRatingDate("2024-02-02"), Rating: 5}}, result.Changes[2].Viewings)
+			}
+
+			movies, err := r.SearchMovies(t.Context(), "all", "", -1, "id asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, 4, movies[2].MyRating, "nothing is changed before the import is applied")
+
+			if err := ApplyRatingImport(t.Context(), r, result.Changes); err != nil {
+				t.Fatalf("ApplyRatingImport() error = %v", err)
+			}
+
+			movies, err = r.SearchMovies(t.Context(), "all", "", -1, "id asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, 4, movies[3].MyRating)
+			assert.Len(t, movies[2].Genres, 2, "the genres are kept")
+			assert.Equal(t, "2024-05-01", movies[2].WatchedAt.Time.In(time.Local).Format(time.DateOnly))
+
+			// Importing the same rows again changes nothing
+			result, err = PrepareRatingImport(t.Context(), r, LetterboxdDiary, rows)
+			if err != nil {
+				t.Fatalf("PrepareRatingImport() error = %v", err)
+			}
+			assert.Empty(t, result.Changes)
+		})
+	}
+}
+
+func TestRepository_WriteLetterboxdCSV(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			heat := movies[2]
+			for _, viewing := range []Viewing{
+				{WatchedAt: getRatingDate("2024-01-10"), Rating: 3},
+				{WatchedAt: getRatingDate("2024-05-01")},
+			} {
+				if err := r.InsertViewing(t.Context(), heat, &viewing); err != nil {
+					t.Fatalf("InsertViewing() error = %v", err)
+				}
+			}
+
+			buf := new(bytes.Buffer)
+			written, err := WriteLetterboxdCSV(t.Context(), r, buf)
+			if err != nil {
+				t.Fatalf("WriteLetterboxdCSV() error = %v", err)
+			}
+			assert.Equal(t, 3, written)
+
+			records, err := csv.NewReader(buf).ReadAll()
+			if err != nil {
+				t.Fatalf("failed to read CSV: %v", err)
+			}
+			// Alien is neither rated nor watched
+			assert.Equal(t, [][]string{
+				letterboxdCSVHeader,
+				{"", "Gladiator", "2000", "Ridley Scott", "10", "", "false"},
+				{"", "Heat", "1995", "Michael Mann", "6", "2024-01-10", "false"},
+				{"", "Heat", "1995", "Michael Mann", "8", "2024-05-01", "true"},
+			}, records)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// Repository is the public surface of the SoftIMDB data layer. It is
+// implemented by Database, which stores the library in MySQL or SQLite,
+// and by MemoryDatabase, which keeps everything in memory and is meant
+// for tests and demos.
+type Repository interface {
+	// Migrate brings the storage up to date with the current schema.
+	Migrate(ctx context.Context) error
+	// CloseDatabase releases the underlying storage.
+	CloseDatabase()
+
+	SearchMovies(ctx context.Context, currentView string, searchFor string, genreId int, orderBy string) ([]*Movie, error)
+	GetAllMoviePaths(ctx context.Context) ([]string, error)
+	GetAllMovieTitles(ctx context.Context) ([]string, error)
+	InsertMovie(ctx context.Context, movie *Movie) error
+	UpdateMovie(ctx context.Context, movie *Movie) error
+	UpdateWatchedAt(ctx context.Context, movie *Movie) error
+	UpdateMoviePersons(ctx context.Context, movie *Movie) error
+	DeleteMovie(ctx context.Context, rootDir string, movie *Movie) error
+	TrashMovie(ctx context.Context, rootDir, trashDir string, movie *Movie) error
+	RestoreMovie(ctx context.Context, rootDir, trashDir string, movie *Movie) error
+	EmptyTrash(ctx context.Context, trashDir string, olderThan time.Duration) (int, error)
+	SetProcessed(ctx context.Context, movie *Movie) error
+	UpdateImage(ctx context.Context, movie *Movie, imageData []byte) error
+
+	GetArtwork(ctx context.Context, movie *Movie) ([]Artwork, error)
+	InsertArtwork(ctx context.Context, movie *Movie, artwork *Artwork) error
+	SetPrimaryArtwork(ctx context.Context, movie *Movie, artwork *Artwork) error
+	DeleteArtwork(ctx context.Context, movie *Movie, artwork *Artwork) error
+
+	GetGenres(ctx context.Context) ([]Genre, error)
+	InsertMovieGenre(ctx context.Context, movie *Movie, genre *Genre) error
+	RemoveMovieGenre(ctx context.Context, movie *Movie, genre *Genre) error
+	GetGenreMovieCounts(ctx context.Context) (map[int]int, error)
+	RenameGenre(ctx context.Context, genre *Genre, name string) error
+	MergeGenres(ctx context.Context, survivor *Genre, duplicates []*Genre) error
+	DeleteGenre(ctx context.Context, genre *Genre) error
+	SetGenrePrivate(ctx context.Context, genre *Genre, isPrivate bool) error
+	GetGenreAliases(ctx context.Context) ([]GenreAlias, error)
+	InsertGenreAlias(ctx context.Context, alias *GenreAlias) error
+	DeleteGenreAlias(ctx context.Context, alias *GenreAlias) error
+
+	GetTags(ctx context.Context) ([]Tag, error)
+	InsertTag(ctx context.Context, tag *Tag) error
+	UpdateTag(ctx context.Context, tag *Tag) error
+	DeleteTag(ctx context.Context, tag *Tag) error
+	SetMovieTags(ctx context.Context, movie *Movie, tags []Tag) error
+	ConvertGenreToTag(ctx context.Context, genre *Genre) (*Tag, error)
+
+	GetPacks(ctx context.Context) ([]Pack, error)
+	GetPack(ctx context.Context, name string) (*Pack, error)
+	GetPackMovies(ctx context.Context, pack *Pack) ([]*Movie, error)
+	InsertPack(ctx context.Context, pack *Pack) error
+	UpdatePack(ctx context.Context, pack *Pack) error
+	DeletePack(ctx context.Context, pack *Pack) error
+	SetPackOrder(ctx context.Context, pack *Pack, movies []*Movie) error
+	UpdatePackImage(ctx context.Context, pack *Pack, imageData []byte) error
+
+	GetPerson(ctx context.Context, name string) (*Person, error)
+	GetPersonById(ctx context.Context, id int) (*Person, error)
+	GetPersonByImdbId(ctx context.Context, imdbId string) (*Person, error)
+	InsertPerson(ctx context.Context, person *Person) (*Person, error)
+	RemovePerson(ctx context.Context, person *Person) error
+	InsertMoviePerson(ctx context.Context, movie *Movie, person *Person) error
+	GetPersonsForMovie(ctx context.Context, movie *Movie) ([]Person, error)
+	GetPersonsForMovies(ctx context.Context, movies []*Movie) ([]*Movie, error)
+	GetDuplicatePersons(ctx context.Context) ([][]Person, error)
+	MergePersons(ctx context.Context, survivor *Person, duplicates []*Person) error
+
+	GetViewings(ctx context.Context, movie *Movie) ([]Viewing, error)
+	InsertViewing(ctx context.Context, movie *Movie, viewing *Viewing) error
+	UpdateViewing(ctx context.Context, movie *Movie, viewing *Viewing) error
+	DeleteViewing(ctx context.Context, movie *Movie, viewing *Viewing) error
+
+	GetStatistics(ctx context.Context) (*Statistics, error)
+
+	GetMovieHistory(ctx context.Context, movie *Movie) ([]MovieChange, error)
+	RevertChange(ctx context.Context, movie *Movie, change *MovieChange) error
+
+	GetAllIgnoredPaths(ctx context.Context) ([]*IgnoredPath, error)
+	InsertIgnorePath(ctx context.Context, ignorePath *IgnoredPath) error
+	DeleteIgnorePath(ctx context.Context, ignorePath *IgnoredPath) error
+}
+
+var (
+	_ Repository = (*Database)(nil)
+	_ Repository = (*MemoryDatabase)(nil)
+)
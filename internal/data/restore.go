@@ -0,0 +1,306 @@
+package data
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// restoreBatchSize is the number of rows that are inserted at a time.
+const restoreBatchSize = 100
+
+// VerifyBackup reads a backup archive, and verifies that it has a manifest,
+// that every file in the manifest is in the archive with the right checksum,
+// and that the archive has no other files.
+func VerifyBackup(fileName string) (*BackupManifest, error) {
+	var manifest *BackupManifest
+	checksums := map[string]string{}
+
+	err := readBackup(fileName, func(name string, data []byte) error {
+		if name != backupManifestName {
+			checksums[name] = getBackupChecksum(data)
+			return nil
+		}
+		manifest = &BackupManifest{}
+		if err := json.Unmarshal(data, manifest); err != nil {
+			return fmt.Errorf("failed to read manifest: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("failed to verify backup: the archive has no manifest")
+	}
+	for name, checksum := range manifest.Checksums {
+		found, ok := checksums[name]
+		if !ok {
+			return nil, fmt.Errorf("failed to verify backup: %s is missing", name)
+		}
+		if found != checksum {
+			return nil, fmt.Errorf("failed to verify backup: the checksum of %s does not match", name)
+		}
+	}
+	for name := range checksums {
+		if _, ok := manifest.Checksums[name]; !ok {
+			return nil, fmt.Errorf("failed to verify backup: %s is not in the manifest", name)
+		}
+	}
+
+	return manifest, nil
+}
+
+// Restore rebuilds the library from a backup archive, into a database that
+// has no movies. The archive is verified first. The database is then migrated
+// to the schema version of the backup, the rows and images are restored in one
+// transaction, and the remaining migrations are applied, so that backups made
+// by an older version can be restored. Restore is not limited by the query
+// timeout, since it may take long.
+func (d *Database) Restore(ctx context.Context, fileName string) (*BackupManifest, error) {
+	manifest, err := VerifyBackup(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Version < 1 || manifest.Version > backupVersion {
+		return nil, fmt.Errorf("failed to restore: unsupported backup version %d", manifest.Version)
+	}
+	if manifest.SchemaVersion < 1 || manifest.SchemaVersion > latestSchemaVersion() {
+		return nil, fmt.Errorf("failed to restore: unsupported schema version %d", manifest.SchemaVersion)
+	}
+
+	if err := d.checkRestoreTarget(ctx, manifest); err != nil {
+		return nil, err
+	}
+	if err := d.migrateTo(ctx, manifest.SchemaVersion); err != nil {
+		return nil, err
+	}
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+	err = db.Transaction(
+		func(tx *gorm.DB) error {
+			return d.restoreBackup(tx, fileName)
+		},
+	)
+	d.genreCache.clear()
+	d.imageCache.clear()
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore: %w", err)
+	}
+
+	if err := d.Migrate(ctx); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// checkRestoreTarget returns an error unless the database is empty, and its
+// schema is not newer than the backup.
+func (d *Database) checkRestoreTarget(ctx context.Context, manifest *BackupManifest) error {
+	current, err := d.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if current > manifest.SchemaVersion {
+		return fmt.Errorf("failed to restore: the database has schema version %d, the backup %d",
+			current, manifest.SchemaVersion)
+	}
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database: %w", err)
+	}
+	for _, table := range manifest.Tables {
+		if !db.Migrator().HasTable(table.Name) {
+			continue
+		}
+		var count int64
+		if err := db.Table(table.Name).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count rows of %s: %w", table.Name, err)
+		}
+		if count > 0 {
+			return fmt.Errorf("failed to restore: the database is not empty, %s has rows", table.Name)
+		}
+	}
+
+	return nil
+}
+
+// restoreBackup inserts the rows of the tables, and then stores the images in
+// the image store. The archive has the tables before the images.
+func (d *Database) restoreBackup(tx *gorm.DB, fileName string) error {
+	hashes := map[int]string{}
+	hasHash := tx.Migrator().HasColumn(&image{}, "hash")
+
+	return readBackup(fileName, func(name string, data []byte) error {
+		switch {
+		case strings.HasPrefix(name, backupTablesDir):
+			table := strings.TrimSuffix(strings.TrimPrefix(name, backupTablesDir), ".json")
+			rows, err := restoreTable(tx, table, data)
+			if err != nil {
+				return err
+			}
+			if table == "image" {
+				for _, row := range rows {
+					id, _ := row["id"].(int64)
+					hash, _ := row["hash"].(string)
+					hashes[int(id)] = hash
+				}
+			}
+		case strings.HasPrefix(name, backupImagesDir):
+			id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, backupImagesDir), ".jpg"))
+			if err != nil {
+				return fmt.Errorf("invalid image %s in backup", name)
+			}
+			img := &image{Id: id, Data: data, Hash: hashes[id]}
+			if !hasHash {
+				return restoreImageData(tx, img)
+			}
+			return d.restoreImage(tx, img)
+		}
+		return nil
+	})
+}
+
+// restoreTable inserts the rows of a table, and returns them.
+func restoreTable(tx *gorm.DB, table string, data []byte) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&rows); err != nil {
+		return nil, fmt.Errorf("failed to read rows of %s: %w", table, err)
+	}
+	if len(rows) == 0 {
+		return rows, nil
+	}
+
+	timeColumns, err := getTimeColumns(tx, table)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		for column, value := range row {
+			row[column] = getRestoreValue(value, timeColumns[column])
+		}
+	}
+
+	if err := tx.Table(table).CreateInBatches(rows, restoreBatchSize).Error; err != nil {
+		return nil, fmt.Errorf("failed to insert rows of %s: %w", table, err)
+	}
+
+	return rows, nil
+}
+
+// getTimeColumns returns the date and time columns of a table, whose values
+// are stored as text in the backup.
+func getTimeColumns(tx *gorm.DB, table string) (map[string]bool, error) {
+	columnTypes, err := tx.Migrator().ColumnTypes(table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns of %s: %w", table, err)
+	}
+
+	columns := map[string]bool{}
+	for _, columnType := range columnTypes {
+		typeName := strings.ToUpper(columnType.DatabaseTypeName())
+		columns[columnType.Name()] = strings.Contains(typeName, "DATE") || strings.Contains(typeName, "TIME")
+	}
+	return columns, nil
+}
+
+// getRestoreValue converts a value read from JSON to the value that is inserted.
+func getRestoreValue(value interface{}, isTime bool) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case string:
+		if isTime {
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t
+			}
+		}
+	}
+	return value
+}
+
+// restoreImage stores the data of an image, whose row has already been inserted.
+func (d *Database) restoreImage(tx *gorm.DB, img *image) error {
+	if img.Hash == "" {
+		img.Hash = getImageHash(img.Data)
+	}
+	if err := d.imageStore.save(img); err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{"hash": img.Hash, "image": img.Data}
+	if err := tx.Model(&image{}).Where("id = ?", img.Id).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to restore image %d: %w", img.Id, err)
+	}
+
+	return nil
+}
+
+// restoreImageData stores the data of an image in the database, for backups
+// made before the image table had a hash column. Without a hash the image can
+// not be found in the image store, so it stays in the database until it is
+// moved with MoveImagesToFiles.
+func restoreImageData(tx *gorm.DB, img *image) error {
+	if err := tx.Model(&image{}).Where("id = ?", img.Id).Update("image", img.Data).Error; err != nil {
+		return fmt.Errorf("failed to restore image %d: %w", img.Id, err)
+	}
+
+	return nil
+}
+
+// readBackup calls fn with the name and data of every file in a backup archive.
+func readBackup(fileName string, fn func(name string, data []byte) error) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer file.Close()
+
+	compressed, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	defer compressed.Close()
+
+	archive := tar.NewReader(compressed)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return fmt.Errorf("failed to read %s from backup: %w", header.Name, err)
+		}
+		if err := fn(header.Name, data); err != nil {
+			return err
+		}
+	}
+}
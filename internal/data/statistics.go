@@ -0,0 +1,321 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// Statistics holds aggregates of the movies in the library. Trashed movies
+// are not counted. Every slice of groups is sorted in the order it is best
+// shown in: counts and people by number of movies, the rest by name.
+type Statistics struct {
+	// Total is all the movies, and Unwatched the movies that have never been watched.
+	Total     StatisticsGroup
+	Unwatched StatisticsGroup
+	ToWatch   StatisticsGroup
+
+	Genres    []StatisticsGroup
+	Decades   []StatisticsGroup
+	Packs     []StatisticsGroup
+	Directors []StatisticsGroup
+	Actors    []StatisticsGroup
+
+	// Ratings is the number of movies with each of my ratings, "0" being not rated.
+	Ratings []StatisticsGroup
+	// RatingDeviations is the number of movies by how much my rating, on
+	// IMDb's scale of 10, differs from the IMDb rating, rounded to whole points.
+	RatingDeviations []StatisticsGroup
+	// Viewings is the number of viewings in each month, named like "2024-05".
+	Viewings []StatisticsGroup
+}
+
+// StatisticsGroup holds the aggregates of a group of movies.
+type StatisticsGroup struct {
+	Name  string
+	Count int
+	// Runtime is the total runtime in minutes, of the movies with a known runtime.
+	Runtime int
+	// Size is the total size in bytes of the movie files.
+	Size int64
+	// AverageMyRating is 0 if no movie in the group is rated.
+	AverageMyRating float64
+	// AverageImdbRating is 0 if no movie in the group has an IMDb rating.
+	AverageImdbRating float64
+	// AverageDeviation is the average of my rating, on IMDb's scale of 10,
+	// minus the IMDb rating, of the movies that have both.
+	AverageDeviation float64
+
+	myRatingSum, imdbRatingSum, deviationSum       float64
+	myRatingCount, imdbRatingCount, deviationCount int
+}
+
+// statisticsCSVHeader is the first row of the CSV export.
+var statisticsCSVHeader = []string{
+	"section", "name", "movies", "runtime_minutes", "size_bytes",
+	"average_my_rating", "average_imdb_rating", "average_deviation",
+}
+
+// GetStatistics returns aggregates of the movies in the library.
+func (d *Database) GetStatistics(ctx context.Context) (*Statistics, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	var movies []*Movie
+	err = db.Select("id, title, year, my_rating, length, size, imdb_rating, pack, to_watch, watched_at").
+		Where("trashed_at IS NULL").Find(&movies).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get movies: %w", err)
+	}
+
+	movieIds := getMovieIds(movies)
+	genres, err := d.getGenresForMovies(db, movieIds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get genres for movies: %w", err)
+	}
+	persons, err := d.getPersonsForMovies(db, movieIds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get persons for movies: %w", err)
+	}
+	for _, movie := range movies {
+		movie.Genres = genres[movie.Id]
+		movie.Persons = persons[movie.Id]
+	}
+
+	var viewings []Viewing
+	if err := db.Select("id, movie_id, watched_at").Find(&viewings).Error; err != nil {
+		return nil, fmt.Errorf("failed to get viewings: %w", err)
+	}
+
+	return computeStatistics(movies, viewings), nil
+}
+
+// computeStatistics aggregates the movies, which must have their genres and
+// persons loaded. Viewings of movies that are not in the list are ignored.
+func computeStatistics(movies []*Movie, viewings []Viewing) *Statistics {
+	stats := &Statistics{
+		Total:     StatisticsGroup{Name: "All movies"},
+		Unwatched: StatisticsGroup{Name: "Unwatched"},
+		ToWatch:   StatisticsGroup{Name: "To watch"},
+	}
+
+	genres := make(map[string]*StatisticsGroup)
+	decades := make(map[string]*StatisticsGroup)
+	packs := make(map[string]*StatisticsGroup)
+	directors := make(map[string]*StatisticsGroup)
+	actors := make(map[string]*StatisticsGroup)
+	ratings := make(map[string]*StatisticsGroup)
+	deviations := make(map[string]*StatisticsGroup)
+	months := make(map[string]*StatisticsGroup)
+
+	movieIds := make(map[int]bool, len(movies))
+	for _, movie := range movies {
+		movieIds[movie.Id] = true
+
+		stats.Total.add(movie)
+		if !movie.WatchedAt.Valid {
+			stats.Unwatched.add(movie)
+		}
+		if movie.ToWatch {
+			stats.ToWatch.add(movie)
+		}
+
+		for _, genre := range movie.Genres {
+			getStatisticsGroup(genres, genre.Name).add(movie)
+		}
+		if movie.Year > 0 {
+			getStatisticsGroup(decades, fmt.Sprintf("%ds", movie.Year/10*10)).add(movie)
+		}
+		if movie.Pack != "" {
+			getStatisticsGroup(packs, movie.Pack).add(movie)
+		}
+		for _, name := range getCreditedNames(movie.Persons, Director) {
+			getStatisticsGroup(directors, name).add(movie)
+		}
+		for _, name := range getCreditedNames(movie.Persons, Actor) {
+			getStatisticsGroup(actors, name).add(movie)
+		}
+		getStatisticsGroup(ratings, strconv.Itoa(movie.MyRating)).add(movie)
+		if deviation, ok := getRatingDeviation(movie); ok {
+			getStatisticsGroup(deviations, formatRatingDeviation(deviation)).add(movie)
+		}
+	}
+
+	for _, viewing := range viewings {
+		if movieIds[viewing.MovieId] && !viewing.WatchedAt.IsZero() {
+			getStatisticsGroup(months, viewing.WatchedAt.Format("2006-01")).Count++
+		}
+	}
+
+	stats.Total.finish()
+	stats.Unwatched.finish()
+	stats.ToWatch.finish()
+	stats.Genres = sortStatisticsGroups(genres, compareStatisticsCount)
+	stats.Decades = sortStatisticsGroups(decades, compareStatisticsName)
+	stats.Packs = sortStatisticsGroups(packs, compareStatisticsCount)
+	stats.Directors = sortStatisticsGroups(directors, compareStatisticsCount)
+	stats.Actors = sortStatisticsGroups(actors, compareStatisticsCount)
+	stats.Ratings = sortStatisticsGroups(ratings, compareStatisticsName)
+	stats.RatingDeviations = sortStatisticsGroups(deviations, compareRatingDeviations)
+	stats.Viewings = sortStatisticsGroups(months, compareStatisticsName)
+
+	return stats
+}
+
+// add counts a movie in the group.
+func (g *StatisticsGroup) add(movie *Movie) {
+	g.Count++
+	if movie.Runtime > 0 {
+		g.Runtime += movie.Runtime
+	}
+	if movie.Size > 0 {
+		g.Size += int64(movie.Size)
+	}
+	if movie.MyRating > 0 {
+		g.myRatingSum += float64(movie.MyRating)
+		g.myRatingCount++
+	}
+	if movie.ImdbRating > 0 {
+		g.imdbRatingSum += float64(movie.ImdbRating)
+		g.imdbRatingCount++
+	}
+	if deviation, ok := getRatingDeviation(movie); ok {
+		g.deviationSum += deviation
+		g.deviationCount++
+	}
+}
+
+// finish calculates the averages of the group.
+func (g *StatisticsGroup) finish() {
+	g.AverageMyRating = getAverage(g.myRatingSum, g.myRatingCount)
+	g.AverageImdbRating = getAverage(g.imdbRatingSum, g.imdbRatingCount)
+	g.AverageDeviation = getAverage(g.deviationSum, g.deviationCount)
+}
+
+// WriteCSV writes the statistics as CSV, one row per group, with the
+// section that the group belongs to in the first column.
+func (s *Statistics) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(statisticsCSVHeader); err != nil {
+		return fmt.Errorf("failed to write statistics: %w", err)
+	}
+
+	sections := []struct {
+		name   string
+		groups []StatisticsGroup
+	}{
+		{"summary", []StatisticsGroup{s.Total, s.Unwatched, s.ToWatch}},
+		{"genre", s.Genres},
+		{"decade", s.Decades},
+		{"pack", s.Packs},
+		{"director", s.Directors},
+		{"actor", s.Actors},
+		{"my_rating", s.Ratings},
+		{"rating_deviation", s.RatingDeviations},
+		{"viewings", s.Viewings},
+	}
+	for _, section := range sections {
+		for _, group := range section.groups {
+			if err := writer.Write(group.csvRecord(section.name)); err != nil {
+				return fmt.Errorf("failed to write statistics: %w", err)
+			}
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write statistics: %w", err)
+	}
+
+	return nil
+}
+
+func (g *StatisticsGroup) csvRecord(section string) []string {
+	formatFloat := func(f float64) string { return strconv.FormatFloat(f, 'f', 2, 64) }
+
+	return []string{
+		section, g.Name, strconv.Itoa(g.Count), strconv.Itoa(g.Runtime), strconv.FormatInt(g.Size, 10),
+		formatFloat(g.AverageMyRating), formatFloat(g.AverageImdbRating), formatFloat(g.AverageDeviation),
+	}
+}
+
+func getStatisticsGroup(groups map[string]*StatisticsGroup, name string) *StatisticsGroup {
+	group, ok := groups[name]
+	if !ok {
+		group = &StatisticsGroup{Name: name}
+		groups[name] = group
+	}
+	return group
+}
+
+// sortStatisticsGroups finishes the groups and returns them sorted.
+func sortStatisticsGroups(groups map[string]*StatisticsGroup, compare func(a, b StatisticsGroup) int) []StatisticsGroup {
+	result := make([]StatisticsGroup, 0, len(groups))
+	for _, group := range groups {
+		group.finish()
+		result = append(result, *group)
+	}
+	slices.SortFunc(result, compare)
+	return result
+}
+
+func compareStatisticsCount(a, b StatisticsGroup) int {
+	return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Name, b.Name))
+}
+
+func compareStatisticsName(a, b StatisticsGroup) int {
+	return cmp.Compare(a.Name, b.Name)
+}
+
+func compareRatingDeviations(a, b StatisticsGroup) int {
+	x, _ := strconv.Atoi(a.Name)
+	y, _ := strconv.Atoi(b.Name)
+	return cmp.Compare(x, y)
+}
+
+// getCreditedNames returns the names of the persons with the given credit,
+// once each, since a person can have the same credit twice.
+func getCreditedNames(persons []Person, personType PersonType) []string {
+	var names []string
+	for _, person := range persons {
+		if person.Type == personType && !slices.Contains(names, person.Name) {
+			names = append(names, person.Name)
+		}
+	}
+	return names
+}
+
+// getRatingDeviation returns my rating, on IMDb's scale of 10, minus the IMDb
+// rating. It returns false if the movie does not have both ratings.
+func getRatingDeviation(movie *Movie) (float64, bool) {
+	if movie.MyRating <= 0 || movie.ImdbRating <= 0 {
+		return 0, false
+	}
+	return float64(movie.MyRating*2) - float64(movie.ImdbRating), true
+}
+
+// formatRatingDeviation rounds a rating deviation to whole points, with a sign.
+func formatRatingDeviation(deviation float64) string {
+	rounded := int(math.Round(deviation))
+	if rounded > 0 {
+		return "+" + strconv.Itoa(rounded)
+	}
+	return strconv.Itoa(rounded)
+}
+
+func getAverage(sum float64, count int) float64 {
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
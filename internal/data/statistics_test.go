@@ -0,0 +1,106 @@
+package data
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_GetStatistics(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			gladiator, alien, heat := movies[0], movies[1], movies[2]
+
+			alien.Runtime = 117
+			heat.Runtime = 170
+			if err := r.UpdateMovie(t.Context(), alien); err != nil {
+				t.Fatalf("UpdateMovie() error = %v", err)
+			}
+			if err := r.UpdateMovie(t.Context(), heat); err != nil {
+				t.Fatalf("UpdateMovie() error = %v", err)
+			}
+
+			viewings := []struct {
+				movie *Movie
+				date  string
+			}{
+				{gladiator, "2024-05-01"}, {gladiator, "2024-05-20"}, {heat, "2024-07-03"},
+			}
+			for _, v := range viewings {
+				watchedAt, _ := time.Parse(time.DateOnly, v.date)
+				if err := r.InsertViewing(t.Context(), v.movie, &Viewing{WatchedAt: watchedAt}); err != nil {
+					t.Fatalf("InsertViewing() error = %v", err)
+				}
+			}
+
+			// Trashed movies are not counted
+			trashed := &Movie{Title: "Trashed", Year: 1990, MoviePath: "Trashed", Runtime: 90}
+			if err := r.InsertMovie(t.Context(), trashed); err != nil {
+				t.Fatalf("InsertMovie() error = %v", err)
+			}
+			if err := r.TrashMovie(t.Context(), t.TempDir(), t.TempDir(), trashed); err != nil {
+				t.Fatalf("TrashMovie() error = %v", err)
+			}
+
+			stats, err := r.GetStatistics(t.Context())
+			if err != nil {
+				t.Fatalf("GetStatistics() error = %v", err)
+			}
+
+			assert.Equal(t, 3, stats.Total.Count)
+			assert.Equal(t, 287, stats.Total.Runtime)
+			assert.InDelta(t, 4.5, stats.Total.AverageMyRating, 0.001)
+			assert.InDelta(t, 8.433, stats.Total.AverageImdbRating, 0.001)
+			assert.InDelta(t, 0.6, stats.Total.AverageDeviation, 0.001)
+			assert.Equal(t, 1, stats.Unwatched.Count)
+			assert.Equal(t, 117, stats.Unwatched.Runtime)
+			assert.Equal(t, 1, stats.ToWatch.Count)
+
+			assert.Equal(t, []string{"Action", "Crime", "Drama", "Horror"}, getStatisticsNames(stats.Genres))
+			assert.Equal(t, 2, stats.Genres[0].Count)
+			assert.Equal(t, []string{"1970s", "1990s", "2000s"}, getStatisticsNames(stats.Decades))
+			assert.Equal(t, []string{"Alien"}, getStatisticsNames(stats.Packs))
+			assert.Equal(t, []string{"Ridley Scott", "Michael Mann"}, getStatisticsNames(stats.Directors))
+			assert.Equal(t, 2, stats.Directors[0].Count)
+			assert.Equal(t, []string{"Russell Crowe", "Sigourney Weaver"}, getStatisticsNames(stats.Actors))
+			assert.Equal(t, []string{"0", "4", "5"}, getStatisticsNames(stats.Ratings))
+			assert.Equal(t, []string{"0", "+2"}, getStatisticsNames(stats.RatingDeviations))
+			assert.Equal(t, []string{"2024-05", "2024-07"}, getStatisticsNames(stats.Viewings))
+			assert.Equal(t, 2, stats.Viewings[0].Count)
+		})
+	}
+}
+
+func TestStatistics_WriteCSV(t *testing.T) {
+	movies := []*Movie{
+		{Id: 1, Title: "Heat", Year: 1995, MyRating: 4, ImdbRating: 8.3, Runtime: 170, Size: 4000,
+			Genres: []Genre{{Name: "Crime, Drama"}}},
+	}
+	stats := computeStatistics(movies, nil)
+
+	buf := new(bytes.Buffer)
+	if err := stats.WriteCSV(buf); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+
+	records, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read CSV: %v", err)
+	}
+	assert.Equal(t, statisticsCSVHeader, records[0])
+	assert.Equal(t, []string{"summary", "All movies", "1", "170", "4000", "4.00", "8.30", "-0.30"}, records[1])
+	assert.Contains(t, records, []string{"genre", "Crime, Drama", "1", "170", "4000", "4.00", "8.30", "-0.30"})
+	assert.Contains(t, records, []string{"rating_deviation", "0", "1", "170", "4000", "4.00", "8.30", "-0.30"})
+}
+
+func getStatisticsNames(groups []StatisticsGroup) []string {
+	var names []string
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	return names
+}
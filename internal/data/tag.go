@@ -0,0 +1,238 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultTagColor is the colour of tags that have no colour of their own.
+const DefaultTagColor = "#91834e"
+
+// ErrTagExists is returned when inserting or renaming a tag to the name of another tag.
+var ErrTagExists = errors.New("tag already exists")
+
+var tagColorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Tag is a free-form label, like "4k" or "christmas", that the user puts on movies.
+// Unlike genres, tags are never scraped.
+type Tag struct {
+	Id    int    `gorm:"column:id;primary_key"`
+	Name  string `gorm:"column:name;size:100"`
+	Color string `gorm:"column:color;size:7"`
+}
+
+// TableName returns the tag table name.
+func (t *Tag) TableName() string {
+	return "tag"
+}
+
+// GetTags returns all tags, ordered by name.
+func (d *Database) GetTags(ctx context.Context) ([]Tag, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	var tags []Tag
+	if err := db.Order("name").Find(&tags).Error; err != nil {
+		return nil, fmt.Errorf("failed to get tags: %w", err)
+	}
+
+	return tags, nil
+}
+
+// InsertTag inserts a new tag. ErrTagExists is returned if there already is a tag with the same name.
+func (d *Database) InsertTag(ctx context.Context, tag *Tag) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database: %w", err)
+	}
+
+	return d.insertTag(db, tag)
+}
+
+// insertTag inserts a new tag, using db, which can be a transaction.
+func (d *Database) insertTag(db *gorm.DB, tag *Tag) error {
+	if err := normalizeTag(tag); err != nil {
+		return err
+	}
+
+	existing, err := d.getTagByName(db, tag.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("failed to insert tag %s: %w", tag.Name, ErrTagExists)
+	}
+
+	if err := db.Create(tag).Error; err != nil {
+		return fmt.Errorf("failed to insert tag: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateTag updates the name and colour of a tag.
+func (d *Database) UpdateTag(ctx context.Context, tag *Tag) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if err := normalizeTag(tag); err != nil {
+		return err
+	}
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database: %w", err)
+	}
+
+	existing, err := d.getTagByName(db, tag.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Id != tag.Id {
+		return fmt.Errorf("failed to rename tag to %s: %w", tag.Name, ErrTagExists)
+	}
+
+	err = db.Model(&Tag{}).Where("id = ?", tag.Id).Updates(map[string]interface{}{"name": tag.Name, "color": tag.Color}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update tag: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteTag deletes a tag, and removes it from all movies.
+func (d *Database) DeleteTag(ctx context.Context, tag *Tag) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	return d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			if err := tx.Where("tag_id = ?", tag.Id).Delete(&MovieTag{}).Error; err != nil {
+				return fmt.Errorf("failed to delete movie tags: %w", err)
+			}
+			if err := tx.Delete(&Tag{}, tag.Id).Error; err != nil {
+				return fmt.Errorf("failed to delete tag: %w", err)
+			}
+			return nil
+		},
+	)
+}
+
+// ConvertGenreToTag replaces a genre, typically a private genre that was used as a tag,
+// with a tag of the same name. The movies that had the genre get the tag, and the genre is deleted.
+func (d *Database) ConvertGenreToTag(ctx context.Context, genre *Genre) (*Tag, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var tag *Tag
+	err := d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			var err error
+			tag, err = d.getOrInsertTag(tx, &Tag{Name: genre.Name})
+			if err != nil {
+				return fmt.Errorf("failed to get or insert tag: %w", err)
+			}
+
+			var movieGenres []MovieGenre
+			if err := tx.Where("genre_id = ?", genre.Id).Find(&movieGenres).Error; err != nil {
+				return fmt.Errorf("failed to get movies for genre %s: %w", genre.Name, err)
+			}
+
+			var changes []MovieChange
+			for _, mg := range movieGenres {
+				insert := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&MovieTag{MovieId: mg.MovieId, TagId: tag.Id})
+				if insert.Error != nil {
+					return fmt.Errorf("failed to insert movie tag: %w", insert.Error)
+				}
+				changes = append(changes, MovieChange{MovieId: mg.MovieId, Field: historyFieldGenre, OldValue: genre.Name})
+				if insert.RowsAffected > 0 {
+					changes = append(changes, MovieChange{MovieId: mg.MovieId, Field: historyFieldTag, NewValue: tag.Name})
+				}
+			}
+			if err := d.recordChanges(tx, changes...); err != nil {
+				return err
+			}
+
+			if err := tx.Where("genre_id = ?", genre.Id).Delete(&MovieGenre{}).Error; err != nil {
+				return fmt.Errorf("failed to delete movie genres: %w", err)
+			}
+			if err := tx.Where("genre_id = ?", genre.Id).Delete(&GenreAlias{}).Error; err != nil {
+				return fmt.Errorf("failed to delete genre aliases: %w", err)
+			}
+			if err := tx.Delete(&Genre{}, genre.Id).Error; err != nil {
+				return fmt.Errorf("failed to delete genre: %w", err)
+			}
+
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	d.genreCache.clear()
+
+	return tag, nil
+}
+
+// getTagByName returns a tag by name, ignoring case, or nil if there is no such tag.
+func (d *Database) getTagByName(db *gorm.DB, name string) (*Tag, error) {
+	var tags []Tag
+	if err := db.Where("LOWER(name) = LOWER(?)", name).Limit(1).Find(&tags).Error; err != nil {
+		return nil, fmt.Errorf("failed to query tag: %w", err)
+	}
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	return &tags[0], nil
+}
+
+// getOrInsertTag returns the tag with the same name, or inserts the tag.
+func (d *Database) getOrInsertTag(db *gorm.DB, tag *Tag) (*Tag, error) {
+	existing, err := d.getTagByName(db, strings.TrimSpace(tag.Name))
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing, nil
+	}
+
+	if err := d.insertTag(db, tag); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// normalizeTag trims the name of a tag, and checks the name and colour.
+func normalizeTag(tag *Tag) error {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" {
+		return fmt.Errorf("tag name cannot be empty")
+	}
+
+	if tag.Color == "" {
+		tag.Color = DefaultTagColor
+	}
+	if !tagColorRegexp.MatchString(tag.Color) {
+		return fmt.Errorf("invalid tag colour %q, expected a colour like #ff8800", tag.Color)
+	}
+	tag.Color = strings.ToLower(tag.Color)
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_SetMovieTags(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			gladiator, heat := movies[0], movies[2]
+
+			if err := r.InsertTag(t.Context(), &Tag{Name: "4k", Color: "#FF8800"}); err != nil {
+				t.Fatalf("InsertTag() error = %v", err)
+			}
+			if err := r.SetMovieTags(t.Context(), gladiator, []Tag{{Name: "4K"}, {Name: "Favourite"}}); err != nil {
+				t.Fatalf("SetMovieTags() error = %v", err)
+			}
+			if err := r.SetMovieTags(t.Context(), heat, []Tag{{Name: "favourite"}}); err != nil {
+				t.Fatalf("SetMovieTags() error = %v", err)
+			}
+
+			// Existing tags are matched ignoring case, and keep their colour
+			if assert.Len(t, gladiator.Tags, 2) {
+				assert.Equal(t, "4k", gladiator.Tags[0].Name)
+				assert.Equal(t, "#ff8800", gladiator.Tags[0].Color)
+				assert.Equal(t, "Favourite", gladiator.Tags[1].Name)
+				assert.Equal(t, DefaultTagColor, gladiator.Tags[1].Color)
+			}
+
+			tags, err := r.GetTags(t.Context())
+			if err != nil {
+				t.Fatalf("GetTags() error = %v", err)
+			}
+			assert.Len(t, tags, 2)
+
+			found, err := r.SearchMovies(t.Context(), "all", "tag:favourite", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Gladiator", "Heat"}, movieTitles(found))
+			assert.Equal(t, gladiator.Tags, found[0].Tags)
+
+			// Replacing the tags removes the tags that are not in the list
+			if err := r.SetMovieTags(t.Context(), gladiator, []Tag{{Name: "4k"}}); err != nil {
+				t.Fatalf("SetMovieTags() error = %v", err)
+			}
+			found, err = r.SearchMovies(t.Context(), "all", "tag:favourite", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Heat"}, movieTitles(found))
+
+			history, err := r.GetMovieHistory(t.Context(), gladiator)
+			if err != nil {
+				t.Fatalf("GetMovieHistory() error = %v", err)
+			}
+			assert.Contains(t, getTestChanges(history, ChangeSourceUI), MovieChange{Field: historyFieldTag, OldValue: "Favourite"})
+
+			// UpdateMovie leaves the tags alone when they are nil, and replaces them otherwise
+			heat.Tags = nil
+			if err := r.UpdateMovie(t.Context(), heat); err != nil {
+				t.Fatalf("UpdateMovie() error = %v", err)
+			}
+			found, err = r.SearchMovies(t.Context(), "all", "tag:favourite", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Heat"}, movieTitles(found))
+
+			heat.Tags = []Tag{}
+			if err := r.UpdateMovie(t.Context(), heat); err != nil {
+				t.Fatalf("UpdateMovie() error = %v", err)
+			}
+			found, err = r.SearchMovies(t.Context(), "all", "tag:favourite", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Empty(t, found)
+		})
+	}
+}
+
+func TestRepository_UpdateAndDeleteTag(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			alien := movies[1]
+
+			if err := r.SetMovieTags(t.Context(), alien, []Tag{{Name: "xmas"}, {Name: "4k"}}); err != nil {
+				t.Fatalf("SetMovieTags() error = %v", err)
+			}
+			xmas := alien.Tags[1]
+
+			xmas.Name, xmas.Color = "christmas", "#cc0000"
+			if err := r.UpdateTag(t.Context(), &xmas); err != nil {
+				t.Fatalf("UpdateTag() error = %v", err)
+			}
+
+			renamed := Tag{Id: xmas.Id, Name: "4K"}
+			assert.ErrorIs(t, r.UpdateTag(t.Context(), &renamed), ErrTagExists)
+			assert.ErrorIs(t, r.InsertTag(t.Context(), &Tag{Name: "Christmas"}), ErrTagExists)
+			assert.Error(t, r.InsertTag(t.Context(), &Tag{Name: "red", Color: "red"}))
+
+			found, err := r.SearchMovies(t.Context(), "all", "tag:christmas", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			if assert.Len(t, found, 1) {
+				assert.Equal(t, []Tag{alien.Tags[0], xmas}, found[0].Tags)
+			}
+
+			if err := r.DeleteTag(t.Context(), &xmas); err != nil {
+				t.Fatalf("DeleteTag() error = %v", err)
+			}
+			found, err = r.SearchMovies(t.Context(), "all", "tag:christmas", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Empty(t, found)
+
+			tags, err := r.GetTags(t.Context())
+			if err != nil {
+				t.Fatalf("GetTags() error = %v", err)
+			}
+			assert.Equal(t, []Tag{alien.Tags[0]}, tags)
+		})
+	}
+}
+
+func TestRepository_ConvertGenreToTag(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			insertTestMovies(t, r)
+
+			action := getTestGenre(t, r, "Action")
+			tag, err := r.ConvertGenreToTag(t.Context(), &action)
+			if err != nil {
+				t.Fatalf("ConvertGenreToTag() error = %v", err)
+			}
+			assert.Equal(t, "Action", tag.Name)
+
+			found, err := r.SearchMovies(t.Context(), "all", "tag:action", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Gladiator", "Heat"}, movieTitles(found))
+
+			found, err = r.SearchMovies(t.Context(), "all", "genre:action", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Empty(t, found)
+
+			genres, err := r.GetGenres(t.Context())
+			if err != nil {
+				t.Fatalf("GetGenres() error = %v", err)
+			}
+			assert.Len(t, genres, 3)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TrashMovie moves the movie folder from rootDir into trashDir, and marks the
+// movie as trashed. A trashed movie is only shown in the trash view, and can be
+// brought back with RestoreMovie until the trash is emptied.
+func (d *Database) TrashMovie(ctx context.Context, rootDir, trashDir string, movie *Movie) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database: %w", err)
+	}
+
+	if err := moveToTrash(rootDir, trashDir, movie); err != nil {
+		return err
+	}
+
+	trashedAt := sql.NullTime{Time: time.Now(), Valid: true}
+	if err := db.Model(&Movie{}).Where("id = ?", movie.Id).Update("trashed_at", trashedAt).Error; err != nil {
+		// Put the folder back, so that the movie is not lost from the library
+		_ = restoreFromTrash(rootDir, trashDir, movie)
+		return fmt.Errorf("failed to trash movie: %w", err)
+	}
+
+	before := *movie
+	movie.TrashedAt = trashedAt
+
+	return d.recordChanges(db, getMovieChanges(&before, movie, []string{"trashed_at"})...)
+}
+
+// RestoreMovie moves a trashed movie's folder back from trashDir to rootDir.
+func (d *Database) RestoreMovie(ctx context.Context, rootDir, trashDir string, movie *Movie) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database: %w", err)
+	}
+
+	if err := restoreFromTrash(rootDir, trashDir, movie); err != nil {
+		return err
+	}
+
+	if err := db.Model(&Movie{}).Where("id = ?", movie.Id).Update("trashed_at", sql.NullTime{}).Error; err != nil {
+		return fmt.Errorf("failed to restore movie: %w", err)
+	}
+
+	before := *movie
+	movie.TrashedAt = sql.NullTime{}
+
+	return d.recordChanges(db, getMovieChanges(&before, movie, []string{"trashed_at"})...)
+}
+
+// EmptyTrash permanently deletes the movies that were trashed more than olderThan ago,
+// including their folders in trashDir. Use zero to delete everything in the trash.
+// Each movie gets its own timeout, so a large trash is not cut off halfway.
+// It returns the number of deleted movies.
+func (d *Database) EmptyTrash(ctx context.Context, trashDir string, olderThan time.Duration) (int, error) {
+	movies, err := d.getTrashedMovies(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, movie := range getExpiredMovies(movies, olderThan) {
+		if err := d.deleteTrashedMovie(ctx, trashDir, movie); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// getTrashedMovies returns the movies that are in the trash.
+func (d *Database) getTrashedMovies(ctx context.Context) ([]*Movie, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	var movies []*Movie
+	if err := db.Where("trashed_at IS NOT NULL").Find(&movies).Error; err != nil {
+		return nil, fmt.Errorf("failed to get trashed movies: %w", err)
+	}
+
+	return movies, nil
+}
+
+// deleteTrashedMovie permanently deletes a trashed movie and its folder in trashDir.
+func (d *Database) deleteTrashedMovie(ctx context.Context, trashDir string, movie *Movie) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if err := d.deleteMovieData(ctx, movie); err != nil {
+		return fmt.Errorf("failed to delete movie (%d: %s): %w", movie.Id, movie.Title, err)
+	}
+	if err := os.RemoveAll(getTrashPath(trashDir, movie)); err != nil {
+		return fmt.Errorf("failed to remove trashed folder: %w", err)
+	}
+
+	return nil
+}
+
+// getExpiredMovies returns the trashed movies that were trashed more than olderThan ago.
+func getExpiredMovies(movies []*Movie, olderThan time.Duration) []*Movie {
+	cutoff := time.Now().Add(-olderThan)
+
+	var expired []*Movie
+	for _, movie := range movies {
+		if movie.TrashedAt.Valid && !movie.TrashedAt.Time.After(cutoff) {
+			expired = append(expired, movie)
+		}
+	}
+	return expired
+}
+
+// getTrashPath returns the path of a trashed movie's folder. The movie id is part
+// of the name, so that movies with the same folder name do not collide.
+func getTrashPath(trashDir string, movie *Movie) string {
+	name := strings.ReplaceAll(movie.MoviePath, string(filepath.Separator), "_")
+	return filepath.Join(trashDir, fmt.Sprintf("%d_%s", movie.Id, name))
+}
+
+// moveToTrash moves the movie folder from rootDir into trashDir. A missing
+// movie folder is not an error, the movie can still be trashed.
+func moveToTrash(rootDir, trashDir string, movie *Movie) error {
+	moviePath := filepath.Join(rootDir, movie.MoviePath)
+	if _, err := os.Stat(moviePath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err := os.MkdirAll(trashDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create trash folder: %w", err)
+	}
+
+	// Rename only works within a volume, which is why the trash
+	// folder should be on the same volume as the movies
+	if err := os.Rename(moviePath, getTrashPath(trashDir, movie)); err != nil {
+		return fmt.Errorf("failed to move movie to trash: %w", err)
+	}
+
+	return nil
+}
+
+// restoreFromTrash moves the movie folder from trashDir back to rootDir.
+func restoreFromTrash(rootDir, trashDir string, movie *Movie) error {
+	trashPath := getTrashPath(trashDir, movie)
+	if _, err := os.Stat(trashPath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	moviePath := filepath.Join(rootDir, movie.MoviePath)
+	if _, err := os.Stat(moviePath); err == nil {
+		return fmt.Errorf("failed to restore movie: folder %s already exists", moviePath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(moviePath), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create movie folder: %w", err)
+	}
+	if err := os.Rename(trashPath, moviePath); err != nil {
+		return fmt.Errorf("failed to restore movie from trash: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_TrashAndRestoreMovie(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			heat := movies[2]
+
+			rootDir := t.TempDir()
+			trashDir := filepath.Join(rootDir, ".trash")
+			moviePath := filepath.Join(rootDir, heat.MoviePath)
+			if err := os.MkdirAll(moviePath, os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := r.TrashMovie(t.Context(), rootDir, trashDir, heat); err != nil {
+				t.Fatalf("TrashMovie() error = %v", err)
+			}
+			assert.True(t, heat.TrashedAt.Valid)
+			assert.NoDirExists(t, moviePath)
+			assert.DirExists(t, getTrashPath(trashDir, heat))
+
+			all, err := r.SearchMovies(t.Context(), "all", "", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Alien", "Gladiator"}, movieTitles(all))
+
+			trash, err := r.SearchMovies(t.Context(), "trash", "", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Heat"}, movieTitles(trash))
+
+			if err := r.RestoreMovie(t.Context(), rootDir, trashDir, heat); err != nil {
+				t.Fatalf("RestoreMovie() error = %v", err)
+			}
+			assert.False(t, heat.TrashedAt.Valid)
+			assert.DirExists(t, moviePath)
+
+			all, err = r.SearchMovies(t.Context(), "all", "", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Alien", "Gladiator", "Heat"}, movieTitles(all))
+		})
+	}
+}
+
+func TestRepository_EmptyTrash(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			alien, heat := movies[1], movies[2]
+
+			rootDir := t.TempDir()
+			trashDir := filepath.Join(rootDir, ".trash")
+			for _, movie := range []*Movie{alien, heat} {
+				if err := os.MkdirAll(filepath.Join(rootDir, movie.MoviePath), os.ModePerm); err != nil {
+					t.Fatal(err)
+				}
+				if err := r.TrashMovie(t.Context(), rootDir, trashDir, movie); err != nil {
+					t.Fatalf("TrashMovie() error = %v", err)
+				}
+			}
+
+			// Nothing has been in the trash for a day yet
+			deleted, err := r.EmptyTrash(t.Context(), trashDir, 24*time.Hour)
+			if err != nil {
+				t.Fatalf("EmptyTrash() error = %v", err)
+			}
+			assert.Equal(t, 0, deleted)
+
+			deleted, err = r.EmptyTrash(t.Context(), trashDir, 0)
+			if err != nil {
+				t.Fatalf("EmptyTrash() error = %v", err)
+			}
+			assert.Equal(t, 2, deleted)
+			assert.NoDirExists(t, getTrashPath(trashDir, alien))
+			assert.NoDirExists(t, getTrashPath(trashDir, heat))
+
+			trash, err := r.SearchMovies(t.Context(), "trash", "", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Empty(t, trash)
+
+			paths, err := r.GetAllMoviePaths(t.Context())
+			if err != nil {
+				t.Fatalf("GetAllMoviePaths() error = %v", err)
+			}
+			assert.Equal(t, []string{"Gladiator"}, paths)
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Viewing represents one viewing of a movie.
+type Viewing struct {
+	Id        int       `gorm:"column:id;primary_key"`
+	MovieId   int       `gorm:"column:movie_id"`
+	WatchedAt time.Time `gorm:"column:watched_at"`
+	Note      string    `gorm:"column:note;size:1024"`
+	Rating    int       `gorm:"column:rating"` // My rating at the time of the viewing, 0 if not rated
+}
+
+// TableName returns the name of the table.
+func (v *Viewing) TableName() string {
+	return "viewing"
+}
+
+// GetViewings returns all viewings of a movie, the latest viewing first.
+func (d *Database) GetViewings(ctx context.Context, movie *Movie) ([]Viewing, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	db, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+
+	var viewings []Viewing
+	if err := db.Where("movie_id = ?", movie.Id).Order("watched_at desc, id desc").Find(&viewings).Error; err != nil {
+		return nil, fmt.Errorf("failed to get viewings: %w", err)
+	}
+
+	return viewings, nil
+}
+
+// InsertViewing adds a viewing to a movie, and updates the movie's watched at date.
+func (d *Database) InsertViewing(ctx context.Context, movie *Movie, viewing *Viewing) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	return d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			viewing.MovieId = movie.Id
+			if err := tx.Create(viewing).Error; err != nil {
+				return fmt.Errorf("failed to insert viewing: %w", err)
+			}
+
+			return d.updateLatestViewing(tx, movie)
+		},
+	)
+}
+
+// UpdateViewing updates a viewing of a movie, and updates the movie's watched at date.
+func (d *Database) UpdateViewing(ctx context.Context, movie *Movie, viewing *Viewing) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	return d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			updates := map[string]interface{}{
+				"watched_at": viewing.WatchedAt,
+				"note":       viewing.Note,
+				"rating":     viewing.Rating,
+			}
+
+			err := tx.Model(&Viewing{}).Where("id = ? AND movie_id = ?", viewing.Id, movie.Id).Updates(updates).Error
+			if err != nil {
+				return fmt.Errorf("failed to update viewing: %w", err)
+			}
+
+			return d.updateLatestViewing(tx, movie)
+		},
+	)
+}
+
+// DeleteViewing removes a viewing of a movie, and updates the movie's watched at date.
+func (d *Database) DeleteViewing(ctx context.Context, movie *Movie, viewing *Viewing) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	return d.transaction(ctx,
+		func(tx *gorm.DB) error {
+			if err := tx.Where("id = ? AND movie_id = ?", viewing.Id, movie.Id).Delete(&Viewing{}).Error; err != nil {
+				return fmt.Errorf("failed to delete viewing: %w", err)
+			}
+
+			return d.updateLatestViewing(tx, movie)
+		},
+	)
+}
+
+// UpdateWatchedAt adds a viewing of the movie with the current date and time.
+func (d *Database) UpdateWatchedAt(ctx context.Context, movie *Movie) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	viewing := &Viewing{WatchedAt: time.Now(), Rating: movie.MyRating}
+
+	if err := d.InsertViewing(ctx, movie, viewing); err != nil {
+		return fmt.Errorf("failed to update watched_at : %w", err)
+	}
+
+	return nil
+}
+
+// updateLatestViewing sets movies.watched_at to the date of the latest viewing
+// of the movie, or NULL if the movie has no viewings. The column is kept so that
+// movies can still be sorted and searched on when they were last watched.
+func (d *Database) updateLatestViewing(tx *gorm.DB, movie *Movie) error {
+	before := Movie{}
+	if err := tx.First(&before, movie.Id).Error; err != nil {
+		return fmt.Errorf("failed to get movie: %w", err)
+	}
+
+	var viewings []Viewing
+	err := tx.Where("movie_id = ?", movie.Id).Order("watched_at desc, id desc").Limit(1).Find(&viewings).Error
+	if err != nil {
+		return fmt.Errorf("failed to get latest viewing: %w", err)
+	}
+
+	movie.WatchedAt = sql.NullTime{}
+	if len(viewings) > 0 {
+		movie.WatchedAt = sql.NullTime{Time: viewings[0].WatchedAt, Valid: true}
+	}
+
+	if err := tx.Model(&Movie{}).Where("id = ?", movie.Id).Update("watched_at", movie.WatchedAt).Error; err != nil {
+		return fmt.Errorf("failed to update watched_at: %w", err)
+	}
+
+	return d.recordChanges(tx, getMovieChanges(&before, movie, []string{"watched_at"})...)
+}
+
+// deleteViewingsForMovie removes all viewings of a movie.
+func (d *Database) deleteViewingsForMovie(db *gorm.DB, movie *Movie) error {
+	if err := db.Where("movie_id = ?", movie.Id).Delete(&Viewing{}).Error; err != nil {
+		return fmt.Errorf("failed to delete viewings: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_Viewings(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			heat := movies[2]
+
+			first := &Viewing{WatchedAt: time.Date(2019, 1, 2, 20, 0, 0, 0, time.Local), Rating: 3}
+			second := &Viewing{WatchedAt: time.Date(2023, 6, 7, 21, 0, 0, 0, time.Local), Note: "Rewatch"}
+			for _, viewing := range []*Viewing{first, second} {
+				if err := r.InsertViewing(t.Context(), heat, viewing); err != nil {
+					t.Fatalf("InsertViewing() error = %v", err)
+				}
+			}
+			assert.True(t, heat.WatchedAt.Valid)
+			assert.True(t, second.WatchedAt.Equal(heat.WatchedAt.Time))
+
+			viewings, err := r.GetViewings(t.Context(), heat)
+			if err != nil {
+				t.Fatalf("GetViewings() error = %v", err)
+			}
+			if assert.Len(t, viewings, 2) {
+				assert.Equal(t, "Rewatch", viewings[0].Note)
+				assert.Equal(t, 3, viewings[1].Rating)
+			}
+
+			// Moving the first viewing to after the second makes it the latest
+			first.WatchedAt = time.Date(2024, 3, 4, 19, 0, 0, 0, time.Local)
+			if err := r.UpdateViewing(t.Context(), heat, first); err != nil {
+				t.Fatalf("UpdateViewing() error = %v", err)
+			}
+			assert.True(t, first.WatchedAt.Equal(heat.WatchedAt.Time))
+
+			// Sorting on watched_at uses the latest viewing
+			sorted, err := r.SearchMovies(t.Context(), "all", "", -1, "watched_at desc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Equal(t, []string{"Heat", "Gladiator", "Alien"}, movieTitles(sorted))
+			assert.True(t, first.WatchedAt.Equal(sorted[0].WatchedAt.Time))
+
+			// Deleting all viewings clears watched_at
+			for _, viewing := range []*Viewing{first, second} {
+				if err := r.DeleteViewing(t.Context(), heat, viewing); err != nil {
+					t.Fatalf("DeleteViewing() error = %v", err)
+				}
+			}
+			assert.False(t, heat.WatchedAt.Valid)
+
+			watched, err := r.SearchMovies(t.Context(), "all", "watched", -1, "title asc")
+			if err != nil {
+				t.Fatalf("SearchMovies() error = %v", err)
+			}
+			assert.Empty(t, watched)
+		})
+	}
+}
+
+func TestRepository_UpdateWatchedAtAddsViewing(t *testing.T) {
+	for name, r := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			movies := insertTestMovies(t, r)
+			gladiator := movies[0]
+
+			for i := 0; i < 2; i++ {
+				if err := r.UpdateWatchedAt(t.Context(), gladiator); err != nil {
+					t.Fatalf("UpdateWatchedAt() error = %v", err)
+				}
+			}
+
+			viewings, err := r.GetViewings(t.Context(), gladiator)
+			if err != nil {
+				t.Fatalf("GetViewings() error = %v", err)
+			}
+			assert.Len(t, viewings, 2)
+			assert.Equal(t, gladiator.MyRating, viewings[0].Rating)
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -15,6 +16,9 @@ import (
 	"github.com/chromedp/chromedp"
 )
 
+// nameIdRegexp finds the IMDb name id in links like /name/nm0000233/?ref_=tt_ov_dr
+var nameIdRegexp = regexp.MustCompile(`/name/(nm\d+)`)
+
 const constYearSelector = "div:has(h1[data-testid='hero__pageTitle']) > ul.ipc-inline-list > li:nth-child([CHILD])"
 
 const (
@@ -28,9 +32,15 @@ type Manager struct {
 	Errors []error
 }
 
+// PersonImdb is a credit of a person on a movie. Billing is the order of the
+// credit within its type, starting at 1, and Character is only set for actors.
+// ImdbId is the IMDb name id (nm…) of the person.
 type PersonImdb struct {
-	Name string
-	Type int
+	Name      string
+	ImdbId    string
+	Type      int
+	Billing   int
+	Character string
 }
 
 type MovieImdb struct {
@@ -317,37 +327,33 @@ func (m *Manager) getMoviePeople(doc *goquery.Document) ([]PersonImdb, error) {
 
 		switch label {
 		case "Director", "Directors":
-			li.Find("a").Each(func(_ int, a *goquery.Selection) {
-				name := strings.TrimSpace(a.Text())
-				persons = append(persons, PersonImdb{
-					Name: name,
-					Type: Director,
-				})
-			})
+			persons = append(persons, getCredits(li, Director)...)
 
 		case "Writer", "Writers":
-			li.Find("a").Each(func(_ int, a *goquery.Selection) {
-				name := strings.TrimSpace(a.Text())
-				persons = append(persons, PersonImdb{
-					Name: name,
-					Type: Writer,
-				})
-			})
+			persons = append(persons, getCredits(li, Writer)...)
 
 		default:
 			// ignore other credit types
 		}
 	})
 
-	// Now actors
-	doc.Find(`div[data-testid="title-cast-item"] a[data-testid="title-cast-item__actor"]`).
-		Each(func(_ int, a *goquery.Selection) {
-			name := strings.TrimSpace(a.Text())
-			persons = append(persons, PersonImdb{
-				Name: name,
-				Type: Actor,
-			})
+	// Now actors, in the order they are billed
+	doc.Find(`div[data-testid="title-cast-item"]`).Each(func(_ int, item *goquery.Selection) {
+		actor := item.Find(`a[data-testid="title-cast-item__actor"]`)
+		name := strings.TrimSpace(actor.Text())
+		if name == "" {
+			return
+		}
+
+		character := item.Find(`[data-testid="cast-item-characters-link"] span`).First().Text()
+		persons = append(persons, PersonImdb{
+			Name:      name,
+			ImdbId:    getNameId(actor),
+			Type:      Actor,
+			Billing:   countCredits(persons, Actor) + 1,
+			Character: strings.TrimSpace(character),
 		})
+	})
 
 	// Optionally dedupe (if the site has repeated names)
 	persons = dedupePersons(persons)
@@ -355,13 +361,61 @@ func (m *Manager) getMoviePeople(doc *goquery.Document) ([]PersonImdb, error) {
 	return persons, nil
 }
 
-// dedupePersons removes subsequent duplicates (same name + type) while preserving order
+// getCredits returns the persons linked in a principal credit, like the directors.
+func getCredits(li *goquery.Selection, typ int) []PersonImdb {
+	var persons []PersonImdb
+	li.Find("a").Each(func(_ int, a *goquery.Selection) {
+		name := strings.TrimSpace(a.Text())
+		persons = append(persons, PersonImdb{
+			Name:    name,
+			ImdbId:  getNameId(a),
+			Type:    typ,
+			Billing: len(persons) + 1,
+		})
+	})
+	return persons
+}
+
+// getNameId returns the IMDb name id from the href of a person link, or an empty string.
+func getNameId(a *goquery.Selection) string {
+	href, _ := a.Attr("href")
+	if match := nameIdRegexp.FindStringSubmatch(href); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// countCredits returns the number of credits of the given type.
+func countCredits(persons []PersonImdb, typ int) int {
+	count := 0
+	for _, p := range persons {
+		if p.Type == typ {
+			count++
+		}
+	}
+	return count
+}
+
+// dedupePersons removes subsequent duplicates (same person + type) while preserving order.
+// Persons are told apart by their IMDb id, and by name only when the id is missing,
+// so that two different persons with the same name are both kept.
+// A person can still have several credits with different types, like director and writer.
 func dedupePersons(input []PersonImdb) []PersonImdb {
-	seen := make(map[PersonImdb]bool)
+	type credit struct {
+		imdbId string
+		name   string
+		typ    int
+	}
+
+	seen := make(map[credit]bool)
 	var out []PersonImdb
 	for _, p := range input {
-		if !seen[p] {
-			seen[p] = true
+		key := credit{imdbId: p.ImdbId, typ: p.Type}
+		if p.ImdbId == "" {
+			key.name = p.Name
+		}
+		if !seen[key] {
+			seen[key] = true
 			out = append(out, p)
 		}
 	}
@@ -1,8 +1,10 @@
 package imdb
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/hultan/softimdb/internal/data"
 	"github.com/stretchr/testify/assert"
 )
@@ -112,3 +114,57 @@ func TestParseYear(t *testing.T) {
 		})
 	}
 }
+
+func TestGetMoviePeople(t *testing.T) {
+	const page = `<ul data-testid="hero-title-block__metadata">
+		<li data-testid="title-pc-principal-credit"><span>Director</span>
+			<a href="/name/nm0000233/?ref_=tt_ov_dr">Quentin Tarantino</a></li>
+		<li data-testid="title-pc-principal-credit"><span>Writers</span>
+			<a href="/name/nm0000233/?ref_=tt_ov_wr">Quentin Tarantino</a><a href="/name/nm0000812/">Roger Avary</a></li>
+	</ul>
+	<div data-testid="title-cast-item">
+		<a data-testid="title-cast-item__actor" href="/name/nm0000237/?ref_=tt_cst">John Travolta</a>
+		<a data-testid="cast-item-characters-link"><span>Vincent Vega</span></a>
+	</div>
+	<div data-testid="title-cast-item">
+		<a data-testid="title-cast-item__actor" href="/name/nm0000233/?ref_=tt_cst">Quentin Tarantino</a>
+		<a data-testid="cast-item-characters-link"><span>Jimmie</span></a>
+	</div>`
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := &Manager{}
+	persons, err := manager.getMoviePeople(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []PersonImdb{
+		{Name: "Quentin Tarantino", ImdbId: "nm0000233", Type: Director, Billing: 1},
+		{Name: "Quentin Tarantino", ImdbId: "nm0000233", Type: Writer, Billing: 1},
+		{Name: "Roger Avary", ImdbId: "nm0000812", Type: Writer, Billing: 2},
+		{Name: "John Travolta", ImdbId: "nm0000237", Type: Actor, Billing: 1, Character: "Vincent Vega"},
+		{Name: "Quentin Tarantino", ImdbId: "nm0000233", Type: Actor, Billing: 2, Character: "Jimmie"},
+	}, persons)
+}
+
+func TestDedupePersons(t *testing.T) {
+	persons := []PersonImdb{
+		{Name: "Paul Anderson", ImdbId: "nm0027271", Type: Director},
+		{Name: "Paul Anderson", ImdbId: "nm0000759", Type: Director},
+		{Name: "Paul Anderson", ImdbId: "nm0027271", Type: Director},
+		{Name: "Paul Anderson", ImdbId: "nm0027271", Type: Writer},
+		{Name: "Jane Doe", Type: Actor},
+		{Name: "Jane Doe", Type: Actor},
+	}
+
+	assert.Equal(t, []PersonImdb{
+		{Name: "Paul Anderson", ImdbId: "nm0027271", Type: Director},
+		{Name: "Paul Anderson", ImdbId: "nm0000759", Type: Director},
+		{Name: "Paul Anderson", ImdbId: "nm0027271", Type: Writer},
+		{Name: "Jane Doe", Type: Actor},
+	}, dedupePersons(persons))
+}
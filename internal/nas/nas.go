@@ -1,8 +1,10 @@
 package nas
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 
@@ -12,21 +14,21 @@ import (
 
 // Manager represents a NAS manager.
 type Manager struct {
-	database     *data.Database
+	database     data.Repository
 	dirs         []string
 	ignoredPaths []*data.IgnoredPath
 }
 
 // ManagerNew creates a new Manager.
-func ManagerNew(database *data.Database) *Manager {
+func ManagerNew(database data.Repository) *Manager {
 	manager := new(Manager)
 	manager.database = database
 	return manager
 }
 
 // GetMovies returns a list of movie paths on the NAS.
-func (m *Manager) GetMovies(config *config.Config) ([]string, error) {
-	ignoredPaths, err := m.database.GetAllIgnoredPaths()
+func (m *Manager) GetMovies(ctx context.Context, config *config.Config) ([]string, error) {
+	ignoredPaths, err := m.database.GetAllIgnoredPaths(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get ignored paths: %w", err)
 	}
@@ -47,15 +49,21 @@ func (m *Manager) GetMovies(config *config.Config) ([]string, error) {
 		return nil, fmt.Errorf("failed to read dir entries: %w", err)
 	}
 
+	// The trash folder may be inside the root dir, but it is not a movie
+	trashDir := config.GetTrashDir()
+
 	var pathsOnNAS []string
 	for _, entry := range entries {
+		if filepath.Join(config.RootDir, entry) == filepath.Clean(trashDir) {
+			continue
+		}
 		if !getIgnorePath(m.ignoredPaths, entry) {
 			pathsOnNAS = append(pathsOnNAS, entry)
 		}
 	}
 
 	// Get movie paths to exclude
-	pathsInDB, err := m.database.GetAllMoviePaths()
+	pathsInDB, err := m.database.GetAllMoviePaths(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get movie paths: %w", err)
 	}
@@ -1,8 +1,13 @@
 package nas
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+
+	"github.com/hultan/softimdb/internal/config"
+	"github.com/hultan/softimdb/internal/data"
 )
 
 func TestRemoveMoviePaths(t *testing.T) {
@@ -61,3 +66,31 @@ func TestRemoveMoviePaths(t *testing.T) {
 		})
 	}
 }
+
+func TestGetMovies(t *testing.T) {
+	rootDir := t.TempDir()
+	for _, dir := range []string{"Heat", "Alien", "Gladiator", "Extras", ".trash"} {
+		if err := os.Mkdir(filepath.Join(rootDir, dir), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	database := data.MemoryDatabaseNew()
+	if err := database.InsertMovie(t.Context(), &data.Movie{Title: "Heat", MoviePath: "Heat"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.InsertIgnorePath(t.Context(), &data.IgnoredPath{Path: filepath.Join(rootDir, "Extras")}); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := ManagerNew(database)
+	actual, err := manager.GetMovies(t.Context(), &config.Config{RootDir: rootDir})
+	if err != nil {
+		t.Fatalf("GetMovies() error = %v", err)
+	}
+
+	expected := []string{"Alien", "Gladiator"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
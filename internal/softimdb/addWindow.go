@@ -1,6 +1,7 @@
 package softimdb
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -17,11 +18,11 @@ type addMovieWindow struct {
 	window         *gtk.Window
 	list           *gtk.ListBox
 	moviePathEntry *gtk.Entry
-	database       *data.Database
+	database       data.Repository
 	config         *config.Config
 }
 
-func newAddMovieWindow(m *MainWindow, db *data.Database, cfg *config.Config) *addMovieWindow {
+func newAddMovieWindow(m *MainWindow, db data.Repository, cfg *config.Config) *addMovieWindow {
 	a := &addMovieWindow{
 		mainWindow: m,
 		database:   db,
@@ -72,7 +73,7 @@ func (a *addMovieWindow) open() {
 func (a *addMovieWindow) findNewMovies() {
 	// Find new paths on NAS
 	nasManager := nas.ManagerNew(a.database)
-	moviePaths, err := nasManager.GetMovies(a.config)
+	moviePaths, err := nasManager.GetMovies(context.Background(), a.config)
 	if err != nil {
 		_, _ = dialog.Title("Error").
 			ErrorIcon().
@@ -138,7 +139,7 @@ func (a *addMovieWindow) insertMovie(info *Movie, _ *data.Movie) {
 	newMovie := &data.Movie{}
 	info.toDatabase(newMovie)
 
-	if err := a.database.InsertMovie(newMovie); err != nil {
+	if err := a.database.InsertMovie(context.Background(), newMovie); err != nil {
 		reportError(fmt.Errorf("failed to insert movie: %w", err))
 		return
 	}
@@ -191,7 +192,7 @@ func (a *addMovieWindow) onIgnorePathButtonClicked() {
 
 	// Save to DB
 	ignorePath := data.IgnoredPath{Path: path}
-	if err := a.database.InsertIgnorePath(&ignorePath); err != nil {
+	if err := a.database.InsertIgnorePath(context.Background(), &ignorePath); err != nil {
 		reportError(fmt.Errorf("failed to insert ignore path: %w", err))
 		return
 	}
@@ -0,0 +1,185 @@
+package softimdb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/hultan/dialog"
+
+	"github.com/hultan/softimdb/internal/data"
+)
+
+// setupArtworkPage connects the widgets of the artwork page of the movie window.
+func (m *movieWindow) setupArtworkPage() {
+	for _, kind := range data.ArtworkKinds {
+		m.artworkKindCombo.Append(kind, kind)
+	}
+	m.artworkKindCombo.SetActiveID(data.ArtworkPoster)
+	m.addArtworkButton.Connect("clicked", m.onAddArtworkClicked)
+}
+
+// fillArtworkPage (re)loads the artwork of the movie into the gallery.
+func (m *movieWindow) fillArtworkPage() {
+	m.artworkFlowBox.GetChildren().Foreach(func(item interface{}) {
+		m.artworkFlowBox.Remove(item.(gtk.IWidget))
+	})
+
+	// New movies have no artwork yet, their poster is saved with the movie
+	m.addArtworkButton.SetSensitive(m.dataMovie != nil)
+	if m.dataMovie == nil {
+		return
+	}
+
+	artwork, err := m.db.GetArtwork(context.Background(), m.dataMovie)
+	if err != nil {
+		reportError(err)
+		return
+	}
+
+	for i := range artwork {
+		m.addArtworkCard(&artwork[i])
+	}
+	m.artworkFlowBox.ShowAll()
+}
+
+func (m *movieWindow) addArtworkCard(artwork *data.Artwork) {
+	box, err := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 5)
+	if err != nil {
+		reportError(err)
+		return
+	}
+
+	if image := getArtworkThumbnail(artwork.Image); image != nil {
+		box.PackStart(image, false, false, 0)
+	}
+
+	label, err := gtk.LabelNew("")
+	if err != nil {
+		reportError(err)
+		return
+	}
+	label.SetMarkup(getArtworkMarkup(artwork))
+	box.PackStart(label, false, false, 0)
+
+	buttons, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	if err != nil {
+		reportError(err)
+		return
+	}
+	box.PackStart(buttons, false, false, 0)
+
+	primary, err := gtk.ButtonNewWithLabel("Use")
+	if err != nil {
+		reportError(err)
+		return
+	}
+	primary.SetSensitive(!artwork.IsPrimary)
+	primary.Connect("clicked", func() {
+		m.applyArtworkChange(m.db.SetPrimaryArtwork(context.Background(), m.dataMovie, artwork))
+	})
+	buttons.PackStart(primary, true, true, 0)
+
+	remove, err := gtk.ButtonNewWithLabel("Delete")
+	if err != nil {
+		reportError(err)
+		return
+	}
+	remove.Connect("clicked", func() { m.deleteArtwork(artwork) })
+	buttons.PackStart(remove, true, true, 0)
+
+	m.artworkFlowBox.Add(box)
+}
+
+func (m *movieWindow) onAddArtworkClicked() {
+	kind := m.artworkKindCombo.GetActiveID()
+	if kind == "" {
+		return
+	}
+
+	dlg, err := gtk.FileChooserDialogNewWith2Buttons(
+		"Choose an image...", m.window, gtk.FILE_CHOOSER_ACTION_OPEN, "Ok", gtk.RESPONSE_OK,
+		"Cancel", gtk.RESPONSE_CANCEL,
+	)
+	if err != nil {
+		reportError(err)
+		return
+	}
+	defer dlg.Destroy()
+
+	home, err := os.UserHomeDir()
+	if err == nil {
+		_ = dlg.SetCurrentFolder(path.Join(home, "Downloads"))
+	}
+
+	if dlg.Run() != gtk.RESPONSE_OK {
+		return
+	}
+
+	imageData, err := readImageFile(dlg.GetFilename())
+	if err != nil {
+		reportError(err)
+		return
+	}
+
+	m.applyArtworkChange(m.db.InsertArtwork(context.Background(), m.dataMovie, &data.Artwork{Kind: kind, Image: imageData}))
+}
+
+func (m *movieWindow) deleteArtwork(artwork *data.Artwork) {
+	response, err := dialog.Title("Delete image...").
+		Textf("Do you want to delete this %s?", artwork.Kind).
+		WarningIcon().YesNoButtons().Show()
+	if err != nil || response != gtk.RESPONSE_YES {
+		return
+	}
+
+	m.applyArtworkChange(m.db.DeleteArtwork(context.Background(), m.dataMovie, artwork))
+}
+
+// applyArtworkChange reports the error of an artwork change, if any, and
+// refreshes the gallery and the poster, since the primary poster may have
+// changed. Artwork changes are saved at once, not when the movie is saved.
+func (m *movieWindow) applyArtworkChange(err error) {
+	if err != nil {
+		reportError(err)
+	}
+	m.artworkChanged = true
+
+	if !m.guiMovie.imageHasChanged {
+		m.guiMovie.image = m.dataMovie.Image
+		if m.guiMovie.image == nil {
+			m.posterImage.Clear()
+		} else {
+			m.updateImage(m.guiMovie.image)
+		}
+	}
+
+	m.fillArtworkPage()
+	m.fillHistoryPage()
+}
+
+// getArtworkThumbnail returns a scaled down image for the artwork gallery.
+func getArtworkThumbnail(imageData []byte) *gtk.Image {
+	pix, err := createPixbuf(imageData, data.ImageSizeThumbnail)
+	if err != nil {
+		reportError(err)
+		return nil
+	}
+
+	image, err := gtk.ImageNewFromPixbuf(pix)
+	if err != nil {
+		reportError(err)
+		return nil
+	}
+	return image
+}
+
+// getArtworkMarkup returns the text that is shown under an image in the artwork gallery.
+func getArtworkMarkup(artwork *data.Artwork) string {
+	if artwork.IsPrimary {
+		return fmt.Sprintf("<span foreground='#f1e3ae'>%s</span> <span foreground='#91834e'>(primary)</span>", artwork.Kind)
+	}
+	return fmt.Sprintf("<span foreground='#91834e'>%s</span>", artwork.Kind)
+}
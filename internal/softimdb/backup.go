@@ -0,0 +1,62 @@
+package softimdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+
+	"github.com/hultan/softimdb/internal/data"
+)
+
+// backupRepository is a repository that can make backups. The MySQL and
+// SQLite databases can, the in-memory database can not.
+type backupRepository interface {
+	BackupToFolder(ctx context.Context, dir string, keep int) (string, error)
+}
+
+// scheduleBackups makes a backup of the library in the backup folder when the
+// latest backup is older than the backup interval, and keeps checking while
+// the application runs. Nothing is done if no backup folder is configured.
+func (m *MainWindow) scheduleBackups() {
+	if m.config.BackupDir == "" {
+		return
+	}
+	repository, ok := m.database.(backupRepository)
+	if !ok {
+		return
+	}
+
+	m.backupIfDue(repository)
+	glib.TimeoutAdd(backupCheckInterval, func() bool {
+		m.backupIfDue(repository)
+		return true
+	})
+}
+
+// backupIfDue starts a backup in the background if it is due. A backup that
+// failed is not tried again until the backup interval has passed, so that a
+// full disk does not show an error every few minutes.
+func (m *MainWindow) backupIfDue(repository backupRepository) {
+	interval := m.config.GetBackupInterval()
+	if time.Since(m.lastBackup) < interval {
+		return
+	}
+	due, err := data.IsBackupDue(m.config.BackupDir, interval, time.Now())
+	if err != nil {
+		reportError(err)
+		return
+	}
+	if !due {
+		return
+	}
+
+	m.lastBackup = time.Now()
+	go func() {
+		_, err := repository.BackupToFolder(context.Background(), m.config.BackupDir, m.config.GetBackupKeep())
+		if err != nil {
+			reportError(fmt.Errorf("failed to back up the library: %w", err))
+		}
+	}()
+}
@@ -6,8 +6,14 @@ const (
 	applicationCopyRight = "©SoftTeam AB, 2025"
 	listMargin           = 3
 	listSpacing          = 0
-	imageWidth           = 190
-	imageHeight          = 280
+
+	// offlineRetryInterval is the number of milliseconds between the searches
+	// while the database is offline
+	offlineRetryInterval = 10000
+
+	// backupCheckInterval is the number of milliseconds between the checks
+	// if a scheduled backup is due
+	backupCheckInterval = 10 * 60 * 1000
 )
 
 const (
@@ -33,6 +39,7 @@ const (
 	viewToWatch                 = "toWatch"
 	viewNoRating                = "noRating"
 	viewNeedsSubtitles          = "needsSubtitles"
+	viewTrash                   = "trash"
 )
 
 const configFile = "~/.config/softteam/softimdb/config.json"
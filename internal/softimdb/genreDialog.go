@@ -0,0 +1,387 @@
+package softimdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/hultan/dialog"
+
+	"github.com/hultan/softimdb/internal/data"
+)
+
+// genreDialog lets the user rename, merge, delete and alias genres,
+// and choose which genres are private.
+type genreDialog struct {
+	db      data.Repository
+	dialog  *gtk.Dialog
+	list    *gtk.ListBox
+	genres  []data.Genre
+	changed bool
+}
+
+// showGenreDialog shows the genre management dialog. It returns true if
+// any genre was changed, so that the caller can rebuild the genre menu.
+func showGenreDialog(parent gtk.IWindow, db data.Repository) (bool, error) {
+	dlg, err := gtk.DialogNewWithButtons(
+		"Manage genres...", parent, gtk.DIALOG_MODAL|gtk.DIALOG_DESTROY_WITH_PARENT,
+		[]interface{}{"Close", gtk.RESPONSE_CLOSE},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to create genre dialog: %w", err)
+	}
+	defer dlg.Destroy()
+	dlg.SetDefaultSize(700, 600)
+
+	content, err := dlg.GetContentArea()
+	if err != nil {
+		return false, fmt.Errorf("failed to get content area: %w", err)
+	}
+
+	scroll, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create scrolled window: %w", err)
+	}
+	scroll.SetVExpand(true)
+	content.PackStart(scroll, true, true, 0)
+
+	list, err := gtk.ListBoxNew()
+	if err != nil {
+		return false, fmt.Errorf("failed to create list: %w", err)
+	}
+	list.SetSelectionMode(gtk.SELECTION_NONE)
+	scroll.Add(list)
+
+	g := &genreDialog{db: db, dialog: dlg, list: list}
+	g.fill()
+
+	dlg.ShowAll()
+	dlg.Run()
+
+	return g.changed, nil
+}
+
+// fill (re)loads the genres, their movie counts and aliases into the list.
+func (g *genreDialog) fill() {
+	g.list.GetChildren().Foreach(func(item interface{}) {
+		g.list.Remove(item.(gtk.IWidget))
+	})
+
+	genres, err := g.db.GetGenres(context.Background())
+	if err != nil {
+		reportError(err)
+		return
+	}
+	slices.SortFunc(genres, func(a, b data.Genre) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	g.genres = genres
+
+	counts, err := g.db.GetGenreMovieCounts(context.Background())
+	if err != nil {
+		reportError(err)
+		return
+	}
+
+	aliases, err := g.db.GetGenreAliases(context.Background())
+	if err != nil {
+		reportError(err)
+		return
+	}
+
+	for i := range genres {
+		g.addRow(&genres[i], counts[genres[i].Id], getAliasesForGenre(aliases, genres[i].Id))
+	}
+	g.list.ShowAll()
+}
+
+func (g *genreDialog) addRow(genre *data.Genre, count int, aliases []data.GenreAlias) {
+	box, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	if err != nil {
+		reportError(err)
+		return
+	}
+
+	label, err := gtk.LabelNew("")
+	if err != nil {
+		reportError(err)
+		return
+	}
+	label.SetMarkup(getGenreMarkup(genre, count, aliases))
+	label.SetXAlign(0)
+	label.SetLineWrap(true)
+	box.PackStart(label, true, true, 5)
+
+	private, err := gtk.CheckButtonNewWithLabel("Private")
+	if err != nil {
+		reportError(err)
+		return
+	}
+	private.SetActive(genre.IsPrivate)
+	private.Connect("toggled", func() {
+		g.apply(g.db.SetGenrePrivate(context.Background(), genre, private.GetActive()))
+	})
+	box.PackStart(private, false, false, 5)
+
+	g.addButton(box, "Rename...", func() { g.rename(genre) })
+	g.addButton(box, "Merge into...", func() { g.merge(genre) })
+	g.addButton(box, "Aliases...", func() { g.editAliases(genre, aliases) })
+	g.addButton(box, "Convert to tag", func() { g.convertToTag(genre) })
+	deleteButton := g.addButton(box, "Delete", func() { g.delete(genre) })
+	deleteButton.SetSensitive(count == 0)
+
+	g.list.Add(box)
+}
+
+func (g *genreDialog) addButton(box *gtk.Box, text string, onClicked func()) *gtk.Button {
+	button, err := gtk.ButtonNewWithLabel(text)
+	if err != nil {
+		reportError(err)
+		return nil
+	}
+	button.Connect("clicked", onClicked)
+	box.PackStart(button, false, false, 0)
+	return button
+}
+
+func (g *genreDialog) rename(genre *data.Genre) {
+	name, ok := askForText(g.dialog, "Rename genre...", fmt.Sprintf("New name of %s:", genre.Name), genre.Name)
+	if !ok || name == genre.Name {
+		return
+	}
+
+	err := g.db.RenameGenre(context.Background(), genre, name)
+	if errors.Is(err, data.ErrGenreExists) {
+		_, _ = dialog.Title("Rename genre...").
+			Textf("There already is a genre called %s. Use Merge into... to move the movies to that genre.", name).
+			WarningIcon().OkButton().Show()
+		return
+	}
+	g.apply(err)
+}
+
+func (g *genreDialog) merge(genre *data.Genre) {
+	survivor, ok := g.askForGenre(genre)
+	if !ok {
+		return
+	}
+
+	response, err := dialog.Title("Merge genres...").
+		Textf("Do you want to move all movies from %s to %s, and delete %s?", genre.Name, survivor.Name, genre.Name).
+		WarningIcon().YesNoButtons().Show()
+	if err != nil || response != gtk.RESPONSE_YES {
+		return
+	}
+
+	g.apply(g.db.MergeGenres(context.Background(), survivor, []*data.Genre{genre}))
+}
+
+func (g *genreDialog) editAliases(genre *data.Genre, aliases []data.GenreAlias) {
+	var names []string
+	for _, alias := range aliases {
+		names = append(names, alias.Name)
+	}
+
+	text, ok := askForText(g.dialog, "Genre aliases...",
+		fmt.Sprintf("Other names of %s, separated by commas:", genre.Name), strings.Join(names, ", "))
+	if !ok {
+		return
+	}
+	wanted := parseGenreAliases(text)
+
+	for i := range aliases {
+		if !slices.Contains(wanted, aliases[i].Name) {
+			if err := g.db.DeleteGenreAlias(context.Background(), &aliases[i]); err != nil {
+				g.apply(err)
+				return
+			}
+		}
+	}
+	for _, name := range wanted {
+		if !slices.Contains(names, name) {
+			if err := g.db.InsertGenreAlias(context.Background(), &data.GenreAlias{Name: name, GenreId: genre.Id}); err != nil {
+				g.apply(err)
+				return
+			}
+		}
+	}
+	g.apply(nil)
+}
+
+func (g *genreDialog) convertToTag(genre *data.Genre) {
+	response, err := dialog.Title("Convert to tag...").
+		Textf("Do you want to replace the genre %s with a tag, and delete the genre?", genre.Name).
+		WarningIcon().YesNoButtons().Show()
+	if err != nil || response != gtk.RESPONSE_YES {
+		return
+	}
+
+	_, err = g.db.ConvertGenreToTag(context.Background(), genre)
+	g.apply(err)
+}
+
+func (g *genreDialog) delete(genre *data.Genre) {
+	response, err := dialog.Title("Delete genre...").
+		Textf("Do you want to delete the genre %s?", genre.Name).
+		WarningIcon().YesNoButtons().Show()
+	if err != nil || response != gtk.RESPONSE_YES {
+		return
+	}
+
+	g.apply(g.db.DeleteGenre(context.Background(), genre))
+}
+
+// apply reports the error of a genre change, if any, and refreshes the list.
+func (g *genreDialog) apply(err error) {
+	if err != nil {
+		reportError(err)
+	}
+	g.changed = true
+	g.fill()
+}
+
+// askForText asks the user for a line of text. It returns false if the user cancelled.
+func askForText(parent gtk.IWindow, title, text, value string) (string, bool) {
+	dlg, err := gtk.DialogNewWithButtons(
+		title, parent, gtk.DIALOG_MODAL|gtk.DIALOG_DESTROY_WITH_PARENT,
+		[]interface{}{"Cancel", gtk.RESPONSE_CANCEL},
+		[]interface{}{"Ok", gtk.RESPONSE_OK},
+	)
+	if err != nil {
+		reportError(err)
+		return "", false
+	}
+	defer dlg.Destroy()
+
+	content, err := dlg.GetContentArea()
+	if err != nil {
+		reportError(err)
+		return "", false
+	}
+	content.SetSpacing(6)
+
+	label, err := gtk.LabelNew(text)
+	if err != nil {
+		reportError(err)
+		return "", false
+	}
+	content.Add(label)
+
+	entry, err := gtk.EntryNew()
+	if err != nil {
+		reportError(err)
+		return "", false
+	}
+	entry.SetText(value)
+	entry.SetActivatesDefault(true)
+	content.Add(entry)
+	dlg.SetDefaultResponse(gtk.RESPONSE_OK)
+
+	dlg.ShowAll()
+	if dlg.Run() != gtk.RESPONSE_OK {
+		return "", false
+	}
+
+	value, err = entry.GetText()
+	if err != nil {
+		reportError(err)
+		return "", false
+	}
+	return strings.TrimSpace(value), true
+}
+
+// askForGenre asks the user for the genre to merge a genre into. It returns false if the user cancelled.
+func (g *genreDialog) askForGenre(genre *data.Genre) (*data.Genre, bool) {
+	dlg, err := gtk.DialogNewWithButtons(
+		"Merge genre...", g.dialog, gtk.DIALOG_MODAL|gtk.DIALOG_DESTROY_WITH_PARENT,
+		[]interface{}{"Cancel", gtk.RESPONSE_CANCEL},
+		[]interface{}{"Ok", gtk.RESPONSE_OK},
+	)
+	if err != nil {
+		reportError(err)
+		return nil, false
+	}
+	defer dlg.Destroy()
+
+	content, err := dlg.GetContentArea()
+	if err != nil {
+		reportError(err)
+		return nil, false
+	}
+	content.SetSpacing(6)
+
+	label, err := gtk.LabelNew(fmt.Sprintf("Merge %s into:", genre.Name))
+	if err != nil {
+		reportError(err)
+		return nil, false
+	}
+	content.Add(label)
+
+	combo, err := gtk.ComboBoxTextNew()
+	if err != nil {
+		reportError(err)
+		return nil, false
+	}
+	var targets []*data.Genre
+	for i := range g.genres {
+		if g.genres[i].Id != genre.Id {
+			targets = append(targets, &g.genres[i])
+			combo.AppendText(g.genres[i].Name)
+		}
+	}
+	content.Add(combo)
+
+	dlg.ShowAll()
+	if dlg.Run() != gtk.RESPONSE_OK {
+		return nil, false
+	}
+
+	active := combo.GetActive()
+	if active < 0 || active >= len(targets) {
+		return nil, false
+	}
+	return targets[active], true
+}
+
+// getAliasesForGenre returns the aliases of a genre.
+func getAliasesForGenre(aliases []data.GenreAlias, genreId int) []data.GenreAlias {
+	var result []data.GenreAlias
+	for _, alias := range aliases {
+		if alias.GenreId == genreId {
+			result = append(result, alias)
+		}
+	}
+	return result
+}
+
+// getGenreMarkup returns the text that is shown for a genre in the genre dialog.
+func getGenreMarkup(genre *data.Genre, count int, aliases []data.GenreAlias) string {
+	markup := fmt.Sprintf("<span foreground='#f1e3ae'>%s</span> <span foreground='#91834e'>(%d movies)</span>",
+		glib.MarkupEscapeText(genre.Name), count)
+	if len(aliases) == 0 {
+		return markup
+	}
+
+	var names []string
+	for _, alias := range aliases {
+		names = append(names, alias.Name)
+	}
+	return markup + fmt.Sprintf("\n<span foreground='#91834e' size='small'>Also known as %s</span>",
+		glib.MarkupEscapeText(strings.Join(names, ", ")))
+}
+
+// parseGenreAliases splits a comma-separated list of aliases, without empty and duplicate names.
+func parseGenreAliases(text string) []string {
+	var names []string
+	for _, name := range strings.Split(text, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
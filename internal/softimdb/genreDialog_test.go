@@ -0,0 +1,39 @@
+package softimdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hultan/softimdb/internal/data"
+)
+
+func Test_parseGenreAliases(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"single", "Sci-Fi", []string{"Sci-Fi"}},
+		{"spaces", " Sci-Fi ,  SF ", []string{"Sci-Fi", "SF"}},
+		{"empty names", "Sci-Fi,, ,SF,", []string{"Sci-Fi", "SF"}},
+		{"duplicates", "SF, Sci-Fi, SF", []string{"SF", "Sci-Fi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseGenreAliases(tt.text))
+		})
+	}
+}
+
+func Test_getAliasesForGenre(t *testing.T) {
+	aliases := []data.GenreAlias{
+		{Id: 1, Name: "Sci-Fi", GenreId: 3},
+		{Id: 2, Name: "Scary", GenreId: 4},
+		{Id: 3, Name: "SF", GenreId: 3},
+	}
+
+	assert.Equal(t, []data.GenreAlias{aliases[0], aliases[2]}, getAliasesForGenre(aliases, 3))
+	assert.Nil(t, getAliasesForGenre(aliases, 5))
+}
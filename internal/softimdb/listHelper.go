@@ -88,6 +88,12 @@ func createMovieBox(movie *data.Movie) *gtk.Box {
 	label = createMovieGenresLabel(movie)
 	box.Add(label)
 
+	// Tags
+	if len(movie.Tags) > 0 {
+		label = createMovieTagsLabel(movie)
+		box.Add(label)
+	}
+
 	// This does not work well when the movie is selected.
 	//
 	//if movie.Pack != "" {
@@ -159,7 +165,7 @@ func createMovieImage(movie *data.Movie) *gtk.Image {
 		return image
 	}
 
-	pixBuf, err := gdk.PixbufNewFromBytesOnly(movie.Image)
+	pixBuf, err := createPixbuf(movie.Image, data.ImageSizeCard)
 	if err != nil {
 		reportError(err)
 		log.Fatal(err)
@@ -229,6 +235,51 @@ func createMovieGenresLabel(movie *data.Movie) *gtk.Label {
 	return label
 }
 
+// createMovieTagsLabel creates a gtk.Label containing the movie tags as coloured chips
+func createMovieTagsLabel(movie *data.Movie) *gtk.Label {
+	label, err := gtk.LabelNew("")
+	if err != nil {
+		reportError(err)
+		log.Fatal(err)
+	}
+
+	label.SetMarkup(getTagsMarkup(movie.Tags))
+	label.SetLineWrap(true)
+	label.SetJustify(gtk.JUSTIFY_CENTER)
+
+	return label
+}
+
+// getTagsMarkup returns the markup for the tag chips, each tag with its own background colour
+func getTagsMarkup(tags []data.Tag) string {
+	var chips []string
+
+	for _, tag := range tags {
+		color := tag.Color
+		if color == "" {
+			color = data.DefaultTagColor
+		}
+		chips = append(chips, fmt.Sprintf(`<span font="Sans Regular 9" background="%s" foreground="%s"> %s </span>`,
+			color, getTagTextColor(color), cleanString(tag.Name)))
+	}
+
+	return strings.Join(chips, " ")
+}
+
+// getTagTextColor returns black or white, whichever is easier to read on the background colour
+func getTagTextColor(background string) string {
+	var r, g, b int
+	if _, err := fmt.Sscanf(background, "#%02x%02x%02x", &r, &g, &b); err != nil {
+		return "#ffffff"
+	}
+
+	// Perceived brightness, see https://www.w3.org/TR/AERT/#color-contrast
+	if (r*299+g*587+b*114)/1000 > 128 {
+		return "#000000"
+	}
+	return "#ffffff"
+}
+
 // createToWatchOverlay creates a gtk.Image containing the to watch image
 func createToWatchOverlay() *gtk.Image {
 	pixBuf, err := gdk.PixbufNewFromBytesOnly(toWatchIcon)
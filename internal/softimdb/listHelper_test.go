@@ -0,0 +1,40 @@
+package softimdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hultan/softimdb/internal/data"
+)
+
+func Test_getTagTextColor(t *testing.T) {
+	tests := []struct {
+		background string
+		want       string
+	}{
+		{"#000000", "#ffffff"},
+		{"#ffffff", "#000000"},
+		{"#5c5c5c", "#ffffff"},
+		{"#ffcc00", "#000000"},
+		{"invalid", "#ffffff"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.background, func(t *testing.T) {
+			assert.Equal(t, tt.want, getTagTextColor(tt.background))
+		})
+	}
+}
+
+func Test_getTagsMarkup(t *testing.T) {
+	tags := []data.Tag{{Name: "4k", Color: "#ffcc00"}, {Name: "R&B"}}
+	want := `<span font="Sans Regular 9" background="#ffcc00" foreground="#000000"> 4k </span> ` +
+		`<span font="Sans Regular 9" background="#91834e" foreground="#000000"> R&amp;B </span>`
+
+	assert.Equal(t, want, getTagsMarkup(tags))
+}
+
+func Test_getHexColor(t *testing.T) {
+	assert.Equal(t, "#ff8000", getHexColor(1, 0.5, 0))
+	assert.Equal(t, "#000000", getHexColor(-1, 0, 0))
+}
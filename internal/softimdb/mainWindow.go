@@ -1,15 +1,18 @@
 package softimdb
 
 import (
+	"context"
 	_ "embed"
 	"errors"
 	"fmt"
-	"io/fs"
 	"log"
 	"path"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/glib"
@@ -78,6 +81,7 @@ type GTK struct {
 	storyLineScrolledWindow               *gtk.ScrolledWindow
 	searchEntry                           *gtk.Entry
 	countLabel                            *gtk.Label
+	databaseStatusLabel                   *gtk.Label
 	menuNoGenreItem                       *gtk.RadioMenuItem
 	menuSortByName, menuSortByRating      *gtk.RadioMenuItem
 	menuSortByMyRating, menuSortByLength  *gtk.RadioMenuItem
@@ -90,7 +94,7 @@ type GTK struct {
 
 type MainWindow struct {
 	builder     *builder.Builder
-	database    *data.Database
+	database    data.Repository
 	config      *config.Config
 	popupMenu   *popupMenu
 	movieWin    *movieWindow
@@ -101,8 +105,17 @@ type MainWindow struct {
 	sort   Sort
 	view   View
 
-	movies     map[int]*data.Movie
-	refreshing bool
+	movies map[int]*data.Movie
+
+	// cancelRefresh cancels the running search, when a new one replaces it
+	cancelRefresh context.CancelFunc
+	// migrated is set when the database has been migrated, which is done
+	// later if the database is offline at startup
+	migrated atomic.Bool
+	// migrateMu makes overlapping searches wait for a running migration
+	migrateMu sync.Mutex
+	// lastBackup is when the last scheduled backup was started
+	lastBackup time.Time
 }
 
 var (
@@ -138,6 +151,13 @@ func NewMainWindow() *MainWindow {
 	// Open the database after we have the config
 	m.database = data.DatabaseNew(false, cnf)
 
+	// Create missing tables and columns before anything else touches the
+	// database. When the database is offline, it is done before the first search.
+	if err := m.migrate(context.Background()); err != nil && !errors.Is(err, data.ErrDatabaseOffline) {
+		reportError(err)
+		log.Fatal(err)
+	}
+
 	m.setupToolBar()
 	m.popupMenu = newPopupMenu(m)
 	m.popupMenu.setup()
@@ -147,6 +167,7 @@ func NewMainWindow() *MainWindow {
 	versionLabel := m.builder.GetObject("versionLabel").(*gtk.Label)
 	versionLabel.SetText("Version : " + applicationVersion)
 	m.gtk.countLabel = m.builder.GetObject("countLabel").(*gtk.Label)
+	m.gtk.databaseStatusLabel = m.builder.GetObject("databaseStatusLabel").(*gtk.Label)
 
 	// Movie list
 	m.gtk.movieList = m.builder.GetObject("movieList").(*gtk.FlowBox)
@@ -188,17 +209,31 @@ func (m *MainWindow) Open(app *gtk.Application) {
 	}
 	gtk.AddProviderForScreen(screen, cssProvider, gtk.STYLE_PROVIDER_PRIORITY_APPLICATION)
 
-	movieTitles, err = m.database.GetAllMovieTitles()
-	if err != nil {
+	movieTitles, err = m.database.GetAllMovieTitles(context.Background())
+	if err != nil && !errors.Is(err, data.ErrDatabaseOffline) {
 		reportError(err)
-		log.Fatal(err)
 	}
 
+	m.purgeTrash()
+	m.scheduleBackups()
+
 	m.view.manager.changeView(viewToWatch)
 }
 
 func (m *MainWindow) setupMenu(window *gtk.ApplicationWindow) {
 	// File menu
+	menuManageGenres := m.builder.GetObject("menuFileManageGenres").(*gtk.MenuItem)
+	_ = menuManageGenres.Connect("activate", m.onManageGenresClicked)
+	menuManageTags := m.builder.GetObject("menuFileManageTags").(*gtk.MenuItem)
+	_ = menuManageTags.Connect("activate", m.onManageTagsClicked)
+	menuStatistics := m.builder.GetObject("menuFileStatistics").(*gtk.MenuItem)
+	_ = menuStatistics.Connect("activate", m.onStatisticsClicked)
+	menuImportRatings := m.builder.GetObject("menuFileImportRatings").(*gtk.MenuItem)
+	_ = menuImportRatings.Connect("activate", m.onImportRatingsClicked)
+	menuExportLetterboxd := m.builder.GetObject("menuFileExportLetterboxd").(*gtk.MenuItem)
+	_ = menuExportLetterboxd.Connect("activate", m.onExportLetterboxdClicked)
+	menuEmptyTrash := m.builder.GetObject("menuFileEmptyTrash").(*gtk.MenuItem)
+	_ = menuEmptyTrash.Connect("activate", m.onEmptyTrashClicked)
 	menuQuit := m.builder.GetObject("menuFileQuit").(*gtk.MenuItem)
 	_ = menuQuit.Connect("activate", window.Close)
 
@@ -320,34 +355,98 @@ func (m *MainWindow) connectToolButton(name string, handler func()) {
 	_ = button.Connect("clicked", handler)
 }
 
+// refresh searches for the movies in the background, so that a slow database
+// doesn't block the UI, and then shows them. A running search is cancelled,
+// since the new one replaces it.
 func (m *MainWindow) refresh(search Search, sort Sort) {
-	// Let's not refresh while we're already refreshing
-	if m.refreshing {
-		return
+	if m.cancelRefresh != nil {
+		m.cancelRefresh()
 	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancelRefresh = cancel
 
-	m.refreshing = true
 	runtime.GC()
 
-	movies, err := m.database.SearchMovies(string(m.view.current), search.forWhat, search.genreId, getSortBy(sort))
-	if err != nil {
-		reportError(err)
-		log.Fatal(err)
-	}
+	view := string(m.view.current)
+	go func() {
+		movies, err := m.searchMovies(ctx, view, search, sort)
+		glib.IdleAdd(func() {
+			// The search was replaced by a newer one
+			if ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, data.ErrDatabaseOffline) {
+				m.setDatabaseOnline(false)
+				glib.TimeoutAdd(offlineRetryInterval, func() bool {
+					// Unless the user has searched again since
+					if ctx.Err() == nil {
+						m.refresh(search, sort)
+					}
+					return false
+				})
+				return
+			}
+			if err != nil {
+				reportError(err)
+				return
+			}
 
-	clearFlowBox(m.gtk.movieList)
-	glib.IdleAdd(func() {
-		m.loadBatch(movies, 0)
-	})
+			m.setDatabaseOnline(true)
+			clearFlowBox(m.gtk.movieList)
+			m.updateCountLabel(len(movies))
+			m.loadBatch(ctx, movies, 0)
+		})
+	}()
 
 	if m.search.forWhat == "" {
 		m.gtk.searchEntry.SetText("")
 	}
+}
+
+// searchMovies searches for movies. The database is migrated first, if that
+// could not be done at startup because the database was offline.
+func (m *MainWindow) searchMovies(ctx context.Context, view string, search Search, sort Sort) ([]*data.Movie, error) {
+	if !m.migrated.Load() {
+		if err := m.migrate(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return m.database.SearchMovies(ctx, view, search.forWhat, search.genreId, getSortBy(sort))
+}
+
+// migrate brings the database schema up to date. Only one migration runs at a
+// time, and once one has succeeded, migrate does nothing.
+func (m *MainWindow) migrate(ctx context.Context) error {
+	m.migrateMu.Lock()
+	defer m.migrateMu.Unlock()
+
+	if m.migrated.Load() {
+		return nil
+	}
+	if err := m.database.Migrate(ctx); err != nil {
+		return err
+	}
+	m.migrated.Store(true)
+	return nil
+}
 
-	m.updateCountLabel(len(movies))
+// setDatabaseOnline shows or hides the database offline status.
+func (m *MainWindow) setDatabaseOnline(online bool) {
+	if online {
+		m.gtk.databaseStatusLabel.Hide()
+		return
+	}
+	m.gtk.databaseStatusLabel.SetMarkup(`<span foreground="#ff7f7f"><b>Database offline, retrying...</b></span>`)
+	m.gtk.databaseStatusLabel.Show()
 }
 
-func (m *MainWindow) loadBatch(movies []*data.Movie, start int) {
+func (m *MainWindow) loadBatch(ctx context.Context, movies []*data.Movie, start int) {
+	// Stop loading movies that a newer search has replaced
+	if ctx.Err() != nil {
+		return
+	}
+
 	var done bool
 	end := start + batchSize
 	if end > len(movies) {
@@ -357,9 +456,7 @@ func (m *MainWindow) loadBatch(movies []*data.Movie, start int) {
 
 	batch := movies[start:end]
 	for _, movie := range batch {
-		if _, ok := m.movies[movie.Id]; !ok {
-			m.movies[movie.Id] = movie
-		}
+		m.movies[movie.Id] = movie
 		card := listHelper.CreateMovieCard(movie)
 		card.SetName("movie_" + strconv.Itoa(movie.Id))
 		m.gtk.movieList.Add(card)
@@ -367,12 +464,11 @@ func (m *MainWindow) loadBatch(movies []*data.Movie, start int) {
 	}
 
 	if done {
-		m.refreshing = false
 		return
 	}
 
 	glib.IdleAdd(func() {
-		m.loadBatch(movies, end)
+		m.loadBatch(ctx, movies, end)
 	})
 }
 
@@ -401,7 +497,7 @@ func (m *MainWindow) getSelectedMovie() *data.Movie {
 }
 
 func (m *MainWindow) fillGenresMenu() {
-	genres, _ := m.database.GetGenres()
+	genres, _ := m.database.GetGenres(context.Background())
 
 	// Create and add the genre menu
 	sub, _ := gtk.MenuNew()
@@ -426,6 +522,14 @@ func (m *MainWindow) fillGenresMenu() {
 	}
 }
 
+// rebuildGenresMenu replaces the genre menu, after genres have been changed or hidden.
+func (m *MainWindow) rebuildGenresMenu() {
+	m.gtk.genresSubMenu.Destroy()
+	m.gtk.genresSubMenu = nil
+	m.fillGenresMenu()
+	m.gtk.genresSubMenu.ShowAll()
+}
+
 func (m *MainWindow) addGenreMenu(sub *gtk.Menu, group *glib.SList, genre data.Genre) *gtk.RadioMenuItem {
 	item, _ := gtk.RadioMenuItemNewWithLabel(group, genre.Name)
 	item.SetName(strconv.Itoa(genre.Id))
@@ -444,24 +548,24 @@ func (m *MainWindow) addGenreMenu(sub *gtk.Menu, group *glib.SList, genre data.G
 func (m *MainWindow) saveMovieInfo(movieInfo *Movie, movie *data.Movie) {
 	movieInfo.toDatabase(movie)
 
-	err := m.database.UpdateMovie(movie)
+	ctx := context.Background()
+	if movieInfo.scraped {
+		ctx = data.WithChangeSource(ctx, data.ChangeSourceRescrape)
+	}
+
+	// The tags are saved with the movie
+	err := m.database.UpdateMovie(ctx, movie)
 	if err != nil {
 		reportError(err)
 		return
 	}
 
 	if movieInfo.imageHasChanged {
-		err = m.database.UpdateImage(movie, movieInfo.image)
+		err = m.database.UpdateImage(ctx, movie, movieInfo.image)
 		if err != nil {
 			reportError(err)
 			return
 		}
-		// TODO : Remove after update cache
-		_, _ = dialog.
-			Title("Restart needed!").
-			Text("You need to restart the application to see the image change.").
-			OkButton().
-			Show()
 	}
 
 	if movie.SubTitle != "" {
@@ -472,23 +576,69 @@ func (m *MainWindow) saveMovieInfo(movieInfo *Movie, movie *data.Movie) {
 }
 
 func (m *MainWindow) deleteMovie(movie *data.Movie) {
-	err := m.database.DeleteMovie(m.config.RootDir, movie)
-	var pathError *fs.PathError
-	if errors.Is(err, pathError) {
+	err := m.database.TrashMovie(context.Background(), m.config.RootDir, m.config.GetTrashDir(), movie)
+	if err != nil {
 		moviePath := path.Join(m.config.RootDir, movie.MoviePath)
-		msg := fmt.Sprintf("Failed to delete movie from NAS. "+
-			"Some directories or files might need to be removed manually from path='%s'.", moviePath)
+		msg := fmt.Sprintf("Failed to move movie to the trash. "+
+			"Make sure the NAS is unlocked, and that the trash folder is on the same volume as path='%s'.", moviePath)
 
 		_, _ = dialog.Title("Failed to delete movie").Text(msg).ExtraExpand(err.Error()).
 			ErrorIcon().OkButton().Show()
 		return
-	} else if err != nil {
-		//reportError(err)
+	}
+
+	_, _ = dialog.Title("Movie deleted...").Text("The movie has been moved to the trash!").
+		InfoIcon().OkButton().Show()
+	m.refresh(m.search, m.sort)
+}
+
+func (m *MainWindow) onRestoreFromTrashClicked() {
+	movie := m.getSelectedMovie()
+	if movie == nil || !movie.TrashedAt.Valid {
+		return
+	}
+
+	err := m.database.RestoreMovie(context.Background(), m.config.RootDir, m.config.GetTrashDir(), movie)
+	if err != nil {
+		reportError(fmt.Errorf("failed to restore movie : %w", err))
+		return
+	}
+
+	m.refresh(m.search, m.sort)
+}
+
+func (m *MainWindow) onEmptyTrashClicked() {
+	response, err := dialog.Title("Empty trash...").
+		Text("Do you want to permanently delete all movies in the trash?").
+		WarningIcon().YesNoButtons().Show()
+	if err != nil || response != gtk.RESPONSE_YES {
+		return
+	}
+
+	deleted, err := m.database.EmptyTrash(context.Background(), m.config.GetTrashDir(), 0)
+	if err != nil {
+		m.refresh(m.search, m.sort)
+		reportError(fmt.Errorf("failed to empty trash, %d movie(s) were permanently deleted : %w", deleted, err))
 		return
 	}
 
-	_, _ = dialog.Title("Movie deleted...").Text("The movie has been deleted!").
+	_, _ = dialog.Title("Empty trash...").Textf("%d movie(s) were permanently deleted.", deleted).
 		InfoIcon().OkButton().Show()
+	m.refresh(m.search, m.sort)
+}
+
+// purgeTrash permanently deletes movies that have been in the trash
+// longer than the configured number of days.
+func (m *MainWindow) purgeTrash() {
+	if m.config.TrashRetentionDays <= 0 {
+		return
+	}
+
+	olderThan := time.Duration(m.config.TrashRetentionDays) * 24 * time.Hour
+	_, err := m.database.EmptyTrash(context.Background(), m.config.GetTrashDir(), olderThan)
+	if err != nil {
+		reportError(fmt.Errorf("failed to purge trash : %w", err))
+	}
 }
 
 func (m *MainWindow) updateCountLabel(i int) {
@@ -500,6 +650,9 @@ func (m *MainWindow) updateCountLabel(i int) {
 //
 
 func (m *MainWindow) onClose() {
+	if m.cancelRefresh != nil {
+		m.cancelRefresh()
+	}
 	m.database.CloseDatabase()
 	m.gtk.window.Close()
 	m.gtk.movieList = nil
@@ -548,7 +701,7 @@ func (m *MainWindow) onPlayMovieClicked() {
 			return
 		}
 
-		err := m.database.UpdateWatchedAt(movie)
+		err := m.database.UpdateWatchedAt(context.Background(), movie)
 		if err != nil {
 			reportError(fmt.Errorf("UpdateWatchedAt failed: %w", err))
 			return
@@ -565,13 +718,64 @@ func (m *MainWindow) onSetAsToWatchClicked() {
 
 		movie.ToWatch = !movie.ToWatch
 
-		err := m.database.UpdateMovie(movie)
+		err := m.database.UpdateMovie(context.Background(), movie)
 		if err != nil {
 			reportError(fmt.Errorf("failed to set To Watch flag : %w", err))
 		}
 	}()
 }
 
+func (m *MainWindow) onMarkWatchedOnDateClicked() {
+	movie := m.getSelectedMovie()
+	if movie == nil {
+		return
+	}
+
+	viewing, err := showViewingDialog(m.gtk.window, movie)
+	if err != nil {
+		reportError(err)
+		return
+	}
+	if viewing == nil {
+		return
+	}
+
+	err = m.database.InsertViewing(context.Background(), movie, viewing)
+	if err != nil {
+		reportError(fmt.Errorf("failed to add viewing : %w", err))
+	}
+}
+
+func (m *MainWindow) onClearLastViewingClicked() {
+	movie := m.getSelectedMovie()
+	if movie == nil {
+		return
+	}
+
+	viewings, err := m.database.GetViewings(context.Background(), movie)
+	if err != nil {
+		reportError(fmt.Errorf("failed to get viewings : %w", err))
+		return
+	}
+	if len(viewings) == 0 {
+		return
+	}
+
+	// Viewings are sorted with the latest viewing first
+	last := viewings[0]
+	response, err := dialog.Title("Clear last viewing...").
+		Textf("Do you want to remove the viewing of %s on %s?", movie.Title, last.WatchedAt.Format("2006-01-02")).
+		QuestionIcon().YesNoButtons().Show()
+	if err != nil || response != gtk.RESPONSE_YES {
+		return
+	}
+
+	err = m.database.DeleteViewing(context.Background(), movie, &last)
+	if err != nil {
+		reportError(fmt.Errorf("failed to delete viewing : %w", err))
+	}
+}
+
 func (m *MainWindow) onEditMovieInfoClicked() {
 	selectedMovie := m.getSelectedMovie()
 	if selectedMovie == nil {
@@ -608,8 +812,18 @@ func (m *MainWindow) onRefreshButtonClicked() {
 }
 
 func (m *MainWindow) onSearchButtonClicked() {
-	search := getEntryText(m.gtk.searchEntry)
-	m.search.forWhat = strings.Trim(search, " ")
+	search := strings.Trim(getEntryText(m.gtk.searchEntry), " ")
+
+	// Report syntax errors, instead of searching for something that matches nothing
+	if _, err := data.ParseQuery(search); err != nil {
+		_, _ = dialog.Title("Invalid search...").
+			Text("The search could not be understood!").
+			ExtraExpand(err.Error()).
+			WarningIcon().OkButton().Show()
+		return
+	}
+
+	m.search.forWhat = search
 	m.refresh(m.search, m.sort)
 }
 
@@ -717,7 +931,7 @@ func (m *MainWindow) onOpenPackClicked() {
 		return
 	}
 
-	m.search.forWhat = "pack:" + movie.Pack
+	m.search.forWhat = "pack:" + data.QuoteQueryValue(movie.Pack)
 	m.search.genreId = -1
 	m.sort.by = sortByName
 	m.sort.order = sortAscending
@@ -728,6 +942,21 @@ func (m *MainWindow) onOpenPackClicked() {
 	m.view.manager.changeView(viewPacks)
 }
 
+func (m *MainWindow) onEditPackClicked() {
+	movie := m.getSelectedMovie()
+	if movie == nil || movie.Pack == "" {
+		return
+	}
+
+	changed, err := showPackDialog(m.gtk.window, m.database, movie.Pack)
+	if err != nil {
+		reportError(err)
+	}
+	if changed {
+		m.refresh(m.search, m.sort)
+	}
+}
+
 func (m *MainWindow) onOpenFolderClicked() {
 	movie := m.getSelectedMovie()
 	if movie == nil {
@@ -741,8 +970,12 @@ func (m *MainWindow) onWindowClosed(r gtk.ResponseType, info *Movie, movie *data
 	case gtk.RESPONSE_ACCEPT:
 		// Save movie
 		m.saveMovieInfo(info, movie)
+		m.refresh(m.search, m.sort)
 	case gtk.RESPONSE_CANCEL:
-		// Cancel dialog
+		// Cancel dialog, but show artwork changes, since they are already saved
+		if m.movieWin.artworkChanged {
+			m.refresh(m.search, m.sort)
+		}
 	case gtk.RESPONSE_REJECT:
 		// Delete movie
 		m.deleteMovie(movie)
@@ -755,11 +988,57 @@ func (m *MainWindow) onWindowClosed(r gtk.ResponseType, info *Movie, movie *data
 func (m *MainWindow) onShowHidePrivateClicked() {
 	showPrivateGenres = !showPrivateGenres
 	m.refresh(m.search, m.sort)
+	m.rebuildGenresMenu()
+}
 
-	m.gtk.genresSubMenu.Destroy()
-	m.gtk.genresSubMenu = nil
-	m.fillGenresMenu()
-	m.gtk.genresSubMenu.ShowAll()
+func (m *MainWindow) onManageGenresClicked() {
+	changed, err := showGenreDialog(m.gtk.window, m.database)
+	if err != nil {
+		reportError(err)
+		return
+	}
+	if !changed {
+		return
+	}
+
+	// The selected genre might have been merged or deleted, so the
+	// rebuilt menu starts without a genre filter
+	m.search.genreId = -1
+	m.rebuildGenresMenu()
+	m.refresh(m.search, m.sort)
+}
+
+func (m *MainWindow) onManageTagsClicked() {
+	changed, err := showTagDialog(m.gtk.window, m.database)
+	if err != nil {
+		reportError(err)
+		return
+	}
+	if changed {
+		m.refresh(m.search, m.sort)
+	}
+}
+
+func (m *MainWindow) onStatisticsClicked() {
+	if err := showStatisticsWindow(m.gtk.window, m.database); err != nil {
+		reportError(err)
+	}
+}
+
+func (m *MainWindow) onImportRatingsClicked() {
+	changed, err := showRatingImportDialog(m.gtk.window, m.database)
+	if err != nil {
+		reportError(err)
+	}
+	if changed {
+		m.refresh(m.search, m.sort)
+	}
+}
+
+func (m *MainWindow) onExportLetterboxdClicked() {
+	if err := exportLetterboxd(m.gtk.window, m.database); err != nil {
+		reportError(err)
+	}
 }
 
 func (m *MainWindow) getIcon(icon []byte) (*gtk.Image, error) {
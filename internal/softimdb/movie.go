@@ -18,6 +18,7 @@ type Movie struct {
 	moviePath string
 	runtime   int
 	genres    string // Info field only
+	tags      string
 	persons   []data.Person
 	size      int
 	watchedAt *time.Time
@@ -28,6 +29,7 @@ type Movie struct {
 
 	image           []byte
 	imageHasChanged bool
+	scraped         bool // Set when the info was scraped from IMDB
 
 	toWatch       bool
 	pack          string
@@ -53,6 +55,7 @@ func (m *Movie) fromDatabase(movie *data.Movie) {
 	m.imdbUrl = movie.ImdbUrl
 	m.imdbId = movie.ImdbID
 	m.genres = getGenresString(movie.Genres)
+	m.tags = getTagsString(movie.Tags)
 	m.image = movie.Image
 	m.imageHasChanged = false
 }
@@ -80,6 +83,7 @@ func (m *Movie) toDatabase(movie *data.Movie) {
 
 	movie.ImdbRating = m.getImdbRating()
 	movie.Genres = m.getGenres(m.genres)
+	movie.Tags = m.getTags(m.tags)
 	for _, person := range m.persons {
 		movie.Persons = append(movie.Persons, person)
 	}
@@ -118,6 +122,29 @@ func (m *Movie) getGenres(genres string) []data.Genre {
 	return result
 }
 
+// getTags returns the tags in a comma separated string. The result is never nil,
+// so that saving the movie removes its tags when all of them have been cleared.
+func (m *Movie) getTags(tags string) []data.Tag {
+	result := []data.Tag{}
+
+	for _, item := range strings.Split(tags, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, data.Tag{Name: item})
+		}
+	}
+
+	return result
+}
+
+func getTagsString(tags []data.Tag) string {
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
 func getGenresString(genres []data.Genre) string {
 	result := ""
 	for _, genre := range genres {
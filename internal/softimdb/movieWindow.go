@@ -1,12 +1,14 @@
 package softimdb
 
 import (
+	"context"
 	"fmt"
 	_ "image/jpeg"
 	"log"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -14,7 +16,7 @@ import (
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 
-	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
 	"github.com/hultan/dialog"
 	"github.com/hultan/softimdb/internal/config"
@@ -38,11 +40,16 @@ type movieWindow struct {
 	storyLineEntry           *gtk.TextView
 	ratingEntry              *gtk.Entry
 	genresEntry              *gtk.Entry
+	tagsEntry                *gtk.Entry
 	packEntry                *gtk.Entry
 	posterImage              *gtk.Image
 	runtimeEntry             *gtk.Entry
 	deleteButton             *gtk.Button
 	castAndCrewList          *gtk.ListBox
+	historyList              *gtk.ListBox
+	artworkFlowBox           *gtk.FlowBox
+	artworkKindCombo         *gtk.ComboBoxText
+	addArtworkButton         *gtk.Button
 	movieStack               *gtk.Stack
 	bitrateLabel             *gtk.Label
 	watchedAtLabel           *gtk.Label
@@ -50,8 +57,12 @@ type movieWindow struct {
 	guiMovie  *Movie
 	dataMovie *data.Movie
 
+	// artworkChanged is true when the artwork of the movie has been changed,
+	// which is saved at once, so the movie cards must be refreshed on cancel too
+	artworkChanged bool
+
 	config *config.Config
-	db     *data.Database
+	db     data.Repository
 
 	closeCallback func(gtk.ResponseType, *Movie, *data.Movie)
 }
@@ -66,7 +77,7 @@ var showSimilarOnce bool
 
 const bitRateWarning = 8000
 
-func newMovieWindow(builder *builder.Builder, parent gtk.IWindow, db *data.Database,
+func newMovieWindow(builder *builder.Builder, parent gtk.IWindow, db data.Repository,
 	config *config.Config) *movieWindow {
 	m := &movieWindow{}
 
@@ -115,10 +126,16 @@ func newMovieWindow(builder *builder.Builder, parent gtk.IWindow, db *data.Datab
 	m.storyLineEntry = builder.GetObject("storyLineTextView").(*gtk.TextView)
 	m.ratingEntry = builder.GetObject("ratingEntry").(*gtk.Entry)
 	m.genresEntry = builder.GetObject("genresEntry").(*gtk.Entry)
+	m.tagsEntry = builder.GetObject("tagsEntry").(*gtk.Entry)
 	m.packEntry = builder.GetObject("packEntry").(*gtk.Entry)
 	m.posterImage = builder.GetObject("posterImage").(*gtk.Image)
 	m.runtimeEntry = builder.GetObject("runtimeEntry").(*gtk.Entry)
 	m.castAndCrewList = builder.GetObject("castAndCrewList").(*gtk.ListBox)
+	m.historyList = builder.GetObject("historyList").(*gtk.ListBox)
+	m.artworkFlowBox = builder.GetObject("artworkFlowBox").(*gtk.FlowBox)
+	m.artworkKindCombo = builder.GetObject("artworkKindCombo").(*gtk.ComboBoxText)
+	m.addArtworkButton = builder.GetObject("addArtworkButton").(*gtk.Button)
+	m.setupArtworkPage()
 	m.movieStack = builder.GetObject("movieStack").(*gtk.Stack)
 	m.bitrateLabel = builder.GetObject("bitrateLabel").(*gtk.Label)
 	m.watchedAtLabel = builder.GetObject("watchedAtLabel").(*gtk.Label)
@@ -157,7 +174,7 @@ func (m *movieWindow) open(guiMovie *Movie, dataMovie *data.Movie, closeCallback
 
 	if dataMovie != nil {
 		// Load persons for the movie (they are no longer loaded in the main load)
-		persons, err := m.db.GetPersonsForMovie(dataMovie)
+		persons, err := m.db.GetPersonsForMovie(context.Background(), dataMovie)
 		if err != nil {
 			return
 		}
@@ -167,6 +184,7 @@ func (m *movieWindow) open(guiMovie *Movie, dataMovie *data.Movie, closeCallback
 	m.dataMovie = dataMovie
 	m.guiMovie = guiMovie
 	m.closeCallback = closeCallback
+	m.artworkChanged = false
 	m.deleteButton.SetSensitive(dataMovie != nil)
 
 	m.fillForm()
@@ -194,6 +212,7 @@ func (m *movieWindow) fillForm() {
 	m.storyLineEntry.SetBuffer(buffer)
 	m.ratingEntry.SetText(m.guiMovie.imdbRating)
 	m.genresEntry.SetText(m.guiMovie.genres)
+	m.tagsEntry.SetText(m.guiMovie.tags)
 	m.packEntry.SetText(m.guiMovie.pack)
 	m.runtimeEntry.SetText(strconv.Itoa(m.guiMovie.runtime))
 
@@ -217,6 +236,8 @@ func (m *movieWindow) fillForm() {
 	if m.dataMovie != nil {
 		m.fillCastAndCrewPage()
 	}
+	m.fillHistoryPage()
+	m.fillArtworkPage()
 	m.movieStack.SetVisibleChildName("MoviePage")
 }
 
@@ -314,6 +335,7 @@ func (m *movieWindow) fillStorylineAndGenres() bool {
 	}
 	m.guiMovie.storyLine = storyLine
 	m.guiMovie.genres = getEntryText(m.genresEntry)
+	m.guiMovie.tags = getEntryText(m.tagsEntry)
 	return true
 }
 
@@ -401,7 +423,7 @@ func (m *movieWindow) deleteMovie() bool {
 	} else {
 		title = m.guiMovie.title[:27] + "..."
 	}
-	msg := fmt.Sprintf("Do you want to delete the movie '%s'?", title)
+	msg := fmt.Sprintf("Do you want to move the movie '%s' to the trash?", title)
 	response, err := dialog.Title("Delete movie...").Text(msg).YesNoButtons().Width(450).
 		WarningIcon().Show()
 
@@ -418,8 +440,7 @@ func (m *movieWindow) deleteMovie() bool {
 
 // updateImage updates the GtkImage
 func (m *movieWindow) updateImage(image []byte) {
-	// Image size: 190x280
-	pix, err := gdk.PixbufNewFromBytesOnly(image)
+	pix, err := createPixbuf(image, data.ImageSizeCard)
 	if err != nil {
 		reportError(err)
 		return
@@ -504,11 +525,16 @@ func (m *movieWindow) addPeopleSection(title string, personType data.PersonType,
 	// Section title
 	m.castAndCrewList.Add(getLabel(title, true))
 
-	// People of this type
+	// People of this type, which are sorted by billing
 	for _, person := range m.dataMovie.Persons {
-		if person.Type == personType {
-			m.castAndCrewList.Add(getLabel(person.Name, false))
+		if person.Type != personType {
+			continue
+		}
+		text := person.Name
+		if person.Character != "" {
+			text = fmt.Sprintf("%s as %s", person.Name, person.Character)
 		}
+		m.castAndCrewList.Add(getLabel(text, false))
 	}
 
 	if addSpacer {
@@ -517,6 +543,104 @@ func (m *movieWindow) addPeopleSection(title string, personType data.PersonType,
 	}
 }
 
+func (m *movieWindow) fillHistoryPage() {
+	// Clear the list before refreshing the list
+	m.historyList.GetChildren().Foreach(func(item interface{}) {
+		m.historyList.Remove(item.(gtk.IWidget))
+	})
+
+	// New movies have no history yet
+	if m.dataMovie == nil {
+		return
+	}
+
+	history, err := m.db.GetMovieHistory(context.Background(), m.dataMovie)
+	if err != nil {
+		reportError(err)
+		return
+	}
+
+	for i := range history {
+		m.addHistoryRow(history[i])
+	}
+	m.historyList.ShowAll()
+}
+
+func (m *movieWindow) addHistoryRow(change data.MovieChange) {
+	box, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+	if err != nil {
+		reportError(err)
+		return
+	}
+
+	label, err := gtk.LabelNew("")
+	if err != nil {
+		reportError(err)
+		return
+	}
+	label.SetMarkup(getHistoryMarkup(change))
+	label.SetXAlign(0)
+	label.SetLineWrap(true)
+	box.PackStart(label, true, true, 5)
+
+	if change.CanRevert() {
+		button, err := gtk.ButtonNewWithLabel("Revert")
+		if err != nil {
+			reportError(err)
+			return
+		}
+		button.Connect("clicked", func() {
+			m.revertChange(change)
+		})
+		box.PackEnd(button, false, false, 5)
+	}
+
+	m.historyList.Add(box)
+}
+
+// revertChange reverts a single change, and refreshes the form, which means
+// that unsaved edits in the form are lost.
+func (m *movieWindow) revertChange(change data.MovieChange) {
+	err := m.db.RevertChange(context.Background(), m.dataMovie, &change)
+	if err != nil {
+		reportError(err)
+		return
+	}
+
+	// RevertChange updates the columns of the movie, but not the loaded genres
+	if change.Field == "genre" {
+		if change.NewValue != "" {
+			m.dataMovie.Genres = slices.DeleteFunc(m.dataMovie.Genres, func(genre data.Genre) bool {
+				return genre.Name == change.NewValue
+			})
+		} else {
+			m.dataMovie.Genres = append(m.dataMovie.Genres, data.Genre{Name: change.OldValue})
+		}
+	}
+
+	m.guiMovie.fromDatabase(m.dataMovie)
+	m.fillForm()
+	m.movieStack.SetVisibleChildName("HistoryPage")
+}
+
+// getHistoryMarkup returns the text that is shown for a change in the history list.
+func getHistoryMarkup(change data.MovieChange) string {
+	var text string
+	switch {
+	case change.Field == "created":
+		text = "Movie added"
+	case change.NewValue == "":
+		text = fmt.Sprintf("%s: removed %s", change.Field, change.OldValue)
+	case change.OldValue == "":
+		text = fmt.Sprintf("%s: added %s", change.Field, change.NewValue)
+	default:
+		text = fmt.Sprintf("%s: %s → %s", change.Field, change.OldValue, change.NewValue)
+	}
+
+	return fmt.Sprintf("<span foreground='#91834e'>%s (%s)</span>\n<span foreground='#f1e3ae'>%s</span>",
+		change.ChangedAt.Format("2006-01-02 15:04"), glib.MarkupEscapeText(change.Source), glib.MarkupEscapeText(text))
+}
+
 func getLabel(text string, header bool) *gtk.Label {
 	label, err := gtk.LabelNew("")
 	if err != nil {
@@ -530,7 +654,7 @@ func getLabel(text string, header bool) *gtk.Label {
 		weight = "bold"
 		color = "#91834e"
 	}
-	m := fmt.Sprintf("<span foreground='%s' weight='%s' size='%dpt'>%s</span>", color, weight, size, text)
+	m := fmt.Sprintf("<span foreground='%s' weight='%s' size='%dpt'>%s</span>", color, weight, size, glib.MarkupEscapeText(text))
 	label.SetMarkup(m)
 	return label
 }
@@ -670,8 +794,9 @@ func (m *movieWindow) createMovieInfo(movieImdb *imdb.MovieImdb) bool {
 		return true
 	}
 
-	fileData := getCorrectImageSize(fileName)
-	if fileData == nil || len(fileData) == 0 {
+	fileData, err := readImageFile(fileName)
+	if err != nil {
+		reportError(err)
 		return true
 	}
 	m.updateImage(fileData)
@@ -681,9 +806,13 @@ func (m *movieWindow) createMovieInfo(movieImdb *imdb.MovieImdb) bool {
 	var p data.Person
 	for _, person := range movieImdb.Persons {
 		p.Name = person.Name
+		p.ImdbId = person.ImdbId
 		p.Type = data.PersonType(person.Type)
+		p.Billing = person.Billing
+		p.Character = person.Character
 		m.guiMovie.persons = append(m.guiMovie.persons, p)
 	}
+	m.guiMovie.scraped = true
 	return false
 }
 
@@ -709,8 +838,9 @@ func (m *movieWindow) onImageClick() {
 		return
 	}
 
-	fileData := getCorrectImageSize(dlg.GetFilename())
-	if fileData == nil || len(fileData) == 0 {
+	fileData, err := readImageFile(dlg.GetFilename())
+	if err != nil {
+		reportError(err)
 		return
 	}
 	m.updateImage(fileData)
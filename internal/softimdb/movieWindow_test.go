@@ -3,6 +3,9 @@ package softimdb
 import (
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/hultan/softimdb/internal/data"
 )
 
 func Test_findSimilarMovies(t *testing.T) {
@@ -36,6 +39,31 @@ func Test_findSimilarMovies(t *testing.T) {
 	}
 }
 
+func Test_getHistoryMarkup(t *testing.T) {
+	changedAt := time.Date(2024, 5, 6, 7, 8, 0, 0, time.Local)
+	tests := []struct {
+		name   string
+		change data.MovieChange
+		want   string
+	}{
+		{"Created", data.MovieChange{Field: "created", NewValue: "Heat"}, "Movie added"},
+		{"Changed", data.MovieChange{Field: "title", OldValue: "Heat", NewValue: "Heat (1995)"}, "title: Heat → Heat (1995)"},
+		{"Added", data.MovieChange{Field: "genre", NewValue: "Crime"}, "genre: added Crime"},
+		{"Removed", data.MovieChange{Field: "genre", OldValue: "Crime"}, "genre: removed Crime"},
+		{"Escaped", data.MovieChange{Field: "title", OldValue: "Tom & Jerry", NewValue: "Tom"}, "title: Tom &amp; Jerry → Tom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.change.ChangedAt = changedAt
+			tt.change.Source = "ui"
+			want := "<span foreground='#91834e'>2024-05-06 07:08 (ui)</span>\n<span foreground='#f1e3ae'>" + tt.want + "</span>"
+			if got := getHistoryMarkup(tt.change); got != want {
+				t.Errorf("getHistoryMarkup() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
 func getTitles() []string {
 	movies := []string{
 		"The House",
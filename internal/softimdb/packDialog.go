@@ -0,0 +1,290 @@
+package softimdb
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/hultan/dialog"
+
+	"github.com/hultan/softimdb/internal/data"
+)
+
+// packDialog lets the user edit the name, description and poster of a
+// pack, and the order of the movies in the pack.
+type packDialog struct {
+	db     data.Repository
+	dialog *gtk.Dialog
+	list   *gtk.ListBox
+	poster *gtk.Image
+
+	pack   *data.Pack
+	movies []*data.Movie
+	image  []byte
+}
+
+// showPackDialog shows the pack dialog for the named pack. It returns
+// true if the pack was changed, so that the caller can refresh the movies.
+func showPackDialog(parent gtk.IWindow, db data.Repository, name string) (bool, error) {
+	pack, err := db.GetPack(context.Background(), name)
+	if err != nil {
+		return false, err
+	}
+	if pack == nil {
+		return false, fmt.Errorf("failed to open pack: the pack %s does not exist", name)
+	}
+	movies, err := db.GetPackMovies(context.Background(), pack)
+	if err != nil {
+		return false, err
+	}
+
+	dlg, err := gtk.DialogNewWithButtons(
+		"Edit pack...", parent, gtk.DIALOG_MODAL|gtk.DIALOG_DESTROY_WITH_PARENT,
+		[]interface{}{"Delete pack", gtk.RESPONSE_REJECT},
+		[]interface{}{"Cancel", gtk.RESPONSE_CANCEL},
+		[]interface{}{"Save", gtk.RESPONSE_OK},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to create pack dialog: %w", err)
+	}
+	defer dlg.Destroy()
+	dlg.SetDefaultSize(600, 700)
+
+	p := &packDialog{db: db, dialog: dlg, pack: pack, movies: movies}
+
+	content, err := dlg.GetContentArea()
+	if err != nil {
+		return false, fmt.Errorf("failed to get content area: %w", err)
+	}
+	content.SetSpacing(6)
+
+	nameEntry, err := gtk.EntryNew()
+	if err != nil {
+		return false, fmt.Errorf("failed to create entry: %w", err)
+	}
+	nameEntry.SetText(pack.Name)
+	content.Add(nameEntry)
+
+	description, err := gtk.TextViewNew()
+	if err != nil {
+		return false, fmt.Errorf("failed to create text view: %w", err)
+	}
+	description.SetWrapMode(gtk.WRAP_WORD)
+	description.SetSizeRequest(-1, 80)
+	buffer, err := description.GetBuffer()
+	if err != nil {
+		return false, fmt.Errorf("failed to get text buffer: %w", err)
+	}
+	buffer.SetText(pack.Description)
+	content.Add(description)
+
+	posterBox, err := p.createPosterBox()
+	if err != nil {
+		return false, err
+	}
+	content.Add(posterBox)
+
+	scroll, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create scrolled window: %w", err)
+	}
+	scroll.SetVExpand(true)
+	content.PackStart(scroll, true, true, 0)
+
+	p.list, err = gtk.ListBoxNew()
+	if err != nil {
+		return false, fmt.Errorf("failed to create list: %w", err)
+	}
+	p.list.SetSelectionMode(gtk.SELECTION_NONE)
+	scroll.Add(p.list)
+
+	sortButton, err := gtk.ButtonNewWithLabel("Sort by release year")
+	if err != nil {
+		return false, fmt.Errorf("failed to create button: %w", err)
+	}
+	sortButton.Connect("clicked", func() {
+		sortPackMoviesByYear(p.movies)
+		p.fill()
+	})
+	content.Add(sortButton)
+
+	p.fill()
+	dlg.ShowAll()
+
+	switch dlg.Run() {
+	case gtk.RESPONSE_OK:
+		pack.Name = getEntryText(nameEntry)
+		text, err := buffer.GetText(buffer.GetStartIter(), buffer.GetEndIter(), false)
+		if err != nil {
+			return false, fmt.Errorf("failed to get description: %w", err)
+		}
+		pack.Description = text
+		return true, p.save()
+	case gtk.RESPONSE_REJECT:
+		return p.delete()
+	default:
+		return false, nil
+	}
+}
+
+func (p *packDialog) createPosterBox() (*gtk.Box, error) {
+	box, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create box: %w", err)
+	}
+
+	p.poster, err = gtk.ImageNew()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image: %w", err)
+	}
+	if len(p.pack.Image) > 0 {
+		p.showPoster(p.pack.Image)
+	}
+	box.PackStart(p.poster, false, false, 0)
+
+	button, err := gtk.ButtonNewWithLabel("Choose poster...")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create button: %w", err)
+	}
+	button.Connect("clicked", p.choosePoster)
+	box.PackStart(button, false, false, 0)
+
+	return box, nil
+}
+
+func (p *packDialog) choosePoster() {
+	dlg, err := gtk.FileChooserDialogNewWith2Buttons(
+		"Choose an image...", p.dialog, gtk.FILE_CHOOSER_ACTION_OPEN, "Ok", gtk.RESPONSE_OK,
+		"Cancel", gtk.RESPONSE_CANCEL,
+	)
+	if err != nil {
+		reportError(err)
+		return
+	}
+	defer dlg.Destroy()
+
+	if dlg.Run() != gtk.RESPONSE_OK {
+		return
+	}
+
+	fileData, err := readImageFile(dlg.GetFilename())
+	if err != nil {
+		reportError(err)
+		return
+	}
+	p.image = fileData
+	p.showPoster(fileData)
+}
+
+func (p *packDialog) showPoster(image []byte) {
+	pix, err := createPixbuf(image, data.ImageSizeCard)
+	if err != nil {
+		reportError(err)
+		return
+	}
+	p.poster.SetFromPixbuf(pix)
+}
+
+// fill (re)loads the movies of the pack into the list, in the order of the pack.
+func (p *packDialog) fill() {
+	p.list.GetChildren().Foreach(func(item interface{}) {
+		p.list.Remove(item.(gtk.IWidget))
+	})
+
+	for i, movie := range p.movies {
+		box, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+		if err != nil {
+			reportError(err)
+			return
+		}
+
+		label, err := gtk.LabelNew(fmt.Sprintf("%d. %s (%d)", i+1, movie.Title, movie.Year))
+		if err != nil {
+			reportError(err)
+			return
+		}
+		label.SetXAlign(0)
+		box.PackStart(label, true, true, 5)
+
+		up, err := gtk.ButtonNewWithLabel("▲")
+		if err != nil {
+			reportError(err)
+			return
+		}
+		up.SetSensitive(i > 0)
+		up.Connect("clicked", func() {
+			p.movies = movePackMovie(p.movies, i, -1)
+			p.fill()
+		})
+		box.PackStart(up, false, false, 0)
+
+		down, err := gtk.ButtonNewWithLabel("▼")
+		if err != nil {
+			reportError(err)
+			return
+		}
+		down.SetSensitive(i < len(p.movies)-1)
+		down.Connect("clicked", func() {
+			p.movies = movePackMovie(p.movies, i, 1)
+			p.fill()
+		})
+		box.PackStart(down, false, false, 0)
+
+		p.list.Add(box)
+	}
+	p.list.ShowAll()
+}
+
+func (p *packDialog) save() error {
+	err := p.db.UpdatePack(context.Background(), p.pack)
+	if errors.Is(err, data.ErrPackExists) {
+		_, _ = dialog.Title("Edit pack...").
+			Textf("There already is a pack called %s.", p.pack.Name).
+			WarningIcon().OkButton().Show()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := p.db.SetPackOrder(context.Background(), p.pack, p.movies); err != nil {
+		return err
+	}
+
+	if p.image != nil {
+		return p.db.UpdatePackImage(context.Background(), p.pack, p.image)
+	}
+	return nil
+}
+
+func (p *packDialog) delete() (bool, error) {
+	response, err := dialog.Title("Delete pack...").
+		Textf("Do you want to delete the pack %s? The movies in the pack are kept.", p.pack.Name).
+		WarningIcon().YesNoButtons().Show()
+	if err != nil || response != gtk.RESPONSE_YES {
+		return false, nil
+	}
+
+	return true, p.db.DeletePack(context.Background(), p.pack)
+}
+
+// movePackMovie moves the movie at index one step up (delta -1) or down (delta 1) in the pack order.
+func movePackMovie(movies []*data.Movie, index, delta int) []*data.Movie {
+	other := index + delta
+	if index < 0 || index >= len(movies) || other < 0 || other >= len(movies) {
+		return movies
+	}
+
+	movies[index], movies[other] = movies[other], movies[index]
+	return movies
+}
+
+// sortPackMoviesByYear sorts the movies of a pack in release order.
+func sortPackMoviesByYear(movies []*data.Movie) {
+	slices.SortStableFunc(movies, func(a, b *data.Movie) int {
+		return cmp.Compare(a.Year, b.Year)
+	})
+}
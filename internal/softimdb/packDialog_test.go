@@ -0,0 +1,50 @@
+package softimdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hultan/softimdb/internal/data"
+)
+
+func Test_movePackMovie(t *testing.T) {
+	tests := []struct {
+		name  string
+		index int
+		delta int
+		want  []string
+	}{
+		{"up", 1, -1, []string{"Aliens", "Alien", "Alien 3"}},
+		{"down", 1, 1, []string{"Alien", "Alien 3", "Aliens"}},
+		{"first up", 0, -1, []string{"Alien", "Aliens", "Alien 3"}},
+		{"last down", 2, 1, []string{"Alien", "Aliens", "Alien 3"}},
+		{"out of range", 5, -1, []string{"Alien", "Aliens", "Alien 3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			movies := []*data.Movie{{Title: "Alien"}, {Title: "Aliens"}, {Title: "Alien 3"}}
+			assert.Equal(t, tt.want, getPackMovieTitles(movePackMovie(movies, tt.index, tt.delta)))
+		})
+	}
+}
+
+func Test_sortPackMoviesByYear(t *testing.T) {
+	movies := []*data.Movie{
+		{Title: "Prometheus", Year: 2012},
+		{Title: "Alien", Year: 1979},
+		{Title: "Alien 3", Year: 1992},
+		{Title: "Alien³ (workprint)", Year: 1992},
+	}
+
+	sortPackMoviesByYear(movies)
+	assert.Equal(t, []string{"Alien", "Alien 3", "Alien³ (workprint)", "Prometheus"}, getPackMovieTitles(movies))
+}
+
+func getPackMovieTitles(movies []*data.Movie) []string {
+	var titles []string
+	for _, movie := range movies {
+		titles = append(titles, movie.Title)
+	}
+	return titles
+}
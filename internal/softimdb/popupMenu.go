@@ -1,6 +1,7 @@
 package softimdb
 
 import (
+	"context"
 	"log"
 
 	"github.com/gotk3/gotk3/gdk"
@@ -18,8 +19,13 @@ type popupMenu struct {
 	popupOpenIMDB      *gtk.MenuItem
 	popupOpenMovieInfo *gtk.MenuItem
 	popupOpenPack      *gtk.MenuItem
+	popupEditPack      *gtk.MenuItem
 	popupPlayMovie     *gtk.MenuItem
 	popupSetToWatch    *gtk.MenuItem
+
+	popupMarkWatchedOnDate *gtk.MenuItem
+	popupClearLastViewing  *gtk.MenuItem
+	popupRestoreFromTrash  *gtk.MenuItem
 }
 
 func newPopupMenu(window *MainWindow) *popupMenu {
@@ -34,8 +40,12 @@ func (p *popupMenu) setup() {
 	p.popupOpenIMDB = p.mainWindow.builder.GetObject("popupOpenIMDBPage").(*gtk.MenuItem)
 	p.popupOpenMovieInfo = p.mainWindow.builder.GetObject("popupOpenMovieInfo").(*gtk.MenuItem)
 	p.popupOpenPack = p.mainWindow.builder.GetObject("popupOpenPack").(*gtk.MenuItem)
+	p.popupEditPack = p.mainWindow.builder.GetObject("popupEditPack").(*gtk.MenuItem)
 	p.popupPlayMovie = p.mainWindow.builder.GetObject("popupPlayMovie").(*gtk.MenuItem)
 	p.popupSetToWatch = p.mainWindow.builder.GetObject("popupSetToWatch").(*gtk.MenuItem)
+	p.popupMarkWatchedOnDate = p.mainWindow.builder.GetObject("popupMarkWatchedOnDate").(*gtk.MenuItem)
+	p.popupClearLastViewing = p.mainWindow.builder.GetObject("popupClearLastViewing").(*gtk.MenuItem)
+	p.popupRestoreFromTrash = p.mainWindow.builder.GetObject("popupRestoreFromTrash").(*gtk.MenuItem)
 
 	p.setupEvents()
 }
@@ -65,6 +75,12 @@ func (p *popupMenu) setupEvents() {
 		},
 	)
 
+	p.popupEditPack.Connect(
+		"activate", func() {
+			p.mainWindow.onEditPackClicked()
+		},
+	)
+
 	p.popupOpenIMDB.Connect(
 		"activate", func() {
 			p.mainWindow.onOpenIMDBClicked()
@@ -82,6 +98,24 @@ func (p *popupMenu) setupEvents() {
 			p.mainWindow.onSetAsToWatchClicked()
 		},
 	)
+
+	p.popupMarkWatchedOnDate.Connect(
+		"activate", func() {
+			p.mainWindow.onMarkWatchedOnDateClicked()
+		},
+	)
+
+	p.popupClearLastViewing.Connect(
+		"activate", func() {
+			p.mainWindow.onClearLastViewingClicked()
+		},
+	)
+
+	p.popupRestoreFromTrash.Connect(
+		"activate", func() {
+			p.mainWindow.onRestoreFromTrashClicked()
+		},
+	)
 }
 
 func (p *popupMenu) showPopup(event *gdk.Event) {
@@ -97,6 +131,11 @@ func (p *popupMenu) showPopup(event *gdk.Event) {
 
 	// Only enable Open Pack if the movie is in a pack
 	p.popupOpenPack.SetSensitive(movie.Pack != "")
+	p.popupEditPack.SetSensitive(movie.Pack != "")
+	// Only enable Clear Last Viewing if the movie has been watched
+	p.popupClearLastViewing.SetSensitive(movie.WatchedAt.Valid)
+	// Only show Restore From Trash for trashed movies
+	p.popupRestoreFromTrash.SetVisible(movie.TrashedAt.Valid)
 
 	menu, err := gtk.MenuNew()
 	if err != nil {
@@ -104,7 +143,7 @@ func (p *popupMenu) showPopup(event *gdk.Event) {
 		log.Fatal(err)
 	}
 
-	genres, err := p.mainWindow.database.GetGenres()
+	genres, err := p.mainWindow.database.GetGenres(context.Background())
 	if err != nil {
 		reportError(err)
 		return
@@ -143,12 +182,12 @@ func (p *popupMenu) createGenreMenu(genres []data.Genre, movie *data.Movie, menu
 func (p *popupMenu) addGenreActivateEvent(item *gtk.CheckMenuItem, movie *data.Movie, genre *data.Genre) {
 	item.Connect("activate", func() {
 		if item.GetActive() {
-			err := p.mainWindow.database.InsertMovieGenre(movie, genre)
+			err := p.mainWindow.database.InsertMovieGenre(context.Background(), movie, genre)
 			if err == nil {
 				p.addGenre(movie, genre)
 			}
 		} else {
-			err := p.mainWindow.database.RemoveMovieGenre(movie, genre)
+			err := p.mainWindow.database.RemoveMovieGenre(context.Background(), movie, genre)
 			if err == nil {
 				p.removeGenre(movie, genre)
 			}
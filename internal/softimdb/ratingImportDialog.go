@@ -0,0 +1,236 @@
+package softimdb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/hultan/dialog"
+
+	"github.com/hultan/softimdb/internal/data"
+)
+
+// showRatingImportDialog asks for an IMDb or Letterboxd export, and shows the
+// changes it would make to the movies. Only the changes that the user keeps
+// checked are made. It returns true if any movie was changed.
+func showRatingImportDialog(parent gtk.IWindow, db data.Repository) (bool, error) {
+	fileName, ok := askForRatingsFile(parent, "Import ratings...", gtk.FILE_CHOOSER_ACTION_OPEN, "Open")
+	if !ok {
+		return false, nil
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %w", fileName, err)
+	}
+	source, rows, err := data.ReadRatings(file)
+	_ = file.Close()
+	if err != nil {
+		return false, err
+	}
+
+	result, err := data.PrepareRatingImport(context.Background(), db, source, rows)
+	if err != nil {
+		return false, err
+	}
+	if len(result.Changes) == 0 {
+		_, _ = dialog.Title("Import ratings...").Text(getRatingImportSummary(result)).
+			InfoIcon().OkButton().Show()
+		return false, nil
+	}
+
+	changes, err := reviewRatingImport(parent, result)
+	if err != nil || len(changes) == 0 {
+		return false, err
+	}
+
+	return true, data.ApplyRatingImport(context.Background(), db, changes)
+}
+
+// reviewRatingImport shows the changes of an import, with a check box for
+// each movie, and returns the checked changes, or nothing if cancelled.
+func reviewRatingImport(parent gtk.IWindow, result *data.RatingImport) ([]data.RatingChange, error) {
+	dlg, err := gtk.DialogNewWithButtons(
+		"Import ratings...", parent, gtk.DIALOG_MODAL|gtk.DIALOG_DESTROY_WITH_PARENT,
+		[]interface{}{"Cancel", gtk.RESPONSE_CANCEL},
+		[]interface{}{"Import", gtk.RESPONSE_APPLY},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create import dialog: %w", err)
+	}
+	defer dlg.Destroy()
+	dlg.SetDefaultSize(700, 600)
+
+	content, err := dlg.GetContentArea()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get content area: %w", err)
+	}
+
+	summary, err := gtk.LabelNew(getRatingImportSummary(result))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create label: %w", err)
+	}
+	summary.SetXAlign(0)
+	summary.SetLineWrap(true)
+	content.PackStart(summary, false, false, 10)
+
+	scroll, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scrolled window: %w", err)
+	}
+	scroll.SetVExpand(true)
+	content.PackStart(scroll, true, true, 0)
+
+	list, err := gtk.ListBoxNew()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create list: %w", err)
+	}
+	list.SetSelectionMode(gtk.SELECTION_NONE)
+	scroll.Add(list)
+
+	checks := make([]*gtk.CheckButton, len(result.Changes))
+	for i, change := range result.Changes {
+		checks[i], err = gtk.CheckButtonNewWithLabel(getRatingChangeText(change))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create check button: %w", err)
+		}
+		checks[i].SetActive(true)
+		list.Add(checks[i])
+	}
+
+	if len(result.Unmatched) > 0 {
+		expander, err := gtk.ExpanderNew(fmt.Sprintf("Rows without a movie (%d)", len(result.Unmatched)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create expander: %w", err)
+		}
+		unmatched, err := gtk.LabelNew(getUnmatchedRatingsText(result.Unmatched))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create label: %w", err)
+		}
+		unmatched.SetXAlign(0)
+		unmatched.SetSelectable(true)
+		expander.Add(unmatched)
+		content.PackStart(expander, false, false, 5)
+	}
+
+	dlg.ShowAll()
+	if dlg.Run() != gtk.RESPONSE_APPLY {
+		return nil, nil
+	}
+
+	var changes []data.RatingChange
+	for i, check := range checks {
+		if check.GetActive() {
+			changes = append(changes, result.Changes[i])
+		}
+	}
+	return changes, nil
+}
+
+// exportLetterboxd asks for a file name, and saves the ratings and viewings
+// in the format that Letterboxd imports.
+func exportLetterboxd(parent gtk.IWindow, db data.Repository) error {
+	fileName, ok := askForRatingsFile(parent, "Export to Letterboxd...", gtk.FILE_CHOOSER_ACTION_SAVE, "Save")
+	if !ok {
+		return nil
+	}
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", fileName, err)
+	}
+	rows, err := data.WriteLetterboxdCSV(context.Background(), db, file)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	_, _ = dialog.Title("Export to Letterboxd...").
+		Textf("%d row(s) were saved to %s.", rows, fileName).
+		InfoIcon().OkButton().Show()
+	return nil
+}
+
+// askForRatingsFile asks for a CSV file to open or save.
+func askForRatingsFile(parent gtk.IWindow, title string, action gtk.FileChooserAction, button string) (string, bool) {
+	dlg, err := gtk.FileChooserDialogNewWith2Buttons(
+		title, parent, action, button, gtk.RESPONSE_OK, "Cancel", gtk.RESPONSE_CANCEL,
+	)
+	if err != nil {
+		reportError(err)
+		return "", false
+	}
+	defer dlg.Destroy()
+
+	filter, err := gtk.FileFilterNew()
+	if err == nil {
+		filter.SetName("CSV files")
+		filter.AddPattern("*.csv")
+		dlg.AddFilter(filter)
+	}
+	if action == gtk.FILE_CHOOSER_ACTION_SAVE {
+		dlg.SetDoOverwriteConfirmation(true)
+		dlg.SetCurrentName("letterboxd.csv")
+	}
+
+	home, err := os.UserHomeDir()
+	if err == nil {
+		_ = dlg.SetCurrentFolder(path.Join(home, "Downloads"))
+	}
+
+	if dlg.Run() != gtk.RESPONSE_OK {
+		return "", false
+	}
+	return dlg.GetFilename(), true
+}
+
+// getRatingImportSummary returns the text above the changes of an import.
+func getRatingImportSummary(result *data.RatingImport) string {
+	summary := fmt.Sprintf("%s: %d movie(s) will be changed", result.Source, len(result.Changes))
+	if len(result.Unmatched) > 0 {
+		summary += fmt.Sprintf(", %d row(s) did not match any movie", len(result.Unmatched))
+	}
+	return summary + "."
+}
+
+// getRatingChangeText describes the change of one movie, like
+// "Heat (1995): my rating 3 → 4, 2 viewings".
+func getRatingChangeText(change data.RatingChange) string {
+	movie := change.Movie
+
+	var parts []string
+	if change.MyRating != movie.MyRating {
+		parts = append(parts, fmt.Sprintf("my rating %d → %d", movie.MyRating, change.MyRating))
+	}
+	if change.ToWatch && !movie.ToWatch {
+		parts = append(parts, "to watch")
+	}
+	switch len(change.Viewings) {
+	case 0:
+	case 1:
+		parts = append(parts, "watched "+change.Viewings[0].WatchedAt.Format("2006-01-02"))
+	default:
+		parts = append(parts, fmt.Sprintf("%d viewings", len(change.Viewings)))
+	}
+
+	return fmt.Sprintf("%s (%d): %s", movie.Title, movie.Year, strings.Join(parts, ", "))
+}
+
+// getUnmatchedRatingsText lists the rows that did not match any movie, one per line.
+func getUnmatchedRatingsText(rows []data.RatingRow) string {
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		line := fmt.Sprintf("%s (%d)", row.Title, row.Year)
+		if row.ImdbId != "" {
+			line += " " + row.ImdbId
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
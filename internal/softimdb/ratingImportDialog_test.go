@@ -0,0 +1,54 @@
+package softimdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hultan/softimdb/internal/data"
+)
+
+func Test_getRatingChangeText(t *testing.T) {
+	heat := &data.Movie{Title: "Heat", Year: 1995, MyRating: 3}
+	watchedAt := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name   string
+		change data.RatingChange
+		want   string
+	}{
+		{
+			"rating and viewings",
+			data.RatingChange{Movie: heat, MyRating: 4, Viewings: []data.Viewing{{}, {}}},
+			"Heat (1995): my rating 3 → 4, 2 viewings",
+		},
+		{
+			"one viewing",
+			data.RatingChange{Movie: heat, MyRating: 3, Viewings: []data.Viewing{{WatchedAt: watchedAt}}},
+			"Heat (1995): watched 2024-05-01",
+		},
+		{
+			"to watch",
+			data.RatingChange{Movie: heat, MyRating: 3, ToWatch: true},
+			"Heat (1995): to watch",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, getRatingChangeText(tt.change))
+		})
+	}
+}
+
+func Test_getRatingImportSummary(t *testing.T) {
+	result := &data.RatingImport{
+		Source:    data.LetterboxdDiary,
+		Changes:   []data.RatingChange{{}},
+		Unmatched: []data.RatingRow{{Title: "Ronin", Year: 1998}},
+	}
+
+	assert.Equal(t, "Letterboxd diary: 1 movie(s) will be changed, 1 row(s) did not match any movie.",
+		getRatingImportSummary(result))
+	assert.Equal(t, "Ronin (1998)", getUnmatchedRatingsText(result.Unmatched))
+}
@@ -0,0 +1,324 @@
+package softimdb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gotk3/gotk3/cairo"
+	"github.com/gotk3/gotk3/gtk"
+
+	"github.com/hultan/softimdb/internal/data"
+)
+
+const (
+	// statisticsChartLimit is the maximum number of bars in a chart.
+	statisticsChartLimit = 25
+	// statisticsMonths is the number of months shown in the viewings chart.
+	statisticsMonths = 24
+
+	chartMargin     = 10.0
+	chartBarHeight  = 24.0
+	chartLabelWidth = 200.0
+	chartValueWidth = 130.0
+	chartFontSize   = 13.0
+)
+
+// statisticsChart is one chart, shown on its own page in the statistics window.
+type statisticsChart struct {
+	title string
+	bars  []chartBar
+}
+
+// chartBar is one bar of a chart, with the text that is shown after the bar.
+type chartBar struct {
+	label string
+	value float64
+	text  string
+}
+
+// showStatisticsWindow shows the library statistics as charts, and lets the
+// user export them as CSV.
+func showStatisticsWindow(parent gtk.IWindow, db data.Repository) error {
+	stats, err := db.GetStatistics(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get statistics: %w", err)
+	}
+
+	dlg, err := gtk.DialogNewWithButtons(
+		"Statistics...", parent, gtk.DIALOG_MODAL|gtk.DIALOG_DESTROY_WITH_PARENT,
+		[]interface{}{"Export CSV...", gtk.RESPONSE_APPLY},
+		[]interface{}{"Close", gtk.RESPONSE_CLOSE},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create statistics window: %w", err)
+	}
+	defer dlg.Destroy()
+	dlg.SetDefaultSize(900, 700)
+
+	content, err := dlg.GetContentArea()
+	if err != nil {
+		return fmt.Errorf("failed to get content area: %w", err)
+	}
+
+	summary, err := gtk.LabelNew("")
+	if err != nil {
+		return fmt.Errorf("failed to create label: %w", err)
+	}
+	summary.SetMarkup(getStatisticsSummaryMarkup(stats))
+	summary.SetXAlign(0)
+	content.PackStart(summary, false, false, 10)
+
+	notebook, err := gtk.NotebookNew()
+	if err != nil {
+		return fmt.Errorf("failed to create notebook: %w", err)
+	}
+	notebook.SetScrollable(true)
+	notebook.SetVExpand(true)
+	content.PackStart(notebook, true, true, 0)
+
+	for _, chart := range getStatisticsCharts(stats) {
+		if err := addChartPage(notebook, chart); err != nil {
+			return err
+		}
+	}
+
+	dlg.ShowAll()
+	for dlg.Run() == gtk.RESPONSE_APPLY {
+		exportStatistics(dlg, stats)
+	}
+
+	return nil
+}
+
+// addChartPage adds a page with a bar chart to the notebook.
+func addChartPage(notebook *gtk.Notebook, chart statisticsChart) error {
+	scroll, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create scrolled window: %w", err)
+	}
+
+	area, err := gtk.DrawingAreaNew()
+	if err != nil {
+		return fmt.Errorf("failed to create drawing area: %w", err)
+	}
+	area.SetSizeRequest(-1, int(getChartHeight(len(chart.bars))))
+	area.Connect("draw", func(da *gtk.DrawingArea, cr *cairo.Context) bool {
+		drawBarChart(cr, float64(da.GetAllocatedWidth()), float64(da.GetAllocatedHeight()), chart.bars)
+		return true
+	})
+	scroll.Add(area)
+
+	label, err := gtk.LabelNew(chart.title)
+	if err != nil {
+		return fmt.Errorf("failed to create label: %w", err)
+	}
+	notebook.AppendPage(scroll, label)
+
+	return nil
+}
+
+// drawBarChart draws a horizontal bar chart, with the label to the left of
+// each bar and the text to the right of it.
+func drawBarChart(cr *cairo.Context, width, height float64, bars []chartBar) {
+	cr.SetSourceRGB(getChartColor(0x141103))
+	cr.Rectangle(0, 0, width, height)
+	cr.Fill()
+
+	cr.SelectFontFace("Sans", cairo.FONT_SLANT_NORMAL, cairo.FONT_WEIGHT_NORMAL)
+	cr.SetFontSize(chartFontSize)
+
+	if len(bars) == 0 {
+		cr.SetSourceRGB(getChartColor(0x91834e))
+		cr.MoveTo(chartMargin, chartMargin+chartFontSize)
+		cr.ShowText("No movies")
+		return
+	}
+
+	maxValue := getMaxChartValue(bars)
+	barSpace := max(width-chartLabelWidth-chartValueWidth-2*chartMargin, 0)
+	for i, bar := range bars {
+		y := chartMargin + float64(i)*chartBarHeight
+		textY := y + chartBarHeight/2 + chartFontSize/3
+
+		cr.SetSourceRGB(getChartColor(0xf1e3ae))
+		cr.MoveTo(chartMargin, textY)
+		cr.ShowText(truncateChartLabel(cr, bar.label))
+
+		barWidth := 0.0
+		if maxValue > 0 {
+			barWidth = barSpace * bar.value / maxValue
+		}
+		x := chartMargin + chartLabelWidth
+		cr.SetSourceRGB(getChartColor(0xe3c75b))
+		cr.Rectangle(x, y+4, barWidth, chartBarHeight-8)
+		cr.Fill()
+
+		cr.SetSourceRGB(getChartColor(0x91834e))
+		cr.MoveTo(x+barWidth+6, textY)
+		cr.ShowText(bar.text)
+	}
+}
+
+// truncateChartLabel shortens a label that does not fit to the left of the bars.
+func truncateChartLabel(cr *cairo.Context, label string) string {
+	runes := []rune(label)
+	for len(runes) > 1 && cr.TextExtents(string(runes)).Width > chartLabelWidth-10 {
+		runes = runes[:len(runes)-2]
+		runes = append(runes, '…')
+	}
+	return string(runes)
+}
+
+// exportStatistics asks for a file name, and saves the statistics as CSV.
+func exportStatistics(parent gtk.IWindow, stats *data.Statistics) {
+	dlg, err := gtk.FileChooserDialogNewWith2Buttons(
+		"Export statistics...", parent, gtk.FILE_CHOOSER_ACTION_SAVE, "Save", gtk.RESPONSE_OK,
+		"Cancel", gtk.RESPONSE_CANCEL,
+	)
+	if err != nil {
+		reportError(err)
+		return
+	}
+	defer dlg.Destroy()
+	dlg.SetDoOverwriteConfirmation(true)
+	dlg.SetCurrentName("softimdb-statistics.csv")
+
+	home, err := os.UserHomeDir()
+	if err == nil {
+		_ = dlg.SetCurrentFolder(path.Join(home, "Documents"))
+	}
+
+	if dlg.Run() != gtk.RESPONSE_OK {
+		return
+	}
+
+	if err := writeStatisticsFile(dlg.GetFilename(), stats); err != nil {
+		reportError(err)
+	}
+}
+
+func writeStatisticsFile(fileName string, stats *data.Statistics) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", fileName, err)
+	}
+
+	if err := stats.WriteCSV(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// getStatisticsCharts returns the charts of the statistics window.
+func getStatisticsCharts(stats *data.Statistics) []statisticsChart {
+	months := stats.Viewings
+	if len(months) > statisticsMonths {
+		months = months[len(months)-statisticsMonths:]
+	}
+
+	var ratings []data.StatisticsGroup
+	for _, group := range stats.Ratings {
+		if group.Name == "0" {
+			group.Name = "Not rated"
+		} else {
+			group.Name += "/5"
+		}
+		ratings = append(ratings, group)
+	}
+
+	return []statisticsChart{
+		{"Genres", getCountBars(stats.Genres)},
+		{"Decades", getCountBars(stats.Decades)},
+		{"My rating", getCountBars(ratings)},
+		{"My rating by genre", getRatingBars(stats.Genres)},
+		{"My rating vs IMDb", getCountBars(stats.RatingDeviations)},
+		{"Watched per month", getCountBars(months)},
+		{"Directors", getCountBars(stats.Directors)},
+		{"Actors", getCountBars(stats.Actors)},
+		{"Packs", getCountBars(stats.Packs)},
+	}
+}
+
+// getCountBars returns a bar for each group, up to statisticsChartLimit,
+// showing the number of movies and their runtime.
+func getCountBars(groups []data.StatisticsGroup) []chartBar {
+	var bars []chartBar
+	for _, group := range groups[:min(len(groups), statisticsChartLimit)] {
+		text := fmt.Sprintf("%d", group.Count)
+		if group.Runtime > 0 {
+			text += fmt.Sprintf(" (%s)", formatStatisticsRuntime(group.Runtime))
+		}
+		bars = append(bars, chartBar{label: group.Name, value: float64(group.Count), text: text})
+	}
+	return bars
+}
+
+// getRatingBars returns a bar with the average of my rating for each group
+// that has rated movies, up to statisticsChartLimit.
+func getRatingBars(groups []data.StatisticsGroup) []chartBar {
+	var bars []chartBar
+	for _, group := range groups {
+		if group.AverageMyRating == 0 {
+			continue
+		}
+		text := fmt.Sprintf("%.1f/5 (IMDb %.1f)", group.AverageMyRating, group.AverageImdbRating)
+		bars = append(bars, chartBar{label: group.Name, value: group.AverageMyRating, text: text})
+		if len(bars) == statisticsChartLimit {
+			break
+		}
+	}
+	return bars
+}
+
+// getStatisticsSummaryMarkup returns the totals that are shown above the charts.
+func getStatisticsSummaryMarkup(stats *data.Statistics) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "<span foreground='#f1e3ae'><b>%d movies</b></span>", stats.Total.Count)
+	fmt.Fprintf(&b, "<span foreground='#91834e'>, %s, %s</span>\n",
+		formatStatisticsRuntime(stats.Total.Runtime), formatStatisticsSize(stats.Total.Size))
+	fmt.Fprintf(&b, "<span foreground='#91834e'>Unwatched: %d movies, %s</span>\n",
+		stats.Unwatched.Count, formatStatisticsRuntime(stats.Unwatched.Runtime))
+	fmt.Fprintf(&b, "<span foreground='#91834e'>To watch: %d movies, %s</span>\n",
+		stats.ToWatch.Count, formatStatisticsRuntime(stats.ToWatch.Runtime))
+	fmt.Fprintf(&b, "<span foreground='#91834e'>Average rating: %.1f/5 (IMDb %.1f), %+.1f compared to IMDb</span>",
+		stats.Total.AverageMyRating, stats.Total.AverageImdbRating, stats.Total.AverageDeviation)
+
+	return b.String()
+}
+
+// formatStatisticsRuntime formats a runtime in minutes as hours and minutes.
+func formatStatisticsRuntime(minutes int) string {
+	return fmt.Sprintf("%dh %dm", minutes/60, minutes%60)
+}
+
+// formatStatisticsSize formats a size in bytes as GB, or TB for large sizes.
+func formatStatisticsSize(size int64) string {
+	const gb = 1024 * 1024 * 1024
+	if size >= 1024*gb {
+		return fmt.Sprintf("%.1f TB", float64(size)/(1024*gb))
+	}
+	return fmt.Sprintf("%.1f GB", float64(size)/gb)
+}
+
+func getChartHeight(bars int) float64 {
+	return 2*chartMargin + float64(max(bars, 1))*chartBarHeight
+}
+
+func getMaxChartValue(bars []chartBar) float64 {
+	maxValue := 0.0
+	for _, bar := range bars {
+		maxValue = max(maxValue, bar.value)
+	}
+	return maxValue
+}
+
+// getChartColor returns the red, green and blue parts of a colour like 0xf1e3ae.
+func getChartColor(color int) (float64, float64, float64) {
+	return float64(color>>16&0xff) / 255, float64(color>>8&0xff) / 255, float64(color&0xff) / 255
+}
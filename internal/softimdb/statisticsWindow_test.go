@@ -0,0 +1,56 @@
+package softimdb
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hultan/softimdb/internal/data"
+)
+
+func Test_formatStatisticsSize(t *testing.T) {
+	tests := []struct {
+		name string
+		size int64
+		want string
+	}{
+		{"empty", 0, "0.0 GB"},
+		{"gigabytes", 5 * 1024 * 1024 * 1024, "5.0 GB"},
+		{"terabytes", 1536 * 1024 * 1024 * 1024, "1.5 TB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, formatStatisticsSize(tt.size))
+		})
+	}
+}
+
+func Test_getCountBars(t *testing.T) {
+	groups := []data.StatisticsGroup{
+		{Name: "Action", Count: 2, Runtime: 325},
+		{Name: "Horror", Count: 1},
+	}
+
+	assert.Equal(t, []chartBar{
+		{label: "Action", value: 2, text: "2 (5h 25m)"},
+		{label: "Horror", value: 1, text: "1"},
+	}, getCountBars(groups))
+
+	var many []data.StatisticsGroup
+	for i := range statisticsChartLimit + 5 {
+		many = append(many, data.StatisticsGroup{Name: fmt.Sprint(i), Count: 1})
+	}
+	assert.Len(t, getCountBars(many), statisticsChartLimit)
+}
+
+func Test_getRatingBars(t *testing.T) {
+	groups := []data.StatisticsGroup{
+		{Name: "Action", AverageMyRating: 4.5, AverageImdbRating: 8.4},
+		{Name: "Horror"},
+	}
+
+	assert.Equal(t, []chartBar{
+		{label: "Action", value: 4.5, text: "4.5/5 (IMDb 8.4)"},
+	}, getRatingBars(groups))
+}
@@ -0,0 +1,177 @@
+package softimdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/hultan/dialog"
+
+	"github.com/hultan/softimdb/internal/data"
+)
+
+// tagDialog lets the user rename, recolour and delete tags. Tags are
+// put on movies in the movie window.
+type tagDialog struct {
+	db      data.Repository
+	dialog  *gtk.Dialog
+	list    *gtk.ListBox
+	changed bool
+}
+
+// showTagDialog shows the tag management dialog. It returns true if
+// any tag was changed, so that the caller can refresh the movie cards.
+func showTagDialog(parent gtk.IWindow, db data.Repository) (bool, error) {
+	dlg, err := gtk.DialogNewWithButtons(
+		"Manage tags...", parent, gtk.DIALOG_MODAL|gtk.DIALOG_DESTROY_WITH_PARENT,
+		[]interface{}{"Close", gtk.RESPONSE_CLOSE},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to create tag dialog: %w", err)
+	}
+	defer dlg.Destroy()
+	dlg.SetDefaultSize(500, 500)
+
+	content, err := dlg.GetContentArea()
+	if err != nil {
+		return false, fmt.Errorf("failed to get content area: %w", err)
+	}
+
+	scroll, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create scrolled window: %w", err)
+	}
+	scroll.SetVExpand(true)
+	content.PackStart(scroll, true, true, 0)
+
+	list, err := gtk.ListBoxNew()
+	if err != nil {
+		return false, fmt.Errorf("failed to create list: %w", err)
+	}
+	list.SetSelectionMode(gtk.SELECTION_NONE)
+	scroll.Add(list)
+
+	t := &tagDialog{db: db, dialog: dlg, list: list}
+	t.fill()
+
+	dlg.ShowAll()
+	dlg.Run()
+
+	return t.changed, nil
+}
+
+// fill (re)loads the tags into the list.
+func (t *tagDialog) fill() {
+	t.list.GetChildren().Foreach(func(item interface{}) {
+		t.list.Remove(item.(gtk.IWidget))
+	})
+
+	tags, err := t.db.GetTags(context.Background())
+	if err != nil {
+		reportError(err)
+		return
+	}
+
+	for i := range tags {
+		t.addRow(&tags[i])
+	}
+	t.list.ShowAll()
+}
+
+func (t *tagDialog) addRow(tag *data.Tag) {
+	box, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 5)
+	if err != nil {
+		reportError(err)
+		return
+	}
+
+	label, err := gtk.LabelNew("")
+	if err != nil {
+		reportError(err)
+		return
+	}
+	label.SetMarkup(getTagsMarkup([]data.Tag{*tag}))
+	label.SetXAlign(0)
+	box.PackStart(label, true, true, 5)
+
+	rgba := gdk.NewRGBA()
+	rgba.Parse(tag.Color)
+	color, err := gtk.ColorButtonNewWithRGBA(rgba)
+	if err != nil {
+		reportError(err)
+		return
+	}
+	color.Connect("color-set", func() {
+		selected := color.GetRGBA()
+		tag.Color = getHexColor(selected.GetRed(), selected.GetGreen(), selected.GetBlue())
+		t.apply(t.db.UpdateTag(context.Background(), tag))
+	})
+	box.PackStart(color, false, false, 5)
+
+	rename, err := gtk.ButtonNewWithLabel("Rename...")
+	if err != nil {
+		reportError(err)
+		return
+	}
+	rename.Connect("clicked", func() { t.rename(tag) })
+	box.PackStart(rename, false, false, 0)
+
+	remove, err := gtk.ButtonNewWithLabel("Delete")
+	if err != nil {
+		reportError(err)
+		return
+	}
+	remove.Connect("clicked", func() { t.delete(tag) })
+	box.PackStart(remove, false, false, 0)
+
+	t.list.Add(box)
+}
+
+func (t *tagDialog) rename(tag *data.Tag) {
+	name, ok := askForText(t.dialog, "Rename tag...", fmt.Sprintf("New name of %s:", tag.Name), tag.Name)
+	if !ok || name == tag.Name {
+		return
+	}
+
+	renamed := *tag
+	renamed.Name = name
+	err := t.db.UpdateTag(context.Background(), &renamed)
+	if errors.Is(err, data.ErrTagExists) {
+		_, _ = dialog.Title("Rename tag...").
+			Textf("There already is a tag called %s.", name).
+			WarningIcon().OkButton().Show()
+		return
+	}
+	t.apply(err)
+}
+
+func (t *tagDialog) delete(tag *data.Tag) {
+	response, err := dialog.Title("Delete tag...").
+		Textf("Do you want to delete the tag %s, and remove it from all movies?", tag.Name).
+		WarningIcon().YesNoButtons().Show()
+	if err != nil || response != gtk.RESPONSE_YES {
+		return
+	}
+
+	t.apply(t.db.DeleteTag(context.Background(), tag))
+}
+
+// apply reports the error of a tag change, if any, and refreshes the list.
+func (t *tagDialog) apply(err error) {
+	if err != nil {
+		reportError(err)
+	}
+	t.changed = true
+	t.fill()
+}
+
+// getHexColor returns a colour, with the components between 0 and 1, like #ff8800.
+func getHexColor(red, green, blue float64) string {
+	component := func(c float64) int {
+		return int(math.Round(math.Max(0, math.Min(1, c)) * 255))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", component(red), component(green), component(blue))
+}
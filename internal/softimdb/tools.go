@@ -16,12 +16,13 @@ import (
 	"strings"
 	"syscall"
 
-	"github.com/disintegration/imaging"
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
 
 	"github.com/hultan/dialog"
+
+	"github.com/hultan/softimdb/internal/data"
 )
 
 func cleanString(text string) string {
@@ -36,10 +37,15 @@ func reportError(err error) {
 
 	_, _ = fmt.Fprintln(os.Stderr, err)
 
+	text := "An unkown error occured!"
+	if errors.Is(err, data.ErrDatabaseOffline) {
+		text = "The database is offline. Try again when the database server is awake."
+	}
+
 	// Always make sure that the dialog is called from the main thread
 	glib.IdleAdd(func() {
 		_, _ = dialog.Title(applicationTitle).
-			Text("An unkown error occured!").
+			Text(text).
 			ExtraExpand(err.Error()).
 			ExtraHeight(80).
 			ErrorIcon().OkButton().Show()
@@ -179,43 +185,34 @@ func clearFlowBox(list *gtk.FlowBox) {
 	})
 }
 
-// getCorrectImageSize makes sure that the size of the image is 190x280 and returns it
-func getCorrectImageSize(fileName string) []byte {
+// readImageFile reads an image file and makes sure that it is an image. The
+// image is kept in its original size, the sizes that are shown are made from
+// it with data.GetImageOfSize.
+func readImageFile(fileName string) ([]byte, error) {
 	data, err := os.ReadFile(fileName)
 	if err != nil {
-		reportError(err)
-		log.Fatal(err)
+		return nil, fmt.Errorf("failed to read image: %w", err)
 	}
 
-	pix, err := gdk.PixbufNewFromBytesOnly(data)
-	if err != nil {
-		reportError(err)
-		log.Fatal(err)
-	}
-	width, height := pix.GetWidth(), pix.GetHeight()
-	if width != imageWidth || height != imageHeight {
-		return resizeImage(data)
+	if _, err := gdk.PixbufNewFromBytesOnly(data); err != nil {
+		return nil, fmt.Errorf("failed to read image %s: %w", fileName, err)
 	}
 
-	return data
+	return data, nil
 }
 
-// resizeImage resizes the image to 190x280 and converts it to a JPG file
-func resizeImage(imgData []byte) []byte {
-	img, _, err := image.Decode(bytes.NewReader(imgData))
+// createPixbuf creates a pixbuf of an image in the given size.
+func createPixbuf(imageData []byte, size data.ImageSize) (*gdk.Pixbuf, error) {
+	resized, err := data.GetImageOfSize(imageData, size)
 	if err != nil {
-		reportError(err)
-		return nil
+		return nil, err
 	}
 
-	imgResized := imaging.Resize(img, imageWidth, imageHeight, imaging.Lanczos)
-	buf := new(bytes.Buffer)
-	err = jpeg.Encode(buf, imgResized, &jpeg.Options{Quality: 85})
+	pix, err := gdk.PixbufNewFromBytesOnly(resized)
 	if err != nil {
-		reportError(err)
-		return nil
+		return nil, fmt.Errorf("failed to create pixbuf: %w", err)
 	}
-	return buf.Bytes()
+	return pix, nil
 }
 
 // doesExist checks if the file exists and is accessible.
@@ -3,9 +3,9 @@ package softimdb
 import "github.com/gotk3/gotk3/gtk"
 
 type viewManager struct {
-	viewAllButton, viewPacksButton        *gtk.ToggleToolButton
-	viewToWatchButton, viewNoRatingButton *gtk.ToggleToolButton
-	viewNeedsSubtitlesButton              *gtk.ToggleToolButton
+	viewAllButton, viewPacksButton            *gtk.ToggleToolButton
+	viewToWatchButton, viewNoRatingButton     *gtk.ToggleToolButton
+	viewNeedsSubtitlesButton, viewTrashButton *gtk.ToggleToolButton
 }
 
 func newViewManager(m *MainWindow) viewManager {
@@ -16,6 +16,7 @@ func newViewManager(m *MainWindow) viewManager {
 	w.viewToWatchButton = m.builder.GetObject("viewToWatch").(*gtk.ToggleToolButton)
 	w.viewNoRatingButton = m.builder.GetObject("viewNoRating").(*gtk.ToggleToolButton)
 	w.viewNeedsSubtitlesButton = m.builder.GetObject("viewNeedsSubtitles").(*gtk.ToggleToolButton)
+	w.viewTrashButton = m.builder.GetObject("viewTrash").(*gtk.ToggleToolButton)
 
 	_ = w.viewAllButton.Connect("toggled", func() {
 		if w.viewAllButton.GetActive() {
@@ -24,6 +25,7 @@ func newViewManager(m *MainWindow) viewManager {
 			w.viewToWatchButton.SetActive(false)
 			w.viewNoRatingButton.SetActive(false)
 			w.viewNeedsSubtitlesButton.SetActive(false)
+			w.viewTrashButton.SetActive(false)
 			m.refresh(m.search, m.sort)
 		}
 	})
@@ -34,6 +36,7 @@ func newViewManager(m *MainWindow) viewManager {
 			w.viewToWatchButton.SetActive(false)
 			w.viewNoRatingButton.SetActive(false)
 			w.viewNeedsSubtitlesButton.SetActive(false)
+			w.viewTrashButton.SetActive(false)
 			m.refresh(m.search, m.sort)
 		}
 	})
@@ -44,6 +47,7 @@ func newViewManager(m *MainWindow) viewManager {
 			w.viewPacksButton.SetActive(false)
 			w.viewNoRatingButton.SetActive(false)
 			w.viewNeedsSubtitlesButton.SetActive(false)
+			w.viewTrashButton.SetActive(false)
 			m.refresh(m.search, m.sort)
 		}
 	})
@@ -54,6 +58,7 @@ func newViewManager(m *MainWindow) viewManager {
 			w.viewPacksButton.SetActive(false)
 			w.viewToWatchButton.SetActive(false)
 			w.viewNeedsSubtitlesButton.SetActive(false)
+			w.viewTrashButton.SetActive(false)
 			m.refresh(m.search, m.sort)
 		}
 	})
@@ -64,6 +69,18 @@ func newViewManager(m *MainWindow) viewManager {
 			w.viewPacksButton.SetActive(false)
 			w.viewToWatchButton.SetActive(false)
 			w.viewNoRatingButton.SetActive(false)
+			w.viewTrashButton.SetActive(false)
+			m.refresh(m.search, m.sort)
+		}
+	})
+	_ = w.viewTrashButton.Connect("toggled", func() {
+		if w.viewTrashButton.GetActive() {
+			m.view.current = viewTrash
+			w.viewAllButton.SetActive(false)
+			w.viewPacksButton.SetActive(false)
+			w.viewToWatchButton.SetActive(false)
+			w.viewNoRatingButton.SetActive(false)
+			w.viewNeedsSubtitlesButton.SetActive(false)
 			m.refresh(m.search, m.sort)
 		}
 	})
@@ -77,6 +94,7 @@ func (w viewManager) changeView(view ViewType) {
 	w.viewPacksButton.SetActive(false)
 	w.viewNoRatingButton.SetActive(false)
 	w.viewNeedsSubtitlesButton.SetActive(false)
+	w.viewTrashButton.SetActive(false)
 
 	switch view {
 	case viewAll:
@@ -89,5 +107,7 @@ func (w viewManager) changeView(view ViewType) {
 		w.viewNoRatingButton.SetActive(true)
 	case viewNeedsSubtitles:
 		w.viewNeedsSubtitlesButton.SetActive(true)
+	case viewTrash:
+		w.viewTrashButton.SetActive(true)
 	}
 }
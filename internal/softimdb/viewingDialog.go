@@ -0,0 +1,70 @@
+package softimdb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gotk3/gotk3/gtk"
+
+	"github.com/hultan/softimdb/internal/data"
+)
+
+// showViewingDialog asks the user for the date of a viewing and an optional note.
+// It returns nil if the user cancelled the dialog.
+func showViewingDialog(parent gtk.IWindow, movie *data.Movie) (*data.Viewing, error) {
+	dlg, err := gtk.DialogNewWithButtons(
+		"Mark watched on date...", parent, gtk.DIALOG_MODAL|gtk.DIALOG_DESTROY_WITH_PARENT,
+		[]interface{}{"Cancel", gtk.RESPONSE_CANCEL},
+		[]interface{}{"Ok", gtk.RESPONSE_OK},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create viewing dialog: %w", err)
+	}
+	defer dlg.Destroy()
+
+	content, err := dlg.GetContentArea()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get content area: %w", err)
+	}
+	content.SetSpacing(6)
+
+	label, err := gtk.LabelNew(fmt.Sprintf("When did you watch %s?", movie.Title))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create label: %w", err)
+	}
+	content.Add(label)
+
+	// The calendar shows today's date by default
+	calendar, err := gtk.CalendarNew()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create calendar: %w", err)
+	}
+	content.Add(calendar)
+
+	note, err := gtk.EntryNew()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create entry: %w", err)
+	}
+	note.SetPlaceholderText("Note (optional)")
+	content.Add(note)
+
+	dlg.ShowAll()
+	if dlg.Run() != gtk.RESPONSE_OK {
+		return nil, nil
+	}
+
+	year, month, day := calendar.GetDate()
+	text, err := note.GetText()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get note: %w", err)
+	}
+
+	// Month is zero based in GtkCalendar
+	viewing := &data.Viewing{
+		WatchedAt: time.Date(int(year), time.Month(month+1), int(day), 0, 0, 0, 0, time.Local),
+		Note:      text,
+		Rating:    movie.MyRating,
+	}
+
+	return viewing, nil
+}
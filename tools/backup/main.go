@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/hultan/softimdb/internal/config"
+	"github.com/hultan/softimdb/internal/data"
+)
+
+const configFile = "/home/per/.config/softteam/softimdb/config.json"
+
+// backup makes a backup of the database and the posters, verifies a backup,
+// or restores a backup into the configured database, which must be empty:
+//
+//	backup create <file>     write a backup
+//	backup verify <file>     verify the checksums of a backup
+//	backup restore <file>    restore a backup into an empty database
+func main() {
+	if len(os.Args) != 3 {
+		log.Fatal("usage: backup create|verify|restore <file>")
+	}
+	command, fileName := os.Args[1], os.Args[2]
+
+	if command == "verify" {
+		manifest, err := data.VerifyBackup(fileName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printManifest("Verified", fileName, manifest)
+		return
+	}
+
+	// Load config file
+	cnf, err := config.LoadConfig(configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Open database
+	database := data.DatabaseNew(false, cnf)
+	defer database.CloseDatabase()
+
+	var manifest *data.BackupManifest
+	var action string
+	switch command {
+	case "create":
+		manifest, err = database.Backup(context.Background(), fileName)
+		action = "Backed up"
+	case "restore":
+		manifest, err = database.Restore(context.Background(), fileName)
+		action = "Restored"
+	default:
+		log.Fatalf("unknown command %q", command)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	printManifest(action, fileName, manifest)
+}
+
+func printManifest(action, fileName string, manifest *data.BackupManifest) {
+	rows := 0
+	for _, table := range manifest.Tables {
+		rows += table.Rows
+	}
+	fmt.Printf("%s %s: %d rows in %d tables, %d images, schema version %d, made %s\n",
+		action, fileName, rows, len(manifest.Tables), manifest.Images, manifest.SchemaVersion,
+		manifest.CreatedAt.Local().Format("2006-01-02 15:04"))
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"strings"
 
@@ -19,8 +20,9 @@ func main() {
 
 	// Open database
 	database := data.DatabaseNew(false, cnf)
+	ctx := data.WithChangeSource(context.Background(), "fixData")
 
-	movies, err := database.SearchMovies("", "", -1, "id asc")
+	movies, err := database.SearchMovies(ctx, "", "", -1, "id asc")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -30,7 +32,7 @@ func main() {
 		if i >= 0 {
 			url := movie.ImdbUrl[:i+1]
 			movie.ImdbUrl = url
-			err = database.UpdateMovie(movie)
+			err = database.UpdateMovie(ctx, movie)
 			if err != nil {
 				log.Fatal(err)
 			}
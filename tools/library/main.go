@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/hultan/softimdb/internal/config"
+	"github.com/hultan/softimdb/internal/data"
+)
+
+const configFile = "/home/per/.config/softteam/softimdb/config.json"
+
+// library exports the library to a file, or imports an exported file. The
+// format is CSV if the file name ends with .csv, otherwise JSON:
+//
+//	library export [-posters] <file>    export the library
+//	library import [-dry-run] <file>    import a file, -dry-run only shows the changes
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("usage: library export [-posters] <file> | library import [-dry-run] <file>")
+	}
+
+	// Load config file
+	cnf, err := config.LoadConfig(configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Open database
+	database := data.DatabaseNew(false, cnf)
+	defer database.CloseDatabase()
+	ctx := data.WithChangeSource(context.Background(), "library")
+
+	switch os.Args[1] {
+	case "export":
+		flags := flag.NewFlagSet("export", flag.ExitOnError)
+		posters := flags.Bool("posters", false, "include the posters, JSON only")
+		_ = flags.Parse(os.Args[2:])
+		if flags.NArg() != 1 {
+			log.Fatal("usage: library export [-posters] <file>")
+		}
+		if err := exportLibrary(ctx, database, flags.Arg(0), *posters); err != nil {
+			log.Fatal(err)
+		}
+	case "import":
+		flags := flag.NewFlagSet("import", flag.ExitOnError)
+		dryRun := flags.Bool("dry-run", false, "show the changes without making them")
+		_ = flags.Parse(os.Args[2:])
+		if flags.NArg() != 1 {
+			log.Fatal("usage: library import [-dry-run] <file>")
+		}
+		if err := importLibrary(ctx, database, flags.Arg(0), *dryRun); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown command %q", os.Args[1])
+	}
+}
+
+func exportLibrary(ctx context.Context, database *data.Database, fileName string, posters bool) error {
+	export, err := data.ExportLibrary(ctx, database, posters && !isCSV(fileName))
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", fileName, err)
+	}
+	if isCSV(fileName) {
+		err = export.WriteCSV(file)
+	} else {
+		err = export.WriteJSON(file)
+	}
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported %d movie(s) to %s\n", len(export.Movies), fileName)
+	return nil
+}
+
+func importLibrary(ctx context.Context, database *data.Database, fileName string, dryRun bool) error {
+	// Create the tables, so that a new database can be seeded from an export
+	if err := database.Migrate(ctx); err != nil {
+		return err
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", fileName, err)
+	}
+	defer file.Close()
+
+	var export *data.Export
+	if isCSV(fileName) {
+		export, err = data.ReadExportCSV(file)
+	} else {
+		export, err = data.ReadExportJSON(file)
+	}
+	if err != nil {
+		return err
+	}
+
+	report, err := data.ImportLibrary(ctx, database, export, dryRun)
+	if report != nil {
+		fmt.Print(report)
+	}
+	return err
+}
+
+func isCSV(fileName string) bool {
+	return strings.EqualFold(path.Ext(fileName), ".csv")
+}
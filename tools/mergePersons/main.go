@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hultan/softimdb/internal/config"
+	"github.com/hultan/softimdb/internal/data"
+)
+
+const configFile = "/home/per/.config/softteam/softimdb/config.json"
+
+// mergePersons lists persons that share a name, or merges persons into a survivor:
+//
+//	mergePersons                        list duplicate persons
+//	mergePersons <survivor> <id>...     move the credits of the ids to the survivor, and remove the ids
+func main() {
+	// Load config file
+	cnf, err := config.LoadConfig(configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Open database
+	database := data.DatabaseNew(false, cnf)
+	defer database.CloseDatabase()
+	ctx := data.WithChangeSource(context.Background(), "mergePersons")
+
+	if len(os.Args) < 2 {
+		listDuplicates(database)
+		return
+	}
+	if len(os.Args) < 3 {
+		log.Fatal("usage: mergePersons <survivor id> <duplicate id>...")
+	}
+
+	ids := make([]int, 0, len(os.Args)-1)
+	for _, arg := range os.Args[1:] {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			log.Fatalf("invalid person id %q", arg)
+		}
+		ids = append(ids, id)
+	}
+
+	persons := make([]*data.Person, 0, len(ids))
+	for _, id := range ids {
+		person, err := database.GetPersonById(ctx, id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if person == nil {
+			log.Fatalf("person %d does not exist", id)
+		}
+		persons = append(persons, person)
+	}
+
+	if err := database.MergePersons(ctx, persons[0], persons[1:]); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Merged %d person(s) into %s\n", len(persons)-1, formatPerson(*persons[0]))
+}
+
+func listDuplicates(database *data.Database) {
+	duplicates, err := database.GetDuplicatePersons(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, group := range duplicates {
+		var persons []string
+		for _, person := range group {
+			persons = append(persons, formatPerson(person))
+		}
+		fmt.Println(strings.Join(persons, ", "))
+	}
+}
+
+func formatPerson(person data.Person) string {
+	if person.ImdbId == "" {
+		return fmt.Sprintf("%d: %s", person.Id, person.Name)
+	}
+	return fmt.Sprintf("%d: %s (%s)", person.Id, person.Name, person.ImdbId)
+}
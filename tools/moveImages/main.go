@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/hultan/softimdb/internal/config"
+	"github.com/hultan/softimdb/internal/data"
+)
+
+const configFile = "/home/per/.config/softteam/softimdb/config.json"
+
+// moveImages moves the posters that are stored in the database to the imageDir
+// folder of the config file. Every file is verified before the poster is
+// removed from the database, so the tool can be stopped and run again.
+func main() {
+	// Load config file
+	cnf, err := config.LoadConfig(configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cnf.ImageDir == "" {
+		log.Fatal("set imageDir in the config file to the folder where the posters should be stored")
+	}
+
+	// Open database
+	database := data.DatabaseNew(false, cnf)
+	defer database.CloseDatabase()
+
+	// Stop after the current poster on Ctrl+C, the rest are moved the next time
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	moved, err := database.MoveImagesToFiles(ctx, func(done, total int) {
+		fmt.Printf("\rMoved %d of %d posters", done, total)
+	})
+	fmt.Println()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Moved %d poster(s) to %s\n", moved, cnf.ImageDir)
+}